@@ -0,0 +1,95 @@
+package conveyor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AccessPolicy restricts which repositories, and which branches of them, can
+// be built. The zero value allows everything.
+type AccessPolicy struct {
+	// The organizations (or users) whose repositories can be built, e.g.
+	// `remind101`.
+	Organizations []string
+
+	// Repositories that can be built, in addition to those of
+	// Organizations. These are patterns, as in path.Match, so
+	// `remind101/acme-*` is allowed. When both Organizations and
+	// Repositories are empty, any repository can be built.
+	Repositories []string
+
+	// When set, builds are only allowed for branches that match one of
+	// these patterns, e.g. `master` or `release/*`. Builds that don't have
+	// a branch, like builds of a tag, are denied.
+	Branches []string
+}
+
+// AccessDeniedError is returned when a build isn't allowed by the access
+// policy.
+type AccessDeniedError struct {
+	Repository string
+	Branch     string
+	Reason     string
+}
+
+// Error implements the error interface.
+func (e *AccessDeniedError) Error() string {
+	if e.Branch != "" {
+		return fmt.Sprintf("access denied to %s (branch %s): %s", e.Repository, e.Branch, e.Reason)
+	}
+	return fmt.Sprintf("access denied to %s: %s", e.Repository, e.Reason)
+}
+
+// checkRepository returns an AccessDeniedError if the repository can't be
+// built.
+func (p AccessPolicy) checkRepository(repository string) error {
+	if len(p.Organizations) == 0 && len(p.Repositories) == 0 {
+		return nil
+	}
+
+	owner := strings.SplitN(repository, "/", 2)[0]
+	for _, o := range p.Organizations {
+		if strings.EqualFold(o, owner) {
+			return nil
+		}
+	}
+
+	for _, pattern := range p.Repositories {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(repository)); ok {
+			return nil
+		}
+	}
+
+	return &AccessDeniedError{
+		Repository: repository,
+		Reason:     "repository is not in the allowed organizations or repositories",
+	}
+}
+
+// checkBranch returns an AccessDeniedError if the branch of the repository
+// can't be built.
+func (p AccessPolicy) checkBranch(repository, branch string) error {
+	if len(p.Branches) == 0 {
+		return nil
+	}
+
+	if branch == "" {
+		return &AccessDeniedError{
+			Repository: repository,
+			Reason:     "only branches can be built",
+		}
+	}
+
+	for _, pattern := range p.Branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return nil
+		}
+	}
+
+	return &AccessDeniedError{
+		Repository: repository,
+		Branch:     branch,
+		Reason:     "branch does not match the allowed branches",
+	}
+}
@@ -0,0 +1,41 @@
+package conveyor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	tests := []struct {
+		policy     AccessPolicy
+		repository string
+		branch     string
+		err        string
+	}{
+		{AccessPolicy{}, "remind101/acme-inc", "", ""},
+		{AccessPolicy{Organizations: []string{"remind101"}}, "remind101/acme-inc", "master", ""},
+		{AccessPolicy{Organizations: []string{"remind101"}}, "Remind101/acme-inc", "master", ""},
+		{AccessPolicy{Organizations: []string{"remind101"}}, "ejholmes/acme-inc", "master", "access denied to ejholmes/acme-inc: repository is not in the allowed organizations or repositories"},
+		{AccessPolicy{Repositories: []string{"remind101/acme-*"}}, "remind101/acme-inc", "master", ""},
+		{AccessPolicy{Repositories: []string{"remind101/acme-*"}}, "remind101/empire", "master", "access denied to remind101/empire: repository is not in the allowed organizations or repositories"},
+		{AccessPolicy{Organizations: []string{"ejholmes"}, Repositories: []string{"remind101/empire"}}, "remind101/empire", "master", ""},
+		{AccessPolicy{Branches: []string{"master", "release/*"}}, "remind101/acme-inc", "master", ""},
+		{AccessPolicy{Branches: []string{"master", "release/*"}}, "remind101/acme-inc", "release/1.0", ""},
+		{AccessPolicy{Branches: []string{"master", "release/*"}}, "remind101/acme-inc", "feature", "access denied to remind101/acme-inc (branch feature): branch does not match the allowed branches"},
+		{AccessPolicy{Branches: []string{"master"}}, "remind101/acme-inc", "", "access denied to remind101/acme-inc: only branches can be built"},
+	}
+
+	for _, tt := range tests {
+		err := tt.policy.checkRepository(tt.repository)
+		if err == nil {
+			err = tt.policy.checkBranch(tt.repository, tt.branch)
+		}
+
+		if tt.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tt.err)
+		}
+	}
+}
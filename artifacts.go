@@ -1,6 +1,7 @@
 package conveyor
 
 import (
+	"database/sql/driver"
 	"strings"
 
 	"github.com/jmoiron/sqlx"
@@ -14,19 +15,48 @@ type Artifact struct {
 	Seq int64 `db:"seq"`
 	// The build that this artifact was a result of.
 	BuildID string `db:"build_id"`
-	// The name of the image that was produced.
+	// The name of the image, for builds that produce more than one image.
+	// This is empty for the primary image.
+	Name string `db:"name"`
+	// The name of the image that was produced. When the digest of the
+	// image is known, this is an immutable reference to it, e.g.
+	// `remind101/acme-inc@sha256:...`.
 	Image string `db:"image"`
+	// The digest of the image that was pushed.
+	Digest string `db:"digest"`
+	// The tags that were pushed for the image.
+	Tags Tags `db:"tags"`
 	// The repository that this artifact relates to.
 	Repository string `db:"repository"`
 	// The sha that this artifact relates to.
 	Sha string `db:"sha"`
 }
 
+// Tags is a list of image tags, which is stored as a comma separated string.
+type Tags []string
+
+// Scan implements the sql.Scanner interface.
+func (t *Tags) Scan(src interface{}) error {
+	if v, ok := src.([]byte); ok {
+		*t = nil
+		if len(v) > 0 {
+			*t = strings.Split(string(v), ",")
+		}
+	}
+
+	return nil
+}
+
+// Value implements the driver.Value interface.
+func (t Tags) Value() (driver.Value, error) {
+	return driver.Value(strings.Join(t, ",")), nil
+}
+
 // artifactsCreate creates a new artifact linked to the build.
 func artifactsCreate(tx *sqlx.Tx, a *Artifact) error {
-	const createArtifactSql = `INSERT INTO artifacts (build_id, image, repository, sha)
+	const createArtifactSql = `INSERT INTO artifacts (build_id, name, image, digest, tags, repository, sha)
 (
-	SELECT :build_id, :image, repository, sha
+	SELECT :build_id, :name, :image, :digest, :tags, repository, sha
 	FROM builds
 	WHERE id = :build_id
 )
@@ -42,15 +72,35 @@ func artifactsFindByID(tx *sqlx.Tx, artifactID string) (*Artifact, error) {
 	return &a, err
 }
 
-// artifactsFindByRepoSha finds an artifact by image.
+// artifactsFindByRepoSha finds an artifact by repository and sha or tag, with an
+// optional name, e.g. `remind101/acme-inc@<sha>/migrations` or
+// `remind101/acme-inc@v1.4.2`.
 func artifactsFindByRepoSha(tx *sqlx.Tx, repoSha string) (*Artifact, error) {
-	parts := strings.Split(repoSha, "@")
-	var sql = `SELECT * FROM artifacts
-WHERE repository = ?
-AND sha = ?
-ORDER BY seq desc
+	repository, ref, name := splitArtifactRef(repoSha)
+	var sql = `SELECT artifacts.* FROM artifacts
+JOIN builds ON builds.id = artifacts.build_id
+WHERE artifacts.repository = ?
+AND (artifacts.sha = ? OR builds.tag = ?)
+AND artifacts.name = ?
+ORDER BY artifacts.seq desc
 LIMIT 1`
 	var a Artifact
-	err := tx.Get(&a, tx.Rebind(sql), parts[0], parts[1])
+	err := tx.Get(&a, tx.Rebind(sql), repository, ref, ref, name)
 	return &a, err
 }
+
+// splitArtifactRef splits a reference to an artifact, e.g.
+// `remind101/acme-inc@<sha>/migrations`, into the repository, the sha or tag,
+// and the name of the artifact. Names of artifacts never contain a `/` (see
+// builder.PushObserver).
+func splitArtifactRef(repoSha string) (repository, ref, name string) {
+	parts := strings.SplitN(repoSha, "@", 2)
+	repository = parts[0]
+	if len(parts) == 2 {
+		ref = parts[1]
+	}
+	if i := strings.Index(ref, "/"); i >= 0 {
+		ref, name = ref[:i], ref[i+1:]
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package conveyor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/remind101/conveyor/builder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArtifactRef(t *testing.T) {
+	tests := []struct {
+		in                    string
+		repository, ref, name string
+	}{
+		{"remind101/acme-inc@139759b", "remind101/acme-inc", "139759b", ""},
+		{"remind101/acme-inc@v1.4.2", "remind101/acme-inc", "v1.4.2", ""},
+		{"remind101/acme-inc@139759b/migrations", "remind101/acme-inc", "139759b", "migrations"},
+		{"remind101/acme-inc@139759b/remind101.other", "remind101/acme-inc", "139759b", "remind101.other"},
+	}
+
+	for _, tt := range tests {
+		repository, ref, name := splitArtifactRef(tt.in)
+		assert.Equal(t, tt.repository, repository, tt.in)
+		assert.Equal(t, tt.ref, ref, tt.in)
+		assert.Equal(t, tt.name, name, tt.in)
+	}
+}
+
+// The names of the images that a build pushes can be used to look up the
+// artifacts again.
+func TestSplitArtifactRef_ImageNames(t *testing.T) {
+	o := builder.ObservePushes(new(bytes.Buffer), "remind101/acme-inc")
+	io.WriteString(o, `The push refers to a repository [docker.io/remind101/acme-inc-migrations]
+latest: digest: sha256:1111111111111111111111111111111111111111111111111111111111111111 size: 1234
+The push refers to a repository [docker.io/remind101/other]
+latest: digest: sha256:2222222222222222222222222222222222222222222222222222222222222222 size: 1234
+The push refers to a repository [quay.io/remind101/acme-inc-tools/lint]
+latest: digest: sha256:3333333333333333333333333333333333333333333333333333333333333333 size: 1234
+`)
+
+	images := o.Images()
+	assert.Equal(t, 3, len(images))
+	for _, i := range images {
+		ref := fmt.Sprintf("remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164/%s", i.Name)
+		repository, sha, name := splitArtifactRef(ref)
+		assert.Equal(t, "remind101/acme-inc", repository)
+		assert.Equal(t, "139759bd61e98faeec619c45b1060b4288952164", sha)
+		assert.Equal(t, i.Name, name)
+	}
+}
@@ -1,6 +1,23 @@
 // Code generated by go-bindata.
 // sources:
 // db/migrations/1_initial_schema.sql
+// db/migrations/2_build_steps.sql
+// db/migrations/3_logs_truncated.sql
+// db/migrations/4_log_encoding.sql
+// db/migrations/5_logs_deleted.sql
+// db/migrations/6_artifact_digests.sql
+// db/migrations/7_artifact_names.sql
+// db/migrations/8_build_directives.sql
+// db/migrations/9_build_tags.sql
+// db/migrations/10_pull_requests.sql
+// db/migrations/11_status_updates.sql
+// db/migrations/12_installations.sql
+// db/migrations/13_deliveries.sql
+// db/migrations/14_repositories.sql
+// db/migrations/15_artifact_name_slashes.sql
+// db/migrations/16_deliveries_delivery_id.sql
+// db/migrations/17_status_updates_lease.sql
+// db/migrations/18_build_timeouts.sql
 // DO NOT EDIT!
 
 package conveyor
@@ -88,6 +105,346 @@ func dbMigrations1_initial_schemaSql() (*asset, error) {
 	return a, nil
 }
 
+var _dbMigrations2_build_stepsSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6d\x91\xc1\x6e\x83\x30\x0c\x86\xef\x3c\x85\x8f\xa0\x8d\xdb\x6e\x3d\x31\xc8\xa6\x4a\x08\xa6\x16\xa4\xdd\xa2\x40\x5c\x1a\xad\x24\x28\x71\xd6\x76\x4f\xbf\xb0\xaa\x55\x51\x77\x49\x14\xff\xf6\x17\xfb\x77\x9a\xc2\xd3\xa8\x06\x2b\x08\xa1\x9d\xa2\x7c\xc3\xb2\x86\x41\x93\xbd\x96\x0c\x3a\xaf\x0e\x92\x3b\xc2\xc9\x41\x1c\x01\x28\x09\xde\x87\xa3\xaa\x1b\xa8\xda\xb2\x84\x82\xbd\x65\x6d\xd9\xfc\x45\xf9\x80\x1a\x67\x0c\xff\x7e\x89\x13\x98\xac\x1a\x85\x3d\xc3\x17\x9e\x9f\x43\xe9\x05\xf5\x00\xb0\xb8\x43\x8b\xba\x47\x77\xc9\x70\xb1\x92\x09\xd4\x55\x20\x97\x2c\xf4\x91\x67\xdb\x3c\x2b\xd8\x4c\xd0\x7e\xec\xd0\x82\xd2\x84\x43\xb8\xaf\x88\x59\x22\x43\xe2\xf0\xaf\xa2\xb4\x23\xeb\x7b\x52\x46\x03\xe1\x89\x16\x62\x2f\xfa\x3d\x4a\xe8\x8c\x39\xa0\xd0\x0b\xc9\x91\xb0\x84\x92\x0b\x02\x52\x23\x86\xe7\x38\xc1\x51\xd1\xde\xf8\x4b\x04\x7e\x8c\xc6\x45\x89\xf4\x61\xf8\xf9\x9f\x4e\x0d\xa1\x95\x9b\x16\x25\xab\xe8\x6a\xeb\xba\x2a\xd8\x67\x68\x4a\xe2\x89\xdf\x99\xcb\x8d\xe6\x37\x83\xc2\xf0\xf7\xbe\xb7\xdb\x75\xf5\x0e\x1d\x59\x44\x88\xaf\x49\x33\x32\xbd\x5b\x5c\x61\x8e\x3a\x2a\x36\xf5\xc7\xe3\xe2\x56\xd1\x2f\x44\x62\xf8\x75\xe2\x01\x00\x00")
+
+func dbMigrations2_build_stepsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations2_build_stepsSql,
+		"db/migrations/2_build_steps.sql",
+	)
+}
+
+func dbMigrations2_build_stepsSql() (*asset, error) {
+	bytes, err := dbMigrations2_build_stepsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/2_build_steps.sql", size: 482, mode: os.FileMode(420), modTime: time.Unix(1792361462, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations3_logs_truncatedSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6d\xcc\xb1\x0e\x83\x20\x14\x05\xd0\x9d\xaf\xb8\x7b\xc3\x17\x38\x51\x1f\x4e\xaf\x60\x0c\xcc\x0d\x2a\x35\x26\x14\x8c\x68\xfa\xfb\xed\xd8\xc1\xfd\xe4\x48\x89\xdb\x7b\x5d\xf6\x70\x44\xf8\x4d\x28\x76\x7a\x80\x53\x77\xd6\x18\xcf\x35\xcd\x15\x8a\x08\xad\x65\xff\x30\x48\x65\xa9\xcf\x63\x3f\xf3\xf4\xe3\x33\xc6\x52\x52\x0c\x19\xc6\x3a\x18\xcf\x0c\xd2\x9d\xf2\xec\xf0\x0a\xa9\xc6\x46\x08\xf9\x97\x53\xf9\xe4\xab\x9e\x06\xdb\x5f\xff\x8d\xf8\x02\x63\xa6\x36\x73\x9d\x00\x00\x00")
+
+func dbMigrations3_logs_truncatedSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations3_logs_truncatedSql,
+		"db/migrations/3_logs_truncated.sql",
+	)
+}
+
+func dbMigrations3_logs_truncatedSql() (*asset, error) {
+	bytes, err := dbMigrations3_logs_truncatedSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/3_logs_truncated.sql", size: 157, mode: os.FileMode(420), modTime: time.Unix(1792361811, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations4_log_encodingSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd3\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x08\x2d\xe0\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x2a\xcd\xcc\x49\x29\x56\x70\x74\x71\x51\x70\xf6\xf7\x09\xf5\xf5\x53\xc8\xc9\x4f\x8f\x4f\xcd\x4b\xce\x4f\xc9\xcc\x4b\x57\x28\x49\xad\x28\x51\xf0\xf3\x0f\x51\xf0\x0b\xf5\xf1\x51\x70\x71\x75\x73\x0c\xf5\x09\x51\x50\x57\xb7\xe6\xe2\xd2\x45\x32\xd4\x25\xbf\x3c\x0f\x9b\xb1\x2e\x41\xfe\x01\xd8\xcc\xb5\xe6\x02\x00\xd9\x90\x29\x66\x93\x00\x00\x00")
+
+func dbMigrations4_log_encodingSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations4_log_encodingSql,
+		"db/migrations/4_log_encoding.sql",
+	)
+}
+
+func dbMigrations4_log_encodingSql() (*asset, error) {
+	bytes, err := dbMigrations4_log_encodingSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/4_log_encoding.sql", size: 147, mode: os.FileMode(420), modTime: time.Unix(1792361982, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations5_logs_deletedSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6d\xcc\x41\x0e\xc2\x20\x10\x05\xd0\x3d\xa7\xf8\x7b\xc3\x09\xba\x42\x07\x57\x23\x98\x06\xd6\x86\x86\xb1\x69\x32\x96\x46\x6a\xbc\xbe\x5b\x17\x7d\x07\x78\xd6\xe2\xf4\x5a\xe6\x77\xd9\x05\x79\x33\x8e\x93\x1f\x91\xdc\x99\x3d\xa6\xcf\xa2\xb5\xc3\x11\xe1\x12\x39\xdf\x02\xb4\xcd\xfd\x51\x45\x65\x97\x8a\xa9\x35\x95\xb2\x22\xc4\x84\x90\x99\x41\xfe\xea\x32\x27\x3c\x8b\x76\x19\x8c\xb1\x7f\x35\xb5\xef\x7a\x94\xd3\x18\xef\x47\xfb\x60\x7e\xd9\x55\x48\x3a\x99\x00\x00\x00")
+
+func dbMigrations5_logs_deletedSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations5_logs_deletedSql,
+		"db/migrations/5_logs_deleted.sql",
+	)
+}
+
+func dbMigrations5_logs_deletedSql() (*asset, error) {
+	bytes, err := dbMigrations5_logs_deletedSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/5_logs_deleted.sql", size: 153, mode: os.FileMode(420), modTime: time.Unix(1792362089, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations6_artifact_digestsSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd3\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x08\x2d\xe0\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x2c\x2a\xc9\x4c\x4b\x4c\x2e\x29\x56\x70\x74\x71\x51\x70\xf6\xf7\x09\xf5\xf5\x53\x48\xc9\x4c\x4f\x2d\x2e\x51\x28\x49\xad\x28\x51\xf0\xf3\x0f\x51\xf0\x0b\xf5\xf1\x51\x70\x71\x75\x73\x0c\xf5\x09\x51\x50\x57\xb7\x26\x6c\x42\x49\x62\x7a\x31\x1e\xfd\x5c\xba\x48\x2e\x72\xc9\x2f\xcf\xc3\x61\xa2\x4b\x90\x7f\x00\xb2\x91\xd6\x44\xa8\x83\x38\xde\x9a\x0b\x00\xd2\x22\xfc\x46\xf5\x00\x00\x00")
+
+func dbMigrations6_artifact_digestsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations6_artifact_digestsSql,
+		"db/migrations/6_artifact_digests.sql",
+	)
+}
+
+func dbMigrations6_artifact_digestsSql() (*asset, error) {
+	bytes, err := dbMigrations6_artifact_digestsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/6_artifact_digests.sql", size: 245, mode: os.FileMode(420), modTime: time.Unix(1792362272, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations7_artifact_namesSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x75\xcc\xbd\x0d\x80\x20\x10\x06\xd0\x9e\x29\xbe\xce\xc2\x30\x81\x15\x7a\x58\x9d\x60\x0c\x0c\x40\x0c\x1a\x0b\x7f\xa2\x97\xe8\xf8\xb6\x36\xbe\x01\x9e\xd6\x28\xd7\x65\x3e\x93\x64\xc4\x43\x19\x0e\x76\x40\x30\x35\x5b\xa4\x53\x96\x29\x8d\x72\xc1\x10\xa1\xf1\x1c\x3b\x87\x2d\xad\x19\x92\x1f\x81\xf3\x01\x2e\x32\x83\x6c\x6b\x22\x07\x14\x45\xa5\x94\xfe\x7c\xb4\xdf\xdb\xcf\x48\x83\xef\xbf\x65\xa5\x5e\xbe\x2a\x2d\xa1\x89\x00\x00\x00")
+
+func dbMigrations7_artifact_namesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations7_artifact_namesSql,
+		"db/migrations/7_artifact_names.sql",
+	)
+}
+
+func dbMigrations7_artifact_namesSql() (*asset, error) {
+	bytes, err := dbMigrations7_artifact_namesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/7_artifact_names.sql", size: 137, mode: os.FileMode(420), modTime: time.Unix(1792362418, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations8_build_directivesSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd3\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x08\x2d\xe0\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x2a\xcd\xcc\x49\x29\x56\x70\x74\x71\x51\x70\xf6\xf7\x09\xf5\xf5\x53\x48\xc9\x2c\x4a\x4d\x2e\xc9\x2c\x4b\x2d\x56\x28\x49\xad\x28\x51\xf0\xf3\x0f\x51\xf0\x0b\xf5\xf1\x51\x70\x71\x75\x73\x0c\xf5\x09\x51\x50\x57\xb7\xe6\xe2\xd2\x45\x32\xd2\x25\xbf\x3c\x0f\x9b\xa1\x2e\x41\xfe\x01\x98\xa6\x5a\x73\x01\x00\x4f\xb9\x0d\xe9\x8f\x00\x00\x00")
+
+func dbMigrations8_build_directivesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations8_build_directivesSql,
+		"db/migrations/8_build_directives.sql",
+	)
+}
+
+func dbMigrations8_build_directivesSql() (*asset, error) {
+	bytes, err := dbMigrations8_build_directivesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/8_build_directives.sql", size: 143, mode: os.FileMode(420), modTime: time.Unix(1792362852, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations9_build_tagsSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd3\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x08\x2d\xe0\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x2a\xcd\xcc\x49\x29\x56\x70\x74\x71\x51\x70\xf6\xf7\x09\xf5\xf5\x53\x28\x49\x4c\x57\x28\x49\xad\x28\x51\xf0\xf3\x0f\x51\xf0\x0b\xf5\xf1\x51\x70\x71\x75\x73\x0c\xf5\x09\x51\x50\x57\xb7\xe6\xe2\xd2\x45\x32\xcb\x25\xbf\x3c\x0f\x9b\x69\x2e\x41\xfe\x01\x48\xc6\x59\x73\x01\x00\xdd\x8b\xcd\x3b\x81\x00\x00\x00")
+
+func dbMigrations9_build_tagsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations9_build_tagsSql,
+		"db/migrations/9_build_tags.sql",
+	)
+}
+
+func dbMigrations9_build_tagsSql() (*asset, error) {
+	bytes, err := dbMigrations9_build_tagsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/9_build_tags.sql", size: 557, mode: os.FileMode(420), modTime: time.Unix(1792363003, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations10_pull_requestsSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x75\x8f\x41\x0a\xc2\x30\x14\x44\xf7\x39\xc5\x5f\x2a\xda\x13\x64\x15\x9b\x8f\x16\x62\x22\x69\x82\xee\x8a\xc5\x4f\x09\xd4\xb6\xa6\x29\xe2\xed\x05\x51\xb0\xa0\xfb\x99\x37\x6f\xb2\x0c\x56\xd7\xd0\xc4\x73\x22\xf0\x03\x13\xca\xa1\x05\x27\x36\x0a\xa1\x9e\x42\x7b\x19\x41\x48\x09\xb9\x51\x7e\xaf\x61\x98\xda\xb6\x8a\x74\x9b\x68\x4c\x10\xba\x44\x0d\x45\xce\x72\x8b\xc2\x21\x14\x5a\xe2\xe9\x5d\xaa\x66\x49\xa3\x3f\x2c\x5f\x16\x7a\x0b\x75\x8a\x44\xb0\x88\x34\xf4\x63\x48\x7d\x7c\xac\x67\xe4\x25\x1c\x77\x68\x71\xbe\x56\x94\xa0\x8d\x03\xed\x95\xe2\x8c\x65\x5f\xd6\xb2\xbf\x77\x4c\x5a\x73\xf8\x6f\xc0\x7f\xfd\x7a\x55\x7e\x1c\xe3\xec\x09\x43\xf0\x1b\x6c\x14\x01\x00\x00")
+
+func dbMigrations10_pull_requestsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations10_pull_requestsSql,
+		"db/migrations/10_pull_requests.sql",
+	)
+}
+
+func dbMigrations10_pull_requestsSql() (*asset, error) {
+	bytes, err := dbMigrations10_pull_requestsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/10_pull_requests.sql", size: 276, mode: os.FileMode(420), modTime: time.Unix(1792363144, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations11_status_updatesSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xad\x53\x4d\x8f\x9b\x30\x10\xbd\xf3\x2b\xe6\x16\x50\x93\x6a\x0f\x7b\x8b\x7a\xa0\xc1\x6d\x23\xb1\xa4\x22\xa0\xf6\x86\x1c\x3c\x21\x56\xc0\xf6\x1a\xd3\x34\xfd\xf5\x1d\x93\x6c\xb6\xbb\x49\xb5\x97\xbd\x60\x31\x1f\x6f\xde\xcc\xbc\x99\xcd\xe0\x43\x27\x1b\xcb\x1d\x42\x69\x82\x38\x2d\x58\x0e\x45\xfc\x39\x65\xb0\x19\x64\x2b\x7a\x88\x93\x04\x16\xab\xb4\x7c\xc8\xa0\xde\x61\xbd\xaf\xec\xa0\x2a\x29\x60\x23\x1b\xa9\xdc\x3c\x08\x16\x39\x8b\x0b\x76\x4e\xea\x1d\x77\x43\x5f\x0d\x46\x10\x62\x0f\x61\x00\x40\xb1\xc3\x40\x9f\x6c\x55\x40\x56\xa6\x29\x24\xec\x4b\x5c\xa6\xc5\x68\xad\x1a\x54\xe8\xab\x57\xbf\xee\xc3\x08\x8c\x95\x1d\xb7\x47\xd8\xe3\x71\x4a\xa9\x3d\x3e\xc2\x9a\xe5\xcb\x38\xf5\x7f\x23\xa1\xea\x09\xce\xe2\x16\x2d\xaa\x9a\xaa\x9c\x98\x86\x52\x44\xb0\xca\x08\x3e\x65\xc4\x67\x11\xaf\x17\x71\xc2\x7c\xa2\x45\xa3\x7b\xe9\x34\x01\x3b\xfc\xed\x2e\x4c\xc6\x12\x3b\x7e\x6d\xdc\x4b\x25\xae\xad\x86\x1f\x5b\xcd\x6f\x38\x7c\xd3\xf8\xd2\x7c\x69\x72\x62\x50\x09\xa9\x9a\x89\x0f\xe4\xce\x61\x67\x5c\x0f\x34\x39\x6c\xd0\x5e\x87\xdf\xf9\xb0\x96\xf7\xae\x42\x6b\xb5\xfd\x1f\xe8\x88\xa6\xc8\x57\x9d\x21\xe9\x05\x27\x3b\x24\x2a\x9d\x81\x83\x74\x3b\x3d\x9c\x2c\xf0\x47\x2b\x04\x81\x5b\x3e\xb4\x0e\x42\xa5\x0f\x34\x67\xfe\xaf\x6f\x32\xb8\x7a\x12\xbd\xe8\xa8\xb6\x48\x2d\x89\xf7\x46\xd5\x9d\x69\xf1\x6d\xdc\x20\x22\x59\xcd\x66\x24\xc8\x93\x8a\xb8\x45\xe0\xc6\xb4\x12\x05\x4d\x0e\xb4\x15\x34\xba\x2d\x4d\x07\x79\xbd\xf3\xa8\x9d\x74\x1f\x9f\x74\xb8\xcc\x12\xf6\xf3\x95\x0e\xab\xf3\x12\xbc\x3c\x5e\x29\xb4\x5c\x2f\xb3\xaf\xb0\x71\x16\x11\xc2\x67\xa1\x4c\xbd\x30\xa6\x5e\x80\x11\xfc\xf8\xc6\x72\x76\x5e\xf2\xa7\xe7\x85\x9e\x38\x5e\xae\x27\xd1\x07\x15\x24\xf9\xea\xfb\xcd\x4b\x98\xdf\x3a\xad\x31\xfa\xc6\x6d\xcd\x83\xbf\xc1\xea\x89\x78\x97\x03\x00\x00")
+
+func dbMigrations11_status_updatesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations11_status_updatesSql,
+		"db/migrations/11_status_updates.sql",
+	)
+}
+
+func dbMigrations11_status_updatesSql() (*asset, error) {
+	bytes, err := dbMigrations11_status_updatesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/11_status_updates.sql", size: 919, mode: os.FileMode(420), modTime: time.Unix(1792364148, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations12_installationsSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x9d\x8f\xb1\x0a\xc2\x30\x18\x84\xf7\x3e\xc5\xed\x12\x70\xef\x14\x4d\x9c\x7e\x13\x29\xc9\x5c\x5a\x22\xe5\x87\x98\x96\x26\xc1\xd7\xb7\xa3\x82\x76\x70\xbf\xfb\xbe\x3b\x21\x70\x78\xf0\xb4\x0e\xe5\x0e\xbf\x34\x92\x9c\xee\xe0\xe4\x89\x34\xc6\xca\x31\x64\x48\xa5\x70\xb6\xe4\xaf\x06\x9c\x72\x19\x62\x1c\x0a\xcf\xa9\xe7\x80\x91\x27\x4e\x05\xc6\x3a\x18\x4f\x04\xa5\x2f\xd2\x93\xc3\xb1\xfd\x00\x6d\xa5\x52\x73\x5f\x97\xb0\x59\xfe\x05\x36\xe2\x6d\xa9\x9a\x9f\x69\x4f\xa1\x3a\x7b\xfb\xe1\x68\xbf\x7d\xdc\xcd\xbf\x00\xa5\x57\x6f\x59\x23\x01\x00\x00")
+
+func dbMigrations12_installationsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations12_installationsSql,
+		"db/migrations/12_installations.sql",
+	)
+}
+
+func dbMigrations12_installationsSql() (*asset, error) {
+	bytes, err := dbMigrations12_installationsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/12_installations.sql", size: 291, mode: os.FileMode(420), modTime: time.Unix(1792364490, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations13_deliveriesSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x7d\x52\xcb\x4e\xc3\x30\x10\xbc\xe7\x2b\xf6\x96\x44\x90\x1b\xb7\x9e\x02\x31\xa8\x52\x94\xa2\x36\x91\xb8\x59\x6e\xbd\x6d\x2d\x12\x3b\xf8\xd1\x12\x10\xff\x8e\x53\x28\x4d\x1b\xd1\x8b\x25\xef\xce\xcc\xbe\x26\x49\xe0\xa6\x11\x1b\xcd\x2c\x42\xd5\x06\x0f\x73\x92\x96\x04\xca\xf4\x3e\x27\xc0\xb1\x16\x3b\xd4\x02\x0d\x44\x01\x80\xe0\xe0\x9c\x7f\x8a\x59\x09\x45\x95\xe7\x90\x91\xc7\xb4\xca\xcb\x43\x94\x6e\x50\x62\xaf\x42\x77\x77\x51\x0c\xad\x16\x0d\xd3\x1d\xbc\x62\x77\xeb\xa9\x06\xdf\x60\x41\xe6\xd3\x34\xef\x7f\xbf\xba\x1d\xf5\x62\x16\xdf\xed\x58\x31\x0c\x7b\x1c\xee\x50\xda\x73\x44\x1f\xd6\xd8\x2a\x23\xac\xf2\xf2\xd7\xd8\x5b\x64\x1c\xb5\xf9\x0f\xf3\xf9\x75\x40\xb5\xac\xab\x15\xe3\xe3\x2a\xc6\x32\xeb\x0c\x08\x69\x71\x83\xfa\xa2\x01\xd3\x2a\x69\xf0\x6a\xf9\xa5\x13\x35\xa7\xc7\x9d\x69\x5c\xa3\x46\xb9\xf2\xab\x3c\x24\x4c\x24\x78\x0c\xb3\xc2\x93\x72\xe2\x17\xbe\x20\x67\xf3\xd5\xac\xa3\x6a\x3d\xa2\x9e\x0e\x72\x85\xbe\xd2\xe8\xcf\xc0\x29\xf3\xab\x13\x0d\xfa\x39\x9a\x16\xf6\xc2\x6e\x95\xfb\x89\xc0\x87\x92\xe8\xb5\xd6\xcc\xd5\x16\x22\xa9\xf6\xfe\x60\x6c\x98\x0b\x9d\x5d\x85\xf1\xdf\x64\x41\x3c\x09\x8e\xce\x98\x16\x19\x79\x19\x34\x42\x07\xe5\x7c\x3f\x03\xcb\x54\x8b\x69\xf1\x04\x4b\xab\x11\x21\x3a\xa1\x7a\xad\x64\x60\xba\x4c\xed\x65\x90\xcd\x67\xcf\x23\xd3\x4d\x82\x6f\x4a\x18\x36\x0e\x9d\x02\x00\x00")
+
+func dbMigrations13_deliveriesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations13_deliveriesSql,
+		"db/migrations/13_deliveries.sql",
+	)
+}
+
+func dbMigrations13_deliveriesSql() (*asset, error) {
+	bytes, err := dbMigrations13_deliveriesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/13_deliveries.sql", size: 669, mode: os.FileMode(420), modTime: time.Unix(1792365211, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations14_repositoriesSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xad\x54\x4d\x73\x9b\x30\x10\xbd\xf3\x2b\xf6\x66\x98\xda\x99\x1e\x7a\xf3\xc9\x31\x24\xf5\x0c\x83\xdb\xc4\xcc\xf4\xc6\x08\x58\xc3\x4e\x41\xa2\xd2\xca\xae\xfb\xeb\x2b\xd9\xb1\x8b\xeb\xa6\xb9\xe4\xc2\x61\xf5\xf6\xed\xc7\x7b\xcb\x6c\x06\x1f\x7a\x6a\xb4\x60\x84\x7c\x08\x96\x4f\xc9\x62\x93\xc0\x66\x71\x9f\x26\xa0\x71\x50\x86\x58\x69\x42\x03\x61\x00\x40\x35\x58\xeb\x3e\xd9\x7a\x03\x59\x9e\xa6\x10\x27\x0f\x8b\x3c\xdd\x1c\xa3\x45\x83\x12\x3d\x4f\xb1\xfb\x14\x46\x30\x68\xea\x85\x3e\xc0\x77\x3c\x4c\x5d\xaa\x14\x3d\x02\xe3\x4f\xbe\x24\xfb\x28\x4a\x51\x76\x58\x43\xa9\x54\x87\x42\xde\x12\xb3\xb6\xe8\x81\x83\xb0\xe6\x7f\xb8\xad\xe8\xcc\x11\x58\xe3\x56\xd8\x8e\x8b\x52\x0b\x59\xb5\xd7\x15\x2f\xe8\x49\x2f\x0c\xa3\x9e\xf8\x04\xd7\x65\x83\xaf\xe1\x8e\x88\xd2\x52\x57\xa3\x2e\xde\x46\x32\xf5\xa8\x2c\x43\x49\x0d\xc9\x7f\xa0\x3e\x7a\x50\xa5\x64\x65\xb5\x46\x59\x1d\xc0\xa1\xb0\x41\xfd\x1a\x52\xa3\x5b\x67\x5d\x08\x3e\x32\x1b\x16\xfd\x00\x7b\xe2\xd6\xd7\xf0\x11\xf8\xa5\x24\x9e\x47\x86\x50\xaa\xbd\x5b\xbc\x18\xbf\x4d\x2c\x57\x93\xe8\x6a\xe7\x76\xa8\xdf\x99\x35\x88\xe6\x41\x30\x9b\xc1\x23\xf1\x67\x5b\xfe\xb1\xcd\xe1\xa8\xba\x01\xa1\x11\x2a\x61\xd0\x8d\x6b\x50\xba\x27\xda\xe1\xdd\xd9\x6a\x79\xb6\xfa\x9a\x27\xb0\xca\xe2\xe4\x1b\x58\x49\x3f\x2c\x16\x23\x86\x75\x76\x6d\xc3\xfc\x79\x95\x3d\x42\xc9\x1a\x11\xc2\x4e\xed\x51\x87\xbe\x48\xf4\xd2\xc2\xbd\xd7\xca\x00\xb7\xae\x5f\x5f\x76\x40\x59\x93\x6c\xa6\x4e\x44\x86\x56\xec\x50\x4e\x9c\x3c\x88\x12\x06\x6b\x5a\xe7\x28\x25\x59\x39\x38\x9e\x54\x06\x57\xdd\xa2\x27\x2a\xb1\xf2\x96\xf3\x4f\xa4\xc7\x23\x91\x79\x31\xe3\x14\x94\xf6\x6b\x21\x36\x57\x9a\x76\xd4\x13\xdf\x5d\x5f\x52\x8b\x5d\x5d\x94\xa7\xde\xc2\xb3\xa5\x8a\x9b\x73\xd2\xb8\x45\x4f\xe2\xe6\x3c\x81\x43\xaa\x23\xbf\x82\x38\x49\x13\x47\xb6\x5c\x3c\x2f\x17\x71\xf2\xf7\x6d\xa9\x81\x49\x49\x73\x7b\x5e\xef\x6f\xa0\xb3\xd4\x97\x7f\x46\xac\xf6\x32\x88\x9f\xd6\x5f\x6e\x27\x9d\x8f\xe3\x63\x11\xe7\xc1\x6f\x68\x8c\xf5\x22\x76\x04\x00\x00")
+
+func dbMigrations14_repositoriesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations14_repositoriesSql,
+		"db/migrations/14_repositories.sql",
+	)
+}
+
+func dbMigrations14_repositoriesSql() (*asset, error) {
+	bytes, err := dbMigrations14_repositoriesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/14_repositories.sql", size: 1142, mode: os.FileMode(420), modTime: time.Unix(1792366011, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations15_artifact_name_slashesSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd3\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x08\x2d\xe0\x0a\x0d\x70\x71\x0c\x71\x55\x48\x2c\x2a\xc9\x4c\x4b\x4c\x2e\x29\x56\x08\x76\x0d\x51\xc8\x4b\xcc\x4d\x55\xb0\x55\x28\x4a\x2d\xc8\x49\x4c\x4e\xd5\x00\x71\x75\x14\xd4\xf5\xd5\x81\x84\x9e\xba\xa6\x42\xb8\x87\x6b\x90\x2b\x44\x91\x8f\xa7\xb7\xab\x82\xba\xaa\xbe\xaa\xba\x35\x17\x97\x2e\x92\xd1\x2e\xf9\xe5\x79\x5c\x00\x74\x99\xcd\xf9\x6c\x00\x00\x00")
+
+func dbMigrations15_artifact_name_slashesSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations15_artifact_name_slashesSql,
+		"db/migrations/15_artifact_name_slashes.sql",
+	)
+}
+
+func dbMigrations15_artifact_name_slashesSql() (*asset, error) {
+	bytes, err := dbMigrations15_artifact_name_slashesSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/15_artifact_name_slashes.sql", size: 108, mode: os.FileMode(420), modTime: time.Unix(1792367955, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations16_deliveries_delivery_idSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\xd3\xd5\x55\xd0\xce\xcd\x4c\x2f\x4a\x2c\x49\x55\x08\x2d\xe0\x72\x0e\x72\x75\x0c\x71\x55\xf0\xf4\x73\x71\x8d\x50\x48\x49\xcd\xc9\x2c\x4b\x2d\xca\x4c\x2d\x8e\x87\x32\x2b\xe3\x33\x53\x14\xfc\xfd\x90\x64\x14\x42\x83\x3d\xfd\xdc\x15\x92\x4a\x8a\x52\x53\x15\x34\x90\x94\x69\x5a\x73\x71\xe9\x22\x19\xee\x92\x5f\x9e\xc7\xe5\x12\xe4\x1f\x80\xd7\x70\x6b\x2e\x00\xb0\xbf\x15\x25\x91\x00\x00\x00")
+
+func dbMigrations16_deliveries_delivery_idSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations16_deliveries_delivery_idSql,
+		"db/migrations/16_deliveries_delivery_id.sql",
+	)
+}
+
+func dbMigrations16_deliveries_delivery_idSql() (*asset, error) {
+	bytes, err := dbMigrations16_deliveries_delivery_idSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/16_deliveries_delivery_id.sql", size: 145, mode: os.FileMode(420), modTime: time.Unix(1792368650, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations17_status_updates_leaseSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x85\x90\xc1\x6e\xc2\x30\x10\x44\xef\xf9\x8a\xb9\x05\x54\xd2\x1f\xe0\x94\x92\x08\x90\x68\x52\xa5\x20\x7a\x43\x26\xde\x36\x56\x1d\xdb\x8a\x37\x45\xf4\xeb\xeb\x04\x0e\x08\x55\xed\x75\x34\x7a\xfb\x76\x92\x04\x0f\xad\xfa\xe8\x04\x13\x76\x2e\x4a\x12\xec\x6d\xf7\x49\x9d\x87\x26\xe1\x09\x02\x9e\x05\xf7\x1e\xbd\x93\x43\xe7\xd4\x28\x4d\xe0\x86\xce\x10\xce\xe9\x33\x14\xcf\xe0\x6d\x48\x04\x0f\x31\xb8\x13\xc6\x8b\x9a\x95\x35\x03\x6d\xcc\x6b\x2d\x54\xeb\x43\x15\xd2\x92\x37\x31\xa3\x11\x5f\xa1\x6a\x07\xf8\x19\xd6\x91\xb9\x82\x97\x8a\x57\xfd\x11\xca\xa3\x16\x5a\x93\x7c\x8c\xd2\xcd\x36\xaf\xb0\x4d\x9f\x36\xf9\x55\xe5\x70\x51\xf1\x48\xb3\x0c\x8b\x72\xb3\x7b\x2e\x2e\xb2\xf2\xd0\x1b\x56\x1a\xac\x5a\x0a\xd5\xd6\xe1\xa4\xb8\xb1\x3d\x8f\x09\xbe\xad\xa1\x79\x14\x2d\xaa\x3c\xdd\xe6\x58\x17\x59\xfe\x76\x47\x3c\xd4\xb6\x75\x9a\x38\x90\x82\x75\x59\xdc\x1f\xdc\xbd\xae\x8b\x25\x8e\xdc\x11\x61\x72\xdb\x9d\x62\xbf\xca\xab\x8b\x20\x05\x34\x26\xb1\xef\xeb\x9a\x48\x92\x8c\x67\x88\xdf\x45\x78\x4e\xc6\xd3\x70\x3e\xb9\x19\x3c\xb3\x27\x13\x65\x55\xf9\xf2\xbf\xcd\xfc\xaf\x21\x46\xc4\x2f\x4b\xcc\xa3\x1f\x07\x95\xff\xab\xdf\x01\x00\x00")
+
+func dbMigrations17_status_updates_leaseSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations17_status_updates_leaseSql,
+		"db/migrations/17_status_updates_lease.sql",
+	)
+}
+
+func dbMigrations17_status_updates_leaseSql() (*asset, error) {
+	bytes, err := dbMigrations17_status_updates_leaseSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/17_status_updates_lease.sql", size: 479, mode: os.FileMode(420), modTime: time.Unix(1792368922, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _dbMigrations18_build_timeoutsSql = []byte("\x1f\x8b\x08\x00\x00\x09\x6e\x88\x00\xff\x6d\xcf\x31\x6e\xc3\x30\x0c\x05\xd0\xdd\xa7\xf8\x5b\x87\xda\x45\xf6\x4c\x6e\xe4\x22\x83\x6a\x17\x81\x7d\x00\x25\x62\x1c\x21\x0a\x59\x48\x74\x8d\xde\xbe\x36\x82\x74\x28\xba\x70\xe1\xff\x0f\x64\x55\xe1\xf9\x16\xc6\xe4\x94\x30\x7c\x16\x55\x85\xbd\xcc\x88\xc2\x23\xf4\x42\x38\x4e\x21\x7a\x9c\x1c\x23\x4d\x5c\x22\x30\xd8\xb1\x64\x3a\x09\xfb\x5c\x42\x12\x36\x38\x2f\x73\xcd\xce\x92\xae\x94\x9e\x32\x3c\x9d\xdd\x14\xb5\x5c\xb5\x2c\xcb\xce\xe9\x1d\xca\x70\x89\x20\x1c\xbf\xb1\x00\x39\x78\x4a\xe4\x91\xd5\x45\x42\xa2\xe8\x34\x7c\x11\x74\x6d\x50\x48\x90\x99\xa1\xe1\x46\x32\xe9\x4b\x51\xdb\xbe\x39\xa0\xaf\x5f\x6d\xf3\xb0\x6a\x63\xb0\xeb\xec\xf0\xde\x3e\x62\x38\x86\x31\xb0\xa2\xed\x7a\xb4\x83\xb5\x30\xcd\x5b\x3d\xd8\x1e\x9b\x6d\xb1\x1e\xf3\xfb\xa9\x59\xec\xff\x48\x73\xe8\x3e\xfe\x98\xdb\xe2\x07\x4c\x03\x47\x3a\x23\x01\x00\x00")
+
+func dbMigrations18_build_timeoutsSqlBytes() ([]byte, error) {
+	return bindataRead(
+		_dbMigrations18_build_timeoutsSql,
+		"db/migrations/18_build_timeouts.sql",
+	)
+}
+
+func dbMigrations18_build_timeoutsSql() (*asset, error) {
+	bytes, err := dbMigrations18_build_timeoutsSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "db/migrations/18_build_timeouts.sql", size: 291, mode: os.FileMode(420), modTime: time.Unix(1792369690, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 // Asset loads and returns the asset for the given name.
 // It returns an error if the asset could not be found or
 // could not be loaded.
@@ -141,6 +498,23 @@ func AssetNames() []string {
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
 	"db/migrations/1_initial_schema.sql": dbMigrations1_initial_schemaSql,
+	"db/migrations/2_build_steps.sql": dbMigrations2_build_stepsSql,
+	"db/migrations/3_logs_truncated.sql": dbMigrations3_logs_truncatedSql,
+	"db/migrations/4_log_encoding.sql": dbMigrations4_log_encodingSql,
+	"db/migrations/5_logs_deleted.sql": dbMigrations5_logs_deletedSql,
+	"db/migrations/6_artifact_digests.sql": dbMigrations6_artifact_digestsSql,
+	"db/migrations/7_artifact_names.sql": dbMigrations7_artifact_namesSql,
+	"db/migrations/8_build_directives.sql": dbMigrations8_build_directivesSql,
+	"db/migrations/9_build_tags.sql": dbMigrations9_build_tagsSql,
+	"db/migrations/10_pull_requests.sql": dbMigrations10_pull_requestsSql,
+	"db/migrations/11_status_updates.sql": dbMigrations11_status_updatesSql,
+	"db/migrations/12_installations.sql": dbMigrations12_installationsSql,
+	"db/migrations/13_deliveries.sql": dbMigrations13_deliveriesSql,
+	"db/migrations/14_repositories.sql": dbMigrations14_repositoriesSql,
+	"db/migrations/15_artifact_name_slashes.sql": dbMigrations15_artifact_name_slashesSql,
+	"db/migrations/16_deliveries_delivery_id.sql": dbMigrations16_deliveries_delivery_idSql,
+	"db/migrations/17_status_updates_lease.sql": dbMigrations17_status_updates_leaseSql,
+	"db/migrations/18_build_timeouts.sql": dbMigrations18_build_timeoutsSql,
 }
 
 // AssetDir returns the file names below a certain
@@ -186,6 +560,23 @@ var _bintree = &bintree{nil, map[string]*bintree{
 	"db": &bintree{nil, map[string]*bintree{
 		"migrations": &bintree{nil, map[string]*bintree{
 			"1_initial_schema.sql": &bintree{dbMigrations1_initial_schemaSql, map[string]*bintree{}},
+			"2_build_steps.sql": &bintree{dbMigrations2_build_stepsSql, map[string]*bintree{}},
+			"3_logs_truncated.sql": &bintree{dbMigrations3_logs_truncatedSql, map[string]*bintree{}},
+			"4_log_encoding.sql": &bintree{dbMigrations4_log_encodingSql, map[string]*bintree{}},
+			"5_logs_deleted.sql": &bintree{dbMigrations5_logs_deletedSql, map[string]*bintree{}},
+			"6_artifact_digests.sql": &bintree{dbMigrations6_artifact_digestsSql, map[string]*bintree{}},
+			"7_artifact_names.sql": &bintree{dbMigrations7_artifact_namesSql, map[string]*bintree{}},
+			"8_build_directives.sql": &bintree{dbMigrations8_build_directivesSql, map[string]*bintree{}},
+			"9_build_tags.sql": &bintree{dbMigrations9_build_tagsSql, map[string]*bintree{}},
+			"10_pull_requests.sql": &bintree{dbMigrations10_pull_requestsSql, map[string]*bintree{}},
+			"11_status_updates.sql": &bintree{dbMigrations11_status_updatesSql, map[string]*bintree{}},
+			"12_installations.sql": &bintree{dbMigrations12_installationsSql, map[string]*bintree{}},
+			"13_deliveries.sql": &bintree{dbMigrations13_deliveriesSql, map[string]*bintree{}},
+			"14_repositories.sql": &bintree{dbMigrations14_repositoriesSql, map[string]*bintree{}},
+			"15_artifact_name_slashes.sql": &bintree{dbMigrations15_artifact_name_slashesSql, map[string]*bintree{}},
+			"16_deliveries_delivery_id.sql": &bintree{dbMigrations16_deliveries_delivery_idSql, map[string]*bintree{}},
+			"17_status_updates_lease.sql": &bintree{dbMigrations17_status_updates_leaseSql, map[string]*bintree{}},
+			"18_build_timeouts.sql": &bintree{dbMigrations18_build_timeoutsSql, map[string]*bintree{}},
 		}},
 	}},
 }}
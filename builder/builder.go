@@ -7,7 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"log"
 	"sync"
 	"text/template"
 	"time"
@@ -50,9 +50,50 @@ type BuildOptions struct {
 	Sha string
 	// Branch is the name of the branch that this build relates to.
 	Branch string
+	// Tag is the name of the git tag that this build relates to, if it
+	// was triggered by a tag.
+	Tag string `json:",omitempty"`
+	// PullRequest is the number of the pull request that this build
+	// relates to, if it was triggered by a pull request.
+	PullRequest int `json:",omitempty"`
+	// The ID of the GitHub App installation that has access to the
+	// repository.
+	InstallationID int64 `json:",omitempty"`
 	// Set to true to disable the layer cache. The zero value is to enable
 	// caching.
 	NoCache bool
+
+	// The stage to build in a multi-stage Dockerfile.
+	Target string `json:",omitempty"`
+	// Build args to pass to `docker build`.
+	BuildArgs map[string]string `json:",omitempty"`
+	// The priority of the build. BuildQueues may build high priority
+	// builds ahead of others.
+	Priority string `json:",omitempty"`
+
+	// The docker repository to push the image to. Defaults to the
+	// Repository.
+	Image string `json:",omitempty"`
+	// The docker image to run the build with, instead of the Builder's
+	// default.
+	BuilderImage string `json:",omitempty"`
+	// How long to wait for the build to complete before canceling it. A
+	// timeout in the repository's ConfigFile can shorten it.
+	Timeout time.Duration `json:",omitempty"`
+
+	// The following options are set from the repository's ConfigFile when
+	// the build runs, so they're never sent over the BuildQueue. See Config
+	// for details.
+	Dockerfile string `json:"-"`
+	Context    string `json:"-"`
+}
+
+// ImageName returns the docker repository that the image is pushed to.
+func (o BuildOptions) ImageName() string {
+	if o.Image != "" {
+		return o.Image
+	}
+	return o.Repository
 }
 
 // Builder represents something that can build a Docker image.
@@ -87,20 +128,36 @@ func (fn BuilderFunc) Build(ctx context.Context, w io.Writer, opts BuildOptions)
 // since is a variable so we can stub it out in tests.
 var since = time.Since
 
+// StatusQueue represents a durable queue of updates to the GitHub commit status
+// or check run for a build. Updates are applied asynchronously, and retried, so
+// that GitHub being unavailable never blocks or fails a build.
+type StatusQueue interface {
+	// QueueStatus queues a commit status for the commit being built.
+	QueueStatus(ctx context.Context, opts BuildOptions, status *github.RepoStatus) error
+
+	// QueueCheckRun queues an update to the check run for the build. The
+	// check run is created by the first update.
+	QueueCheckRun(ctx context.Context, opts BuildOptions, run *CheckRun) error
+}
+
 // statusUpdaterBuilder is a Builder implementation that updates the commit
 // status in github.
 type statusUpdaterBuilder struct {
 	Builder
-	github  GitHubClient
+	queue   StatusQueue
 	urlTmpl *template.Template
+
+	// If set, SignURL signs the link to the logs of a build, so that it
+	// can be followed without the API credentials.
+	SignURL func(url, buildID string) string
 }
 
 // UpdateGitHubCommitStatus wraps b to update the GitHub commit status when a
-// build starts, and stops.
-func UpdateGitHubCommitStatus(b Builder, g GitHubClient, urlTmpl string) *statusUpdaterBuilder {
+// build starts, and stops. The statuses are queued on q.
+func UpdateGitHubCommitStatus(b Builder, q StatusQueue, urlTmpl string) *statusUpdaterBuilder {
 	return &statusUpdaterBuilder{
 		Builder: b,
-		github:  g,
+		queue:   q,
 		urlTmpl: template.Must(template.New("url").Parse(urlTmpl)),
 	}
 }
@@ -108,6 +165,10 @@ func UpdateGitHubCommitStatus(b Builder, g GitHubClient, urlTmpl string) *status
 func (b *statusUpdaterBuilder) Build(ctx context.Context, w io.Writer, opts BuildOptions) (image string, err error) {
 	t := time.Now()
 
+	// Observe the images that are pushed, so that each named image can get
+	// its own commit status.
+	ctx, w, output := ObserveOutput(ctx, w, opts)
+
 	defer func() {
 		duration := since(t)
 		description := fmt.Sprintf("Image built in %v.", duration)
@@ -116,22 +177,29 @@ func (b *statusUpdaterBuilder) Build(ctx context.Context, w io.Writer, opts Buil
 			status = "failure"
 			description = err.Error()
 		}
-		b.updateStatus(ctx, w, opts, status, description)
+		b.updateStatus(ctx, opts, Context, status, description)
+
+		if err != nil {
+			return
+		}
+
+		for _, i := range output.Images() {
+			if i.Name == "" {
+				continue
+			}
+			b.updateStatus(ctx, opts, fmt.Sprintf("%s/%s", Context, i.Name), "success", fmt.Sprintf("Image pushed to %s.", i.Ref()))
+		}
 	}()
 
-	if err = b.updateStatus(ctx, w, opts, "pending", "Image building."); err != nil {
-		return
-	}
+	b.updateStatus(ctx, opts, Context, "pending", "Image building.")
 
 	image, err = b.Builder.Build(ctx, w, opts)
 	return
 }
 
-// updateStatus updates the given commit with a new status.
-func (b *statusUpdaterBuilder) updateStatus(ctx context.Context, w io.Writer, opts BuildOptions, status string, description string) error {
-	context := Context
-	parts := strings.SplitN(opts.Repository, "/", 2)
-
+// updateStatus queues a new status for the context on the given commit. Errors
+// are logged, rather than returned, so that they don't fail the build.
+func (b *statusUpdaterBuilder) updateStatus(ctx context.Context, opts BuildOptions, context, status, description string) {
 	var desc *string
 	if description != "" {
 		desc = &description
@@ -139,22 +207,34 @@ func (b *statusUpdaterBuilder) updateStatus(ctx context.Context, w io.Writer, op
 
 	url, err := b.url(opts)
 	if err != nil {
-		return err
+		log.Printf("error rendering status url for build %s: %v", opts.ID, err)
 	}
 
-	_, _, err = b.github.CreateStatus(ctx, parts[0], parts[1], opts.Sha, &github.RepoStatus{
+	if err := b.queue.QueueStatus(ctx, opts, &github.RepoStatus{
 		State:       &status,
 		Context:     &context,
 		Description: desc,
 		TargetURL:   github.String(url),
-	})
-	return err
+	}); err != nil {
+		log.Printf("error queueing %s status for build %s: %v", status, opts.ID, err)
+	}
 }
 
 func (b *statusUpdaterBuilder) url(opts BuildOptions) (string, error) {
+	return logsURL(b.urlTmpl, b.SignURL, opts)
+}
+
+// logsURL renders the link to the logs of a build, and signs it with sign, if
+// it's set.
+func logsURL(t *template.Template, sign func(url, buildID string) string, opts BuildOptions) (string, error) {
 	buf := new(bytes.Buffer)
-	err := b.urlTmpl.Execute(buf, opts)
-	return buf.String(), err
+	if err := t.Execute(buf, opts); err != nil {
+		return "", err
+	}
+	if sign == nil {
+		return buf.String(), nil
+	}
+	return sign(buf.String(), opts.ID), nil
 }
 
 // WithCancel wraps a Builder with a method to stop all builds.
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"golang.org/x/net/context"
 )
 
@@ -21,68 +23,181 @@ func TestStatusUpdaterBuilder(t *testing.T) {
 	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
 		return "", nil
 	}
-	g := &MockGitHubClient{}
+	q := &MockStatusQueue{}
 	w := &mockLogger{}
 	builder := &statusUpdaterBuilder{
 		Builder: BuilderFunc(b),
-		github:  g,
+		queue:   q,
 		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
 	}
+	opts := BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}
 
-	g.On("CreateStatus", "remind101", "acme-inc", "abcd", &github.RepoStatus{
+	q.On("QueueStatus", opts, &github.RepoStatus{
 		State:       github.String("pending"),
 		Description: github.String("Image building."),
 		TargetURL:   github.String("https://google.com"),
 		Context:     github.String("container/docker"),
 	}).Return(nil)
-	g.On("CreateStatus", "remind101", "acme-inc", "abcd", &github.RepoStatus{
+	q.On("QueueStatus", opts, &github.RepoStatus{
 		State:       github.String("success"),
 		Description: github.String("Image built in 1s."),
 		TargetURL:   github.String("https://google.com"),
 		Context:     github.String("container/docker"),
 	}).Return(nil)
 
-	builder.Build(context.Background(), w, BuildOptions{
+	builder.Build(context.Background(), w, opts)
+
+	q.AssertExpectations(t)
+}
+
+func TestStatusUpdaterBuilder_SignURL(t *testing.T) {
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		return "", nil
+	}
+	q := &MockStatusQueue{}
+	w := &mockLogger{}
+	builder := &statusUpdaterBuilder{
+		Builder: BuilderFunc(b),
+		queue:   q,
+		urlTmpl: template.Must(template.New("url").Parse("https://conveyor/logs/{{.ID}}")),
+		SignURL: func(url, buildID string) string {
+			return url + "?signature=" + buildID
+		},
+	}
+	opts := BuildOptions{
+		ID:         "1234",
 		Repository: "remind101/acme-inc",
 		Branch:     "master",
 		Sha:        "abcd",
-	})
+	}
+
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("pending"),
+		Description: github.String("Image building."),
+		TargetURL:   github.String("https://conveyor/logs/1234?signature=1234"),
+		Context:     github.String("container/docker"),
+	}).Return(nil)
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String("Image built in 1s."),
+		TargetURL:   github.String("https://conveyor/logs/1234?signature=1234"),
+		Context:     github.String("container/docker"),
+	}).Return(nil)
 
-	g.AssertExpectations(t)
+	builder.Build(context.Background(), w, opts)
+
+	q.AssertExpectations(t)
+}
+
+func TestStatusUpdaterBuilder_MultipleImages(t *testing.T) {
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		io.WriteString(w, "The push refers to a repository [docker.io/remind101/acme-inc]\n")
+		io.WriteString(w, "abcd: digest: "+testDigest+" size: 1234\n")
+		io.WriteString(w, "The push refers to a repository [docker.io/remind101/acme-inc-migrations]\n")
+		io.WriteString(w, "abcd: digest: "+testDigest+" size: 1234\n")
+		return "", nil
+	}
+	q := &MockStatusQueue{}
+	w := &mockLogger{}
+	builder := &statusUpdaterBuilder{
+		Builder: BuilderFunc(b),
+		queue:   q,
+		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
+	}
+	opts := BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}
+
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("pending"),
+		Description: github.String("Image building."),
+		TargetURL:   github.String("https://google.com"),
+		Context:     github.String("container/docker"),
+	}).Return(nil)
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String("Image built in 1s."),
+		TargetURL:   github.String("https://google.com"),
+		Context:     github.String("container/docker"),
+	}).Return(nil)
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("success"),
+		Description: github.String("Image pushed to remind101/acme-inc-migrations@" + testDigest + "."),
+		TargetURL:   github.String("https://google.com"),
+		Context:     github.String("container/docker/migrations"),
+	}).Return(nil)
+
+	builder.Build(context.Background(), w, opts)
+
+	q.AssertExpectations(t)
 }
 
 func TestStatusUpdaterBuilder_Error(t *testing.T) {
 	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
 		return "", errors.New("i/o timeout")
 	}
-	g := &MockGitHubClient{}
+	q := &MockStatusQueue{}
 	w := &mockLogger{}
 	builder := &statusUpdaterBuilder{
 		Builder: BuilderFunc(b),
-		github:  g,
+		queue:   q,
 		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
 	}
+	opts := BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}
 
-	g.On("CreateStatus", "remind101", "acme-inc", "abcd", &github.RepoStatus{
+	q.On("QueueStatus", opts, &github.RepoStatus{
 		State:       github.String("pending"),
 		Description: github.String("Image building."),
 		TargetURL:   github.String("https://google.com"),
 		Context:     github.String("container/docker"),
 	}).Return(nil)
-	g.On("CreateStatus", "remind101", "acme-inc", "abcd", &github.RepoStatus{
+	q.On("QueueStatus", opts, &github.RepoStatus{
 		State:       github.String("failure"),
 		Description: github.String("i/o timeout"),
 		TargetURL:   github.String("https://google.com"),
 		Context:     github.String("container/docker"),
 	}).Return(nil)
 
-	builder.Build(context.Background(), w, BuildOptions{
+	builder.Build(context.Background(), w, opts)
+
+	q.AssertExpectations(t)
+}
+
+func TestStatusUpdaterBuilder_QueueError(t *testing.T) {
+	var built bool
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		built = true
+		return "remind101/acme-inc:abcd", nil
+	}
+	q := &MockStatusQueue{}
+	builder := &statusUpdaterBuilder{
+		Builder: BuilderFunc(b),
+		queue:   q,
+		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
+	}
+
+	q.On("QueueStatus", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+
+	image, err := builder.Build(context.Background(), &mockLogger{}, BuildOptions{
 		Repository: "remind101/acme-inc",
-		Branch:     "master",
 		Sha:        "abcd",
 	})
-
-	g.AssertExpectations(t)
+	assert.NoError(t, err)
+	assert.True(t, built)
+	assert.Equal(t, "remind101/acme-inc:abcd", image)
 }
 
 func TestWithCancel(t *testing.T) {
@@ -182,3 +297,18 @@ func (m *mockLogger) Close() error {
 	m.closed = true
 	return m.closeErr
 }
+
+// MockStatusQueue is a mock implementation of the StatusQueue interface.
+type MockStatusQueue struct {
+	mock.Mock
+}
+
+func (m *MockStatusQueue) QueueStatus(ctx context.Context, opts BuildOptions, status *github.RepoStatus) error {
+	args := m.Called(opts, status)
+	return args.Error(0)
+}
+
+func (m *MockStatusQueue) QueueCheckRun(ctx context.Context, opts BuildOptions, run *CheckRun) error {
+	args := m.Called(opts, run)
+	return args.Error(0)
+}
@@ -0,0 +1,397 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/net/context"
+)
+
+// The states of a check run.
+const (
+	CheckRunQueued     = "queued"
+	CheckRunInProgress = "in_progress"
+	CheckRunCompleted  = "completed"
+)
+
+// The conclusions of a completed check run.
+const (
+	CheckRunSuccess   = "success"
+	CheckRunFailure   = "failure"
+	CheckRunCancelled = "cancelled"
+	CheckRunNeutral   = "neutral"
+)
+
+// ActionRebuildNoCache is the identifier of the check run action that rebuilds
+// the commit with the layer cache disabled.
+const ActionRebuildNoCache = "rebuild_nocache"
+
+// checksMediaType is the media type that's required to use the GitHub Checks
+// API.
+const checksMediaType = "application/vnd.github.antiope-preview+json"
+
+// logTailLines is the number of lines from the end of the log that are shown
+// in the check run for a failed build.
+const logTailLines = 50
+
+// maxCheckRunText is the maximum length of the text of a check run output that
+// GitHub accepts.
+const maxCheckRunText = 65535
+
+// CheckRun represents a GitHub check run.
+type CheckRun struct {
+	ID          int64            `json:"id,omitempty"`
+	Name        string           `json:"name,omitempty"`
+	HeadSHA     string           `json:"head_sha,omitempty"`
+	ExternalID  string           `json:"external_id,omitempty"`
+	DetailsURL  string           `json:"details_url,omitempty"`
+	Status      string           `json:"status,omitempty"`
+	Conclusion  string           `json:"conclusion,omitempty"`
+	StartedAt   *time.Time       `json:"started_at,omitempty"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	Output      *CheckRunOutput  `json:"output,omitempty"`
+	Actions     []CheckRunAction `json:"actions,omitempty"`
+}
+
+// CheckRunOutput is the output that's shown for a check run.
+type CheckRunOutput struct {
+	Title       string               `json:"title"`
+	Summary     string               `json:"summary"`
+	Text        string               `json:"text,omitempty"`
+	Annotations []CheckRunAnnotation `json:"annotations,omitempty"`
+}
+
+// CheckRunAnnotation annotates a line of a file in a check run.
+type CheckRunAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title,omitempty"`
+	Message         string `json:"message"`
+}
+
+// CheckRunAction is a button that's shown on a check run. When it's clicked,
+// GitHub sends a `check_run` event with the `requested_action` action.
+type CheckRunAction struct {
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Identifier  string `json:"identifier"`
+}
+
+// ChecksClient represents a client that can create and update GitHub check
+// runs.
+type ChecksClient interface {
+	CreateCheckRun(ctx context.Context, owner, repo string, run *CheckRun) (*CheckRun, error)
+	UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run *CheckRun) (*CheckRun, error)
+}
+
+// NewChecksClient returns a ChecksClient backed by the GitHub API.
+func NewChecksClient(c *github.Client) ChecksClient {
+	return &checksService{client: c}
+}
+
+// checksService implements the ChecksClient interface with the GitHub API.
+// go-github doesn't support the Checks API, so the requests are made directly.
+type checksService struct {
+	client *github.Client
+}
+
+func (s *checksService) CreateCheckRun(ctx context.Context, owner, repo string, run *CheckRun) (*CheckRun, error) {
+	return s.do(ctx, "POST", fmt.Sprintf("repos/%s/%s/check-runs", owner, repo), run)
+}
+
+func (s *checksService) UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run *CheckRun) (*CheckRun, error) {
+	return s.do(ctx, "PATCH", fmt.Sprintf("repos/%s/%s/check-runs/%d", owner, repo, id), run)
+}
+
+func (s *checksService) do(ctx context.Context, method, path string, run *CheckRun) (*CheckRun, error) {
+	req, err := s.client.NewRequest(method, path, run)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", checksMediaType)
+
+	var r CheckRun
+	if _, err := s.client.Do(ctx, req, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// checkRunBuilder is a Builder implementation that reports the progress and
+// result of a build as a GitHub check run.
+type checkRunBuilder struct {
+	Builder
+	queue   StatusQueue
+	github  GitHubClients
+	urlTmpl *template.Template
+
+	// If set, SignURL signs the link to the logs of a build, so that it
+	// can be followed without the API credentials.
+	SignURL func(url, buildID string) string
+}
+
+// UpdateGitHubCheckRun wraps b to report builds as a GitHub check run. Updates
+// to the check run are queued on q. g is used to fetch the Dockerfile, to
+// annotate the step that failed.
+func UpdateGitHubCheckRun(b Builder, q StatusQueue, g GitHubClients, urlTmpl string) *checkRunBuilder {
+	return &checkRunBuilder{
+		Builder: b,
+		queue:   q,
+		github:  g,
+		urlTmpl: template.Must(template.New("url").Parse(urlTmpl)),
+	}
+}
+
+func (b *checkRunBuilder) Build(ctx context.Context, w io.Writer, opts BuildOptions) (image string, err error) {
+	url, err := b.url(opts)
+	if err != nil {
+		log.Printf("error rendering check run url for build %s: %v", opts.ID, err)
+	}
+
+	// Observe the output to report the images that were pushed, the step
+	// that failed and the end of the log.
+	ctx, w, output := ObserveOutput(ctx, w, opts)
+
+	startedAt := now()
+	b.updateCheckRun(ctx, opts, &CheckRun{
+		DetailsURL: url,
+		Status:     CheckRunInProgress,
+		StartedAt:  &startedAt,
+		Output: &CheckRunOutput{
+			Title:   "Image building",
+			Summary: "Image building.",
+		},
+	})
+
+	defer func() {
+		// The build's context may have been canceled, but the result
+		// should still be reported.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		completedAt := now()
+		b.updateCheckRun(ctx, opts, &CheckRun{
+			DetailsURL:  url,
+			Status:      CheckRunCompleted,
+			Conclusion:  conclusion(err),
+			CompletedAt: &completedAt,
+			Output:      b.output(ctx, opts, image, err, since(startedAt), output),
+			Actions: []CheckRunAction{
+				{
+					Label:       "Rebuild (no cache)",
+					Description: "Rebuild without the layer cache.",
+					Identifier:  ActionRebuildNoCache,
+				},
+			},
+		})
+	}()
+
+	image, err = b.Builder.Build(ctx, w, opts)
+	return
+}
+
+// updateCheckRun queues an update to the check run for the build. Errors are
+// logged, rather than returned, so that they don't fail the build.
+func (b *checkRunBuilder) updateCheckRun(ctx context.Context, opts BuildOptions, run *CheckRun) {
+	run.Name = Context
+	run.HeadSHA = opts.Sha
+	run.ExternalID = opts.ID
+
+	if err := b.queue.QueueCheckRun(ctx, opts, run); err != nil {
+		log.Printf("error queueing %s check run for build %s: %v", run.Status, opts.ID, err)
+	}
+}
+
+// conclusion returns the conclusion of a check run for a build that completed
+// with err.
+func conclusion(err error) string {
+	switch err.(type) {
+	case nil:
+		return CheckRunSuccess
+	case *BuildCanceledError:
+		return CheckRunCancelled
+	}
+	if err == context.Canceled {
+		return CheckRunCancelled
+	}
+	return CheckRunFailure
+}
+
+// output returns the output of a check run for a build that completed.
+func (b *checkRunBuilder) output(ctx context.Context, opts BuildOptions, image string, err error, d time.Duration, output *Output) *CheckRunOutput {
+	if err == nil {
+		return &CheckRunOutput{
+			Title:   "Image built",
+			Summary: imagesSummary(fmt.Sprintf("Image built in %v.", d), image, output.Images()),
+		}
+	}
+
+	o := &CheckRunOutput{
+		Title:   "Build failed",
+		Summary: err.Error(),
+		Text:    logText(output.Tail()),
+	}
+
+	if conclusion(err) == CheckRunCancelled {
+		o.Title = "Build canceled"
+		return o
+	}
+
+	if s := output.Steps(); len(s) > 0 {
+		if a := b.annotate(ctx, opts, output.Config(), s[len(s)-1]); a != nil {
+			o.Annotations = []CheckRunAnnotation{*a}
+		}
+	}
+
+	return o
+}
+
+// annotate returns an annotation for the Dockerfile instruction of a step that
+// failed, using the Dockerfile that config points to. If the Dockerfile can't
+// be fetched, nil is returned.
+func (b *checkRunBuilder) annotate(ctx context.Context, opts BuildOptions, config *Config, step Step) *CheckRunAnnotation {
+	parts := strings.SplitN(opts.Repository, "/", 2)
+
+	g, err := b.github.GitHubClient(ctx, opts)
+	if err != nil {
+		return nil
+	}
+
+	path := config.DockerfilePath()
+
+	file, _, _, err := g.GetContents(ctx, parts[0], parts[1], path, &github.RepositoryContentGetOptions{
+		Ref: opts.Sha,
+	})
+	if err != nil || file == nil {
+		return nil
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil
+	}
+
+	start, end, ok := instructionLines(content, step.Number)
+	if !ok {
+		return nil
+	}
+
+	return &CheckRunAnnotation{
+		Path:            path,
+		StartLine:       start,
+		EndLine:         end,
+		AnnotationLevel: "failure",
+		Title:           fmt.Sprintf("Step %d failed", step.Number),
+		Message:         step.Instruction,
+	}
+}
+
+func (b *checkRunBuilder) url(opts BuildOptions) (string, error) {
+	return logsURL(b.urlTmpl, b.SignURL, opts)
+}
+
+// imagesSummary returns a summary that lists the images that were pushed. If
+// no pushes were observed, the image that the builder returned is listed.
+func imagesSummary(summary, image string, images []Image) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString(summary)
+	buf.WriteString("\n\n")
+
+	if len(images) == 0 {
+		fmt.Fprintf(buf, "Image: `%s`\n", image)
+		return buf.String()
+	}
+
+	buf.WriteString("| Name | Image | Digest |\n")
+	buf.WriteString("| ---- | ----- | ------ |\n")
+	for _, i := range images {
+		name := i.Name
+		if name == "" {
+			name = "(default)"
+		}
+		fmt.Fprintf(buf, "| %s | `%s` | `%s` |\n", name, i.Ref(), i.Digest)
+	}
+	return buf.String()
+}
+
+// logText formats the last lines of a log as the text of a check run output.
+func logText(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	const prefix, suffix = "Last lines of the log:\n\n```\n", "\n```\n"
+	log := strings.Join(lines, "\n")
+	if max := maxCheckRunText - len(prefix) - len(suffix); len(log) > max {
+		log = log[len(log)-max:]
+	}
+	return prefix + log + suffix
+}
+
+// instructionLines returns the first and last lines of the nth instruction in a
+// Dockerfile, which is step n of the build. Lines are numbered from 1.
+func instructionLines(dockerfile string, n int) (start, end int, ok bool) {
+	var (
+		count        int
+		continuation bool
+	)
+
+	for i, line := range strings.Split(dockerfile, "\n") {
+		// Blank lines and comments are ignored, even within an
+		// instruction that's continued over multiple lines.
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if !continuation {
+			count++
+			if count == n {
+				start = i + 1
+			}
+		}
+
+		continuation = strings.HasSuffix(trimmed, "\\")
+		if count == n && !continuation {
+			return start, i + 1, true
+		}
+	}
+
+	// The Dockerfile ended with a line continuation.
+	if start != 0 {
+		return start, start, true
+	}
+	return 0, 0, false
+}
+
+// tailObserver records the last n lines of output.
+type tailObserver struct {
+	sync.Mutex
+	n     int
+	lines []string
+}
+
+// Lines returns the last lines that were written.
+func (o *tailObserver) Lines() []string {
+	o.Lock()
+	defer o.Unlock()
+	return append([]string(nil), o.lines...)
+}
+
+func (o *tailObserver) observe(line string) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.lines = append(o.lines, line)
+	if len(o.lines) > o.n {
+		o.lines = o.lines[len(o.lines)-o.n:]
+	}
+}
@@ -0,0 +1,262 @@
+package builder
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/net/context"
+)
+
+func TestCheckRunBuilder(t *testing.T) {
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		io.WriteString(w, "The push refers to a repository [docker.io/remind101/acme-inc]\n")
+		io.WriteString(w, "abcd: digest: "+testDigest+" size: 1234\n")
+		return "remind101/acme-inc:abcd", nil
+	}
+	q := &MockStatusQueue{}
+	builder := &checkRunBuilder{
+		Builder: BuilderFunc(b),
+		queue:   q,
+		github:  &MockGitHubClient{},
+		urlTmpl: template.Must(template.New("url").Parse("https://google.com/{{.ID}}")),
+	}
+	opts := BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}
+
+	var runs []*CheckRun
+	q.On("QueueCheckRun", opts, mock.Anything).Run(func(args mock.Arguments) {
+		runs = append(runs, args.Get(1).(*CheckRun))
+	}).Return(nil)
+
+	_, err := builder.Build(context.Background(), &mockLogger{}, opts)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(runs))
+	assert.Equal(t, Context, runs[0].Name)
+	assert.Equal(t, "abcd", runs[0].HeadSHA)
+	assert.Equal(t, "1234", runs[0].ExternalID)
+	assert.Equal(t, CheckRunInProgress, runs[0].Status)
+	assert.NotNil(t, runs[0].StartedAt)
+	assert.Equal(t, "https://google.com/1234", runs[0].DetailsURL)
+	assert.Equal(t, CheckRunCompleted, runs[1].Status)
+	assert.Equal(t, CheckRunSuccess, runs[1].Conclusion)
+	assert.Equal(t, "Image built in 1s.\n\n| Name | Image | Digest |\n| ---- | ----- | ------ |\n| (default) | `remind101/acme-inc@"+testDigest+"` | `"+testDigest+"` |\n", runs[1].Output.Summary)
+	assert.Equal(t, ActionRebuildNoCache, runs[1].Actions[0].Identifier)
+}
+
+func TestCheckRunBuilder_Error(t *testing.T) {
+	completedAt := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return completedAt }
+	defer func() { now = time.Now }()
+
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		io.WriteString(w, "Step 1/2 : FROM busybox\n")
+		io.WriteString(w, "Step 2/2 : RUN make\n")
+		io.WriteString(w, "make: *** No targets specified and no makefile found.  Stop.\n")
+		return "", errors.New("exit status 2")
+	}
+	q := &MockStatusQueue{}
+	g := &MockGitHubClient{}
+	builder := &checkRunBuilder{
+		Builder: BuilderFunc(b),
+		queue:   q,
+		github:  g,
+		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
+	}
+	opts := BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}
+
+	q.On("QueueCheckRun", opts, &CheckRun{
+		Name:       Context,
+		HeadSHA:    "abcd",
+		ExternalID: "1234",
+		DetailsURL: "https://google.com",
+		Status:     CheckRunInProgress,
+		StartedAt:  &completedAt,
+		Output: &CheckRunOutput{
+			Title:   "Image building",
+			Summary: "Image building.",
+		},
+	}).Return(nil)
+	g.On("GetContents", "remind101", "acme-inc", "Dockerfile", &github.RepositoryContentGetOptions{Ref: "abcd"}).Return(&github.RepositoryContent{
+		Content: github.String("# syntax=docker/dockerfile:1\nFROM busybox\n\nRUN make\n"),
+	}, 0, nil)
+	q.On("QueueCheckRun", opts, &CheckRun{
+		Name:        Context,
+		HeadSHA:     "abcd",
+		ExternalID:  "1234",
+		DetailsURL:  "https://google.com",
+		Status:      CheckRunCompleted,
+		Conclusion:  CheckRunFailure,
+		CompletedAt: &completedAt,
+		Output: &CheckRunOutput{
+			Title:   "Build failed",
+			Summary: "exit status 2",
+			Text:    "Last lines of the log:\n\n```\nStep 1/2 : FROM busybox\nStep 2/2 : RUN make\nmake: *** No targets specified and no makefile found.  Stop.\n```\n",
+			Annotations: []CheckRunAnnotation{
+				{
+					Path:            "Dockerfile",
+					StartLine:       4,
+					EndLine:         4,
+					AnnotationLevel: "failure",
+					Title:           "Step 2 failed",
+					Message:         "RUN make",
+				},
+			},
+		},
+		Actions: []CheckRunAction{
+			{
+				Label:       "Rebuild (no cache)",
+				Description: "Rebuild without the layer cache.",
+				Identifier:  ActionRebuildNoCache,
+			},
+		},
+	}).Return(nil)
+
+	_, err := builder.Build(context.Background(), &mockLogger{}, opts)
+	assert.EqualError(t, err, "exit status 2")
+
+	q.AssertExpectations(t)
+	g.AssertExpectations(t)
+}
+
+func TestCheckRunBuilder_Config(t *testing.T) {
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		io.WriteString(w, "Step 1/1 : RUN make\n")
+		return "", errors.New("exit status 2")
+	}
+	q := &MockStatusQueue{}
+	g := &MockGitHubClient{}
+	builder := &checkRunBuilder{
+		Builder: WithConfig(BuilderFunc(b), g),
+		queue:   q,
+		github:  g,
+		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
+	}
+	opts := BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+	}
+
+	// The config that was loaded for the build is used to find the
+	// Dockerfile, rather than fetching it again.
+	g.On("GetContents", "remind101", "acme-inc", ConfigFile, &github.RepositoryContentGetOptions{Ref: "abcd"}).Once().Return(&github.RepositoryContent{
+		Content: github.String("dockerfile: docker/Dockerfile\n"),
+	}, 0, nil)
+	g.On("GetContents", "remind101", "acme-inc", "docker/Dockerfile", &github.RepositoryContentGetOptions{Ref: "abcd"}).Return(&github.RepositoryContent{
+		Content: github.String("RUN make\n"),
+	}, 0, nil)
+
+	var runs []*CheckRun
+	q.On("QueueCheckRun", opts, mock.Anything).Run(func(args mock.Arguments) {
+		runs = append(runs, args.Get(1).(*CheckRun))
+	}).Return(nil)
+
+	_, err := builder.Build(context.Background(), &mockLogger{}, opts)
+	assert.EqualError(t, err, "exit status 2")
+
+	assert.Equal(t, 2, len(runs))
+	assert.Equal(t, []CheckRunAnnotation{
+		{
+			Path:            "docker/Dockerfile",
+			StartLine:       1,
+			EndLine:         1,
+			AnnotationLevel: "failure",
+			Title:           "Step 1 failed",
+			Message:         "RUN make",
+		},
+	}, runs[1].Output.Annotations)
+	g.AssertExpectations(t)
+}
+
+func TestCheckRunBuilder_QueueError(t *testing.T) {
+	b := func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		return "remind101/acme-inc:abcd", nil
+	}
+	q := &MockStatusQueue{}
+	builder := &checkRunBuilder{
+		Builder: BuilderFunc(b),
+		queue:   q,
+		urlTmpl: template.Must(template.New("url").Parse("https://google.com")),
+	}
+
+	q.On("QueueCheckRun", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+
+	image, err := builder.Build(context.Background(), &mockLogger{}, BuildOptions{
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "remind101/acme-inc:abcd", image)
+}
+
+func TestInstructionLines(t *testing.T) {
+	dockerfile := strings.Join([]string{
+		"# syntax=docker/dockerfile:1",
+		"FROM golang",
+		"",
+		"RUN apt-get update && \\",
+		"    # Install make",
+		"    apt-get install -y make",
+		"COPY . /go/src/app",
+		"RUN make \\",
+	}, "\n")
+
+	tests := []struct {
+		n          int
+		start, end int
+		ok         bool
+	}{
+		{1, 2, 2, true},
+		{2, 4, 6, true},
+		{3, 7, 7, true},
+		{4, 8, 8, true},
+		{5, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		start, end, ok := instructionLines(dockerfile, tt.n)
+		assert.Equal(t, tt.start, start, "step %d", tt.n)
+		assert.Equal(t, tt.end, end, "step %d", tt.n)
+		assert.Equal(t, tt.ok, ok, "step %d", tt.n)
+	}
+}
+
+func TestTailObserver(t *testing.T) {
+	o := &tailObserver{n: 2}
+	for _, line := range []string{"a", "b", "c"} {
+		o.observe(line)
+	}
+	assert.Equal(t, []string{"b", "c"}, o.Lines())
+}
+
+// MockChecksClient is a mock implementation of the ChecksClient interface.
+type MockChecksClient struct {
+	mock.Mock
+}
+
+func (m *MockChecksClient) CreateCheckRun(ctx context.Context, owner, repo string, run *CheckRun) (*CheckRun, error) {
+	args := m.Called(owner, repo, run)
+	return args.Get(0).(*CheckRun), args.Error(1)
+}
+
+func (m *MockChecksClient) UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run *CheckRun) (*CheckRun, error) {
+	args := m.Called(owner, repo, id, run)
+	return nil, args.Error(0)
+}
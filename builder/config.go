@@ -0,0 +1,261 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/remind101/conveyor/logs"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFile is the path, relative to the root of the repository, of the file
+// that configures how the repository is built.
+const ConfigFile = ".conveyor.yml"
+
+// validBuildArg matches the names of build args that can be provided in a
+// Config.
+var validBuildArg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Config is the build configuration for a repository, read from ConfigFile at
+// the commit being built. All fields are optional.
+type Config struct {
+	// Path to the Dockerfile, relative to the root of the repository.
+	Dockerfile string `yaml:"dockerfile"`
+
+	// Path to the build context, relative to the root of the repository.
+	Context string `yaml:"context"`
+
+	// Build args to pass to `docker build`.
+	BuildArgs map[string]string `yaml:"build_args"`
+
+	// The stage to build in a multi-stage Dockerfile.
+	Target string `yaml:"target"`
+
+	// How long to wait for the build to complete before canceling it, e.g.
+	// `30m`.
+	Timeout string `yaml:"timeout"`
+
+	// Pushes to branches that don't match this filter aren't built.
+	Branches Filter `yaml:"branches"`
+
+	// Pushes that only change files that don't match this filter aren't
+	// built.
+	Paths Filter `yaml:"paths"`
+
+	// When true, pushes that aren't built get a successful commit status
+	// saying why, so that required status checks don't block them.
+	SkippedStatus bool `yaml:"skipped_status"`
+}
+
+// ConfigError is returned when a repository's ConfigFile is invalid.
+type ConfigError struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", ConfigFile, e.Err)
+}
+
+// ParseConfig parses and validates a Config. Unknown fields are an error, so
+// that typos aren't silently ignored.
+func ParseConfig(b []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	return &c, nil
+}
+
+// Validate returns an error if the Config is invalid.
+func (c *Config) Validate() error {
+	if err := validatePath("dockerfile", c.Dockerfile); err != nil {
+		return err
+	}
+
+	if err := validatePath("context", c.Context); err != nil {
+		return err
+	}
+
+	for k, v := range c.BuildArgs {
+		if !validBuildArg.MatchString(k) {
+			return fmt.Errorf("build_args: invalid name: %q", k)
+		}
+		if strings.Contains(v, "\n") {
+			return fmt.Errorf("build_args: %s: value can't contain a newline", k)
+		}
+	}
+
+	if strings.ContainsAny(c.Target, " \t\n") {
+		return fmt.Errorf("target: invalid stage: %q", c.Target)
+	}
+
+	if _, err := c.timeout(); err != nil {
+		return err
+	}
+
+	if err := c.Branches.validate("branches"); err != nil {
+		return err
+	}
+
+	return c.Paths.validate("paths")
+}
+
+// Apply sets the BuildOptions that are configured in the Config. A Target or
+// build args that are already set in opts, e.g. from commit message directives,
+// take precedence.
+func (c *Config) Apply(opts *BuildOptions) {
+	opts.Dockerfile = c.Dockerfile
+	opts.Context = c.Context
+
+	if timeout, _ := c.timeout(); timeout != 0 {
+		opts.Timeout = timeout
+	}
+
+	if opts.Target == "" {
+		opts.Target = c.Target
+	}
+
+	if len(c.BuildArgs) > 0 {
+		args := make(map[string]string)
+		for k, v := range c.BuildArgs {
+			args[k] = v
+		}
+		for k, v := range opts.BuildArgs {
+			args[k] = v
+		}
+		opts.BuildArgs = args
+	}
+}
+
+// DockerfilePath returns the path to the Dockerfile, relative to the root of
+// the repository. Like `docker build`, the default is a file named
+// `Dockerfile` in the build context. c can be nil.
+func (c *Config) DockerfilePath() string {
+	if c == nil {
+		return "Dockerfile"
+	}
+	if c.Dockerfile != "" {
+		return c.Dockerfile
+	}
+	return path.Join(c.Context, "Dockerfile")
+}
+
+func (c *Config) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("timeout: %v", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout: must be positive: %s", c.Timeout)
+	}
+	return d, nil
+}
+
+// validatePath returns an error if p isn't a relative path within the
+// repository.
+func validatePath(field, p string) error {
+	if p == "" {
+		return nil
+	}
+
+	if path.IsAbs(p) {
+		return fmt.Errorf("%s: must be relative to the root of the repository: %s", field, p)
+	}
+
+	if c := path.Clean(p); c == ".." || strings.HasPrefix(c, "../") {
+		return fmt.Errorf("%s: must be within the repository: %s", field, p)
+	}
+
+	return nil
+}
+
+// configBuilder is a Builder implementation that fetches the repository's
+// ConfigFile at the commit being built, and applies it to the BuildOptions.
+type configBuilder struct {
+	Builder
+	github GitHubClients
+}
+
+// WithConfig wraps b to configure builds from the repository's ConfigFile. It
+// should be wrapped with UpdateGitHubCheckRun or UpdateGitHubCommitStatus, so
+// that an invalid ConfigFile is reported on the commit.
+func WithConfig(b Builder, g GitHubClients) Builder {
+	return &configBuilder{
+		Builder: b,
+		github:  g,
+	}
+}
+
+func (b *configBuilder) Build(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+	ctx, w, output := ObserveOutput(ctx, w, opts)
+
+	config, err := b.config(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	output.config = config
+
+	if config != nil {
+		logs.Mark(w, logs.PhaseConfig, "Using %s", ConfigFile)
+		config.Apply(&opts)
+	}
+
+	if opts.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	return b.Builder.Build(ctx, w, opts)
+}
+
+// config fetches and parses the ConfigFile. If the repository doesn't have
+// one, a nil Config is returned.
+func (b *configBuilder) config(ctx context.Context, opts BuildOptions) (*Config, error) {
+	g, err := b.github.GitHubClient(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(opts.Repository, "/", 2)
+	return FetchConfig(ctx, g, parts[0], parts[1], opts.Sha)
+}
+
+// FetchConfig fetches and parses the ConfigFile for a repository at the given
+// ref. If the repository doesn't have one, a nil Config is returned.
+func FetchConfig(ctx context.Context, g GitHubClient, owner, repo, ref string) (*Config, error) {
+	file, _, resp, err := g.GetContents(ctx, owner, repo, ConfigFile, &github.RepositoryContentGetOptions{
+		Ref: ref,
+	})
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", ConfigFile, err)
+	}
+	if file == nil {
+		return nil, &ConfigError{Err: fmt.Errorf("not a file")}
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", ConfigFile, err)
+	}
+
+	return ParseConfig([]byte(content))
+}
@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`dockerfile: docker/Dockerfile.app
+context: docker
+build_args:
+  RAILS_ENV: production
+target: release
+timeout: 30m
+`))
+	assert.NoError(t, err)
+
+	var opts BuildOptions
+	c.Apply(&opts)
+	assert.Equal(t, BuildOptions{
+		Dockerfile: "docker/Dockerfile.app",
+		Context:    "docker",
+		BuildArgs:  map[string]string{"RAILS_ENV": "production"},
+		Target:     "release",
+		Timeout:    30 * time.Minute,
+	}, opts)
+}
+
+func TestParseConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"dockerfil: Dockerfile", "invalid .conveyor.yml: yaml: unmarshal errors:\n  line 1: field dockerfil not found in type builder.Config"},
+		{"dockerfile: /etc/passwd", "invalid .conveyor.yml: dockerfile: must be relative to the root of the repository: /etc/passwd"},
+		{"context: ../other", "invalid .conveyor.yml: context: must be within the repository: ../other"},
+		{"build_args: {1FOO: bar}", `invalid .conveyor.yml: build_args: invalid name: "1FOO"`},
+		{"target: a b", `invalid .conveyor.yml: target: invalid stage: "a b"`},
+		{"timeout: 30", "invalid .conveyor.yml: timeout: time: missing unit in duration \"30\""},
+		{"timeout: -1m", "invalid .conveyor.yml: timeout: must be positive: -1m"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseConfig([]byte(tt.in))
+		if assert.Error(t, err, tt.in) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+}
+
+func TestConfigBuilder(t *testing.T) {
+	var got BuildOptions
+	b := WithConfig(BuilderFunc(func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		got = opts
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return "", nil
+	}), newConfigGitHubClient("remind101", "acme-inc", "abcd", "target: release\ntimeout: 5m\n"))
+
+	_, err := b.Build(context.Background(), &mockLogger{}, BuildOptions{
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "release", got.Target)
+	assert.Equal(t, 5*time.Minute, got.Timeout)
+}
+
+func TestConfigBuilder_NotFound(t *testing.T) {
+	g := &MockGitHubClient{}
+	g.On("GetContents", "remind101", "acme-inc", ConfigFile, &github.RepositoryContentGetOptions{Ref: "abcd"}).Return((*github.RepositoryContent)(nil), http.StatusNotFound, errors.New("404 Not Found"))
+
+	b := WithConfig(BuilderFunc(func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		return "remind101/acme-inc:abcd", nil
+	}), g)
+
+	image, err := b.Build(context.Background(), &mockLogger{}, BuildOptions{
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "remind101/acme-inc:abcd", image)
+}
+
+func TestConfigBuilder_Invalid(t *testing.T) {
+	g := newConfigGitHubClient("remind101", "acme-inc", "abcd", "timeout: forever\n")
+	q := &MockStatusQueue{}
+	b := UpdateGitHubCommitStatus(WithConfig(BuilderFunc(func(ctx context.Context, w io.Writer, opts BuildOptions) (string, error) {
+		t.Fatal("Expected the build to not run")
+		return "", nil
+	}), g), q, "https://google.com")
+	opts := BuildOptions{
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+	}
+
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("pending"),
+		Description: github.String("Image building."),
+		TargetURL:   github.String("https://google.com"),
+		Context:     github.String("container/docker"),
+	}).Return(nil)
+	q.On("QueueStatus", opts, &github.RepoStatus{
+		State:       github.String("failure"),
+		Description: github.String(`invalid .conveyor.yml: timeout: time: invalid duration "forever"`),
+		TargetURL:   github.String("https://google.com"),
+		Context:     github.String("container/docker"),
+	}).Return(nil)
+
+	_, err := b.Build(context.Background(), &mockLogger{}, opts)
+	assert.IsType(t, &ConfigError{}, err)
+	q.AssertExpectations(t)
+}
+
+// newConfigGitHubClient returns a MockGitHubClient that returns config as the
+// contents of the ConfigFile.
+func newConfigGitHubClient(owner, repo, sha, config string) *MockGitHubClient {
+	g := &MockGitHubClient{}
+	g.On("GetContents", owner, repo, ConfigFile, &github.RepositoryContentGetOptions{Ref: sha}).Return(&github.RepositoryContent{
+		Encoding: github.String("base64"),
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(config))),
+	}, http.StatusOK, nil)
+	return g
+}
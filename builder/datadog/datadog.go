@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
@@ -57,7 +58,7 @@ func (b *Builder) Build(ctx context.Context, w io.Writer, options builder.BuildO
 			if err2 := b.statsd.Event(&statsd.Event{
 				Title: fmt.Sprintf("Conveyor built %s", image),
 				Text:  fmt.Sprintf("Built %s from %s@%s", image, options.Repository, options.Branch),
-				Tags: append(tags,
+				Tags: append(append([]string(nil), tags...),
 					fmt.Sprintf("branch:%s", options.Branch),
 					fmt.Sprintf("sha:%s", options.Sha),
 					fmt.Sprintf("image:%s", image),
@@ -68,6 +69,31 @@ func (b *Builder) Build(ctx context.Context, w io.Writer, options builder.BuildO
 		}
 	}()
 
+	ctx, w, output := builder.ObserveOutput(ctx, w, options)
+	defer b.stepStats(output.Steps, tags)
+
 	image, err = b.Builder.Build(ctx, w, options)
 	return
 }
+
+// stepStats sends timings for each Dockerfile step, tagged with whether the
+// layer cache was used, so that the cache hit ratio can be derived from the
+// `conveyor.build.step` count.
+func (b *Builder) stepStats(steps func() []builder.Step, tags []string) {
+	for _, s := range steps() {
+		// Copy tags, so that appending to it doesn't write to the
+		// caller's array.
+		stepTags := append(append([]string(nil), tags...),
+			fmt.Sprintf("instruction:%s", instruction(s.Instruction)),
+			fmt.Sprintf("cached:%t", s.Cached),
+		)
+		_ = b.statsd.Count("conveyor.build.step", 1, stepTags, 1)
+		_ = b.statsd.TimeInMilliseconds("conveyor.build.step.time", s.Duration.Seconds()*1000, stepTags, 1)
+	}
+}
+
+// instruction returns the Dockerfile instruction keyword (e.g. `RUN`) from a
+// step, to keep the cardinality of tags low.
+func instruction(s string) string {
+	return strings.ToUpper(strings.SplitN(s, " ", 2)[0])
+}
@@ -81,6 +81,57 @@ func TestBuilder_Build_Err(t *testing.T) {
 	assert.Equal(t, err, errBoom)
 }
 
+func TestBuilder_Build_Steps(t *testing.T) {
+	c := new(mockStatsdClient)
+	b := &Builder{
+		Builder: builder.BuilderFunc(func(ctx context.Context, w io.Writer, options builder.BuildOptions) (string, error) {
+			io.WriteString(w, "Step 1/2 : FROM ubuntu:14.04\n ---> Using cache\nStep 2/2 : RUN make\n")
+			return "", errors.New("container returned non-zero exit")
+		}),
+		statsd: c,
+	}
+
+	c.On("Count", "conveyor.build.error", int64(1), []string{"repo:remind101/acme-inc"}, float64(1)).Return(nil)
+	c.On("Count", "conveyor.build.step", int64(1), []string{"repo:remind101/acme-inc", "instruction:FROM", "cached:true"}, float64(1)).Return(nil)
+	c.On("TimeInMilliseconds", "conveyor.build.step.time", mock.AnythingOfType("float64"), []string{"repo:remind101/acme-inc", "instruction:FROM", "cached:true"}, float64(1)).Return(nil)
+	c.On("Count", "conveyor.build.step", int64(1), []string{"repo:remind101/acme-inc", "instruction:RUN", "cached:false"}, float64(1)).Return(nil)
+	c.On("TimeInMilliseconds", "conveyor.build.step.time", mock.AnythingOfType("float64"), []string{"repo:remind101/acme-inc", "instruction:RUN", "cached:false"}, float64(1)).Return(nil)
+
+	_, err := b.Build(context.Background(), ioutil.Discard, builder.BuildOptions{
+		Repository: "remind101/acme-inc",
+	})
+	assert.Error(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestBuilder_Build_SharedOutput(t *testing.T) {
+	opts := builder.BuildOptions{Repository: "remind101/acme-inc"}
+	ctx, w, output := builder.ObserveOutput(context.Background(), ioutil.Discard, opts)
+
+	c := new(mockStatsdClient)
+	b := &Builder{
+		Builder: builder.BuilderFunc(func(ctx context.Context, bw io.Writer, options builder.BuildOptions) (string, error) {
+			// The Output that's already observing the build is
+			// used, rather than observing it again.
+			assert.Equal(t, w, bw)
+			io.WriteString(bw, "Step 1/1 : FROM ubuntu:14.04\n")
+			return "", errors.New("container returned non-zero exit")
+		}),
+		statsd: c,
+	}
+
+	c.On("Count", "conveyor.build.error", int64(1), []string{"repo:remind101/acme-inc"}, float64(1)).Return(nil)
+	c.On("Count", "conveyor.build.step", int64(1), []string{"repo:remind101/acme-inc", "instruction:FROM", "cached:false"}, float64(1)).Return(nil)
+	c.On("TimeInMilliseconds", "conveyor.build.step.time", mock.AnythingOfType("float64"), []string{"repo:remind101/acme-inc", "instruction:FROM", "cached:false"}, float64(1)).Return(nil)
+
+	_, err := b.Build(ctx, w, opts)
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(output.Steps()))
+
+	c.AssertExpectations(t)
+}
+
 // mockStatsdClient is a mock implementation of the statsdClient interface.
 type mockStatsdClient struct {
 	mock.Mock
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"code.google.com/p/go-uuid/uuid"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/remind101/conveyor/builder"
+	"github.com/remind101/conveyor/logs"
 	"github.com/remind101/pkg/reporter"
 	"golang.org/x/net/context"
 )
@@ -52,6 +54,10 @@ type Builder struct {
 	// flag depends on how the builder image handles the `DRY` environment
 	// variable.
 	DryRun bool
+	// The host of the GitHub Enterprise Server that repositories are
+	// cloned from. When set, the `GITHUB_HOST` and `CLONE_URL` environment
+	// variables are provided to the builder image. Defaults to github.com.
+	GitHubHost string
 
 	client dockerClient
 }
@@ -74,7 +80,7 @@ func NewBuilderFromEnv() (*Builder, error) {
 
 // Build executes the docker image.
 func (b *Builder) Build(ctx context.Context, w io.Writer, opts builder.BuildOptions) (image string, err error) {
-	image = fmt.Sprintf("%s:%s", opts.Repository, opts.Sha)
+	image = fmt.Sprintf("%s:%s", opts.ImageName(), opts.Sha)
 	err = b.build(ctx, w, opts)
 	return
 }
@@ -87,6 +93,8 @@ func (b *Builder) build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 		fmt.Sprintf("DRY=%s", b.dryRun()),
 		fmt.Sprintf("CACHE=%s", b.cache(opts)),
 	}
+	env = append(env, configEnv(opts)...)
+	env = append(env, b.gitHubEnv(opts)...)
 
 	name := strings.Join([]string{
 		strings.Replace(opts.Repository, "/", "-", -1),
@@ -101,7 +109,7 @@ func (b *Builder) build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 			AttachStdout: true,
 			AttachStderr: true,
 			OpenStdin:    true,
-			Image:        b.image(),
+			Image:        b.image(opts),
 			Hostname:     hostname,
 			Env:          env,
 		},
@@ -120,17 +128,22 @@ func (b *Builder) build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 	})
 
 	reporter.AddContext(ctx, "container_id", c.ID)
+	logs.Mark(w, logs.PhaseCreate, "Created container %s", c.ID)
 
 	if err := b.client.StartContainer(c.ID, nil); err != nil {
 		return fmt.Errorf("start container: %v", err)
 	}
 
+	logs.Mark(w, logs.PhaseStart, "Started container %s", c.ID)
+
+	stdout, stderr := b.streams(w)
+
 	done := make(chan error, 1)
 	go func() {
 		done <- b.client.AttachToContainer(docker.AttachToContainerOptions{
 			Container:    c.ID,
-			OutputStream: w,
-			ErrorStream:  w,
+			OutputStream: stdout,
+			ErrorStream:  stderr,
 			Logs:         true,
 			Stream:       true,
 			Stdout:       true,
@@ -166,6 +179,8 @@ func (b *Builder) build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 		return fmt.Errorf("wait container: %v", err)
 	}
 
+	logs.Mark(w, logs.PhaseComplete, "Container exited with status %d", exit)
+
 	// A non-zero exit status means the build failed.
 	if exit != 0 {
 		err := fmt.Errorf("container returned a non-zero exit code: %d", exit)
@@ -181,6 +196,63 @@ func (b *Builder) build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 	return nil
 }
 
+// streams returns the io.Writers to attach the stdout and stderr of the
+// container to. If w supports markers, the output is also scanned for the
+// phases of the build.
+func (b *Builder) streams(w io.Writer) (stdout, stderr io.Writer) {
+	stdout, stderr = logs.Stream(w, logs.StreamStdout), logs.Stream(w, logs.StreamStderr)
+	if _, ok := w.(logs.Marker); ok {
+		stdout, stderr = markPhases(w, stdout), markPhases(w, stderr)
+	}
+	return
+}
+
+// configEnv returns the environment variables for the optional build options,
+// e.g. those set from the repository's config file. Options that aren't set
+// are omitted, so that the builder image can apply its own defaults.
+func configEnv(opts builder.BuildOptions) []string {
+	var env []string
+	if opts.Tag != "" {
+		env = append(env, fmt.Sprintf("TAG=%s", opts.Tag))
+	}
+	if opts.PullRequest != 0 {
+		env = append(env, fmt.Sprintf("PULL_REQUEST=%d", opts.PullRequest))
+	}
+	if opts.Dockerfile != "" {
+		env = append(env, fmt.Sprintf("DOCKERFILE=%s", opts.Dockerfile))
+	}
+	if opts.Context != "" {
+		env = append(env, fmt.Sprintf("CONTEXT=%s", opts.Context))
+	}
+	if len(opts.BuildArgs) > 0 {
+		var args []string
+		for k, v := range opts.BuildArgs {
+			args = append(args, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(args)
+		env = append(env, fmt.Sprintf("BUILD_ARGS=%s", strings.Join(args, "\n")))
+	}
+	if opts.Target != "" {
+		env = append(env, fmt.Sprintf("TARGET=%s", opts.Target))
+	}
+	if opts.Image != "" {
+		env = append(env, fmt.Sprintf("IMAGE=%s", opts.Image))
+	}
+	return env
+}
+
+// gitHubEnv returns the environment variables that point the builder image at
+// GitHub Enterprise, if it's configured.
+func (b *Builder) gitHubEnv(opts builder.BuildOptions) []string {
+	if b.GitHubHost == "" {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("GITHUB_HOST=%s", b.GitHubHost),
+		fmt.Sprintf("CLONE_URL=git@%s:%s.git", b.GitHubHost, opts.Repository),
+	}
+}
+
 func (b *Builder) dryRun() string {
 	if b.DryRun {
 		return "true"
@@ -188,7 +260,10 @@ func (b *Builder) dryRun() string {
 	return ""
 }
 
-func (b *Builder) image() string {
+func (b *Builder) image(opts builder.BuildOptions) string {
+	if opts.BuilderImage != "" {
+		return opts.BuilderImage
+	}
 	if b.Image == "" {
 		return DefaultBuilderImage
 	}
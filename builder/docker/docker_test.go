@@ -2,7 +2,10 @@ package docker
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +13,7 @@ import (
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/remind101/conveyor/builder"
+	"github.com/remind101/conveyor/logs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -269,6 +273,79 @@ func TestBuilder_Build_Cancel(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestBuilder_Build_Markers(t *testing.T) {
+	c := new(mockDockerClient)
+	b := &Builder{
+		client: c,
+	}
+
+	ctx := context.Background()
+	raw, structured := new(bytes.Buffer), new(bytes.Buffer)
+	w := logs.NewStructuredWriter(raw, structured)
+
+	c.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(&docker.Container{ID: "4321"}, nil)
+	c.On("StartContainer", "4321", (*docker.HostConfig)(nil)).Return(nil)
+	c.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Run(func(args mock.Arguments) {
+		options := args.Get(0).(docker.AttachToContainerOptions)
+		io.WriteString(options.OutputStream, "master: Pulling from remind101/acme-inc\n")
+		io.WriteString(options.OutputStream, "Step 1/2 : FROM ubuntu:14.04\n")
+		io.WriteString(options.ErrorStream, "warning\n")
+		io.WriteString(options.OutputStream, "The push refers to a repository [docker.io/remind101/acme-inc]\n")
+	}).Return(nil)
+	c.On("WaitContainer", "4321").Return(0, nil)
+	c.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil)
+
+	_, err := b.Build(ctx, w, builder.BuildOptions{
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+		Branch:     "master",
+	})
+	assert.NoError(t, err)
+
+	var phases, streams []string
+	for _, line := range strings.Split(strings.TrimSpace(structured.String()), "\n") {
+		var e logs.Entry
+		assert.NoError(t, json.Unmarshal([]byte(line), &e))
+		phases = append(phases, e.Phase)
+		streams = append(streams, e.Stream)
+	}
+	assert.Equal(t, []string{"create", "start", "pull", "", "step", "", "", "push", "", "complete"}, phases)
+	assert.Equal(t, "stderr", streams[6])
+	assert.Equal(t, "master: Pulling from remind101/acme-inc\nStep 1/2 : FROM ubuntu:14.04\nwarning\nThe push refers to a repository [docker.io/remind101/acme-inc]\n", raw.String())
+}
+
+func TestConfigEnv(t *testing.T) {
+	env := configEnv(builder.BuildOptions{
+		Tag:        "v1.4.2",
+		Dockerfile: "docker/Dockerfile.app",
+		BuildArgs:  map[string]string{"RAILS_ENV": "production", "BUNDLE_WITHOUT": "test"},
+		Target:     "release",
+		Image:      "quay.io/remind101/acme-inc",
+	})
+	assert.Equal(t, []string{
+		"TAG=v1.4.2",
+		"DOCKERFILE=docker/Dockerfile.app",
+		"BUILD_ARGS=BUNDLE_WITHOUT=test\nRAILS_ENV=production",
+		"TARGET=release",
+		"IMAGE=quay.io/remind101/acme-inc",
+	}, env)
+
+	assert.Nil(t, configEnv(builder.BuildOptions{}))
+}
+
+func TestBuilder_GitHubEnv(t *testing.T) {
+	opts := builder.BuildOptions{Repository: "remind101/acme-inc"}
+
+	b := &Builder{}
+	assert.Nil(t, b.gitHubEnv(opts))
+
+	b.GitHubHost = "github.example.com"
+	assert.Equal(t, []string{
+		"GITHUB_HOST=github.example.com",
+		"CLONE_URL=git@github.example.com:remind101/acme-inc.git",
+	}, b.gitHubEnv(opts))
+}
+
 // mockDockerClient is a mock implementation of the dockerClient interface.
 type mockDockerClient struct {
 	mock.Mock
@@ -303,3 +380,12 @@ func (c *mockDockerClient) WaitContainer(id string) (int, error) {
 	args := c.Called(id)
 	return args.Int(0), args.Error(1)
 }
+
+func TestBuilder_Image(t *testing.T) {
+	b := &Builder{}
+	assert.Equal(t, DefaultBuilderImage, b.image(builder.BuildOptions{}))
+
+	b.Image = "remind101/conveyor-builder:custom"
+	assert.Equal(t, "remind101/conveyor-builder:custom", b.image(builder.BuildOptions{}))
+	assert.Equal(t, "remind101/conveyor-builder:go", b.image(builder.BuildOptions{BuilderImage: "remind101/conveyor-builder:go"}))
+}
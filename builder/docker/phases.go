@@ -0,0 +1,35 @@
+package docker
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/remind101/conveyor/logs"
+)
+
+// phaseRegexps maps output from the builder image to the phase of the build
+// that it marks the start of.
+var phaseRegexps = []struct {
+	phase string
+	re    *regexp.Regexp
+}{
+	// `docker pull` of the image used for the layer cache.
+	{logs.PhasePull, regexp.MustCompile(`^(\S+: )?Pulling (from|repository) `)},
+	// `docker build` starting a Dockerfile instruction.
+	{logs.PhaseStep, regexp.MustCompile(`^Step \d+(/\d+)? : `)},
+	// `docker push` of the built image.
+	{logs.PhasePush, regexp.MustCompile(`^The push refers to a repository `)},
+}
+
+// markPhases returns a logs.LineObserver that writes to w and records a marker
+// on m whenever a line of output signals the start of a new phase.
+func markPhases(m io.Writer, w io.Writer) *logs.LineObserver {
+	return logs.ObserveLines(w, func(line string) {
+		for _, p := range phaseRegexps {
+			if p.re.MatchString(line) {
+				logs.Mark(m, p.phase, "%s", line)
+				return
+			}
+		}
+	})
+}
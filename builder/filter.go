@@ -0,0 +1,128 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter includes or excludes names (branches or file paths) by glob
+// patterns. In a pattern, `*` matches any sequence of characters other than
+// `/`, `**` matches any sequence of characters including `/`, and `?` matches
+// any single character other than `/`.
+type Filter struct {
+	// If provided, only names that match one of these patterns are
+	// included.
+	Include []string `yaml:"include"`
+
+	// Names that match one of these patterns are excluded, even if they
+	// match an Include pattern.
+	Exclude []string `yaml:"exclude"`
+}
+
+// Match returns whether name is included by the filter. When it isn't, the
+// rule that excluded it is returned.
+func (f *Filter) Match(name string) (bool, string) {
+	if len(f.Include) > 0 {
+		var included bool
+		for _, p := range f.Include {
+			if globMatch(p, name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, fmt.Sprintf("include %s", strings.Join(f.Include, ", "))
+		}
+	}
+
+	for _, p := range f.Exclude {
+		if globMatch(p, name) {
+			return false, fmt.Sprintf("exclude %s", p)
+		}
+	}
+
+	return true, ""
+}
+
+func (f *Filter) validate(field string) error {
+	for _, p := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if p == "" {
+			return fmt.Errorf("%s: empty pattern", field)
+		}
+	}
+	return nil
+}
+
+// SkipReason returns why a push of branch, that changed files, shouldn't be
+// built. For pushes of tags, branch is empty. If it should be built, an empty
+// string is returned. When files is empty, e.g. because GitHub didn't provide
+// the list of changed files, the path filter isn't applied.
+func (c *Config) SkipReason(branch string, files []string) string {
+	// Tags don't have a branch, so the branch filter doesn't apply.
+	if branch != "" {
+		if ok, rule := c.Branches.Match(branch); !ok {
+			return fmt.Sprintf("branch %s doesn't match branches: %s", branch, rule)
+		}
+	}
+
+	if len(files) == 0 {
+		return ""
+	}
+
+	for _, f := range files {
+		if ok, _ := c.Paths.Match(f); ok {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("no changed files match paths: %s", c.Paths.rule())
+}
+
+// rule describes the filter, for reporting why a push was skipped.
+func (f *Filter) rule() string {
+	var rules []string
+	if len(f.Include) > 0 {
+		rules = append(rules, fmt.Sprintf("include %s", strings.Join(f.Include, ", ")))
+	}
+	if len(f.Exclude) > 0 {
+		rules = append(rules, fmt.Sprintf("exclude %s", strings.Join(f.Exclude, ", ")))
+	}
+	return strings.Join(rules, "; ")
+}
+
+// globMatch returns whether name matches the glob pattern.
+func globMatch(pattern, name string) bool {
+	return globRegexp(pattern).MatchString(name)
+}
+
+// globRegexp converts a glob pattern to a regular expression.
+func globRegexp(pattern string) *regexp.Regexp {
+	p := []rune(pattern)
+	re := new(bytes.Buffer)
+	re.WriteString("^")
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				i++
+				// `**/` also matches no directories at all.
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					re.WriteString("(.*/)?")
+				} else {
+					re.WriteString(".*")
+				}
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
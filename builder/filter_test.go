@@ -0,0 +1,55 @@
+package builder
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"master", "master", true},
+		{"master", "master2", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", false},
+		{"dependabot/**", "dependabot/npm/lodash", true},
+		{"*.md", "README.md", true},
+		{"*.md", "docs/setup.md", false},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/setup.md", true},
+		{"docs/**", "docs/a/b.png", true},
+		{"v?", "v1", true},
+		{"v?", "v10", false},
+		{"a.b", "axb", false},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.name); got != tt.match {
+			t.Errorf("globMatch(%q, %q) => %v; want %v", tt.pattern, tt.name, got, tt.match)
+		}
+	}
+}
+
+func TestConfig_SkipReason(t *testing.T) {
+	c := &Config{
+		Branches: Filter{Include: []string{"master", "release/*"}},
+		Paths:    Filter{Include: []string{"services/api/**"}, Exclude: []string{"**/*.md"}},
+	}
+
+	tests := []struct {
+		branch string
+		files  []string
+		reason string
+	}{
+		{"master", []string{"services/api/main.go"}, ""},
+		{"master", nil, ""},
+		{"feature", []string{"services/api/main.go"}, "branch feature doesn't match branches: include master, release/*"},
+		{"release/1.0", []string{"services/web/main.go", "services/api/README.md"}, "no changed files match paths: include services/api/**; exclude **/*.md"},
+	}
+
+	for _, tt := range tests {
+		if got := c.SkipReason(tt.branch, tt.files); got != tt.reason {
+			t.Errorf("SkipReason(%q, %v) => %q; want %q", tt.branch, tt.files, got, tt.reason)
+		}
+	}
+}
@@ -2,13 +2,22 @@ package builder
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/google/go-github/github"
 )
 
-// GitHubClient represents a client that can create github commit statuses.
+// GitHubClient represents a client that can create github commit statuses, and
+// fetch the contents of files in a repository.
 type GitHubClient interface {
 	CreateStatus(context context.Context, owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error)
+	GetContents(context context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error)
+}
+
+// GitHubClients returns the GitHubClient to use for a build, which is
+// authenticated as the GitHub App installation that the build belongs to.
+type GitHubClients interface {
+	GitHubClient(ctx context.Context, opts BuildOptions) (GitHubClient, error)
 }
 
 // NewGitHubClient returns a new GitHubClient instance. If token is an empty
@@ -24,3 +33,7 @@ type nullGitHubClient struct{}
 func (c *nullGitHubClient) CreateStatus(ctx context.Context, owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
 	return nil, nil, nil
 }
+
+func (c *nullGitHubClient) GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error) {
+	return nil, nil, &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}, nil
+}
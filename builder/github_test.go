@@ -2,6 +2,7 @@ package builder
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/google/go-github/github"
 	"github.com/stretchr/testify/mock"
@@ -11,7 +12,22 @@ type MockGitHubClient struct {
 	mock.Mock
 }
 
+// GitHubClient implements the GitHubClients interface, by always returning the
+// mock.
+func (m *MockGitHubClient) GitHubClient(ctx context.Context, opts BuildOptions) (GitHubClient, error) {
+	return m, nil
+}
+
 func (m *MockGitHubClient) CreateStatus(ctx context.Context, owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error) {
 	args := m.Called(owner, repo, ref, status)
 	return nil, nil, args.Error(0)
 }
+
+func (m *MockGitHubClient) GetContents(ctx context.Context, owner, repo, path string, opt *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error) {
+	args := m.Called(owner, repo, path, opt)
+	var resp *github.Response
+	if code := args.Int(1); code != 0 {
+		resp = &github.Response{Response: &http.Response{StatusCode: code}}
+	}
+	return args.Get(0).(*github.RepositoryContent), nil, resp, args.Error(2)
+}
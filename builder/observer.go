@@ -0,0 +1,73 @@
+package builder
+
+import (
+	"io"
+	"sync"
+
+	"github.com/remind101/conveyor/logs"
+)
+
+// observer is an io.Writer that calls a function for each line of output
+// written to any stream. All output is passed through to the underlying
+// io.Writer, and markers, streams and Close are passed through if it supports
+// them.
+type observer struct {
+	w       io.Writer
+	observe func(line string)
+
+	mu      sync.Mutex
+	streams map[string]*logs.LineObserver
+}
+
+func newObserver(w io.Writer, observe func(line string)) *observer {
+	return &observer{
+		w:       w,
+		observe: observe,
+		streams: make(map[string]*logs.LineObserver),
+	}
+}
+
+// Write implements the io.Writer interface.
+func (o *observer) Write(p []byte) (int, error) {
+	return o.Stream(logs.StreamStdout).Write(p)
+}
+
+// Stream implements the logs.Streamer interface.
+func (o *observer) Stream(name string) io.Writer {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, ok := o.streams[name]
+	if !ok {
+		s = logs.ObserveLines(logs.Stream(o.w, name), o.observe)
+		o.streams[name] = s
+	}
+	return s
+}
+
+// Mark implements the logs.Marker interface.
+func (o *observer) Mark(phase, text string) error {
+	return logs.Mark(o.w, phase, "%s", text)
+}
+
+// ReportImage implements the ImageReporter interface.
+func (o *observer) ReportImage(image Image) error {
+	return ReportImage(o.w, image)
+}
+
+// Close closes the underlying io.Writer if it implements the io.Closer
+// interface.
+func (o *observer) Close() error {
+	o.mu.Lock()
+	streams := o.streams
+	o.mu.Unlock()
+
+	for _, s := range streams {
+		s.Flush()
+	}
+
+	if c, ok := o.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
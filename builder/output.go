@@ -0,0 +1,82 @@
+package builder
+
+import (
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// Output is an io.Writer that observes the output of a build once, recording
+// the timing of each Dockerfile step, the images that were pushed and the last
+// lines of the log. All output is passed through to the underlying io.Writer,
+// and markers, streams and Close are passed through if it supports them.
+//
+// The Output is carried in the context.Context of the build, so that the
+// Builders that wrap each other can share it instead of each parsing every
+// line again. It also carries the Config that WithConfig loaded, so that
+// decorators don't have to fetch it again.
+type Output struct {
+	*observer
+
+	steps  *StepObserver
+	pushes *PushObserver
+	tail   *tailObserver
+
+	config *Config
+}
+
+// key used to store the Output in a context.Context.
+type outputKey struct{}
+
+// ObserveOutput returns the Output that's carried in ctx. If there isn't one,
+// a new Output that writes to w is returned, along with a context.Context that
+// carries it. The returned io.Writer should be passed to the wrapped Builder.
+func ObserveOutput(ctx context.Context, w io.Writer, opts BuildOptions) (context.Context, io.Writer, *Output) {
+	if o, ok := ctx.Value(outputKey{}).(*Output); ok {
+		return ctx, w, o
+	}
+
+	o := &Output{
+		steps:  &StepObserver{},
+		pushes: &PushObserver{repository: opts.ImageName(), current: -1},
+		tail:   &tailObserver{n: logTailLines},
+	}
+	o.observer = newObserver(w, o.observe)
+	return context.WithValue(ctx, outputKey{}, o), o, o
+}
+
+// Steps returns the steps that have been observed so far. See
+// StepObserver.Steps.
+func (o *Output) Steps() []Step {
+	return o.steps.Steps()
+}
+
+// Images returns the images that were pushed. See PushObserver.Images.
+func (o *Output) Images() []Image {
+	return o.pushes.Images()
+}
+
+// Tail returns the last lines of the output.
+func (o *Output) Tail() []string {
+	return o.tail.Lines()
+}
+
+// Config returns the Config that the build was configured with, or nil if
+// the repository doesn't have a ConfigFile, or the build wasn't wrapped with
+// WithConfig.
+func (o *Output) Config() *Config {
+	return o.config
+}
+
+// ReportImage implements the ImageReporter interface. The image is recorded,
+// then passed through to the underlying io.Writer.
+func (o *Output) ReportImage(image Image) error {
+	o.pushes.record(image)
+	return o.observer.ReportImage(image)
+}
+
+func (o *Output) observe(line string) {
+	o.steps.observe(line)
+	o.pushes.observe(line)
+	o.tail.observe(line)
+}
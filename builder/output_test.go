@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveOutput(t *testing.T) {
+	b := new(bytes.Buffer)
+	opts := BuildOptions{Repository: "remind101/acme-inc"}
+
+	ctx, w, o := ObserveOutput(context.Background(), b, opts)
+	assert.Equal(t, o, w)
+
+	// Builders that are wrapped share the same Output, and don't observe
+	// the output again.
+	inner := new(bytes.Buffer)
+	_, innerW, innerO := ObserveOutput(ctx, inner, opts)
+	assert.Equal(t, o, innerO)
+	assert.Equal(t, inner, innerW)
+
+	output := `Step 1/1 : FROM ubuntu:14.04
+ ---> Using cache
+Successfully built 1234
+The push refers to a repository [docker.io/remind101/acme-inc]
+master: digest: ` + testDigest + ` size: 1234
+`
+	io.WriteString(w, output)
+	assert.Equal(t, output, b.String())
+	assert.Equal(t, strings.Split(strings.TrimSuffix(output, "\n"), "\n"), o.Tail())
+
+	steps := o.Steps()
+	assert.Equal(t, 1, len(steps))
+	assert.True(t, steps[0].Cached)
+	assert.Equal(t, []Image{
+		{
+			Repository: "docker.io/remind101/acme-inc",
+			Digest:     testDigest,
+			Tags:       []string{"master"},
+		},
+	}, o.Images())
+
+	image := Image{Name: "worker", Repository: "remind101/acme-worker", Tags: []string{"abcd"}}
+	assert.NoError(t, ReportImage(w, image))
+	assert.Equal(t, image, o.Images()[1])
+}
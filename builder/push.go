@@ -0,0 +1,226 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	// Matches the line that `docker push` outputs before it starts pushing
+	// to a repository.
+	pushRepositoryRegexp = regexp.MustCompile(`^The push refers to a repository \[([^\]]+)\]`)
+
+	// Matches the line that `docker push` outputs once a tag has been
+	// pushed. Older versions of Docker don't include the tag.
+	pushDigestRegexp = regexp.MustCompile(`^(?:(\S+): )?[Dd]igest: (sha256:[0-9a-f]{64})`)
+)
+
+// defaultRegistry is the registry that docker uses for repositories that
+// don't include one.
+const defaultRegistry = "docker.io/"
+
+// Image describes an image that was pushed during a build.
+type Image struct {
+	// The name of the image, for builds that produce more than one image.
+	// This is empty for the image that's pushed to the repository named
+	// after the GitHub repository.
+	Name string
+	// The repository that the image was pushed to, as reported by `docker
+	// push`, e.g. `docker.io/remind101/acme-inc`.
+	Repository string
+	// The digest of the image, e.g. `sha256:6b558cade79544da...`.
+	Digest string
+	// The tags that were pushed.
+	Tags []string
+}
+
+// Ref returns a reference that can be used to pull the image. This is the
+// immutable digest reference if the digest is known.
+func (i Image) Ref() string {
+	repo := strings.TrimPrefix(i.Repository, defaultRegistry)
+	switch {
+	case i.Digest != "":
+		return fmt.Sprintf("%s@%s", repo, i.Digest)
+	case len(i.Tags) > 0:
+		return fmt.Sprintf("%s:%s", repo, i.Tags[0])
+	default:
+		return repo
+	}
+}
+
+// ImageReporter can be implemented by the io.Writer that's passed to a Builder,
+// to be told about the images that the build produced.
+type ImageReporter interface {
+	ReportImage(Image) error
+}
+
+// ReportImage reports an image that was produced by a build, if w implements
+// the ImageReporter interface. Builders that push images with `docker push`
+// don't need to call this, since the output is parsed to find the images.
+func ReportImage(w io.Writer, image Image) error {
+	if r, ok := w.(ImageReporter); ok {
+		return r.ReportImage(image)
+	}
+	return nil
+}
+
+// PushObserver is an io.Writer that parses the output of `docker push` to
+// record the images that were pushed, along with their digests and tags. All
+// output is passed through to the underlying io.Writer, and markers, streams
+// and Close are passed through if it supports them.
+//
+// Images pushed to the build's docker repository (usually named after the
+// GitHub repository) are unnamed. Images pushed to `<repository>-<name>` are
+// named `<name>`, and images pushed anywhere else are named after the
+// repository they were pushed to. Any `/` in a name is replaced with `.`, e.g.
+// `remind101.other`.
+type PushObserver struct {
+	*observer
+
+	// The docker repository that the build pushes to.
+	repository string
+
+	sync.Mutex
+	images  []Image
+	current int
+}
+
+// ObservePushes returns a new PushObserver that writes to w, for a build that
+// pushes to the given docker repository. See BuildOptions.ImageName.
+func ObservePushes(w io.Writer, repository string) *PushObserver {
+	o := &PushObserver{repository: repository, current: -1}
+	o.observer = newObserver(w, o.observe)
+	return o
+}
+
+// Images returns the images that were pushed, in the order that they were
+// first pushed.
+func (o *PushObserver) Images() []Image {
+	o.Lock()
+	defer o.Unlock()
+
+	images := make([]Image, len(o.images))
+	for i, image := range o.images {
+		image.Tags = append([]string(nil), image.Tags...)
+		images[i] = image
+	}
+	return images
+}
+
+// ReportImage implements the ImageReporter interface. The image is recorded,
+// then passed through to the underlying io.Writer.
+func (o *PushObserver) ReportImage(image Image) error {
+	o.record(image)
+	return o.observer.ReportImage(image)
+}
+
+// record records an image that was reported by the build.
+func (o *PushObserver) record(image Image) {
+	o.Lock()
+	defer o.Unlock()
+
+	i := o.image(image.Repository)
+	i.Name = escapeName(image.Name)
+	if image.Digest != "" {
+		i.Digest = image.Digest
+	}
+	for _, tag := range image.Tags {
+		if !contains(i.Tags, tag) {
+			i.Tags = append(i.Tags, tag)
+		}
+	}
+}
+
+func (o *PushObserver) observe(line string) {
+	o.Lock()
+	defer o.Unlock()
+
+	if m := pushRepositoryRegexp.FindStringSubmatch(line); m != nil {
+		o.image(m[1])
+		return
+	}
+
+	m := pushDigestRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+
+	// Older versions of Docker don't report the repository, in which case
+	// the image was pushed to the default repository.
+	if o.current < 0 {
+		o.image(strings.ToLower(o.repository))
+	}
+	i := &o.images[o.current]
+
+	// All tags that are pushed to a repository refer to the same image,
+	// so the first digest wins.
+	if i.Digest == "" {
+		i.Digest = m[2]
+	}
+
+	if tag := m[1]; tag != "" && !contains(i.Tags, tag) {
+		i.Tags = append(i.Tags, tag)
+	}
+}
+
+// image returns the image that was pushed to the repository, adding it if it
+// hasn't been seen yet, and makes it the current image.
+func (o *PushObserver) image(repository string) *Image {
+	for i := range o.images {
+		if o.images[i].Repository == repository {
+			o.current = i
+			return &o.images[i]
+		}
+	}
+
+	o.images = append(o.images, Image{
+		Name:       imageName(o.repository, repository),
+		Repository: repository,
+	})
+	o.current = len(o.images) - 1
+	return &o.images[o.current]
+}
+
+// imageName returns the name of an image that was pushed to the pushed
+// repository, during a build that pushes to the given docker repository.
+func imageName(repository, pushed string) string {
+	path := repositoryPath(pushed)
+
+	repository = strings.ToLower(repositoryPath(repository))
+	switch {
+	case path == repository:
+		return ""
+	case strings.HasPrefix(path, repository+"-"):
+		return escapeName(strings.TrimPrefix(path, repository+"-"))
+	default:
+		return escapeName(path)
+	}
+}
+
+// escapeName replaces the `/` in the name of an image with `.`, so that the
+// name can be used as a single path segment, e.g. in
+// `/artifacts/{owner}/{repo}@{sha}/{name}`.
+func escapeName(name string) string {
+	return strings.Replace(name, "/", ".", -1)
+}
+
+// repositoryPath returns the path of a docker repository, without the
+// registry.
+func repositoryPath(repository string) string {
+	if parts := strings.SplitN(repository, "/", 2); len(parts) == 2 && strings.ContainsAny(parts[0], ".:") {
+		return parts[1]
+	}
+	return repository
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package builder
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDigest = "sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d"
+
+func TestPushObserver(t *testing.T) {
+	b := new(bytes.Buffer)
+	o := ObservePushes(b, "remind101/acme-inc")
+
+	output := `The push refers to a repository [docker.io/remind101/acme-inc]
+5f70bf18a086: Pushed
+abcd: digest: ` + testDigest + ` size: 1234
+5f70bf18a086: Layer already exists
+master: digest: ` + testDigest + ` size: 1234
+latest: digest: ` + testDigest + ` size: 1234
+`
+	io.WriteString(o, output)
+	assert.Equal(t, output, b.String())
+
+	assert.Equal(t, []Image{
+		{
+			Repository: "docker.io/remind101/acme-inc",
+			Digest:     testDigest,
+			Tags:       []string{"abcd", "master", "latest"},
+		},
+	}, o.Images())
+}
+
+func TestPushObserver_MultipleImages(t *testing.T) {
+	o := ObservePushes(new(bytes.Buffer), "remind101/acme-inc")
+
+	io.WriteString(o, `The push refers to a repository [docker.io/remind101/acme-inc]
+abcd: digest: `+testDigest+` size: 1234
+The push refers to a repository [quay.io/remind101/acme-inc-migrations]
+abcd: digest: sha256:1111111111111111111111111111111111111111111111111111111111111111 size: 1234
+The push refers to a repository [docker.io/remind101/acme-inc]
+latest: digest: `+testDigest+` size: 1234
+`)
+
+	images := o.Images()
+	assert.Equal(t, 2, len(images))
+	assert.Equal(t, "", images[0].Name)
+	assert.Equal(t, []string{"abcd", "latest"}, images[0].Tags)
+	assert.Equal(t, "remind101/acme-inc@"+testDigest, images[0].Ref())
+	assert.Equal(t, "migrations", images[1].Name)
+	assert.Equal(t, "quay.io/remind101/acme-inc-migrations@sha256:1111111111111111111111111111111111111111111111111111111111111111", images[1].Ref())
+}
+
+func TestPushObserver_ReportImage(t *testing.T) {
+	outer := ObservePushes(new(bytes.Buffer), "remind101/acme-inc")
+	inner := ObserveSteps(outer)
+
+	image := Image{Name: "worker", Repository: "remind101/acme-worker", Tags: []string{"abcd"}}
+	assert.NoError(t, ReportImage(inner, image))
+
+	assert.Equal(t, []Image{image}, outer.Images())
+}
+
+func TestPushObserver_NoPush(t *testing.T) {
+	o := ObservePushes(new(bytes.Buffer), "remind101/acme-inc")
+	io.WriteString(o, "Step 1/1 : FROM ubuntu:14.04\n")
+	assert.Equal(t, []Image{}, o.Images())
+}
+
+func TestImageName(t *testing.T) {
+	tests := []struct {
+		repository, pushed string
+		name               string
+	}{
+		{"remind101/acme-inc", "docker.io/remind101/acme-inc", ""},
+		{"remind101/Acme-Inc", "remind101/acme-inc", ""},
+		{"remind101/acme-inc", "localhost:5000/remind101/acme-inc-worker", "worker"},
+		{"remind101/acme-inc", "docker.io/remind101/other", "remind101.other"},
+		{"remind101/acme-inc", "quay.io/remind101/acme-inc-tools/migrations", "tools.migrations"},
+		{"quay.io/remind101/acme", "quay.io/remind101/acme-worker", "worker"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.name, imageName(tt.repository, tt.pushed))
+	}
+}
@@ -0,0 +1,125 @@
+package builder
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// now returns the current time. It's a variable so we can stub it out in
+// tests.
+var now = time.Now
+
+var (
+	// Matches the line that `docker build` outputs when it starts running
+	// an instruction from the Dockerfile. Older versions of Docker don't
+	// include the total number of steps.
+	stepRegexp = regexp.MustCompile(`^Step (\d+)(?:/(\d+))? : (.*)$`)
+
+	// Matches the line that `docker build` outputs when an instruction was
+	// satisfied by the layer cache.
+	cacheRegexp = regexp.MustCompile(`^ ?---> Using cache\s*$`)
+
+	// Matches the line that `docker build` outputs when the image was
+	// built, which marks the end of the last step.
+	builtRegexp = regexp.MustCompile(`^Successfully built `)
+)
+
+// Step represents an instruction from a Dockerfile that was run as part of a
+// build.
+type Step struct {
+	// The position of this step in the Dockerfile, starting at 1.
+	Number int
+	// The total number of steps in the Dockerfile. This will be 0 if the
+	// version of Docker doesn't report it.
+	Total int
+	// The instruction, e.g. `RUN make`.
+	Instruction string
+	// True if the layer for this step was found in the layer cache.
+	Cached bool
+	// The time that the step started.
+	StartedAt time.Time
+	// How long the step took to run.
+	Duration time.Duration
+}
+
+// StepObserver is an io.Writer that parses the output of `docker build` to
+// record the timing of each step in the Dockerfile. All output is passed
+// through to the underlying io.Writer, and markers, streams and Close are
+// passed through if it supports them.
+type StepObserver struct {
+	*observer
+
+	sync.Mutex
+	steps   []Step
+	running bool
+}
+
+// ObserveSteps returns a new StepObserver that writes to w.
+func ObserveSteps(w io.Writer) *StepObserver {
+	o := &StepObserver{}
+	o.observer = newObserver(w, o.observe)
+	return o
+}
+
+// Steps returns the steps that have been observed so far. If a step is still
+// running, its duration will be the time elapsed since it started.
+func (o *StepObserver) Steps() []Step {
+	o.Lock()
+	defer o.Unlock()
+
+	steps := make([]Step, len(o.steps))
+	copy(steps, o.steps)
+	if o.running {
+		s := &steps[len(steps)-1]
+		s.Duration = now().Sub(s.StartedAt)
+	}
+	return steps
+}
+
+func (o *StepObserver) observe(line string) {
+	o.Lock()
+	defer o.Unlock()
+
+	t := now()
+
+	if m := stepRegexp.FindStringSubmatch(line); m != nil {
+		o.finish(t)
+
+		number, _ := strconv.Atoi(m[1])
+		total, _ := strconv.Atoi(m[2])
+		o.steps = append(o.steps, Step{
+			Number:      number,
+			Total:       total,
+			Instruction: m[3],
+			StartedAt:   t,
+		})
+		o.running = true
+		return
+	}
+
+	if !o.running {
+		return
+	}
+
+	switch {
+	case cacheRegexp.MatchString(line):
+		o.steps[len(o.steps)-1].Cached = true
+	case builtRegexp.MatchString(line):
+		o.finish(t)
+	}
+}
+
+// finish records the duration of the currently running step, which finished
+// at t.
+func (o *StepObserver) finish(t time.Time) {
+	if !o.running {
+		return
+	}
+
+	s := &o.steps[len(o.steps)-1]
+	s.Duration = t.Sub(s.StartedAt)
+	o.running = false
+}
@@ -0,0 +1,90 @@
+package builder
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remind101/conveyor/logs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepObserver(t *testing.T) {
+	clock := stubNow()
+	defer func() { now = time.Now }()
+
+	b := new(bytes.Buffer)
+	o := ObserveSteps(b)
+
+	// Each chunk of output is written 1 second after the last.
+	output := []string{
+		"Step 1/3 : FROM ubuntu:14.04\n ---> 91e54dfb1179\n",
+		"Step 2/3 : RUN apt-get update\n ---> Using cache\n ---> 1f4e1a2ce9a1\n",
+		"Step 3/3 : ADD . /app\n ---> 5a0ec7ac4bd1\nRemoving intermediate container 81d4d2c6b0c4\n",
+		"Successfully built 5a0ec7ac4bd1\n",
+	}
+	for _, chunk := range output {
+		_, err := io.WriteString(o, chunk)
+		assert.NoError(t, err)
+		clock.Add(time.Second)
+	}
+	assert.Equal(t, strings.Join(output, ""), b.String())
+
+	steps := o.Steps()
+	assert.Equal(t, 3, len(steps))
+	assert.Equal(t, Step{Number: 1, Total: 3, Instruction: "FROM ubuntu:14.04", StartedAt: time.Unix(0, 0), Duration: time.Second}, steps[0])
+	assert.Equal(t, Step{Number: 2, Total: 3, Instruction: "RUN apt-get update", Cached: true, StartedAt: time.Unix(1, 0), Duration: time.Second}, steps[1])
+	assert.Equal(t, Step{Number: 3, Total: 3, Instruction: "ADD . /app", StartedAt: time.Unix(2, 0), Duration: time.Second}, steps[2])
+}
+
+func TestStepObserver_Running(t *testing.T) {
+	clock := stubNow()
+	defer func() { now = time.Now }()
+
+	o := ObserveSteps(new(bytes.Buffer))
+	io.WriteString(o, "Step 1/1 : RUN make\n")
+	clock.Add(5 * time.Second)
+
+	steps := o.Steps()
+	assert.Equal(t, 1, len(steps))
+	assert.Equal(t, 5*time.Second, steps[0].Duration)
+}
+
+func TestStepObserver_Streams(t *testing.T) {
+	stubNow()
+	defer func() { now = time.Now }()
+
+	raw, structured := new(bytes.Buffer), new(bytes.Buffer)
+	w := logs.NewStructuredWriter(raw, structured)
+	o := ObserveSteps(w)
+
+	io.WriteString(logs.Stream(o, logs.StreamStdout), "Step 1 : FROM ubuntu:14.04\n")
+	io.WriteString(logs.Stream(o, logs.StreamStderr), "warning\n")
+	assert.NoError(t, logs.Mark(o, logs.PhasePush, "Pushing"))
+	assert.NoError(t, o.Close())
+
+	steps := o.Steps()
+	assert.Equal(t, 1, len(steps))
+	assert.Equal(t, 0, steps[0].Total)
+	assert.Equal(t, "Step 1 : FROM ubuntu:14.04\nwarning\n", raw.String())
+	assert.Contains(t, structured.String(), `"stream":"stderr","text":"warning"`)
+	assert.Contains(t, structured.String(), `"phase":"push","text":"Pushing"`)
+}
+
+// fakeClock is a clock that only moves forward when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// stubNow stubs out now with a fakeClock starting at the unix epoch.
+func stubNow() *fakeClock {
+	c := &fakeClock{t: time.Unix(0, 0)}
+	now = func() time.Time { return c.t }
+	return c
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -18,6 +19,38 @@ import (
 // This is also enforced at the db level with the `unique_build` constraint.
 var ErrDuplicateBuild = errors.New("a build for this sha is already pending or building")
 
+// ErrBuildCanceled is returned when starting a build that was canceled while it
+// was pending.
+var ErrBuildCanceled = errors.New("build was canceled")
+
+// ErrBuildFinished is returned when canceling a build that isn't pending or
+// building.
+var ErrBuildFinished = errors.New("build has already finished")
+
+// TagError is returned when building a git tag that isn't a valid docker tag,
+// e.g. `release/1.0`.
+type TagError struct {
+	Tag string
+}
+
+// Error implements the error interface.
+func (e *TagError) Error() string {
+	return fmt.Sprintf("tag %s can't be built: it isn't a valid docker tag", e.Tag)
+}
+
+// dockerTag matches the tags that docker allows.
+var dockerTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// CheckTag returns a TagError if a git tag can't be built. The image for a
+// build of a tag is tagged with it, and its artifacts are looked up by it (see
+// FindArtifact), so it has to be a valid docker tag.
+func CheckTag(tag string) error {
+	if !dockerTag.MatchString(tag) {
+		return &TagError{Tag: tag}
+	}
+	return nil
+}
+
 // The database constraint that counts as an ErrDuplicateBuild.
 const uniqueBuildConstraint = "unique_build"
 
@@ -31,6 +64,8 @@ type Build struct {
 	Repository string `db:"repository"`
 	// The branch that this build relates to.
 	Branch string `db:"branch"`
+	// The git tag that this build relates to, if it was triggered by a tag.
+	Tag string `db:"tag"`
 	// The sha that this build relates to.
 	Sha string `db:"sha"`
 	// The current state of the build.
@@ -41,6 +76,28 @@ type Build struct {
 	StartedAt *time.Time `db:"started_at"`
 	// The time that the build was completed.
 	CompletedAt *time.Time `db:"completed_at"`
+	// True if the output of the build exceeded the maximum log size and
+	// was truncated.
+	LogsTruncated bool `db:"logs_truncated"`
+	// The encoding that the logs for this build are stored with.
+	LogEncoding string `db:"log_encoding"`
+	// True if the logs for this build were removed by garbage collection.
+	LogsDeleted bool `db:"logs_deleted"`
+	// The directives, given in the commit message, that configured this
+	// build.
+	Directives DirectiveList `db:"directives"`
+	// The number of the pull request that this build relates to, if it
+	// was triggered by a pull request.
+	PullRequest *int `db:"pull_request"`
+	// The ID of the GitHub check run for this build, once it's been
+	// created.
+	CheckRunID *int64 `db:"check_run_id"`
+	// The ID of the GitHub App installation that has access to the
+	// repository.
+	InstallationID int64 `db:"installation_id"`
+	// How long the build can run, from the repository registry, or 0 for
+	// the worker's default.
+	Timeout time.Duration `db:"timeout"`
 }
 
 type BuildState int
@@ -50,6 +107,7 @@ const (
 	StateBuilding
 	StateFailed
 	StateSucceeded
+	StateCanceled
 )
 
 func (s BuildState) String() string {
@@ -62,8 +120,10 @@ func (s BuildState) String() string {
 		return "failed"
 	case StateSucceeded:
 		return "succeeded"
+	case StateCanceled:
+		return "canceled"
 	default:
-		panic(fmt.Sprintf("unknown build state: %s", string(s)))
+		panic(fmt.Sprintf("unknown build state: %d", int(s)))
 	}
 }
 
@@ -79,6 +139,8 @@ func (s *BuildState) Scan(src interface{}) error {
 			*s = StateFailed
 		case "succeeded":
 			*s = StateSucceeded
+		case "canceled":
+			*s = StateCanceled
 		default:
 			return fmt.Errorf("unknown build state: %v", string(v))
 		}
@@ -94,7 +156,7 @@ func (s BuildState) Value() (driver.Value, error) {
 
 // buildsCreate inserts a new build into the database.
 func buildsCreate(tx *sqlx.Tx, b *Build) error {
-	const createBuildSql = `INSERT INTO builds (repository, branch, sha, state) VALUES (:repository, :branch, :sha, :state) RETURNING id`
+	const createBuildSql = `INSERT INTO builds (repository, branch, tag, sha, pull_request, installation_id, state, log_encoding, directives, timeout) VALUES (:repository, :branch, :tag, :sha, :pull_request, :installation_id, :state, :log_encoding, :directives, :timeout) RETURNING id`
 	err := insert(tx, createBuildSql, b, &b.ID)
 	if err, ok := err.(*pq.Error); ok {
 		if err.Constraint == uniqueBuildConstraint {
@@ -125,18 +187,127 @@ LIMIT 1`
 	return &b, err
 }
 
-// buildsUpdateState changes the state of a build.
-func buildsUpdateState(tx *sqlx.Tx, buildID string, state BuildState) error {
+// buildsUpdateState changes the state of a build, and returns whether it was
+// changed. Builds that were canceled stay canceled, and only builds that are
+// building can succeed or fail, so that a build that was canceled, or failed
+// because it was stale, isn't completed later.
+func buildsUpdateState(tx *sqlx.Tx, buildID string, state BuildState) (bool, error) {
 	var sql string
 	switch state {
 	case StateBuilding:
-		sql = `UPDATE builds SET state = ?, started_at = ? WHERE id = ?`
+		sql = `UPDATE builds SET state = ?, started_at = ? WHERE id = ? AND state != 'canceled'`
 	case StateSucceeded, StateFailed:
-		sql = `UPDATE builds SET state = ?, completed_at = ? WHERE id = ?`
+		sql = `UPDATE builds SET state = ?, completed_at = ? WHERE id = ? AND state = 'building'`
 	default:
 		panic(fmt.Sprintf("not implemented for %s", state))
 	}
 
-	_, err := tx.Exec(tx.Rebind(sql), state, time.Now(), buildID)
+	res, err := tx.Exec(tx.Rebind(sql), state, time.Now(), buildID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if state == StateBuilding && n == 0 {
+		return false, ErrBuildCanceled
+	}
+
+	return n > 0, nil
+}
+
+// buildsCancelPullRequest cancels the pending and building builds for a pull
+// request, and returns them.
+func buildsCancelPullRequest(tx *sqlx.Tx, repository string, number int) ([]*Build, error) {
+	const sql = `UPDATE builds SET state = 'canceled', completed_at = ?
+WHERE repository = ?
+AND pull_request = ?
+AND state IN ('pending', 'building')
+RETURNING *`
+	var builds []*Build
+	err := tx.Select(&builds, tx.Rebind(sql), time.Now(), repository, number)
+	return builds, err
+}
+
+// buildsAttachPullRequest sets the pull request of the pending or building
+// build of a commit on a branch, if it doesn't have one, and returns it.
+func buildsAttachPullRequest(tx *sqlx.Tx, repository, sha, branch string, number int) (*Build, error) {
+	const sql = `UPDATE builds SET pull_request = ?
+WHERE repository = ?
+AND sha = ?
+AND branch = ?
+AND tag = ''
+AND pull_request IS NULL
+AND state IN ('pending', 'building')
+RETURNING *`
+	var b Build
+	err := tx.Get(&b, tx.Rebind(sql), number, repository, sha, branch)
+	return &b, err
+}
+
+// buildsCancelSha cancels the pending and building builds for a commit, and
+// returns them.
+func buildsCancelSha(tx *sqlx.Tx, repository, sha string) ([]*Build, error) {
+	const sql = `UPDATE builds SET state = 'canceled', completed_at = ?
+WHERE repository = ?
+AND sha = ?
+AND state IN ('pending', 'building')
+RETURNING *`
+	var builds []*Build
+	err := tx.Select(&builds, tx.Rebind(sql), time.Now(), repository, sha)
+	return builds, err
+}
+
+// buildsCancelByID cancels a build if it's pending or building, and returns
+// it.
+func buildsCancelByID(tx *sqlx.Tx, buildID string) (*Build, error) {
+	const sql = `UPDATE builds SET state = 'canceled', completed_at = ?
+WHERE id = ?
+AND state IN ('pending', 'building')
+RETURNING *`
+	var b Build
+	err := tx.Get(&b, tx.Rebind(sql), time.Now(), buildID)
+	return &b, err
+}
+
+// buildsFailStale fails the builds that have been building for longer than
+// twice their timeout, or twice defaultTimeout if they don't have one, and
+// returns them.
+func buildsFailStale(tx *sqlx.Tx, defaultTimeout time.Duration) ([]*Build, error) {
+	const sql = `UPDATE builds SET state = 'failed', completed_at = ?
+WHERE state = 'building'
+AND started_at + 2 * (CASE WHEN timeout > 0 THEN timeout ELSE ? END) / 1000 * interval '1 microsecond' < ?
+RETURNING *`
+	t := time.Now()
+	var builds []*Build
+	err := tx.Select(&builds, tx.Rebind(sql), t, int64(defaultTimeout), t)
+	return builds, err
+}
+
+// buildsFindByPullRequest finds the builds for a pull request, newest first.
+func buildsFindByPullRequest(tx *sqlx.Tx, repository string, number int) ([]*Build, error) {
+	const sql = `SELECT * FROM builds
+WHERE repository = ?
+AND pull_request = ?
+ORDER BY seq desc`
+	var builds []*Build
+	err := tx.Select(&builds, tx.Rebind(sql), repository, number)
+	return builds, err
+}
+
+// buildsUpdateCheckRunID sets the ID of the GitHub check run for a build.
+func buildsUpdateCheckRunID(tx *sqlx.Tx, buildID string, checkRunID int64) error {
+	const sql = `UPDATE builds SET check_run_id = ? WHERE id = ?`
+	_, err := tx.Exec(tx.Rebind(sql), checkRunID, buildID)
+	return err
+}
+
+// buildsUpdateLogsTruncated marks the logs for a build as truncated.
+func buildsUpdateLogsTruncated(tx *sqlx.Tx, buildID string) error {
+	const sql = `UPDATE builds SET logs_truncated = true WHERE id = ?`
+	_, err := tx.Exec(tx.Rebind(sql), buildID)
 	return err
 }
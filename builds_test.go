@@ -0,0 +1,31 @@
+package conveyor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTag(t *testing.T) {
+	tests := []struct {
+		tag string
+		ok  bool
+	}{
+		{"v1.4.2", true},
+		{"1.0", true},
+		{"release_1.0-rc1", true},
+		{"release/1.0", false},
+		{".hidden", false},
+		{"-rc1", false},
+		{"v1+build", false},
+	}
+
+	for _, tt := range tests {
+		err := CheckTag(tt.tag)
+		if tt.ok {
+			assert.NoError(t, err, tt.tag)
+		} else {
+			assert.Equal(t, &TagError{Tag: tt.tag}, err, tt.tag)
+		}
+	}
+}
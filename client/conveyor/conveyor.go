@@ -3,11 +3,10 @@
 // To be able to interact with this API, you have to
 // create a new service:
 //
-//     s := conveyor.NewService(nil)
+//	s := conveyor.NewService(nil)
 //
 // The Service struct has all the methods you need
 // to interact with conveyor API.
-//
 package conveyor
 
 import (
@@ -210,8 +209,15 @@ type Artifact struct {
 	Build struct {
 		ID string `json:"id" url:"id,key"` // unique identifier of build
 	} `json:"build" url:"build,key"`
+	Digest string `json:"digest" url:"digest,key"` // the digest of the Docker image that was pushed, or an empty string if
+	// it's unknown
 	ID    string `json:"id" url:"id,key"`       // unique identifier of artifact
-	Image string `json:"image" url:"image,key"` // the name of the Docker image. This can be pulled with `docker pull`
+	Image string `json:"image" url:"image,key"` // the name of the Docker image. This can be pulled with `docker pull`.
+	// When the digest of the image is known, this is an immutable reference
+	// to the image by its digest
+	Name string `json:"name" url:"name,key"` // the name of the image, for builds that produce more than one image.
+	// This is empty for the primary image
+	Tags []string `json:"tags" url:"tags,key"` // the tags that were pushed for the Docker image
 }
 
 func (s *Service) ArtifactInfo(artifactIdentity string) (*Artifact, error) {
@@ -223,28 +229,44 @@ func (s *Service) ArtifactInfo(artifactIdentity string) (*Artifact, error) {
 type Build struct {
 	Branch string `json:"branch" url:"branch,key"` // the branch within the GitHub repository that the build was triggered
 	// from
-	CompletedAt *time.Time `json:"completed_at" url:"completed_at,key"` // when the build moved to the `"succeeded"` or `"failed"` state
-	CreatedAt   time.Time  `json:"created_at" url:"created_at,key"`     // when the build was created
-	ID          string     `json:"id" url:"id,key"`                     // unique identifier of build
-	Repository  string     `json:"repository" url:"repository,key"`     // the GitHub repository that this build is for
-	Sha         string     `json:"sha" url:"sha,key"`                   // the git commit to build
-	StartedAt   *time.Time `json:"started_at" url:"started_at,key"`     // when the build moved to the `"building"` state
-	State       string     `json:"state" url:"state,key"`               // the current state of the build
+	CompletedAt *time.Time `json:"completed_at" url:"completed_at,key"` // when the build moved to the `"succeeded"`, `"failed"` or
+	// `"canceled"` state
+	CreatedAt     time.Time `json:"created_at" url:"created_at,key"`         // when the build was created
+	Directives    []string  `json:"directives" url:"directives,key"`         // the directives that configured the build, e.g. `docker nocache`
+	ID            string    `json:"id" url:"id,key"`                         // unique identifier of build
+	LogsTruncated bool      `json:"logs_truncated" url:"logs_truncated,key"` // true if the build output exceeded the maximum log size and was
+	// truncated
+	PullRequest *int `json:"pull_request" url:"pull_request,key"` // the number of the pull request that the build was triggered from, if
+	// any
+	Repository string     `json:"repository" url:"repository,key"` // the GitHub repository that this build is for
+	Sha        string     `json:"sha" url:"sha,key"`               // the git commit to build
+	StartedAt  *time.Time `json:"started_at" url:"started_at,key"` // when the build moved to the `"building"` state
+	State      string     `json:"state" url:"state,key"`           // the current state of the build
+	Tag        string     `json:"tag" url:"tag,key"`               // the git tag that the build was triggered from, if any
 }
 type BuildCreateOpts struct {
 	Branch *string `json:"branch,omitempty" url:"branch,omitempty,key"` // the branch within the GitHub repository that the build was triggered
 	// from
+	Message *string `json:"message,omitempty" url:"message,omitempty,key"` // a commit message, or any other text, to parse directives like
+	// `[docker nocache]` from
+	Ref *string `json:"ref,omitempty" url:"ref,omitempty,key"` // a branch, tag, abbreviated or full sha, or pull request ref (e.g.
+	// `pull/123/head`) to build
 	Repository string  `json:"repository" url:"repository,key"`       // the GitHub repository that this build is for
 	Sha        *string `json:"sha,omitempty" url:"sha,omitempty,key"` // the git commit to build
+	Tag        *string `json:"tag,omitempty" url:"tag,omitempty,key"` // the git tag that the build was triggered from, if any
 }
 
 // Create a new build and start it. Note that you cannot start a new
 // build for a sha that is already in a "pending" or "building" state.
 // You should cancel the existing build first, or wait for it to
-// complete. You must specify either a `branch` OR a `sha`. If you
-// provide a `branch` but no `sha`, Conveyor will use the GitHub API to
-// resolve the HEAD commit on that branch to a sha. If you provide a
-// `sha` but no `branch`, branch caching will be disabled.
+// complete. You must specify either a `branch`, a `tag`, a `ref` OR a
+// `sha`. If you provide a `branch` but no `sha`, Conveyor will use the
+// GitHub API to resolve the HEAD commit on that branch to a sha.
+// Likewise, a `tag` is resolved to the commit it points to. A `ref` can
+// be a branch, tag, abbreviated sha or pull request ref (e.g.
+// `pull/123/head`), and the branch, tag or pull request that it refers
+// to is set on the build. If you provide a `sha` but no `branch`, branch
+// caching will be disabled.
 func (s *Service) BuildCreate(o BuildCreateOpts) (*Build, error) {
 	var build Build
 	return &build, s.Post(&build, fmt.Sprintf("/builds"), o)
@@ -256,9 +278,216 @@ func (s *Service) BuildInfo(buildIdentity string) (*Build, error) {
 	return &build, s.Get(&build, fmt.Sprintf("/builds/%v", buildIdentity), nil, nil)
 }
 
+// List the builds for a pull request, newest first.
+func (s *Service) BuildPullRequestList(buildRepository string, buildPullRequest int, lr *ListRange) ([]Build, error) {
+	var build []Build
+	return build, s.Get(&build, fmt.Sprintf("/builds/%v/pulls/%v", buildRepository, buildPullRequest), nil, lr)
+}
+
 // Defines the format that errors are returned in
 type Error struct {
 	ID      string `json:"id" url:"id,key"`           // unique identifier of error
 	Message string `json:"message" url:"message,key"` // human readable message
 }
 
+// A repository is a GitHub repository in the registry, which controls
+// whether, and how, it's built.
+type Repository struct {
+	BuilderImage string `json:"builder_image" url:"builder_image,key"` // the docker image that builds are run with, or an empty string to use
+	// the default
+	Concurrency int `json:"concurrency" url:"concurrency,key"` // the maximum number of builds that can be queued or running at once, or
+	// 0 for no limit. Further builds are held in the `"pending"` state until
+	// one completes
+	CreatedAt     time.Time `json:"created_at" url:"created_at,key"`         // when the repository was registered
+	DefaultBranch string    `json:"default_branch" url:"default_branch,key"` // the branch that's built when a build is created without a `branch`,
+	// `tag`, `ref` or `sha`
+	Enabled bool   `json:"enabled" url:"enabled,key"` // when false, builds of the repository are denied
+	ID      string `json:"id" url:"id,key"`           // unique identifier of repository
+	Image   string `json:"image" url:"image,key"`     // the docker repository that images are pushed to, or an empty string to
+	// push to the repository named after the GitHub repository
+	Name   string `json:"name" url:"name,key"`     // the full name of the GitHub repository
+	Paused bool   `json:"paused" url:"paused,key"` // when true, new builds are held in the `"pending"` state until the
+	// repository is unpaused
+	Timeout int `json:"timeout" url:"timeout,key"` // how long builds can run before they're canceled, in seconds, or 0 to
+	// use the default
+	UpdatedAt time.Time `json:"updated_at" url:"updated_at,key"` // when the repository was last updated
+}
+type RepositoryCreateOpts struct {
+	BuilderImage *string `json:"builder_image,omitempty" url:"builder_image,omitempty,key"` // the docker image that builds are run with, or an empty string to use
+	// the default
+	Concurrency *int `json:"concurrency,omitempty" url:"concurrency,omitempty,key"` // the maximum number of builds that can be queued or running at once, or
+	// 0 for no limit. Further builds are held in the `"pending"` state until
+	// one completes
+	DefaultBranch *string `json:"default_branch,omitempty" url:"default_branch,omitempty,key"` // the branch that's built when a build is created without a `branch`,
+	// `tag`, `ref` or `sha`
+	Enabled *bool   `json:"enabled,omitempty" url:"enabled,omitempty,key"` // when false, builds of the repository are denied
+	Image   *string `json:"image,omitempty" url:"image,omitempty,key"`     // the docker repository that images are pushed to, or an empty string to
+	// push to the repository named after the GitHub repository
+	Name   string `json:"name" url:"name,key"`                         // the full name of the GitHub repository
+	Paused *bool  `json:"paused,omitempty" url:"paused,omitempty,key"` // when true, new builds are held in the `"pending"` state until the
+	// repository is unpaused
+	Timeout *int `json:"timeout,omitempty" url:"timeout,omitempty,key"` // how long builds can run before they're canceled, in seconds, or 0 to
+	// use the default
+}
+
+// Register a repository. Builds of repositories that aren't registered
+// use the defaults.
+func (s *Service) RepositoryCreate(o RepositoryCreateOpts) (*Repository, error) {
+	var repository Repository
+	return &repository, s.Post(&repository, fmt.Sprintf("/repositories"), o)
+}
+
+// Remove a repository from the registry, so that it's built with the
+// defaults. Builds that were held are released.
+func (s *Service) RepositoryDelete(repositoryIdentity string) (*Repository, error) {
+	var repository Repository
+	return &repository, s.Delete(&repository, fmt.Sprintf("/repositories/%v", repositoryIdentity))
+}
+
+// Info for existing repository.
+func (s *Service) RepositoryInfo(repositoryIdentity string) (*Repository, error) {
+	var repository Repository
+	return &repository, s.Get(&repository, fmt.Sprintf("/repositories/%v", repositoryIdentity), nil, nil)
+}
+
+// List the registered repositories.
+func (s *Service) RepositoryList(lr *ListRange) ([]Repository, error) {
+	var repository []Repository
+	return repository, s.Get(&repository, fmt.Sprintf("/repositories"), nil, lr)
+}
+
+type RepositoryUpdateOpts struct {
+	BuilderImage *string `json:"builder_image,omitempty" url:"builder_image,omitempty,key"` // the docker image that builds are run with, or an empty string to use
+	// the default
+	Concurrency *int `json:"concurrency,omitempty" url:"concurrency,omitempty,key"` // the maximum number of builds that can be queued or running at once, or
+	// 0 for no limit. Further builds are held in the `"pending"` state until
+	// one completes
+	DefaultBranch *string `json:"default_branch,omitempty" url:"default_branch,omitempty,key"` // the branch that's built when a build is created without a `branch`,
+	// `tag`, `ref` or `sha`
+	Enabled *bool   `json:"enabled,omitempty" url:"enabled,omitempty,key"` // when false, builds of the repository are denied
+	Image   *string `json:"image,omitempty" url:"image,omitempty,key"`     // the docker repository that images are pushed to, or an empty string to
+	// push to the repository named after the GitHub repository
+	Paused *bool `json:"paused,omitempty" url:"paused,omitempty,key"` // when true, new builds are held in the `"pending"` state until the
+	// repository is unpaused
+	Timeout *int `json:"timeout,omitempty" url:"timeout,omitempty,key"` // how long builds can run before they're canceled, in seconds, or 0 to
+	// use the default
+}
+
+// Update an existing repository. Unpausing it, or raising its
+// concurrency, releases builds that were held.
+func (s *Service) RepositoryUpdate(repositoryIdentity string, o RepositoryUpdateOpts) (*Repository, error) {
+	var repository Repository
+	return &repository, s.Patch(&repository, fmt.Sprintf("/repositories/%v", repositoryIdentity), o)
+}
+
+// A status update is a queued update to a GitHub commit status or check
+// run, which hasn't been applied yet.
+type StatusUpdate struct {
+	Attempts int `json:"attempts" url:"attempts,key"` // the number of times that applying the update has failed
+	Build    *struct {
+		ID string `json:"id" url:"id,key"` // unique identifier of build
+	} `json:"build" url:"build,key"`
+	CreatedAt     time.Time `json:"created_at" url:"created_at,key"`           // when the update was queued
+	ID            string    `json:"id" url:"id,key"`                           // unique identifier of status update
+	Kind          string    `json:"kind" url:"kind,key"`                       // the kind of update
+	LastError     string    `json:"last_error" url:"last_error,key"`           // the error from the last attempt, or an empty string
+	NextAttemptAt time.Time `json:"next_attempt_at" url:"next_attempt_at,key"` // when the update will next be tried
+	Repository    string    `json:"repository" url:"repository,key"`           // the repository of the commit to update
+	Sha           string    `json:"sha" url:"sha,key"`                         // the sha of the commit to update
+}
+
+// List the status updates that haven't been applied yet, oldest first.
+func (s *Service) StatusUpdateList(lr *ListRange) ([]StatusUpdate, error) {
+	var statusUpdate []StatusUpdate
+	return statusUpdate, s.Get(&statusUpdate, fmt.Sprintf("/status_updates"), nil, lr)
+}
+
+// A step is an instruction from a Dockerfile that was run as part of a
+// build.
+type Step struct {
+	Build struct {
+		ID string `json:"id" url:"id,key"` // unique identifier of build
+	} `json:"build" url:"build,key"`
+	Cached      bool      `json:"cached" url:"cached,key"`           // whether the step was satisfied by the layer cache
+	Duration    float64   `json:"duration" url:"duration,key"`       // how long the step took to run, in seconds
+	ID          string    `json:"id" url:"id,key"`                   // unique identifier of step
+	Instruction string    `json:"instruction" url:"instruction,key"` // the Dockerfile instruction that was run
+	Number      int       `json:"number" url:"number,key"`           // the position of the step in the Dockerfile, starting at 1
+	StartedAt   time.Time `json:"started_at" url:"started_at,key"`   // when the step started
+	Total       int       `json:"total" url:"total,key"`             // the total number of steps in the Dockerfile, or 0 if unknown
+}
+
+// List the steps that were run for a build.
+func (s *Service) StepList(buildIdentity string, lr *ListRange) ([]Step, error) {
+	var step []Step
+	return step, s.Get(&step, fmt.Sprintf("/builds/%v/steps", buildIdentity), nil, lr)
+}
+
+// A webhook is a GitHub webhook that delivers the events of a
+// repository to Conveyor.
+type Webhook struct {
+	Created bool     `json:"created" url:"created,key"` // true if the webhook was created, false if an existing webhook was
+	// updated
+	Events []string `json:"events" url:"events,key"` // the events that the webhook is subscribed to
+	ID     int      `json:"id" url:"id,key"`         // the id of the webhook in GitHub
+	Ping   struct {
+		ID string `json:"id" url:"id,key"` // unique identifier of webhook delivery
+	} `json:"ping" url:"ping,key"`
+	Repository string `json:"repository" url:"repository,key"` // the GitHub repository that the webhook is for
+	URL        string `json:"url" url:"url,key"`               // the URL that events are delivered to
+}
+type WebhookSetupOpts struct {
+	PullRequests *bool  `json:"pull_requests,omitempty" url:"pull_requests,omitempty,key"` // when true, the webhook is also subscribed to the `pull_request` event
+	Repository   string `json:"repository" url:"repository,key"`                           // the GitHub repository that the webhook is for
+}
+
+// Create the webhook for a repository, or update the existing one, so
+// that it delivers to this Conveyor and is signed with its secret.
+// Conveyor then pings the webhook, waits until the ping is delivered,
+// and registers the repository. Responds with a `bad_request` error if
+// the ping isn't delivered.
+func (s *Service) WebhookSetup(o WebhookSetupOpts) (*Webhook, error) {
+	var webhook Webhook
+	return &webhook, s.Post(&webhook, fmt.Sprintf("/webhooks"), o)
+}
+
+// A webhook delivery is a record of a webhook that GitHub sent, and how it
+// was handled.
+type WebhookDelivery struct {
+	Build *struct {
+		ID string `json:"id" url:"id,key"` // unique identifier of build
+	} `json:"build" url:"build,key"`
+	CreatedAt  time.Time         `json:"created_at" url:"created_at,key"`   // when the delivery was received
+	DeliveryID string            `json:"delivery_id" url:"delivery_id,key"` // the GUID from the `X-GitHub-Delivery` header, which replays keep
+	Event      string            `json:"event" url:"event,key"`             // the event, from the `X-GitHub-Event` header
+	Headers    map[string]string `json:"headers" url:"headers,key"`         // the request headers
+	ID         string            `json:"id" url:"id,key"`                   // unique identifier of webhook delivery
+	Payload    string            `json:"payload" url:"payload,key"`         // the raw JSON payload
+	ReplayOf   *struct {
+		ID string `json:"id" url:"id,key"` // unique identifier of webhook delivery
+	} `json:"replay_of" url:"replay_of,key"`
+	Repository string `json:"repository" url:"repository,key"` // the repository that the event was for, or an empty string
+	Response   string `json:"response" url:"response,key"`     // the body of the response, which is the ID of the build that was
+	// triggered, or the reason that it wasn't
+	Status int `json:"status" url:"status,key"` // the HTTP status code of the response
+}
+
+// Info for existing webhook delivery.
+func (s *Service) WebhookDeliveryInfo(webhookDeliveryIdentity string) (*WebhookDelivery, error) {
+	var webhookDelivery WebhookDelivery
+	return &webhookDelivery, s.Get(&webhookDelivery, fmt.Sprintf("/webhooks/deliveries/%v", webhookDeliveryIdentity), nil, nil)
+}
+
+// List the most recent webhook deliveries, newest first.
+func (s *Service) WebhookDeliveryList(lr *ListRange) ([]WebhookDelivery, error) {
+	var webhookDelivery []WebhookDelivery
+	return webhookDelivery, s.Get(&webhookDelivery, fmt.Sprintf("/webhooks/deliveries"), nil, lr)
+}
+
+// Handle a webhook delivery again, as if GitHub had redelivered it.
+// Signatures aren't verified, and the delivery isn't rejected as a replay.
+// Returns the record of the replay.
+func (s *Service) WebhookDeliveryReplay(webhookDeliveryIdentity string) (*WebhookDelivery, error) {
+	var webhookDelivery WebhookDelivery
+	return &webhookDelivery, s.Post(&webhookDelivery, fmt.Sprintf("/webhooks/deliveries/%v/replay", webhookDeliveryIdentity), nil)
+}
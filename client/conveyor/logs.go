@@ -8,3 +8,9 @@ import (
 func (s *Service) LogsStream(w io.Writer, buildIdentity string) error {
 	return s.Get(w, fmt.Sprintf("/logs/%s", buildIdentity), nil, nil)
 }
+
+// LogsStreamJSON streams the structured logs for a build as newline delimited
+// JSON.
+func (s *Service) LogsStreamJSON(w io.Writer, buildIdentity string) error {
+	return s.Get(w, fmt.Sprintf("/logs/%s?format=json", buildIdentity), nil, nil)
+}
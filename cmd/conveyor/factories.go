@@ -1,29 +1,32 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
 	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/codegangsta/cli"
 	"github.com/codegangsta/negroni"
 	"github.com/goji/httpauth"
-	"github.com/google/go-github/github"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/remind101/conveyor"
 	"github.com/remind101/conveyor/builder"
 	"github.com/remind101/conveyor/builder/datadog"
 	"github.com/remind101/conveyor/builder/docker"
-	"github.com/remind101/conveyor/internal/ghinstallation"
+	"github.com/remind101/conveyor/internal/ghtransport"
 	"github.com/remind101/conveyor/logs"
 	"github.com/remind101/conveyor/logs/cloudwatch"
 	"github.com/remind101/conveyor/logs/s3"
 	"github.com/remind101/conveyor/server"
+	"github.com/remind101/conveyor/server/api"
+	"github.com/remind101/conveyor/server/slack"
 	"github.com/remind101/conveyor/worker"
 	"github.com/remind101/pkg/reporter"
 	"github.com/remind101/pkg/reporter/hb2"
@@ -43,10 +46,39 @@ func newConveyor(c *cli.Context) *conveyor.Conveyor {
 	cy := conveyor.New(newDB(c))
 	cy.BuildQueue = newBuildQueue(c)
 	cy.Logger = newLogger(c)
-	cy.GitHub = conveyor.NewGitHub(newGitHubClient(c))
+	cy.StructuredLogging = c.Bool("logger.structured")
+	cy.MaxLogSize = int64(c.Int("logger.max_size"))
+	if cy.MaxLogSize < 0 {
+		must(fmt.Errorf("--logger.max_size can't be negative"))
+	}
+	cy.FailOnLogTruncation = c.Bool("logger.fail_on_truncate")
+	cy.LogEncoding = c.String("logger.encoding")
+	cy.PrivateLogEncoding = c.String("logger.private_encoding")
+	cy.AllowedBuildArgs = c.StringSlice("builder.allowed_build_args")
+	cy.CommitStatuses = c.Bool("github.commit_statuses")
+	cy.GitHub = newGitHubApp(c)
+	cy.Access = conveyor.AccessPolicy{
+		Organizations: c.StringSlice("access.organizations"),
+		Repositories:  c.StringSlice("access.repositories"),
+		Branches:      c.StringSlice("access.branches"),
+	}
+	cy.Webhook = conveyor.WebhookConfig{
+		URL:    c.String("url"),
+		Secret: webhookSecret(c),
+	}
 	return cy
 }
 
+// webhookSecret returns the secret that webhooks are created with. While
+// rotating the secret, that's the last one given to --github.secret.
+func webhookSecret(c *cli.Context) string {
+	secrets := c.StringSlice("github.secret")
+	if len(secrets) == 0 {
+		return ""
+	}
+	return secrets[len(secrets)-1]
+}
+
 func newBuildQueue(c *cli.Context) conveyor.BuildQueue {
 	u := urlParse(c.String("queue"))
 
@@ -62,6 +94,7 @@ func newBuildQueue(c *cli.Context) conveyor.BuildQueue {
 			url.Scheme = "https"
 			q.QueueURL = url.String()
 		}
+		q.HighPriorityQueueURL = c.String("queue.high_priority")
 		return q
 	default:
 		must(fmt.Errorf("Unknown queue: %v", u.Scheme))
@@ -79,10 +112,26 @@ func newServer(cy *conveyor.Conveyor, c *cli.Context) http.Handler {
 		apiAuth = func(h http.Handler) http.Handler { return h }
 	}
 
+	slackUsers, err := slack.ParseUsers(c.StringSlice("slack.users"))
+	must(err)
+
+	var logsSecret []byte
+	if secret := c.String("logs.secret"); secret != "" {
+		logsSecret = []byte(secret)
+	}
+
 	r := mux.NewRouter()
 	r.NotFoundHandler = server.NewServer(cy, server.Config{
-		APIAuth:      apiAuth,
-		GitHubSecret: c.String("github.secret"),
+		APIAuth:            apiAuth,
+		GitHubSecrets:      c.StringSlice("github.secret"),
+		GitHubReplayWindow: c.Duration("github.replay_window"),
+		PullRequests:       c.StringSlice("github.pull_requests"),
+		LogsURL:            fmt.Sprintf(logsURLTemplate, c.String("url")),
+		LogsSecret:         logsSecret,
+		LogsLinkTTL:        c.Duration("logs.link_ttl"),
+		SlackSigningSecret: c.String("slack.signing_secret"),
+		SlackUsers:         slackUsers,
+		Stats:              newStatsd(c),
 	})
 
 	n := negroni.Classic()
@@ -91,42 +140,51 @@ func newServer(cy *conveyor.Conveyor, c *cli.Context) http.Handler {
 	return n
 }
 
-func newGitHubClient(c *cli.Context) *github.Client {
-	t, err := ghinstallation.New(http.DefaultTransport, c.Int("github.app_id"), c.Int("github.installation_id"), []byte(c.String("github.private_key")))
-	if err != nil {
-		panic(err)
+func newGitHubApp(c *cli.Context) *conveyor.GitHubInstallations {
+	tr := ghtransport.New(http.DefaultTransport)
+	if s := newStatsd(c); s != nil {
+		tr.Stats = s
 	}
 
-	return github.NewClient(&http.Client{Transport: t})
+	g, err := conveyor.NewGitHubEnterpriseInstallations(tr, c.String("github.base_url"), c.String("github.upload_url"), c.Int("github.app_id"), []byte(c.String("github.private_key")))
+	must(err)
+	g.DefaultInstallationID = int64(c.Int("github.installation_id"))
+
+	return g
 }
 
-func newBuilder(c *cli.Context) builder.Builder {
+// newBuilder returns the builder for the worker. GitHub status updates are
+// queued on cy, and the builder shares cy's GitHub App clients, so that
+// installation tokens are reused.
+func newBuilder(c *cli.Context, cy *conveyor.Conveyor) builder.Builder {
 	db, err := docker.NewBuilderFromEnv()
 	if err != nil {
 		must(err)
 	}
 	db.DryRun = c.Bool("dry")
 	db.Image = c.String("builder.image")
+	if baseURL := c.String("github.base_url"); baseURL != "" {
+		db.GitHubHost = urlParse(baseURL).Host
+	}
 
-	g := builder.NewGitHubClient(newGitHubClient(c))
-
-	var backend builder.Builder = builder.UpdateGitHubCommitStatus(db, g, fmt.Sprintf(logsURLTemplate, c.String("url")))
-
-	if uri := c.String("stats"); uri != "" {
-		u := urlParse(uri)
+	g, ok := cy.GitHub.(builder.GitHubClients)
+	if !ok {
+		must(fmt.Errorf("%T doesn't provide clients for builds", cy.GitHub))
+	}
 
-		switch u.Scheme {
-		case "dogstatsd":
-			c, err := statsd.New(u.Host)
-			must(err)
+	var backend builder.Builder = builder.WithConfig(db, g)
+	if c.Bool("github.commit_statuses") {
+		b := builder.UpdateGitHubCommitStatus(backend, cy, fmt.Sprintf(logsURLTemplate, c.String("url")))
+		b.SignURL = logsSigner(c)
+		backend = b
+	} else {
+		b := builder.UpdateGitHubCheckRun(backend, cy, g, fmt.Sprintf(logsURLTemplate, c.String("url")))
+		b.SignURL = logsSigner(c)
+		backend = b
+	}
 
-			backend = datadog.WithStats(
-				backend,
-				c,
-			)
-		default:
-			must(fmt.Errorf("Unknown stats backend: %v", u.Scheme))
-		}
+	if s := newStatsd(c); s != nil {
+		backend = datadog.WithStats(backend, s)
 	}
 
 	b := worker.NewBuilder(backend)
@@ -135,6 +193,46 @@ func newBuilder(c *cli.Context) builder.Builder {
 	return b
 }
 
+// logsSigner returns a function that signs links to the logs of builds with
+// --logs.secret, or nil if there isn't one. Links that aren't signed need the
+// API credentials when there's a secret.
+func logsSigner(c *cli.Context) func(url, buildID string) string {
+	secret := c.String("logs.secret")
+	if secret == "" {
+		return nil
+	}
+
+	ttl := c.Duration("logs.link_ttl")
+	if ttl == 0 {
+		ttl = server.DefaultLogsLinkTTL
+	}
+
+	return func(url, buildID string) string {
+		return api.SignLogsURL([]byte(secret), url, buildID, time.Now().Add(ttl))
+	}
+}
+
+// newStatsd returns the statsd client that metrics are sent to, or nil if
+// metrics aren't enabled.
+func newStatsd(c *cli.Context) *statsd.Client {
+	uri := c.String("stats")
+	if uri == "" {
+		return nil
+	}
+
+	u := urlParse(uri)
+
+	switch u.Scheme {
+	case "dogstatsd":
+		s, err := statsd.New(u.Host)
+		must(err)
+		return s
+	default:
+		must(fmt.Errorf("Unknown stats backend: %v", u.Scheme))
+		return nil
+	}
+}
+
 func newReporter(c *cli.Context) reporter.Reporter {
 	u := urlParse(c.String("reporter"))
 
@@ -151,6 +249,41 @@ func newReporter(c *cli.Context) reporter.Reporter {
 }
 
 func newLogger(c *cli.Context) logs.Logger {
+	l := newLogBackend(c)
+	encodings := []string{c.String("logger.encoding"), c.String("logger.private_encoding")}
+
+	// Fail at startup, rather than when the logs for a build are created.
+	if u := urlParse(c.String("logger")); u.Scheme == "cloudwatch" {
+		if encodings[0] != "" || encodings[1] != "" {
+			must(fmt.Errorf("--logger.encoding and --logger.private_encoding aren't supported by the cloudwatch logger"))
+		}
+		return l
+	}
+
+	// Other backends are always wrapped, even when no encoding is
+	// configured, so that logs that were stored with an encoding stay
+	// readable after the configuration changes. The key is only required
+	// by the encodings that use it.
+	var key []byte
+	if s := c.String("logger.key"); s != "" {
+		var err error
+		key, err = base64.StdEncoding.DecodeString(s)
+		must(err)
+	}
+
+	el := &logs.EncodedLogger{
+		Logger:   l,
+		Encoding: encodings[0],
+		Key:      key,
+	}
+	for _, encoding := range encodings {
+		must(el.Validate(encoding))
+	}
+
+	return el
+}
+
+func newLogBackend(c *cli.Context) logs.Logger {
 	u := urlParse(c.String("logger"))
 
 	switch u.Scheme {
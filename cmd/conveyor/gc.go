@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/remind101/conveyor"
+	"golang.org/x/net/context"
+)
+
+// flags for garbage collection.
+var gcFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:   "gc.keep_builds",
+		Value:  0,
+		Usage:  "The number of builds to keep for each branch. Older builds are deleted, along with their artifacts and logs. 0 means builds are never deleted.",
+		EnvVar: "GC_KEEP_BUILDS",
+	},
+	cli.DurationFlag{
+		Name:   "gc.min_age",
+		Value:  0,
+		Usage:  "Builds younger than this are never deleted.",
+		EnvVar: "GC_MIN_AGE",
+	},
+	cli.DurationFlag{
+		Name:   "gc.failed_logs_ttl",
+		Value:  0,
+		Usage:  "If provided, the logs for failed builds are deleted after this long. e.g. `720h`.",
+		EnvVar: "GC_FAILED_LOGS_TTL",
+	},
+	cli.DurationFlag{
+		Name:   "gc.deliveries_ttl",
+		Value:  0,
+		Usage:  "If provided, recorded webhook deliveries are deleted after this long. e.g. `168h`.",
+		EnvVar: "GC_DELIVERIES_TTL",
+	},
+	cli.DurationFlag{
+		Name:   "gc.status_updates_ttl",
+		Value:  0,
+		Usage:  "If provided, GitHub status updates that were applied, or given up on, are deleted after this long. e.g. `168h`.",
+		EnvVar: "GC_STATUS_UPDATES_TTL",
+	},
+	cli.DurationFlag{
+		Name:   "gc.interval",
+		Value:  0,
+		Usage:  "If provided, workers will garbage collect periodically at this interval.",
+		EnvVar: "GC_INTERVAL",
+	},
+}
+
+var cmdGC = cli.Command{
+	Name:   "gc",
+	Usage:  "Delete builds, artifacts and logs according to the retention policy.",
+	Action: gcAction,
+	Flags: append(sharedFlags, append(gcFlags,
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Report what would be deleted, without deleting anything.",
+		},
+	)...),
+}
+
+func gcAction(c *cli.Context) {
+	cy := newConveyor(c)
+
+	dryRun := c.Bool("dry-run")
+	r, err := cy.GC(context.Background(), newRetentionPolicy(c), dryRun)
+	if r != nil {
+		printGCReport(r, dryRun)
+	}
+	must(err)
+}
+
+func newRetentionPolicy(c *cli.Context) conveyor.RetentionPolicy {
+	return conveyor.RetentionPolicy{
+		KeepBuilds:       c.Int("gc.keep_builds"),
+		MinAge:           c.Duration("gc.min_age"),
+		FailedLogsTTL:    c.Duration("gc.failed_logs_ttl"),
+		DeliveriesTTL:    c.Duration("gc.deliveries_ttl"),
+		StatusUpdatesTTL: c.Duration("gc.status_updates_ttl"),
+	}
+}
+
+// runGC garbage collects at the configured interval, until quit is closed.
+func runGC(cy *conveyor.Conveyor, c *cli.Context, quit chan struct{}) {
+	interval := c.Duration("gc.interval")
+	if interval == 0 {
+		return
+	}
+
+	p := newRetentionPolicy(c)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			// Every worker runs this loop, but only one of them
+			// garbage collects at a time.
+			r, err := cy.GC(context.Background(), p, false)
+			if err == conveyor.ErrGCLocked {
+				continue
+			}
+			if err != nil {
+				log.Printf("gc: %v", err)
+			}
+			if r != nil {
+				log.Printf("gc: deleted %d builds, the logs for %d failed builds, %d webhook deliveries and %d status updates", len(r.Builds), len(r.Logs), r.Deliveries, r.StatusUpdates)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+func printGCReport(r *conveyor.GCReport, dryRun bool) {
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+
+	for _, b := range r.Builds {
+		info("%s build %s (%s@%s, branch %s, %s)\n", verb, b.ID, b.Repository, b.Sha, b.Branch, b.State)
+	}
+	for _, b := range r.Logs {
+		info("%s logs for failed build %s (%s@%s)\n", verb, b.ID, b.Repository, b.Sha)
+	}
+	info("%s %d builds, the logs for %d failed builds, %d webhook deliveries and %d status updates\n", verb, len(r.Builds), len(r.Logs), r.Deliveries, r.StatusUpdates)
+}
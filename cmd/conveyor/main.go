@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/codegangsta/cli"
+	"github.com/remind101/conveyor/server"
 )
 
 // flags shared between the server and worker subcommands.
@@ -16,6 +17,74 @@ var sharedFlags = []cli.Flag{
 		Usage:  "Build queue to use. Defaults to an in memory queue.",
 		EnvVar: "QUEUE",
 	},
+	cli.StringFlag{
+		Name:   "queue.high_priority",
+		Value:  "",
+		Usage:  "When using the `sqs://` queue, the URL of a separate SQS queue for builds with `[conveyor priority=high]`, which workers receive from first.",
+		EnvVar: "QUEUE_HIGH_PRIORITY",
+	},
+	cli.StringSliceFlag{
+		Name:   "builder.allowed_build_args",
+		Value:  &cli.StringSlice{},
+		Usage:  "The build args that can be provided with the `[docker build-arg KEY=VALUE]` directive in commit messages.",
+		EnvVar: "BUILDER_ALLOWED_BUILD_ARGS",
+	},
+	cli.StringSliceFlag{
+		Name:   "access.organizations",
+		Value:  &cli.StringSlice{},
+		Usage:  "If provided, only repositories of these organizations (or those in --access.repositories) can be built.",
+		EnvVar: "ACCESS_ORGANIZATIONS",
+	},
+	cli.StringSliceFlag{
+		Name:   "access.repositories",
+		Value:  &cli.StringSlice{},
+		Usage:  "If provided, only these repositories (or those of --access.organizations) can be built. Patterns like `remind101/acme-*` are allowed.",
+		EnvVar: "ACCESS_REPOSITORIES",
+	},
+	cli.StringSliceFlag{
+		Name:   "access.branches",
+		Value:  &cli.StringSlice{},
+		Usage:  "If provided, only branches that match one of these patterns, e.g. `release/*`, can be built.",
+		EnvVar: "ACCESS_BRANCHES",
+	},
+	cli.BoolFlag{
+		Name:   "github.commit_statuses",
+		Usage:  "Report builds with commit statuses, rather than check runs. Use this if the GitHub Checks API isn't available.",
+		EnvVar: "GITHUB_COMMIT_STATUSES",
+	},
+	cli.IntFlag{
+		Name:   "github.app_id",
+		Usage:  "GitHub App ID. See https://developer.github.com/apps/building-github-apps/authentication-options-for-github-apps/",
+		EnvVar: "GITHUB_APP_ID",
+	},
+	cli.IntFlag{
+		Name:   "github.installation_id",
+		Usage:  "Optional GitHub Installation ID to use for builds that aren't triggered by a webhook, instead of looking up the installation for the repository. See https://developer.github.com/apps/building-github-apps/authentication-options-for-github-apps/",
+		EnvVar: "GITHUB_INSTALLATION_ID",
+	},
+	cli.StringFlag{
+		Name:   "github.private_key",
+		Usage:  "Private key for the GitHub App. See https://developer.github.com/apps/building-github-apps/authentication-options-for-github-apps/",
+		EnvVar: "GITHUB_PRIVATE_KEY",
+	},
+	cli.StringFlag{
+		Name:   "github.base_url",
+		Value:  "",
+		Usage:  "The API URL of a GitHub Enterprise Server, e.g. `https://github.example.com/api/v3/`. Defaults to github.com.",
+		EnvVar: "GITHUB_BASE_URL",
+	},
+	cli.StringFlag{
+		Name:   "github.upload_url",
+		Value:  "",
+		Usage:  "The upload URL of a GitHub Enterprise Server, e.g. `https://github.example.com/api/uploads/`. Defaults to the base URL.",
+		EnvVar: "GITHUB_UPLOAD_URL",
+	},
+	cli.StringFlag{
+		Name:   "stats",
+		Value:  "",
+		Usage:  "If provided, defines where build and GitHub API metrics are sent. Available options are dogstatsd://<host>",
+		EnvVar: "STATS",
+	},
 	cli.StringFlag{
 		Name:   "url",
 		Value:  "",
@@ -28,12 +97,58 @@ var sharedFlags = []cli.Flag{
 		Usage:  "The logger to use. Available options are `stdout://`, `s3://bucket` or `cloudwatch://`.",
 		EnvVar: "LOGGER",
 	},
+	cli.BoolFlag{
+		Name:   "logger.structured",
+		Usage:  "Store a structured log, with timestamps and build phase markers, alongside the raw log for each build.",
+		EnvVar: "LOGGER_STRUCTURED",
+	},
+	cli.IntFlag{
+		Name:   "logger.max_size",
+		Value:  0,
+		Usage:  "The maximum size of the logs for a build, in bytes. Past this size, only the head and tail of the output are kept. 0 means no limit.",
+		EnvVar: "LOGGER_MAX_SIZE",
+	},
+	cli.BoolFlag{
+		Name:   "logger.fail_on_truncate",
+		Usage:  "Fail builds when their output exceeds the maximum log size.",
+		EnvVar: "LOGGER_FAIL_ON_TRUNCATE",
+	},
+	cli.StringFlag{
+		Name:   "logger.encoding",
+		Value:  "",
+		Usage:  "The encoding to store logs with. Available options are `gzip` and `gzip+aes-gcm`. Defaults to storing logs as plain text. Not supported by the cloudwatch logger.",
+		EnvVar: "LOGGER_ENCODING",
+	},
+	cli.StringFlag{
+		Name:   "logger.private_encoding",
+		Value:  "",
+		Usage:  "The encoding to store logs for private repositories with. Defaults to --logger.encoding.",
+		EnvVar: "LOGGER_PRIVATE_ENCODING",
+	},
+	cli.StringFlag{
+		Name:   "logger.key",
+		Value:  "",
+		Usage:  "A base64 encoded AES key (16, 24 or 32 bytes), used to encrypt logs stored with the `gzip+aes-gcm` encoding.",
+		EnvVar: "LOGGER_KEY",
+	},
 	cli.StringFlag{
 		Name:   "db",
 		Value:  "",
 		Usage:  "A postgres connection string for the database.",
 		EnvVar: "DATABASE_URL",
 	},
+	cli.StringFlag{
+		Name:   "logs.secret",
+		Value:  "",
+		Usage:  "Secret used to sign links to the logs of builds, which the server posts in Slack and comment replies, and workers use as the details link of check runs and commit statuses. When set, streaming logs requires either a signed link or the API credentials.",
+		EnvVar: "LOGS_SECRET",
+	},
+	cli.DurationFlag{
+		Name:   "logs.link_ttl",
+		Value:  server.DefaultLogsLinkTTL,
+		Usage:  "How long signed links to the logs of builds are valid for.",
+		EnvVar: "LOGS_LINK_TTL",
+	},
 }
 
 func main() {
@@ -43,11 +158,13 @@ func main() {
 	app.Action = mainAction
 	app.Flags = append(
 		sharedFlags,
-		append(workerFlags, serverFlags...)...,
+		append(workerFlags, append(serverFlags, gcFlags...)...)...,
 	)
 	app.Commands = []cli.Command{
 		cmdServer,
 		cmdWorker,
+		cmdGC,
+		cmdSetup,
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -8,6 +8,7 @@ import (
 
 	"github.com/codegangsta/cli"
 	"github.com/remind101/conveyor"
+	"github.com/remind101/conveyor/server/github"
 )
 
 // flags for the http server.
@@ -18,12 +19,36 @@ var serverFlags = []cli.Flag{
 		Usage:  "Port to run the server on",
 		EnvVar: "PORT",
 	},
-	cli.StringFlag{
+	cli.StringSliceFlag{
 		Name:   "github.secret",
-		Value:  "",
-		Usage:  "Shared secret used by GitHub to sign webhook payloads. This secret will be used to verify that the request came from GitHub.",
+		Value:  &cli.StringSlice{},
+		Usage:  "Shared secret used by GitHub to sign webhook payloads. This secret will be used to verify that the request came from GitHub. Can be given multiple times (or comma separated in the environment variable) to accept any of several secrets while rotating it.",
 		EnvVar: "GITHUB_SECRET",
 	},
+	cli.DurationFlag{
+		Name:   "github.replay_window",
+		Value:  github.DefaultReplayWindow,
+		Usage:  "How far back to look for webhook deliveries that were already handled. Deliveries with an ID that was handled successfully within this window are rejected.",
+		EnvVar: "GITHUB_REPLAY_WINDOW",
+	},
+	cli.StringSliceFlag{
+		Name:   "github.pull_requests",
+		Value:  &cli.StringSlice{},
+		Usage:  "The kinds of pull requests to build: `same-repo` for pull requests from branches in the same repository, and `forks` for pull requests from forks. Can be given multiple times. Pull requests aren't built by default.",
+		EnvVar: "GITHUB_PULL_REQUESTS",
+	},
+	cli.StringFlag{
+		Name:   "slack.signing_secret",
+		Value:  "",
+		Usage:  "The signing secret of the Slack app. When set, Slack slash commands are served at /slack, and requests are verified with this secret.",
+		EnvVar: "SLACK_SIGNING_SECRET",
+	},
+	cli.StringSliceFlag{
+		Name:   "slack.users",
+		Value:  &cli.StringSlice{},
+		Usage:  "What Slack users are allowed to do with slash commands, in the form `user=permission`, where user is a Slack user ID (not a user name, which can be changed), or `*` for everyone else, and permission is one of `none`, `read`, `write` or `admin`. Can be given multiple times. Users that aren't mapped have `read` permission.",
+		EnvVar: "SLACK_USERS",
+	},
 	cli.StringFlag{
 		Name:   "auth",
 		Value:  "",
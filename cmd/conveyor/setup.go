@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/remind101/conveyor"
+	"golang.org/x/net/context"
+)
+
+var cmdSetup = cli.Command{
+	Name:        "setup",
+	Usage:       "Create or update the GitHub webhook for a repository, verify it with a ping, and register the repository.",
+	Description: "Usage: conveyor setup [options] <owner/repo>\n\n   The webhook delivers to --url, and is signed with the last --github.secret. The server must be running, and reachable from GitHub, for the ping to be delivered.",
+	Action:      setupAction,
+	Flags: append(sharedFlags, append(serverFlags,
+		cli.BoolFlag{
+			Name:  "pull-requests",
+			Usage: "Also subscribe the webhook to the `pull_request` event.",
+		},
+		cli.DurationFlag{
+			Name:  "ping-timeout",
+			Value: conveyor.DefaultPingTimeout,
+			Usage: "How long to wait for the ping to be delivered.",
+		},
+	)...),
+}
+
+func setupAction(c *cli.Context) {
+	repository := c.Args().First()
+	if strings.Count(repository, "/") != 1 {
+		must(fmt.Errorf("usage: conveyor setup <owner/repo>"))
+	}
+
+	cy := newConveyor(c)
+	cy.Webhook.PingTimeout = c.Duration("ping-timeout")
+
+	w, err := cy.Setup(context.Background(), conveyor.SetupRequest{
+		Repository:   repository,
+		PullRequests: c.Bool("pull-requests"),
+	})
+	must(err)
+
+	verb := "Updated"
+	if w.Created {
+		verb = "Created"
+	}
+	info("%s webhook %d for %s, delivering %s to %s\n", verb, w.ID, w.Repository, strings.Join(w.Events, " and "), w.URL)
+	info("Ping delivered (%s), and %s is registered\n", w.Ping.DeliveryID, w.Repository)
+}
@@ -1,34 +1,29 @@
 package main
 
 import (
+	"log"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/remind101/conveyor"
 	"github.com/remind101/conveyor/builder/docker"
 	"github.com/remind101/conveyor/worker"
+	"golang.org/x/net/context"
 )
 
+// statusUpdatesInterval is how often the worker applies the queued GitHub
+// status updates that are due.
+const statusUpdatesInterval = time.Second
+
+// staleBuildsInterval is how often the worker looks for stale builds.
+const staleBuildsInterval = time.Minute
+
 // flags for the worker.
 var workerFlags = []cli.Flag{
-	cli.IntFlag{
-		Name:   "github.app_id",
-		Usage:  "GitHub App ID. See https://developer.github.com/apps/building-github-apps/authentication-options-for-github-apps/",
-		EnvVar: "GITHUB_APP_ID",
-	},
-	cli.IntFlag{
-		Name:   "github.installation_id",
-		Usage:  "GitHub Installation ID. See https://developer.github.com/apps/building-github-apps/authentication-options-for-github-apps/",
-		EnvVar: "GITHUB_INSTALLATION_ID",
-	},
-	cli.StringFlag{
-		Name:   "github.private_key",
-		Usage:  "Private key for the GitHub App. See https://developer.github.com/apps/building-github-apps/authentication-options-for-github-apps/",
-		EnvVar: "GITHUB_PRIVATE_KEY",
-	},
 	cli.BoolFlag{
 		Name:   "dry",
 		Usage:  "Enable dry run mode.",
@@ -52,19 +47,13 @@ var workerFlags = []cli.Flag{
 		Usage:  "Number of workers in goroutines to start.",
 		EnvVar: "WORKERS",
 	},
-	cli.StringFlag{
-		Name:   "stats",
-		Value:  "",
-		Usage:  "If provided, defines where build metrics are sent. Available options are dogstatsd://<host>",
-		EnvVar: "STATS",
-	},
 }
 
 var cmdWorker = cli.Command{
 	Name:   "worker",
 	Usage:  "Run a set of workers.",
 	Action: workerAction,
-	Flags:  append(sharedFlags, workerFlags...),
+	Flags:  append(sharedFlags, append(workerFlags, gcFlags...)...),
 }
 
 func workerAction(c *cli.Context) {
@@ -84,12 +73,18 @@ func runWorker(cy *conveyor.Conveyor, c *cli.Context) error {
 	cy.BuildQueue.Subscribe(ch)
 
 	workers := worker.NewPool(cy, numWorkers, worker.Options{
-		Builder:       newBuilder(c),
+		Builder:       newBuilder(c, cy),
 		BuildRequests: ch,
 	})
 
 	workers.Start()
 
+	done := make(chan struct{})
+	defer close(done)
+	go runGC(cy, c, done)
+	go runStatusUpdates(cy, done)
+	go runStaleBuilds(cy, done)
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	sig := <-quit
@@ -97,3 +92,40 @@ func runWorker(cy *conveyor.Conveyor, c *cli.Context) error {
 	info("Signal %d received. Shutting down workers.\n", sig)
 	return workers.Shutdown()
 }
+
+// runStatusUpdates applies queued GitHub status updates until quit is closed.
+func runStatusUpdates(cy *conveyor.Conveyor, quit chan struct{}) {
+	t := time.NewTicker(statusUpdatesInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := cy.UpdateStatuses(context.Background()); err != nil {
+				log.Printf("status updates: %v", err)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// runStaleBuilds fails stale builds until quit is closed, so that they don't
+// count against the concurrency limit of their repository forever. Builds are
+// stale once they've been building for twice their timeout, which workers
+// enforce well before then.
+func runStaleBuilds(cy *conveyor.Conveyor, quit chan struct{}) {
+	t := time.NewTicker(staleBuildsInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if _, err := cy.FailStaleBuilds(context.Background(), worker.DefaultTimeout); err != nil {
+				log.Printf("stale builds: %v", err)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
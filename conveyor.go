@@ -1,9 +1,15 @@
 package conveyor
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"strings"
+	"time"
 
+	"github.com/google/go-github/github"
 	"github.com/jmoiron/sqlx"
 	"github.com/remind101/conveyor/builder"
 	"github.com/remind101/conveyor/logs"
@@ -12,6 +18,10 @@ import (
 	"code.google.com/p/go-uuid/uuid"
 )
 
+// ErrLogsDeleted is returned when opening the logs for a build that were
+// removed by garbage collection.
+var ErrLogsDeleted = errors.New("logs for this build were deleted by the retention policy")
+
 // newID returns a new unique identifier.
 var newID = uuid.New
 
@@ -23,7 +33,45 @@ type Conveyor struct {
 	// Logger is the log storage backend to read and write logs for builds.
 	Logger logs.Logger
 
-	GitHub GitHubAPI
+	// When true, a structured log with timestamps, streams and phase
+	// markers is stored alongside the raw log for each build.
+	StructuredLogging bool
+
+	// The maximum size of the logs for a build, in bytes. Past this size,
+	// only the head and tail of the output are kept. The zero value means
+	// no limit.
+	MaxLogSize int64
+
+	// When true, builds will fail if their output exceeds MaxLogSize.
+	FailOnLogTruncation bool
+
+	// The encoding that logs for new builds are stored with. Any encoding
+	// other than logs.EncodingNone requires Logger to implement the
+	// logs.EncodingLogger interface.
+	LogEncoding string
+
+	// The encoding that logs for new builds of private repositories are
+	// stored with. The zero value is to use LogEncoding.
+	PrivateLogEncoding string
+
+	// The build args that can be provided with the `[docker build-arg]`
+	// directive.
+	AllowedBuildArgs []string
+
+	// When true, builds are reported with commit statuses, rather than
+	// check runs. Use this when the Checks API isn't available, e.g. on
+	// older versions of GitHub Enterprise.
+	CommitStatuses bool
+
+	// GitHub provides clients for the installations of the GitHub App.
+	GitHub GitHubApp
+
+	// Access restricts which repositories and branches can be built, for
+	// both webhooks and the API.
+	Access AccessPolicy
+
+	// Webhook configures the webhooks that Setup creates.
+	Webhook WebhookConfig
 
 	db *sqlx.DB
 }
@@ -37,27 +85,122 @@ func New(db *sqlx.DB) *Conveyor {
 type BuildRequest struct {
 	// Repository is the repo to build. This is always required.
 	Repository string
-	// Sha is the git commit to build. If this is not provided, and a Branch
-	// is provided, the sha will be auto-resolved.
+	// Sha is the git commit to build. If this is not provided, and a Ref,
+	// Branch or Tag is provided, the sha will be auto-resolved.
 	Sha string
+	// Ref is a branch, tag, abbreviated sha, or pull request ref (e.g.
+	// `pull/123/head`) to build. The branch, tag or pull request that
+	// it refers to is set on the build.
+	Ref string
 	// Branch is the name of the branch that this build relates to.
 	Branch string
+	// Tag is the name of the git tag that this build relates to. If Sha is
+	// not provided, the tag will be resolved to the commit it points to.
+	Tag string
+	// PullRequest is the number of the pull request that this build
+	// relates to, or 0 if it doesn't relate to a pull request.
+	PullRequest int
+	// InstallationID is the GitHub App installation that has access to
+	// the repository. If this is not provided, the installation will be
+	// looked up.
+	InstallationID int64
 	// Set to true to disable the layer cache. The zero value is to enable
 	// caching.
 	NoCache bool
+	// True if the repository is private. If this is false, and
+	// PrivateLogEncoding is set, the visibility of the repository will be
+	// looked up.
+	Private bool
+	// Directives parsed from the commit message.
+	Directives Directives
+}
+
+// ref returns the ref that the sha should be resolved from.
+func (r BuildRequest) ref() string {
+	switch {
+	case r.Ref != "":
+		return r.Ref
+	case r.Branch != "":
+		return "refs/heads/" + r.Branch
+	case r.Tag != "":
+		return "refs/tags/" + r.Tag
+	default:
+		return ""
+	}
 }
 
 // Build enqueues a build to run.
 func (c *Conveyor) Build(ctx context.Context, req BuildRequest) (*Build, error) {
-	// A branch is provied with no sha. Use the GitHub API to resolve the
-	// branch to the sha of HEAD of the branch.
-	if req.Sha == "" && req.Branch != "" {
+	if err := c.Access.checkRepository(req.Repository); err != nil {
+		log.Printf("build denied: %v", err)
+		return nil, err
+	}
+
+	r, err := c.registeredRepository(ctx, req.Repository)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil && !r.Enabled {
+		err := &AccessDeniedError{Repository: req.Repository, Reason: "repository is disabled"}
+		log.Printf("build denied: %v", err)
+		return nil, err
+	}
+
+	g, installationID, err := c.installation(ctx, req.Repository, req.InstallationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only webhooks report whether the repository is private, so it's
+	// looked up for builds from the API, Slack and replays. Otherwise the
+	// logs of a private repository would be stored with LogEncoding.
+	if !req.Private && c.PrivateLogEncoding != "" {
 		owner, repo := splitRepo(req.Repository)
-		sha, err := c.GitHub.ResolveBranch(ctx, owner, repo, req.Branch)
+		req.Private, err = g.Private(ctx, owner, repo)
 		if err != nil {
 			return nil, err
 		}
-		req.Sha = sha
+	}
+
+	// Nothing to build was provided, so build the registered repository's
+	// default branch.
+	if r != nil && req.Sha == "" && req.ref() == "" {
+		req.Branch = r.DefaultBranch
+	}
+
+	// A ref, branch or tag is provided with no sha. Use the GitHub API to
+	// resolve it to the commit that it points to.
+	if ref := req.ref(); req.Sha == "" && ref != "" {
+		owner, repo := splitRepo(req.Repository)
+		r, err := g.ResolveRef(ctx, owner, repo, ref)
+		if err != nil {
+			return nil, err
+		}
+		req.Sha = r.Sha
+		if req.Branch == "" {
+			req.Branch = r.Branch
+		}
+		if req.Tag == "" {
+			req.Tag = r.Tag
+		}
+		if req.PullRequest == 0 {
+			req.PullRequest = r.PullRequest
+		}
+	}
+
+	if req.Tag != "" {
+		if err := CheckTag(req.Tag); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Access.checkBranch(req.Repository, req.Branch); err != nil {
+		log.Printf("build denied: %v", err)
+		return nil, err
+	}
+
+	if err := c.checkBuildArgs(req.Directives); err != nil {
+		return nil, err
 	}
 
 	tx, err := c.db.Beginx()
@@ -66,9 +209,20 @@ func (c *Conveyor) Build(ctx context.Context, req BuildRequest) (*Build, error)
 	}
 
 	b := &Build{
-		Repository: req.Repository,
-		Sha:        req.Sha,
-		Branch:     req.Branch,
+		Repository:     req.Repository,
+		Sha:            req.Sha,
+		Branch:         req.Branch,
+		Tag:            req.Tag,
+		LogEncoding:    c.logEncoding(req),
+		Directives:     req.Directives.List,
+		InstallationID: installationID,
+	}
+
+	if req.PullRequest != 0 {
+		b.PullRequest = &req.PullRequest
+	}
+	if r != nil {
+		b.Timeout = r.Timeout
 	}
 
 	if err := buildsCreate(tx, b); err != nil {
@@ -76,6 +230,30 @@ func (c *Conveyor) Build(ctx context.Context, req BuildRequest) (*Build, error)
 		return b, err
 	}
 
+	opts := builder.BuildOptions{
+		ID:             b.ID,
+		Repository:     req.Repository,
+		Sha:            req.Sha,
+		Branch:         req.Branch,
+		Tag:            req.Tag,
+		PullRequest:    req.PullRequest,
+		InstallationID: installationID,
+		NoCache:        req.NoCache || req.Directives.NoCache,
+		Target:         req.Directives.Target,
+		BuildArgs:      req.Directives.BuildArgs,
+		Priority:       req.Directives.Priority,
+	}
+
+	var held bool
+	if r != nil {
+		r.apply(&opts)
+		held, err = holdBuild(tx, r, opts)
+		if err != nil {
+			tx.Rollback()
+			return b, err
+		}
+	}
+
 	// Commit before we push the build into the queue. We need to do this
 	// because it's possible that two inflight transactions will get
 	// commited and one will raise an error.
@@ -83,14 +261,169 @@ func (c *Conveyor) Build(ctx context.Context, req BuildRequest) (*Build, error)
 		return b, err
 	}
 
-	return b, c.BuildQueue.Push(ctx, builder.BuildOptions{
-		ID:         b.ID,
-		Repository: req.Repository,
-		Sha:        req.Sha,
-		Branch:     req.Branch,
-		NoCache:    req.NoCache,
+	c.queueCheckRun(ctx, opts)
+
+	// The build is pushed onto the queue when it's released.
+	if held {
+		log.Printf("holding build %s of %s", b.ID, b.Repository)
+		return b, nil
+	}
+
+	return b, c.BuildQueue.Push(ctx, opts)
+
+}
+
+// queueCheckRun queues the creation of a queued check run for a build. If it
+// can't be queued, the error is logged, and the check run is created when the
+// build starts.
+func (c *Conveyor) queueCheckRun(ctx context.Context, opts builder.BuildOptions) {
+	if c.CommitStatuses {
+		return
+	}
+
+	if err := c.QueueCheckRun(ctx, opts, &builder.CheckRun{
+		Name:       builder.Context,
+		HeadSHA:    opts.Sha,
+		ExternalID: opts.ID,
+		Status:     builder.CheckRunQueued,
+	}); err != nil {
+		log.Printf("error queueing check run for build %s: %v", opts.ID, err)
+	}
+}
+
+// checkBuildArgs returns an error if the directives provide a build arg that
+// isn't in AllowedBuildArgs.
+func (c *Conveyor) checkBuildArgs(d Directives) error {
+	for k := range d.BuildArgs {
+		var allowed bool
+		for _, a := range c.AllowedBuildArgs {
+			if k == a {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &DirectiveError{
+				Directive: fmt.Sprintf("docker build-arg %s=%s", k, d.BuildArgs[k]),
+				Reason:    fmt.Sprintf("%s is not an allowed build arg", k),
+			}
+		}
+	}
+	return nil
+}
+
+// Config returns the build configuration for a repository at the given sha, or
+// nil if the repository doesn't have one.
+func (c *Conveyor) Config(ctx context.Context, installationID int64, repository, sha string) (*builder.Config, error) {
+	g, _, err := c.installation(ctx, repository, installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repo := splitRepo(repository)
+	return g.Config(ctx, owner, repo, sha)
+}
+
+// BuildSkipped reports that a build wasn't triggered, by queueing a neutral
+// check run, or a successful commit status, that describes why.
+func (c *Conveyor) BuildSkipped(ctx context.Context, req BuildRequest, reason string) error {
+	opts := builder.BuildOptions{
+		Repository:     req.Repository,
+		Sha:            req.Sha,
+		InstallationID: req.InstallationID,
+	}
+
+	if !c.CommitStatuses {
+		completedAt := time.Now()
+		return c.QueueCheckRun(ctx, opts, &builder.CheckRun{
+			Name:        builder.Context,
+			HeadSHA:     req.Sha,
+			Status:      builder.CheckRunCompleted,
+			Conclusion:  builder.CheckRunNeutral,
+			CompletedAt: &completedAt,
+			Output: &builder.CheckRunOutput{
+				Title:   "Build skipped",
+				Summary: fmt.Sprintf("Build skipped: %s", reason),
+			},
+		})
+	}
+
+	return c.QueueStatus(ctx, opts, &github.RepoStatus{
+		State:       github.String("success"),
+		Context:     github.String(builder.Context),
+		Description: github.String(truncateDescription(fmt.Sprintf("Build skipped: %s", reason))),
 	})
+}
+
+// CanWrite returns true if a GitHub user has write access to a repository.
+func (c *Conveyor) CanWrite(ctx context.Context, installationID int64, repository, user string) (bool, error) {
+	g, _, err := c.installation(ctx, repository, installationID)
+	if err != nil {
+		return false, err
+	}
+
+	owner, repo := splitRepo(repository)
+	p, err := g.Permission(ctx, owner, repo, user)
+	if err != nil {
+		return false, err
+	}
+	return p == "admin" || p == "write", nil
+}
+
+// PullRequestHead returns the repository, branch and sha of the head of a pull
+// request. See GitHubAPI.PullRequestHead.
+func (c *Conveyor) PullRequestHead(ctx context.Context, installationID int64, repository string, number int) (head, branch, sha string, err error) {
+	g, _, err := c.installation(ctx, repository, installationID)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	owner, repo := splitRepo(repository)
+	return g.PullRequestHead(ctx, owner, repo, number)
+}
 
+// PullRequestFiles returns the paths of the files that a pull request changes.
+func (c *Conveyor) PullRequestFiles(ctx context.Context, installationID int64, repository string, number int) ([]string, error) {
+	g, _, err := c.installation(ctx, repository, installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repo := splitRepo(repository)
+	return g.PullRequestFiles(ctx, owner, repo, number)
+}
+
+// CommentOnPullRequest adds a comment to a pull request.
+func (c *Conveyor) CommentOnPullRequest(ctx context.Context, installationID int64, repository string, number int, body string) error {
+	g, _, err := c.installation(ctx, repository, installationID)
+	if err != nil {
+		return err
+	}
+
+	owner, repo := splitRepo(repository)
+	return g.CreateIssueComment(ctx, owner, repo, number, body)
+}
+
+// CommentOnCommit adds a comment to a commit.
+func (c *Conveyor) CommentOnCommit(ctx context.Context, installationID int64, repository, sha, body string) error {
+	g, _, err := c.installation(ctx, repository, installationID)
+	if err != nil {
+		return err
+	}
+
+	owner, repo := splitRepo(repository)
+	return g.CreateCommitComment(ctx, owner, repo, sha, body)
+}
+
+// truncateDescription truncates a commit status description to the maximum
+// length that GitHub accepts.
+func truncateDescription(s string) string {
+	const max = 140
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-3]) + "..."
 }
 
 // FindBuild finds a build by its identity.
@@ -117,6 +450,157 @@ func (c *Conveyor) FindBuild(ctx context.Context, buildIdentity string) (*Build,
 	return b, tx.Commit()
 }
 
+// FindPullRequestBuilds returns the builds for a pull request, newest first.
+func (c *Conveyor) FindPullRequestBuilds(ctx context.Context, repository string, number int) ([]*Build, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	builds, err := buildsFindByPullRequest(tx, repository, number)
+	if err != nil {
+		tx.Rollback()
+		return builds, err
+	}
+
+	return builds, tx.Commit()
+}
+
+// CancelPullRequest cancels the pending and building builds for a pull
+// request, and returns them. Workers stop builds that are canceled while
+// they're running.
+func (c *Conveyor) CancelPullRequest(ctx context.Context, repository string, number int) ([]*Build, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	builds, err := buildsCancelPullRequest(tx, repository, number)
+	if err != nil {
+		tx.Rollback()
+		return builds, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return builds, err
+	}
+
+	c.buildsFinished(ctx, repository)
+	return builds, nil
+}
+
+// AttachPullRequest records that the pending or building build of a commit,
+// on the same branch, relates to a pull request, e.g. because it was triggered
+// by the `push` event that GitHub sends along with the pull request's
+// `synchronize` event. It returns the build, or nil if there isn't one that
+// doesn't already relate to a pull request.
+func (c *Conveyor) AttachPullRequest(ctx context.Context, req BuildRequest) (*Build, error) {
+	var b *Build
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		b, err = buildsAttachPullRequest(tx, req.Repository, req.Sha, req.Branch, req.PullRequest)
+		return
+	})
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+// CancelCommit cancels the pending and building builds for a commit, and
+// returns them.
+func (c *Conveyor) CancelCommit(ctx context.Context, repository, sha string) ([]*Build, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	builds, err := buildsCancelSha(tx, repository, sha)
+	if err != nil {
+		tx.Rollback()
+		return builds, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return builds, err
+	}
+
+	c.buildsFinished(ctx, repository)
+	return builds, nil
+}
+
+// CancelBuild cancels a build, and returns it. ErrBuildFinished is returned if
+// the build isn't pending or building.
+func (c *Conveyor) CancelBuild(ctx context.Context, buildID string) (*Build, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := buildsCancelByID(tx, buildID)
+	if err == sql.ErrNoRows {
+		// Either the build doesn't exist, or it's already finished.
+		if _, err = buildsFindByID(tx, buildID); err == nil {
+			err = ErrBuildFinished
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	c.buildsFinished(ctx, b.Repository)
+	return b, nil
+}
+
+// FailStaleBuilds fails the builds that have been building for longer than
+// twice their timeout, e.g. because the worker that was building them crashed,
+// so that they stop counting against the concurrency limit of their
+// repository. Builds without a timeout of their own use defaultTimeout, the
+// workers' default. The builds that were failed are returned.
+func (c *Conveyor) FailStaleBuilds(ctx context.Context, defaultTimeout time.Duration) ([]*Build, error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	builds, err := buildsFailStale(tx, defaultTimeout)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	repositories := make(map[string]bool)
+	for _, b := range builds {
+		timeout := b.Timeout
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+		log.Printf("failed build %s of %s, which was building for more than twice its timeout of %v", b.ID, b.Repository, timeout)
+		if !repositories[b.Repository] {
+			repositories[b.Repository] = true
+			c.buildsFinished(ctx, b.Repository)
+		}
+	}
+	return builds, nil
+}
+
+// IsCanceled returns whether a build was canceled.
+func (c *Conveyor) IsCanceled(ctx context.Context, buildID string) (bool, error) {
+	b, err := c.FindBuild(ctx, buildID)
+	if err != nil {
+		return false, err
+	}
+	return b.State == StateCanceled, nil
+}
+
 // FindArtifact finds an artifact by its identity.
 func (c *Conveyor) FindArtifact(ctx context.Context, artifactIdentity string) (*Artifact, error) {
 	tx, err := c.db.Beginx()
@@ -141,14 +625,169 @@ func (c *Conveyor) FindArtifact(ctx context.Context, artifactIdentity string) (*
 	return a, tx.Commit()
 }
 
+// FindSteps returns the Dockerfile steps that were run for a build.
+func (c *Conveyor) FindSteps(ctx context.Context, buildIdentity string) ([]*Step, error) {
+	b, err := c.FindBuild(ctx, buildIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := stepsFindByBuildID(tx, b.ID)
+	if err != nil {
+		tx.Rollback()
+		return steps, err
+	}
+
+	return steps, tx.Commit()
+}
+
+// RecordSteps records the Dockerfile steps that were run for a build.
+func (c *Conveyor) RecordSteps(ctx context.Context, buildID string, steps []builder.Step) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		if err := stepsCreate(tx, &Step{
+			BuildID:     buildID,
+			Number:      s.Number,
+			Total:       s.Total,
+			Instruction: s.Instruction,
+			Cached:      s.Cached,
+			StartedAt:   s.StartedAt,
+			Duration:    s.Duration,
+		}); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// logEncoding returns the encoding that the logs for a new build should be
+// stored with.
+func (c *Conveyor) logEncoding(req BuildRequest) string {
+	if req.Private && c.PrivateLogEncoding != "" {
+		return c.PrivateLogEncoding
+	}
+	return c.LogEncoding
+}
+
 // Writer returns an io.Writer to write logs for the build.
 func (c *Conveyor) Writer(ctx context.Context, buildID string) (io.Writer, error) {
-	return c.Logger.Create(buildID)
+	b, err := c.FindBuild(ctx, buildID)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := c.createLog(buildID, b.LogEncoding)
+	if err != nil {
+		return w, err
+	}
+
+	if c.MaxLogSize != 0 {
+		l := logs.Limit(w, c.MaxLogSize)
+		l.FailOnTruncate = c.FailOnLogTruncation
+		l.OnTruncate = c.logsTruncated(ctx, buildID)
+		w = l
+	}
+
+	if !c.StructuredLogging {
+		return w, nil
+	}
+
+	structured, err := c.createLog(logs.StructuredName(buildID), b.LogEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MaxLogSize != 0 {
+		l := logs.LimitStructured(structured, c.MaxLogSize)
+		l.OnTruncate = c.logsTruncated(ctx, buildID)
+		structured = l
+	}
+
+	return logs.NewStructuredWriter(w, structured), nil
+}
+
+// logsTruncated returns a function that records that the logs for the build
+// were truncated.
+func (c *Conveyor) logsTruncated(ctx context.Context, buildID string) func(int64) {
+	return func(truncated int64) {
+		if err := c.LogsTruncated(ctx, buildID); err != nil {
+			log.Printf("error marking logs for build %s as truncated: %v", buildID, err)
+		}
+	}
+}
+
+// LogsTruncated records that the logs for the build exceeded the maximum size
+// and were truncated.
+func (c *Conveyor) LogsTruncated(ctx context.Context, buildID string) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := buildsUpdateLogsTruncated(tx, buildID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Logs returns an io.Reader to read logs for the build.
 func (c *Conveyor) Logs(ctx context.Context, buildID string) (io.Reader, error) {
-	return c.Logger.Open(buildID)
+	return c.openLog(ctx, buildID, buildID)
+}
+
+// StructuredLogs returns an io.Reader to read the structured logs for the
+// build, as newline delimited JSON encoded logs.Entry's.
+func (c *Conveyor) StructuredLogs(ctx context.Context, buildID string) (io.Reader, error) {
+	return c.openLog(ctx, buildID, logs.StructuredName(buildID))
+}
+
+// createLog creates the named log, stored with the given encoding.
+func (c *Conveyor) createLog(name, encoding string) (io.Writer, error) {
+	if encoding == logs.EncodingNone {
+		return c.Logger.Create(name)
+	}
+
+	l, ok := c.Logger.(logs.EncodingLogger)
+	if !ok {
+		return nil, fmt.Errorf("logger does not support the %q encoding", encoding)
+	}
+	return l.CreateEncoded(name, encoding)
+}
+
+// openLog opens the named log for the build, decoding it with the encoding
+// that was recorded for the build.
+func (c *Conveyor) openLog(ctx context.Context, buildID, name string) (io.Reader, error) {
+	b, err := c.FindBuild(ctx, buildID)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.LogsDeleted {
+		return nil, ErrLogsDeleted
+	}
+
+	if b.LogEncoding == logs.EncodingNone {
+		return c.Logger.Open(name)
+	}
+
+	l, ok := c.Logger.(logs.EncodingLogger)
+	if !ok {
+		return nil, fmt.Errorf("logger does not support the %q encoding", b.LogEncoding)
+	}
+	return l.OpenEncoded(name, b.LogEncoding)
 }
 
 // BuildStarted marks the build as started.
@@ -158,7 +797,7 @@ func (c *Conveyor) BuildStarted(ctx context.Context, buildID string) error {
 		return err
 	}
 
-	if err := buildsUpdateState(tx, buildID, StateBuilding); err != nil {
+	if _, err := buildsUpdateState(tx, buildID, StateBuilding); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -166,27 +805,58 @@ func (c *Conveyor) BuildStarted(ctx context.Context, buildID string) error {
 	return tx.Commit()
 }
 
-// BuildComplete marks a build as successful and adds the image as an artifact.
-func (c *Conveyor) BuildComplete(ctx context.Context, buildID, image string) error {
+// BuildComplete marks a build as successful and adds the image as an artifact,
+// along with an artifact for each named image that was pushed. Builds that
+// are no longer building, because they were canceled or failed as stale,
+// aren't changed, and don't get artifacts.
+func (c *Conveyor) BuildComplete(ctx context.Context, buildID, image string, pushed []builder.Image) error {
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 
-	if err := buildsUpdateState(tx, buildID, StateSucceeded); err != nil {
+	ok, err := buildsUpdateState(tx, buildID, StateSucceeded)
+	if err != nil {
 		tx.Rollback()
 		return err
 	}
+	if !ok {
+		log.Printf("not completing build %s, which is no longer building", buildID)
+		return tx.Rollback()
+	}
 
-	if err := artifactsCreate(tx, &Artifact{
-		BuildID: buildID,
-		Image:   image,
-	}); err != nil {
-		tx.Rollback()
+	artifacts := []*Artifact{
+		{BuildID: buildID, Image: image},
+	}
+	for _, i := range pushed {
+		if i.Name == "" {
+			artifacts[0].Digest = i.Digest
+			artifacts[0].Tags = i.Tags
+			continue
+		}
+
+		artifacts = append(artifacts, &Artifact{
+			BuildID: buildID,
+			Name:    i.Name,
+			Image:   i.Ref(),
+			Digest:  i.Digest,
+			Tags:    i.Tags,
+		})
+	}
+
+	for _, a := range artifacts {
+		if err := artifactsCreate(tx, a); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	c.buildFinished(ctx, buildID)
+	return nil
 }
 
 // BuildFailed marks the build as failed.
@@ -196,12 +866,38 @@ func (c *Conveyor) BuildFailed(ctx context.Context, buildID string, err error) e
 		return err
 	}
 
-	if err := buildsUpdateState(tx, buildID, StateFailed); err != nil {
+	if _, err := buildsUpdateState(tx, buildID, StateFailed); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.buildFinished(ctx, buildID)
+	return nil
+}
+
+// buildFinished releases the held builds of the repository of a build that's
+// no longer running.
+func (c *Conveyor) buildFinished(ctx context.Context, buildID string) {
+	b, err := c.FindBuild(ctx, buildID)
+	if err != nil {
+		log.Printf("error releasing held builds after build %s: %v", buildID, err)
+		return
+	}
+
+	c.buildsFinished(ctx, b.Repository)
+}
+
+// buildsFinished releases the held builds of a repository, after some of its
+// builds stopped running. Errors are logged, rather than returned, so that
+// they don't fail the build.
+func (c *Conveyor) buildsFinished(ctx context.Context, repository string) {
+	if err := c.releaseBuilds(ctx, repository); err != nil {
+		log.Printf("error releasing held builds of %s: %v", repository, err)
+	}
 }
 
 func insert(tx *sqlx.Tx, sql string, v interface{}, returns ...interface{}) error {
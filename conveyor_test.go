@@ -1,14 +1,22 @@
 package conveyor
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
+	"github.com/google/go-github/github"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/remind101/conveyor/builder"
+	"github.com/remind101/conveyor/logs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -27,10 +35,11 @@ func TestConveyor_Build(t *testing.T) {
 	c.BuildQueue = q
 
 	q.On("Push", builder.BuildOptions{
-		ID:         "<build_id>",
-		Repository: "remind101/acme-inc",
-		Branch:     "master",
-		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
 	}).Once().Return(nil)
 
 	b, err := c.Build(context.Background(), BuildRequest{
@@ -52,16 +61,276 @@ func TestConveyor_Build(t *testing.T) {
 	assert.Equal(t, "139759bd61e98faeec619c45b1060b4288952164", b.Sha)
 }
 
-func TestConveyor_Build_Duplicate(t *testing.T) {
+func TestConveyor_Build_Directives(t *testing.T) {
 	q := new(mockBuildQueue)
 	c := newConveyor(t)
 	c.BuildQueue = q
+	c.AllowedBuildArgs = []string{"RAILS_ENV"}
+
+	directives, err := ParseDirectives("[docker nocache] [docker build-arg RAILS_ENV=staging]")
+	assert.NoError(t, err)
 
 	q.On("Push", builder.BuildOptions{
-		ID:         "<build_id>",
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
+		NoCache:        true,
+		BuildArgs:      map[string]string{"RAILS_ENV": "staging"},
+	}).Once().Return(nil)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		Directives: directives,
+	})
+	assert.NoError(t, err)
+
+	b, err = c.FindBuild(context.Background(), b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, DirectiveList{"docker nocache", "docker build-arg RAILS_ENV=staging"}, b.Directives)
+}
+
+func TestConveyor_Build_BuildArgNotAllowed(t *testing.T) {
+	c := newConveyor(t)
+
+	directives, err := ParseDirectives("[docker build-arg SECRET=x]")
+	assert.NoError(t, err)
+
+	_, err = c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		Directives: directives,
+	})
+	assert.EqualError(t, err, "invalid directive [docker build-arg SECRET=x]: SECRET is not an allowed build arg")
+}
+
+func TestConveyor_Build_AccessDenied(t *testing.T) {
+	c := newConveyor(t)
+	c.Access = AccessPolicy{Organizations: []string{"remind101"}}
+
+	_, err := c.Build(context.Background(), BuildRequest{
+		Repository: "ejholmes/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.IsType(t, &AccessDeniedError{}, err)
+}
+
+func TestConveyor_Build_Disabled(t *testing.T) {
+	c := newConveyor(t)
+
+	r := NewRepository("remind101/acme-inc")
+	r.Enabled = false
+	err := c.CreateRepository(context.Background(), r)
+	assert.NoError(t, err)
+
+	_, err = c.Build(context.Background(), BuildRequest{
 		Repository: "remind101/acme-inc",
 		Branch:     "master",
 		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.EqualError(t, err, "access denied to remind101/acme-inc: repository is disabled")
+}
+
+func TestConveyor_Build_Repository(t *testing.T) {
+	q := new(mockBuildQueue)
+	c := newConveyor(t)
+	c.BuildQueue = q
+
+	r := NewRepository("remind101/acme-inc")
+	r.Image = "quay.io/remind101/acme-inc"
+	r.Timeout = 10 * time.Minute
+	err := c.CreateRepository(context.Background(), r)
+	assert.NoError(t, err)
+
+	q.On("Push", builder.BuildOptions{
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		Image:          "quay.io/remind101/acme-inc",
+		Timeout:        10 * time.Minute,
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
+	}).Once().Return(nil)
+
+	_, err = c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	q.AssertExpectations(t)
+}
+
+func TestConveyor_Build_Paused(t *testing.T) {
+	q := new(mockBuildQueue)
+	c := newConveyor(t)
+	c.BuildQueue = q
+
+	r := NewRepository("remind101/acme-inc")
+	r.Paused = true
+	err := c.CreateRepository(context.Background(), r)
+	assert.NoError(t, err)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StatePending, b.State)
+
+	// Unpausing the repository should release the held build.
+	q.On("Push", builder.BuildOptions{
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
+	}).Once().Return(nil)
+
+	r.Paused = false
+	err = c.UpdateRepository(context.Background(), r)
+	assert.NoError(t, err)
+
+	q.AssertExpectations(t)
+}
+
+func TestConveyor_Build_ReleasePushError(t *testing.T) {
+	q := new(mockBuildQueue)
+	c := newConveyor(t)
+	c.BuildQueue = q
+	ctx := context.Background()
+
+	r := NewRepository("remind101/acme-inc")
+	r.Paused = true
+	assert.NoError(t, c.CreateRepository(ctx, r))
+
+	_, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	// A build that can't be pushed stays held, and is released again
+	// later.
+	q.On("Push", mock.Anything).Once().Return(errors.New("queue unavailable"))
+	q.On("Push", mock.Anything).Once().Return(nil)
+
+	r.Paused = false
+	assert.NoError(t, c.UpdateRepository(ctx, r))
+	assert.NoError(t, c.releaseBuilds(ctx, "remind101/acme-inc"))
+
+	q.AssertExpectations(t)
+}
+
+func TestConveyor_Build_Ref(t *testing.T) {
+	q := new(mockBuildQueue)
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.BuildQueue = q
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+
+	g.On("ResolveRef", "remind101", "acme-inc", "pull/42/head").Return(&Ref{
+		Sha:         "139759bd61e98faeec619c45b1060b4288952164",
+		Branch:      "feature",
+		PullRequest: 42,
+	}, nil)
+	q.On("Push", builder.BuildOptions{
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "feature",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
+		PullRequest:    42,
+	}).Once().Return(nil)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Ref:        "pull/42/head",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "feature", b.Branch)
+	assert.Equal(t, 42, *b.PullRequest)
+}
+
+func TestConveyor_Build_ForkBranch(t *testing.T) {
+	// A fork can name its branch anything, including a branch that's
+	// allowed to build.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/remind101/acme-inc/pulls/42":
+			fmt.Fprint(w, `{"head": {"ref": "master", "sha": "139759bd61e98faeec619c45b1060b4288952164", "repo": {"full_name": "ejholmes/acme-inc"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	gc := github.NewClient(nil)
+	gc.BaseURL, _ = url.Parse(ts.URL + "/")
+
+	q := new(mockBuildQueue)
+	c := newConveyor(t)
+	c.BuildQueue = q
+	c.GitHub = &mockGitHubApp{GitHubAPI: NewGitHub(gc)}
+	c.Access = AccessPolicy{Branches: []string{"master"}}
+
+	_, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Ref:        "pull/42/head",
+	})
+	assert.EqualError(t, err, "access denied to remind101/acme-inc: only branches can be built")
+	q.AssertNotCalled(t, "Push", mock.Anything)
+}
+
+func TestConveyor_Build_Private(t *testing.T) {
+	q := new(mockBuildQueue)
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.BuildQueue = q
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	c.PrivateLogEncoding = "gzip+aes-gcm"
+
+	// Builds from the API don't say whether the repository is private,
+	// so it's looked up.
+	g.On("Private", "remind101", "acme-inc").Return(true, nil)
+	q.On("Push", builder.BuildOptions{
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
+	}).Once().Return(nil)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip+aes-gcm", b.LogEncoding)
+
+	g.AssertExpectations(t)
+}
+
+func TestConveyor_Build_Duplicate(t *testing.T) {
+	q := new(mockBuildQueue)
+	c := newConveyor(t)
+	c.BuildQueue = q
+
+	q.On("Push", builder.BuildOptions{
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
 	}).Once().Return(nil)
 
 	b, err := c.Build(context.Background(), BuildRequest{
@@ -120,7 +389,8 @@ func TestConveyor_BuildComplete(t *testing.T) {
 	assert.NoError(t, err)
 
 	image := "remind101/acme-inc:139759bd61e98faeec619c45b1060b4288952164"
-	err = c.BuildComplete(context.Background(), b.ID, image)
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
+	err = c.BuildComplete(context.Background(), b.ID, image, nil)
 	assert.NoError(t, err)
 
 	b, err = c.FindBuild(context.Background(), b.ID)
@@ -130,6 +400,46 @@ func TestConveyor_BuildComplete(t *testing.T) {
 	assert.Equal(t, StateSucceeded, b.State)
 }
 
+func TestConveyor_BuildComplete_Images(t *testing.T) {
+	c := newConveyor(t)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	digest := "sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d"
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
+	err = c.BuildComplete(context.Background(), b.ID, "remind101/acme-inc@"+digest, []builder.Image{
+		{
+			Repository: "docker.io/remind101/acme-inc",
+			Digest:     digest,
+			Tags:       []string{"139759bd61e98faeec619c45b1060b4288952164", "master", "latest"},
+		},
+		{
+			Name:       "migrations",
+			Repository: "docker.io/remind101/acme-inc-migrations",
+			Digest:     digest,
+			Tags:       []string{"139759bd61e98faeec619c45b1060b4288952164"},
+		},
+	})
+	assert.NoError(t, err)
+
+	a, err := c.FindArtifact(context.Background(), "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164")
+	assert.NoError(t, err)
+	assert.Equal(t, "", a.Name)
+	assert.Equal(t, "remind101/acme-inc@"+digest, a.Image)
+	assert.Equal(t, digest, a.Digest)
+	assert.Equal(t, Tags{"139759bd61e98faeec619c45b1060b4288952164", "master", "latest"}, a.Tags)
+
+	a, err = c.FindArtifact(context.Background(), "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164/migrations")
+	assert.NoError(t, err)
+	assert.Equal(t, "migrations", a.Name)
+	assert.Equal(t, "remind101/acme-inc-migrations@"+digest, a.Image)
+}
+
 func TestConveyor_BuildFailed(t *testing.T) {
 	c := newConveyor(t)
 
@@ -140,6 +450,7 @@ func TestConveyor_BuildFailed(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
 	err = c.BuildFailed(context.Background(), b.ID, errors.New("Docker error"))
 	assert.NoError(t, err)
 
@@ -150,16 +461,178 @@ func TestConveyor_BuildFailed(t *testing.T) {
 	assert.Equal(t, StateFailed, b.State)
 }
 
+func TestConveyor_FailStaleBuilds(t *testing.T) {
+	c := newConveyor(t)
+	ctx := context.Background()
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, c.BuildStarted(ctx, b.ID))
+
+	builds, err := c.FailStaleBuilds(ctx, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(builds))
+
+	builds, err = c.FailStaleBuilds(ctx, -time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(builds))
+
+	b, err = c.FindBuild(ctx, b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateFailed, b.State)
+}
+
+func TestConveyor_FailStaleBuilds_Timeout(t *testing.T) {
+	c := newConveyor(t)
+	ctx := context.Background()
+
+	// Builds of a repository with a timeout are stale relative to it.
+	r := NewRepository("remind101/acme-inc")
+	r.Timeout = 2 * time.Hour
+	assert.NoError(t, c.CreateRepository(ctx, r))
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, b.Timeout)
+	assert.NoError(t, c.BuildStarted(ctx, b.ID))
+
+	builds, err := c.FailStaleBuilds(ctx, -time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(builds))
+}
+
+func TestConveyor_BuildComplete_NotBuilding(t *testing.T) {
+	c := newConveyor(t)
+	ctx := context.Background()
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, c.BuildStarted(ctx, b.ID))
+
+	builds, err := c.FailStaleBuilds(ctx, -time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(builds))
+
+	// A build that was failed as stale stays failed when its worker
+	// finishes it.
+	assert.NoError(t, c.BuildComplete(ctx, b.ID, "remind101/acme-inc:139759bd61e98faeec619c45b1060b4288952164", nil))
+
+	b, err = c.FindBuild(ctx, b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateFailed, b.State)
+
+	_, err = c.FindArtifact(ctx, "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164")
+	assert.Error(t, err)
+}
+
+func TestConveyor_AttachPullRequest(t *testing.T) {
+	c := newConveyor(t)
+	ctx := context.Background()
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "feature",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	req := BuildRequest{
+		Repository:  "remind101/acme-inc",
+		Branch:      "feature",
+		Sha:         "139759bd61e98faeec619c45b1060b4288952164",
+		PullRequest: 42,
+	}
+	attached, err := c.AttachPullRequest(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, b.ID, attached.ID)
+	assert.Equal(t, 42, *attached.PullRequest)
+
+	// A build that already relates to a pull request is left alone.
+	req.PullRequest = 43
+	attached, err = c.AttachPullRequest(ctx, req)
+	assert.NoError(t, err)
+	assert.Nil(t, attached)
+}
+
+func TestConveyor_CancelPullRequest(t *testing.T) {
+	c := newConveyor(t)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository:  "remind101/acme-inc",
+		Branch:      "feature",
+		Sha:         "139759bd61e98faeec619c45b1060b4288952164",
+		PullRequest: 42,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, *b.PullRequest)
+
+	canceled, err := c.CancelPullRequest(context.Background(), "remind101/acme-inc", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(canceled))
+
+	ok, err := c.IsCanceled(context.Background(), b.ID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// Canceled builds can't be started, and stay canceled.
+	err = c.BuildStarted(context.Background(), b.ID)
+	assert.Equal(t, ErrBuildCanceled, err)
+
+	err = c.BuildFailed(context.Background(), b.ID, errors.New("context canceled"))
+	assert.NoError(t, err)
+
+	builds, err := c.FindPullRequestBuilds(context.Background(), "remind101/acme-inc", 42)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(builds))
+	assert.Equal(t, StateCanceled, builds[0].State)
+}
+
+func TestConveyor_CancelBuild(t *testing.T) {
+	c := newConveyor(t)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	canceled, err := c.CancelBuild(context.Background(), b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, b.ID, canceled.ID)
+	assert.Equal(t, StateCanceled, canceled.State)
+	assert.NotNil(t, canceled.CompletedAt)
+
+	_, err = c.CancelBuild(context.Background(), b.ID)
+	assert.Equal(t, ErrBuildFinished, err)
+
+	_, err = c.CancelBuild(context.Background(), "01234567-89ab-cdef-0123-456789abcdef")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
 func TestConveyor_FindArtifact(t *testing.T) {
 	q := new(mockBuildQueue)
 	c := newConveyor(t)
 	c.BuildQueue = q
 
 	q.On("Push", builder.BuildOptions{
-		ID:         "<build_id>",
-		Repository: "remind101/acme-inc",
-		Branch:     "master",
-		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
 	}).Once().Return(nil)
 
 	b, err := c.Build(context.Background(), BuildRequest{
@@ -170,7 +643,8 @@ func TestConveyor_FindArtifact(t *testing.T) {
 	assert.NoError(t, err)
 
 	image := "remind101/acme-inc:139759bd61e98faeec619c45b1060b4288952164"
-	err = c.BuildComplete(context.Background(), b.ID, image)
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
+	err = c.BuildComplete(context.Background(), b.ID, image, nil)
 	assert.NoError(t, err)
 
 	// Find by repo@sha
@@ -186,6 +660,39 @@ func TestConveyor_FindArtifact(t *testing.T) {
 	assert.Equal(t, image, a.Image)
 }
 
+func TestConveyor_FindArtifact_Tag(t *testing.T) {
+	q := new(mockBuildQueue)
+	c := newConveyor(t)
+	c.BuildQueue = q
+
+	q.On("Push", builder.BuildOptions{
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Tag:            "v1.4.2",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
+	}).Once().Return(nil)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Tag:        "v1.4.2",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.4.2", b.Tag)
+
+	image := "remind101/acme-inc:v1.4.2"
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
+	err = c.BuildComplete(context.Background(), b.ID, image, nil)
+	assert.NoError(t, err)
+
+	// Find by repo@tag
+	a, err := c.FindArtifact(context.Background(), "remind101/acme-inc@v1.4.2")
+	assert.NoError(t, err)
+	assert.Equal(t, image, a.Image)
+	assert.Equal(t, b.ID, a.BuildID)
+}
+
 // This tests the case where we have a previous successful build for a sha that
 // resulted in an artifact, but we re-triggered the build. We want to return the
 // artifacts from the previous successful build until the new build is
@@ -196,10 +703,11 @@ func TestConveyor_FindArtifact_PendingBuild(t *testing.T) {
 	c.BuildQueue = q
 
 	q.On("Push", builder.BuildOptions{
-		ID:         "<build_id>",
-		Repository: "remind101/acme-inc",
-		Branch:     "master",
-		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		ID:             "<build_id>",
+		Repository:     "remind101/acme-inc",
+		InstallationID: 1,
+		Branch:         "master",
+		Sha:            "139759bd61e98faeec619c45b1060b4288952164",
 	}).Twice().Return(nil)
 
 	b, err := c.Build(context.Background(), BuildRequest{
@@ -210,7 +718,8 @@ func TestConveyor_FindArtifact_PendingBuild(t *testing.T) {
 	assert.NoError(t, err)
 
 	image := "remind101/acme-inc:139759bd61e98faeec619c45b1060b4288952164"
-	err = c.BuildComplete(context.Background(), b.ID, image)
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
+	err = c.BuildComplete(context.Background(), b.ID, image, nil)
 	assert.NoError(t, err)
 
 	successfulBuild := b
@@ -230,7 +739,8 @@ func TestConveyor_FindArtifact_PendingBuild(t *testing.T) {
 	assert.Equal(t, successfulBuild.ID, a.BuildID)
 
 	// Mark the new build as complete. New artifact.
-	err = c.BuildComplete(context.Background(), b.ID, image)
+	assert.NoError(t, c.BuildStarted(context.Background(), b.ID))
+	err = c.BuildComplete(context.Background(), b.ID, image, nil)
 	assert.NoError(t, err)
 
 	newBuild := b
@@ -241,6 +751,494 @@ func TestConveyor_FindArtifact_PendingBuild(t *testing.T) {
 	assert.Equal(t, newBuild.ID, a.BuildID)
 }
 
+func TestConveyor_RecordSteps(t *testing.T) {
+	c := newConveyor(t)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	err = c.RecordSteps(context.Background(), b.ID, []builder.Step{
+		{Number: 1, Total: 2, Instruction: "FROM ubuntu:14.04", Cached: true, StartedAt: time.Now(), Duration: time.Second},
+		{Number: 2, Total: 2, Instruction: "RUN make", StartedAt: time.Now(), Duration: time.Minute},
+	})
+	assert.NoError(t, err)
+
+	steps, err := c.FindSteps(context.Background(), "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(steps))
+	assert.Equal(t, "FROM ubuntu:14.04", steps[0].Instruction)
+	assert.True(t, steps[0].Cached)
+	assert.Equal(t, time.Minute, steps[1].Duration)
+}
+
+func TestConveyor_LogsTruncated(t *testing.T) {
+	c := newConveyor(t)
+
+	b, err := c.Build(context.Background(), BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.False(t, b.LogsTruncated)
+
+	err = c.LogsTruncated(context.Background(), b.ID)
+	assert.NoError(t, err)
+
+	b, err = c.FindBuild(context.Background(), b.ID)
+	assert.NoError(t, err)
+	assert.True(t, b.LogsTruncated)
+}
+
+func TestConveyor_GC(t *testing.T) {
+	c := newConveyor(t)
+	c.Logger = logs.Discard
+	ctx := context.Background()
+
+	var builds []*Build
+	for _, sha := range []string{"a", "b", "c"} {
+		b, err := c.Build(ctx, BuildRequest{
+			Repository: "remind101/acme-inc",
+			Branch:     "master",
+			Sha:        sha,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, c.BuildStarted(ctx, b.ID))
+		assert.NoError(t, c.BuildComplete(ctx, b.ID, "remind101/acme-inc:"+sha, nil))
+		builds = append(builds, b)
+	}
+
+	p := RetentionPolicy{KeepBuilds: 1}
+
+	r, err := c.GC(ctx, p, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(r.Builds))
+
+	// Nothing is deleted in a dry run.
+	_, err = c.FindBuild(ctx, builds[0].ID)
+	assert.NoError(t, err)
+
+	r, err = c.GC(ctx, p, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(r.Builds))
+	assert.Equal(t, builds[0].ID, r.Builds[0].ID)
+	assert.Equal(t, builds[1].ID, r.Builds[1].ID)
+
+	_, err = c.FindBuild(ctx, builds[0].ID)
+	assert.Error(t, err)
+	_, err = c.FindArtifact(ctx, "remind101/acme-inc@c")
+	assert.NoError(t, err)
+}
+
+func TestConveyor_GC_FailedLogs(t *testing.T) {
+	c := newConveyor(t)
+	c.Logger = logs.Discard
+	ctx := context.Background()
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, c.BuildStarted(ctx, b.ID))
+	assert.NoError(t, c.BuildFailed(ctx, b.ID, errors.New("boom")))
+
+	now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	defer func() { now = time.Now }()
+
+	r, err := c.GC(ctx, RetentionPolicy{FailedLogsTTL: 24 * time.Hour}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(r.Logs))
+
+	_, err = c.Logs(ctx, b.ID)
+	assert.Equal(t, ErrLogsDeleted, err)
+}
+
+func TestConveyor_GC_Locked(t *testing.T) {
+	c := newConveyor(t)
+	ctx := context.Background()
+
+	unlock, err := c.lockGC(ctx)
+	assert.NoError(t, err)
+
+	_, err = c.GC(ctx, RetentionPolicy{}, false)
+	assert.Equal(t, ErrGCLocked, err)
+
+	// Dry runs don't delete anything, so they don't need the lock.
+	_, err = c.GC(ctx, RetentionPolicy{}, true)
+	assert.NoError(t, err)
+
+	unlock()
+	_, err = c.GC(ctx, RetentionPolicy{}, false)
+	assert.NoError(t, err)
+}
+
+func TestConveyor_Deliveries(t *testing.T) {
+	c := newConveyor(t)
+	c.Logger = logs.Discard
+	ctx := context.Background()
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	d := &Delivery{
+		DeliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		Event:      "push",
+		Repository: "remind101/acme-inc",
+		Headers:    DeliveryHeaders{"X-Github-Event": "push"},
+		Payload:    `{}`,
+		Status:     200,
+		Response:   b.ID,
+		BuildID:    &b.ID,
+	}
+	assert.NoError(t, c.RecordDelivery(ctx, d))
+	assert.NotEqual(t, "", d.ID)
+
+	replay := &Delivery{
+		DeliveryID: d.DeliveryID,
+		Event:      "push",
+		Payload:    `{}`,
+		Status:     200,
+		ReplayOf:   &d.ID,
+	}
+	assert.NoError(t, c.RecordDelivery(ctx, replay))
+
+	deliveries, err := c.Deliveries(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(deliveries))
+	assert.Equal(t, replay.ID, deliveries[0].ID)
+	assert.Equal(t, &d.ID, deliveries[0].ReplayOf)
+
+	found, err := c.FindDelivery(ctx, d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, DeliveryHeaders{"X-Github-Event": "push"}, found.Headers)
+	assert.Equal(t, &b.ID, found.BuildID)
+
+	handled, err := c.DeliveryHandled(ctx, d.DeliveryID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, handled)
+
+	handled, err = c.DeliveryHandled(ctx, d.DeliveryID, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, handled)
+
+	// Deliveries that failed can be redelivered.
+	failed := &Delivery{
+		DeliveryID: "a1a2ea9c-cc78-11e3-81ab-4c9367dc0958",
+		Event:      "push",
+		Payload:    `{}`,
+		Status:     500,
+	}
+	assert.NoError(t, c.RecordDelivery(ctx, failed))
+	handled, err = c.DeliveryHandled(ctx, failed.DeliveryID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, handled)
+
+	now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	defer func() { now = time.Now }()
+
+	r, err := c.GC(ctx, RetentionPolicy{DeliveriesTTL: 24 * time.Hour}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, r.Deliveries)
+
+	_, err = c.FindDelivery(ctx, d.ID)
+	assert.Error(t, err)
+}
+
+func TestConveyor_Setup(t *testing.T) {
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	c.Webhook = WebhookConfig{URL: "https://conveyor.example.com", Secret: "secret"}
+	ctx := context.Background()
+
+	hook := &github.Hook{
+		Name:   github.String("web"),
+		Events: []string{"push", "pull_request"},
+		Active: github.Bool(true),
+		Config: map[string]interface{}{
+			"url":          "https://conveyor.example.com",
+			"content_type": "json",
+			"secret":       "secret",
+			"insecure_ssl": "0",
+		},
+	}
+	g.On("Hooks", "remind101", "acme-inc").Return([]*github.Hook{
+		{ID: github.Int64(1), Config: map[string]interface{}{"url": "https://ci.example.com"}},
+	}, nil)
+	g.On("CreateHook", "remind101", "acme-inc", hook).Return(&github.Hook{ID: github.Int64(2)}, nil)
+	g.On("PingHook", "remind101", "acme-inc", int64(2)).Return(nil).Run(func(mock.Arguments) {
+		// A ping for another webhook.
+		assert.NoError(t, c.RecordDelivery(ctx, &Delivery{
+			Event:   "ping",
+			Payload: `{"hook_id": 1}`,
+			Status:  200,
+		}))
+		assert.NoError(t, c.RecordDelivery(ctx, &Delivery{
+			Event:    "ping",
+			Payload:  `{"hook_id": 2}`,
+			Status:   200,
+			Response: "Ok\n",
+		}))
+	})
+
+	w, err := c.Setup(ctx, SetupRequest{
+		Repository:   "remind101/acme-inc",
+		PullRequests: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), w.ID)
+	assert.True(t, w.Created)
+	assert.Equal(t, `{"hook_id": 2}`, w.Ping.Payload)
+
+	r, err := c.FindRepository(ctx, "remind101/acme-inc")
+	assert.NoError(t, err)
+	assert.True(t, r.Enabled)
+
+	g.AssertExpectations(t)
+}
+
+func TestConveyor_Setup_Timeout(t *testing.T) {
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	c.Webhook = WebhookConfig{URL: "https://conveyor.example.com", Secret: "secret", PingTimeout: time.Millisecond}
+	ctx := context.Background()
+
+	g.On("Hooks", "remind101", "acme-inc").Return([]*github.Hook{
+		{ID: github.Int64(1), Events: []string{"issue_comment", "push"}, Config: map[string]interface{}{"url": "https://conveyor.example.com/"}},
+	}, nil)
+	// The events that the webhook is already subscribed to are kept.
+	g.On("EditHook", "remind101", "acme-inc", int64(1), &github.Hook{
+		Events: []string{"issue_comment", "push"},
+		Active: github.Bool(true),
+		Config: map[string]interface{}{
+			"url":          "https://conveyor.example.com",
+			"content_type": "json",
+			"secret":       "secret",
+			"insecure_ssl": "0",
+		},
+	}).Return(&github.Hook{ID: github.Int64(1)}, nil)
+	g.On("PingHook", "remind101", "acme-inc", int64(1)).Return(nil)
+
+	_, err := c.Setup(ctx, SetupRequest{Repository: "remind101/acme-inc"})
+	assert.EqualError(t, err, "setup of remind101/acme-inc failed: the ping wasn't delivered within 1ms; check that https://conveyor.example.com is reachable from GitHub, and that the server's secret matches")
+
+	// The repository is only registered once the webhook works.
+	_, err = c.FindRepository(ctx, "remind101/acme-inc")
+	assert.Error(t, err)
+
+	g.AssertExpectations(t)
+}
+
+func TestConveyor_Setup_NoSecret(t *testing.T) {
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	c.Webhook = WebhookConfig{URL: "https://conveyor.example.com"}
+
+	_, err := c.Setup(context.Background(), SetupRequest{Repository: "remind101/acme-inc"})
+	assert.EqualError(t, err, "setup of remind101/acme-inc failed: the webhook secret isn't configured")
+	g.AssertNotCalled(t, "CreateHook", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestMergeEvents(t *testing.T) {
+	assert.Equal(t, []string{"push", "pull_request"}, mergeEvents(nil, []string{"push", "pull_request"}))
+	assert.Equal(t, []string{"issue_comment", "push", "check_run", "pull_request"}, mergeEvents([]string{"issue_comment", "push", "check_run"}, []string{"push", "pull_request"}))
+}
+
+func TestConveyor_UpdateStatuses(t *testing.T) {
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	ctx := context.Background()
+
+	b, err := c.Build(ctx, BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	})
+	assert.NoError(t, err)
+
+	err = c.QueueCheckRun(ctx, builder.BuildOptions{
+		ID:         b.ID,
+		Repository: "remind101/acme-inc",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	}, &builder.CheckRun{
+		Name:       builder.Context,
+		HeadSHA:    "139759bd61e98faeec619c45b1060b4288952164",
+		ExternalID: b.ID,
+		Status:     builder.CheckRunInProgress,
+	})
+	assert.NoError(t, err)
+
+	updates, err := c.PendingStatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(updates))
+
+	// The first update creates the check run, and the next one updates
+	// it.
+	g.On("CreateCheckRun", "remind101", "acme-inc", &builder.CheckRun{
+		Name:       builder.Context,
+		HeadSHA:    "139759bd61e98faeec619c45b1060b4288952164",
+		ExternalID: b.ID,
+		Status:     builder.CheckRunQueued,
+	}).Return(&builder.CheckRun{ID: 1}, nil)
+	g.On("UpdateCheckRun", "remind101", "acme-inc", int64(1), &builder.CheckRun{
+		Name:       builder.Context,
+		ExternalID: b.ID,
+		Status:     builder.CheckRunInProgress,
+	}).Return(nil)
+
+	assert.NoError(t, c.UpdateStatuses(ctx))
+	g.AssertExpectations(t)
+
+	updates, err = c.PendingStatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(updates))
+
+	b, err = c.FindBuild(ctx, b.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), *b.CheckRunID)
+}
+
+func TestConveyor_UpdateStatuses_Retry(t *testing.T) {
+	// Updates that were just queued are due.
+	t0 := time.Now().UTC().Add(time.Minute).Truncate(time.Second)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	ctx := context.Background()
+
+	opts := builder.BuildOptions{
+		Repository: "remind101/acme-inc",
+		Sha:        "abcd",
+	}
+	pending := &github.RepoStatus{State: github.String("pending")}
+	success := &github.RepoStatus{State: github.String("success")}
+	assert.NoError(t, c.QueueStatus(ctx, opts, pending))
+	assert.NoError(t, c.QueueStatus(ctx, opts, success))
+
+	// The second status isn't applied until the first one succeeds.
+	g.On("CreateStatus", "remind101", "acme-inc", "abcd", pending).Once().Return(errors.New("502 Bad Gateway"))
+	assert.NoError(t, c.UpdateStatuses(ctx))
+	g.AssertExpectations(t)
+
+	updates, err := c.PendingStatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(updates))
+	assert.Equal(t, 1, updates[0].Attempts)
+	assert.Equal(t, "502 Bad Gateway", updates[0].LastError)
+	assert.Equal(t, t0.Add(time.Second).Unix(), updates[0].NextAttemptAt.Unix())
+
+	now = func() time.Time { return t0.Add(time.Second) }
+	g.On("CreateStatus", "remind101", "acme-inc", "abcd", pending).Once().Return(nil)
+	g.On("CreateStatus", "remind101", "acme-inc", "abcd", success).Once().Return(nil)
+	assert.NoError(t, c.UpdateStatuses(ctx))
+	g.AssertExpectations(t)
+
+	updates, err = c.PendingStatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(updates))
+}
+
+func TestConveyor_UpdateStatuses_RateLimit(t *testing.T) {
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	ctx := context.Background()
+
+	status := &github.RepoStatus{State: github.String("pending")}
+	assert.NoError(t, c.QueueStatus(ctx, builder.BuildOptions{Repository: "remind101/acme-inc", Sha: "a"}, status))
+	assert.NoError(t, c.QueueStatus(ctx, builder.BuildOptions{Repository: "remind101/acme-inc", Sha: "b"}, status))
+
+	// All pending updates wait for the rate limit to reset.
+	reset := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	g.On("CreateStatus", "remind101", "acme-inc", "a", status).Once().Return(&github.RateLimitError{
+		Rate: github.Rate{Reset: github.Timestamp{Time: reset}},
+	})
+	assert.NoError(t, c.UpdateStatuses(ctx))
+	g.AssertExpectations(t)
+
+	updates, err := c.PendingStatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(updates))
+	for _, u := range updates {
+		assert.Equal(t, 0, u.Attempts)
+		assert.Equal(t, reset.Unix(), u.NextAttemptAt.Unix())
+	}
+}
+
+func TestConveyor_UpdateStatuses_Lease(t *testing.T) {
+	g := new(mockGitHub)
+	c := newConveyor(t)
+	c.GitHub = &mockGitHubApp{GitHubAPI: g}
+	ctx := context.Background()
+
+	status := &github.RepoStatus{State: github.String("pending")}
+	assert.NoError(t, c.QueueStatus(ctx, builder.BuildOptions{Repository: "remind101/acme-inc", Sha: "abcd"}, status))
+
+	// Another worker claimed the update, and died before applying it.
+	assert.NoError(t, c.inTx(func(tx *sqlx.Tx) error {
+		_, err := statusUpdatesClaim(tx, time.Now().UTC())
+		return err
+	}))
+	assert.NoError(t, c.UpdateStatuses(ctx))
+	g.AssertNotCalled(t, "CreateStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Once the lease expires, the update is tried again.
+	now = func() time.Time { return time.Now().Add(statusUpdateLease + time.Minute) }
+	defer func() { now = time.Now }()
+
+	g.On("CreateStatus", "remind101", "acme-inc", "abcd", status).Once().Return(nil)
+	assert.NoError(t, c.UpdateStatuses(ctx))
+	g.AssertExpectations(t)
+
+	updates, err := c.PendingStatusUpdates(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(updates))
+
+	// Completed updates are garbage collected.
+	r, err := c.GC(ctx, RetentionPolicy{StatusUpdatesTTL: time.Minute}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, r.StatusUpdates)
+
+	now = func() time.Time { return time.Now().Add(statusUpdateLease + time.Hour) }
+	r, err = c.GC(ctx, RetentionPolicy{StatusUpdatesTTL: time.Minute}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, r.StatusUpdates)
+}
+
+func TestStatusUpdateBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{10, 512 * time.Second},
+		{11, maxStatusUpdateBackoff},
+		{14, maxStatusUpdateBackoff},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.backoff, statusUpdateBackoff(tt.attempts), "attempt %d", tt.attempts)
+	}
+}
+
 func newConveyor(t testing.TB) *Conveyor {
 	db := sqlx.MustConnect("postgres", databaseURL)
 	if err := Reset(db); err != nil {
@@ -249,6 +1247,7 @@ func newConveyor(t testing.TB) *Conveyor {
 
 	c := New(db)
 	c.BuildQueue = NewBuildQueue(100)
+	c.GitHub = &mockGitHubApp{GitHubAPI: new(mockGitHub)}
 
 	return c
 }
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN pull_request integer;
+CREATE INDEX builds_pull_request ON builds USING btree (repository, pull_request) WHERE pull_request IS NOT NULL;
+
+-- +migrate Down
+DROP INDEX builds_pull_request;
+ALTER TABLE builds DROP COLUMN pull_request;
@@ -0,0 +1,25 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN check_run_id bigint;
+
+CREATE TABLE status_updates (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  seq SERIAL,
+  build_id uuid references builds(id) ON DELETE CASCADE,
+  repository text NOT NULL,
+  sha text NOT NULL,
+  kind text NOT NULL,
+  payload text NOT NULL,
+  state text NOT NULL DEFAULT 'pending',
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text NOT NULL DEFAULT '',
+  next_attempt_at timestamp without time zone default (now() at time zone 'utc') NOT NULL,
+  created_at timestamp without time zone default (now() at time zone 'utc') NOT NULL,
+  completed_at timestamp without time zone
+);
+
+-- Updates are applied in order for each commit.
+CREATE INDEX status_updates_pending ON status_updates USING btree (repository, sha, seq) WHERE state = 'pending';
+
+-- +migrate Down
+DROP TABLE status_updates;
+ALTER TABLE builds DROP COLUMN check_run_id;
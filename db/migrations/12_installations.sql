@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN installation_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE status_updates ADD COLUMN installation_id bigint NOT NULL DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE status_updates DROP COLUMN installation_id;
+ALTER TABLE builds DROP COLUMN installation_id;
@@ -0,0 +1,20 @@
+-- +migrate Up
+CREATE TABLE deliveries (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  seq SERIAL,
+  delivery_id text NOT NULL DEFAULT '',
+  event text NOT NULL,
+  repository text NOT NULL DEFAULT '',
+  headers text NOT NULL DEFAULT '{}',
+  payload text NOT NULL,
+  status integer NOT NULL,
+  response text NOT NULL DEFAULT '',
+  build_id uuid references builds(id) ON DELETE SET NULL,
+  replay_of uuid references deliveries(id) ON DELETE SET NULL,
+  created_at timestamp without time zone default (now() at time zone 'utc') NOT NULL
+);
+
+CREATE INDEX deliveries_created_at ON deliveries USING btree (created_at);
+
+-- +migrate Down
+DROP TABLE deliveries;
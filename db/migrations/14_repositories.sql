@@ -0,0 +1,29 @@
+-- +migrate Up
+CREATE TABLE repositories (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  name text NOT NULL,
+  enabled boolean NOT NULL DEFAULT true,
+  paused boolean NOT NULL DEFAULT false,
+  default_branch text NOT NULL DEFAULT 'master',
+  image text NOT NULL DEFAULT '',
+  builder_image text NOT NULL DEFAULT '',
+  timeout bigint NOT NULL DEFAULT 0,
+  concurrency integer NOT NULL DEFAULT 0,
+  created_at timestamp without time zone default (now() at time zone 'utc') NOT NULL,
+  updated_at timestamp without time zone default (now() at time zone 'utc') NOT NULL
+);
+
+-- GitHub repository names are case insensitive.
+CREATE UNIQUE INDEX unique_repository ON repositories USING btree (lower(name));
+
+-- Builds that are pending, but haven't been pushed onto the build queue
+-- because their repository is paused, or at its concurrency limit.
+CREATE TABLE held_builds (
+  build_id uuid NOT NULL references builds(id) ON DELETE CASCADE primary key,
+  options text NOT NULL,
+  created_at timestamp without time zone default (now() at time zone 'utc') NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE held_builds;
+DROP TABLE repositories;
@@ -0,0 +1,4 @@
+-- +migrate Up
+UPDATE artifacts SET name = replace(name, '/', '.') WHERE name LIKE '%/%';
+
+-- +migrate Down
@@ -0,0 +1,5 @@
+-- +migrate Up
+CREATE INDEX deliveries_delivery_id ON deliveries USING btree (delivery_id);
+
+-- +migrate Down
+DROP INDEX deliveries_delivery_id;
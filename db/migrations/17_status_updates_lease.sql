@@ -0,0 +1,10 @@
+-- +migrate Up
+-- Workers lease a status update while they apply it, so that the transaction
+-- that claims it doesn't have to stay open while GitHub is called.
+ALTER TABLE status_updates ADD COLUMN leased_until timestamp without time zone;
+
+CREATE INDEX status_updates_completed_at ON status_updates USING btree (completed_at) WHERE state IN ('succeeded', 'failed');
+
+-- +migrate Down
+DROP INDEX status_updates_completed_at;
+ALTER TABLE status_updates DROP COLUMN leased_until;
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- How long the build can run, in nanoseconds, or 0 for the worker's default,
+-- so that builds are only considered stale relative to their own timeout.
+ALTER TABLE builds ADD COLUMN timeout bigint NOT NULL DEFAULT 0;
+
+-- +migrate Down
+ALTER TABLE builds DROP COLUMN timeout;
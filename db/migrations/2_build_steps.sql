@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE build_steps (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  build_id uuid NOT NULL references builds(id) ON DELETE CASCADE,
+  number integer NOT NULL,
+  total integer NOT NULL,
+  instruction text NOT NULL,
+  cached boolean NOT NULL,
+  started_at timestamp without time zone NOT NULL,
+  duration bigint NOT NULL
+);
+
+CREATE INDEX index_build_steps_on_build_id ON build_steps USING btree (build_id);
+
+-- +migrate Down
+DROP TABLE build_steps;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN logs_truncated boolean NOT NULL DEFAULT false;
+
+-- +migrate Down
+ALTER TABLE builds DROP COLUMN logs_truncated;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN log_encoding text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE builds DROP COLUMN log_encoding;
@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE artifacts ADD COLUMN digest text NOT NULL DEFAULT '';
+ALTER TABLE artifacts ADD COLUMN tags text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE artifacts DROP COLUMN tags;
+ALTER TABLE artifacts DROP COLUMN digest;
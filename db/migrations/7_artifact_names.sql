@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE artifacts ADD COLUMN name text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE artifacts DROP COLUMN name;
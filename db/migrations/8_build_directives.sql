@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN directives text NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE builds DROP COLUMN directives;
@@ -0,0 +1,12 @@
+-- +migrate Up
+ALTER TABLE builds ADD COLUMN tag text NOT NULL DEFAULT '';
+
+-- A tag can be pushed while a build for the commit it points to is still
+-- running, so only 1 pending/building build is allowed for each sha and tag.
+DROP INDEX unique_build;
+CREATE UNIQUE INDEX unique_build ON builds USING btree (sha, tag) WHERE (state = 'building' OR state = 'pending');
+
+-- +migrate Down
+DROP INDEX unique_build;
+CREATE UNIQUE INDEX unique_build ON builds USING btree (sha) WHERE (state = 'building' OR state = 'pending');
+ALTER TABLE builds DROP COLUMN tag;
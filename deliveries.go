@@ -0,0 +1,173 @@
+package conveyor
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/context"
+)
+
+// maxDeliveries is the number of deliveries returned by Deliveries.
+const maxDeliveries = 50
+
+// Delivery is a record of a webhook delivery from GitHub, and how it was
+// handled.
+type Delivery struct {
+	// A unique identifier for this delivery.
+	ID string `db:"id"`
+	// Autogenerated sequence id.
+	Seq int64 `db:"seq"`
+	// The GUID that GitHub sent in the X-GitHub-Delivery header. Replays
+	// keep the GUID of the original delivery.
+	DeliveryID string `db:"delivery_id"`
+	// The event, from the X-GitHub-Event header, e.g. `push`.
+	Event string `db:"event"`
+	// The repository that the event was for, if any.
+	Repository string `db:"repository"`
+	// The request headers.
+	Headers DeliveryHeaders `db:"headers"`
+	// The raw JSON payload.
+	Payload string `db:"payload"`
+	// The HTTP status code and body of the response. The body is the ID
+	// of the build that was triggered, or the reason that it wasn't.
+	Status   int    `db:"status"`
+	Response string `db:"response"`
+	// The build that the delivery triggered, if any.
+	BuildID *string `db:"build_id"`
+	// The delivery that this is a replay of, if any.
+	ReplayOf *string `db:"replay_of"`
+	// The time that the delivery was received.
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// DeliveryHeaders are the request headers of a webhook delivery.
+type DeliveryHeaders map[string]string
+
+// Scan implements the sql.Scanner interface.
+func (h *DeliveryHeaders) Scan(src interface{}) error {
+	if v, ok := src.([]byte); ok {
+		return json.Unmarshal(v, h)
+	}
+	return nil
+}
+
+// Value implements the driver.Value interface.
+func (h DeliveryHeaders) Value() (driver.Value, error) {
+	if h == nil {
+		return driver.Value("{}"), nil
+	}
+	raw, err := json.Marshal(h)
+	return driver.Value(string(raw)), err
+}
+
+// RecordDelivery records a webhook delivery.
+func (c *Conveyor) RecordDelivery(ctx context.Context, d *Delivery) error {
+	return c.inTx(func(tx *sqlx.Tx) error {
+		return deliveriesCreate(tx, d)
+	})
+}
+
+// DeliveryHandled returns true if a webhook delivery with the GUID that GitHub
+// sent in the X-GitHub-Delivery header was handled successfully since the
+// given time. Deliveries that failed, and replays, don't count, so that failed
+// deliveries can be redelivered.
+func (c *Conveyor) DeliveryHandled(ctx context.Context, deliveryID string, since time.Time) (bool, error) {
+	var handled bool
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		handled, err = deliveriesHandled(tx, deliveryID, since.UTC())
+		return
+	})
+	return handled, err
+}
+
+// Deliveries returns the most recent webhook deliveries, newest first.
+func (c *Conveyor) Deliveries(ctx context.Context) ([]*Delivery, error) {
+	var deliveries []*Delivery
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		deliveries, err = deliveriesFindRecent(tx, maxDeliveries)
+		return
+	})
+	return deliveries, err
+}
+
+// FindDelivery finds a webhook delivery by its id.
+func (c *Conveyor) FindDelivery(ctx context.Context, id string) (*Delivery, error) {
+	var d *Delivery
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		d, err = deliveriesFindByID(tx, id)
+		return
+	})
+	return d, err
+}
+
+// deliveriesCreate inserts a new delivery into the database.
+func deliveriesCreate(tx *sqlx.Tx, d *Delivery) error {
+	const sql = `INSERT INTO deliveries (delivery_id, event, repository, headers, payload, status, response, build_id, replay_of) VALUES (:delivery_id, :event, :repository, :headers, :payload, :status, :response, :build_id, :replay_of) RETURNING id, created_at`
+	return insert(tx, sql, d, &d.ID, &d.CreatedAt)
+}
+
+// deliveriesFindRecent returns the most recent deliveries, newest first.
+func deliveriesFindRecent(tx *sqlx.Tx, limit int) ([]*Delivery, error) {
+	const sql = `SELECT * FROM deliveries ORDER BY seq DESC LIMIT ?`
+	var deliveries []*Delivery
+	err := tx.Select(&deliveries, tx.Rebind(sql), limit)
+	return deliveries, err
+}
+
+// deliveriesFindByID finds a delivery by id.
+func deliveriesFindByID(tx *sqlx.Tx, id string) (*Delivery, error) {
+	const sql = `SELECT * FROM deliveries WHERE id = ? LIMIT 1`
+	var d Delivery
+	err := tx.Get(&d, tx.Rebind(sql), id)
+	return &d, err
+}
+
+// deliveriesHandled returns true if a delivery with the given GUID, that isn't
+// a replay, was handled successfully since the given time.
+func deliveriesHandled(tx *sqlx.Tx, deliveryID string, since time.Time) (bool, error) {
+	const sql = `SELECT count(*) > 0 FROM deliveries WHERE delivery_id = ? AND replay_of IS NULL AND status < 300 AND created_at >= ?`
+	var handled bool
+	err := tx.Get(&handled, tx.Rebind(sql), deliveryID, since)
+	return handled, err
+}
+
+// deliveriesLastSeq returns the seq of the most recent delivery, or 0 if there
+// aren't any.
+func deliveriesLastSeq(tx *sqlx.Tx) (int64, error) {
+	const sql = `SELECT coalesce(max(seq), 0) FROM deliveries`
+	var seq int64
+	err := tx.Get(&seq, sql)
+	return seq, err
+}
+
+// deliveriesFindPings returns the `ping` deliveries that were recorded after the
+// delivery with the given seq, oldest first.
+func deliveriesFindPings(tx *sqlx.Tx, after int64) ([]*Delivery, error) {
+	const sql = `SELECT * FROM deliveries WHERE event = 'ping' AND seq > ? ORDER BY seq ASC`
+	var deliveries []*Delivery
+	err := tx.Select(&deliveries, tx.Rebind(sql), after)
+	return deliveries, err
+}
+
+// deliveriesDeleteExpired deletes the deliveries that were received before the
+// given time, and returns how many were deleted.
+func deliveriesDeleteExpired(tx *sqlx.Tx, before time.Time) (int, error) {
+	const sql = `DELETE FROM deliveries WHERE created_at < ?`
+	res, err := tx.Exec(tx.Rebind(sql), before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// deliveriesCountExpired returns how many deliveries were received before the
+// given time.
+func deliveriesCountExpired(tx *sqlx.Tx, before time.Time) (int, error) {
+	const sql = `SELECT count(*) FROM deliveries WHERE created_at < ?`
+	var n int
+	err := tx.Get(&n, tx.Rebind(sql), before)
+	return n, err
+}
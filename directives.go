@@ -0,0 +1,173 @@
+package conveyor
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Build priorities.
+const (
+	PriorityNormal = ""
+	PriorityHigh   = "high"
+)
+
+// directiveRegexp matches a directive within a commit message, e.g.
+// `[docker nocache]`.
+var directiveRegexp = regexp.MustCompile(`\[([^\[\]\n]+)\]`)
+
+// Directives are instructions for a build that are given in a commit message.
+// The following directives are supported:
+//
+//	[skip conveyor] or [ci skip]      Don't build the commit.
+//	[docker nocache]                  Disable the layer cache.
+//	[docker target=<stage>]           Build the given stage of the Dockerfile.
+//	[docker build-arg <KEY>=<VALUE>]  Pass a build arg to `docker build`.
+//	[conveyor priority=high]          Build ahead of normal priority builds.
+//
+// Anything else in square brackets is ignored.
+type Directives struct {
+	// True if the commit shouldn't be built.
+	Skip bool
+
+	// True if the layer cache should be disabled.
+	NoCache bool
+
+	// The stage to build in a multi-stage Dockerfile.
+	Target string
+
+	// Build args to pass to `docker build`. Only build args that are
+	// allowed by Conveyor.AllowedBuildArgs can be provided.
+	BuildArgs map[string]string
+
+	// The priority of the build.
+	Priority string
+
+	// The directives that were given, as they appeared in the message,
+	// without the surrounding brackets.
+	List DirectiveList
+}
+
+// DirectiveError is returned when a commit message contains a malformed
+// directive.
+type DirectiveError struct {
+	Directive string
+	Reason    string
+}
+
+// Error implements the error interface.
+func (e *DirectiveError) Error() string {
+	return fmt.Sprintf("invalid directive [%s]: %s", e.Directive, e.Reason)
+}
+
+// ParseDirectives parses the directives in a commit message.
+func ParseDirectives(message string) (Directives, error) {
+	var d Directives
+
+	for _, m := range directiveRegexp.FindAllStringSubmatch(message, -1) {
+		directive := strings.Join(strings.Fields(m[1]), " ")
+		ok, err := d.apply(directive)
+		if err != nil {
+			return d, &DirectiveError{Directive: directive, Reason: err.Error()}
+		}
+		if ok {
+			d.List = append(d.List, directive)
+		}
+	}
+
+	return d, nil
+}
+
+// apply applies a single directive, returning false if it isn't a known
+// directive.
+func (d *Directives) apply(directive string) (bool, error) {
+	switch directive {
+	case "skip conveyor", "ci skip", "skip ci":
+		d.Skip = true
+		return true, nil
+	case "docker nocache":
+		d.NoCache = true
+		return true, nil
+	}
+
+	parts := strings.SplitN(directive, " ", 3)
+	if len(parts) < 2 {
+		return false, nil
+	}
+
+	switch {
+	case parts[0] == "docker" && strings.HasPrefix(parts[1], "target="):
+		if len(parts) > 2 {
+			return true, fmt.Errorf("target can't contain spaces")
+		}
+		d.Target = strings.TrimPrefix(parts[1], "target=")
+		if d.Target == "" {
+			return true, fmt.Errorf("target is required")
+		}
+	case parts[0] == "docker" && parts[1] == "build-arg":
+		if len(parts) < 3 {
+			return true, fmt.Errorf("expected KEY=VALUE")
+		}
+		kv := strings.SplitN(parts[2], "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return true, fmt.Errorf("expected KEY=VALUE")
+		}
+		if d.BuildArgs == nil {
+			d.BuildArgs = make(map[string]string)
+		}
+		d.BuildArgs[kv[0]] = kv[1]
+	case parts[0] == "conveyor" && strings.HasPrefix(parts[1], "priority="):
+		switch p := strings.TrimPrefix(parts[1], "priority="); p {
+		case "high":
+			d.Priority = PriorityHigh
+		case "normal":
+			d.Priority = PriorityNormal
+		default:
+			return true, fmt.Errorf("unknown priority: %s", p)
+		}
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// DirectiveList is a list of directives, which is stored as a newline
+// separated string.
+type DirectiveList []string
+
+// Scan implements the sql.Scanner interface.
+func (l *DirectiveList) Scan(src interface{}) error {
+	if v, ok := src.([]byte); ok {
+		*l = nil
+		if len(v) > 0 {
+			*l = strings.Split(string(v), "\n")
+		}
+	}
+
+	return nil
+}
+
+// Parse parses the directives in the list, e.g. so that a build can be rebuilt
+// with the same directives.
+func (l DirectiveList) Parse() (Directives, error) {
+	var d Directives
+
+	for _, directive := range l {
+		ok, err := d.apply(directive)
+		if err != nil {
+			return d, &DirectiveError{Directive: directive, Reason: err.Error()}
+		}
+		if ok {
+			d.List = append(d.List, directive)
+		}
+	}
+
+	return d, nil
+}
+
+// Value implements the driver.Value interface.
+func (l DirectiveList) Value() (driver.Value, error) {
+	return driver.Value(strings.Join(l, "\n")), nil
+}
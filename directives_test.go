@@ -0,0 +1,62 @@
+package conveyor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Directives
+	}{
+		{"testing", Directives{}},
+		{"[docker nocache]", Directives{NoCache: true, List: DirectiveList{"docker nocache"}}},
+		{"this is a commit [docker nocache]", Directives{NoCache: true, List: DirectiveList{"docker nocache"}}},
+		{"Update docs [ci skip]", Directives{Skip: true, List: DirectiveList{"ci skip"}}},
+		{"Update docs\n\n[skip conveyor]", Directives{Skip: true, List: DirectiveList{"skip conveyor"}}},
+		{"[docker target=release]", Directives{Target: "release", List: DirectiveList{"docker target=release"}}},
+		{"[conveyor priority=high]", Directives{Priority: PriorityHigh, List: DirectiveList{"conveyor priority=high"}}},
+		{"[docker build-arg RAILS_ENV=staging] [docker build-arg GREETING=hello world]", Directives{
+			BuildArgs: map[string]string{"RAILS_ENV": "staging", "GREETING": "hello world"},
+			List:      DirectiveList{"docker build-arg RAILS_ENV=staging", "docker build-arg GREETING=hello world"},
+		}},
+		{"Fix [WIP] [docker  nocache]", Directives{NoCache: true, List: DirectiveList{"docker nocache"}}},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDirectives(tt.in)
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.out, d, tt.in)
+	}
+}
+
+func TestParseDirectives_Invalid(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"[docker target=]", "invalid directive [docker target=]: target is required"},
+		{"[docker build-arg FOO]", "invalid directive [docker build-arg FOO]: expected KEY=VALUE"},
+		{"[conveyor priority=urgent]", "invalid directive [conveyor priority=urgent]: unknown priority: urgent"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseDirectives(tt.in)
+		if assert.Error(t, err, tt.in) {
+			assert.Equal(t, tt.err, err.Error())
+		}
+	}
+}
+
+func TestDirectiveList_Parse(t *testing.T) {
+	d, err := ParseDirectives("Release\n\n[docker nocache] [docker target=release] [docker build-arg VERSION=1.2] [conveyor priority=high]")
+	assert.NoError(t, err)
+
+	// The directives that are stored with a build are parsed the same way
+	// as the commit message.
+	parsed, err := d.List.Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, d, parsed)
+}
@@ -1,36 +1,302 @@
 package conveyor
 
 import (
-	"context"
 	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 
+	"golang.org/x/net/context"
+
 	"github.com/google/go-github/github"
+	"github.com/remind101/conveyor/builder"
 )
 
 // GitHubAPI represents an interface for performing Git operations.
 type GitHubAPI interface {
-	ResolveBranch(ctx context.Context, owner, repo, branch string) (sha string, err error)
+	// ResolveRef resolves a branch, tag, short or full sha, or pull
+	// request ref (`pull/123/head`) to the commit that it points to.
+	ResolveRef(ctx context.Context, owner, repo, ref string) (*Ref, error)
+
+	// Config returns the build configuration for the repository at the
+	// given sha, or nil if it doesn't have one.
+	Config(ctx context.Context, owner, repo, sha string) (*builder.Config, error)
+
+	// CreateStatus creates a commit status.
+	CreateStatus(ctx context.Context, owner, repo, sha string, status *github.RepoStatus) error
+
+	// CreateCheckRun creates a check run.
+	CreateCheckRun(ctx context.Context, owner, repo string, run *builder.CheckRun) (*builder.CheckRun, error)
+
+	// UpdateCheckRun updates a check run.
+	UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run *builder.CheckRun) error
+
+	// Private returns true if the repository is private.
+	Private(ctx context.Context, owner, repo string) (bool, error)
+
+	// Permission returns the permission that a user has on the
+	// repository: "admin", "write", "read" or "none".
+	Permission(ctx context.Context, owner, repo, user string) (string, error)
+
+	// PullRequestHead returns the repository, branch and sha of the head
+	// of a pull request. For pull requests from a fork, the repository is
+	// the fork, or empty if the fork has been deleted.
+	PullRequestHead(ctx context.Context, owner, repo string, number int) (repository, branch, sha string, err error)
+
+	// PullRequestFiles returns the paths of the files that a pull request
+	// changes.
+	PullRequestFiles(ctx context.Context, owner, repo string, number int) ([]string, error)
+
+	// CreateIssueComment comments on an issue or pull request.
+	CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error
+
+	// CreateCommitComment comments on a commit.
+	CreateCommitComment(ctx context.Context, owner, repo, sha, body string) error
+
+	// Hooks returns the webhooks of the repository.
+	Hooks(ctx context.Context, owner, repo string) ([]*github.Hook, error)
+
+	// CreateHook creates a webhook.
+	CreateHook(ctx context.Context, owner, repo string, hook *github.Hook) (*github.Hook, error)
+
+	// EditHook updates a webhook.
+	EditHook(ctx context.Context, owner, repo string, id int64, hook *github.Hook) (*github.Hook, error)
+
+	// PingHook asks GitHub to send a `ping` event to a webhook.
+	PingHook(ctx context.Context, owner, repo string, id int64) error
 }
 
 func NewGitHub(c *github.Client) *GitHub {
 	return &GitHub{
-		Git: c.Git,
+		Git:          c.Git,
+		Repositories: c.Repositories,
+		PullRequests: c.PullRequests,
+		Issues:       c.Issues,
+		Checks:       builder.NewChecksClient(c),
 	}
 }
 
 // GitHub is an implementation of the Git interface
 // backed by the GitHub API.
 type GitHub struct {
-	Git *github.GitService
+	Git          *github.GitService
+	Repositories *github.RepositoriesService
+	PullRequests *github.PullRequestsService
+	Issues       *github.IssuesService
+	Checks       builder.ChecksClient
 }
 
-func (g *GitHub) ResolveBranch(ctx context.Context, owner, repo, branch string) (string, error) {
-	ref, _, err := g.Git.GetRef(ctx, owner, repo, fmt.Sprintf("refs/heads/%s", branch))
+// Ref is a git ref that was resolved to a commit, along with the branch, tag or
+// pull request that it came from.
+type Ref struct {
+	// The full sha of the commit.
+	Sha string
+	// The branch, tag or pull request that the ref refers to, if any.
+	Branch      string
+	Tag         string
+	PullRequest int
+}
+
+var (
+	// pullRequestRef matches refs to the head of a pull request.
+	pullRequestRef = regexp.MustCompile(`^(?:refs/)?pull/(\d+)/head$`)
+
+	// shaRef matches abbreviated or full commit shas.
+	shaRef = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+)
+
+// ResolveRef implements the GitHubAPI interface. Fully qualified refs, like
+// `refs/heads/master` or `refs/tags/v1.2.3`, are resolved directly. Other refs
+// are tried as a branch, then a tag, then an abbreviated sha, like git does.
+func (g *GitHub) ResolveRef(ctx context.Context, owner, repo, ref string) (*Ref, error) {
+	if m := pullRequestRef.FindStringSubmatch(ref); m != nil {
+		number, err := strconv.Atoi(m[1])
+		if err != nil {
+			return nil, err
+		}
+		repository, branch, sha, err := g.PullRequestHead(ctx, owner, repo, number)
+		if err != nil {
+			return nil, err
+		}
+		r := &Ref{Sha: sha, PullRequest: number}
+		// The branch of a fork is named by its owner, so it isn't a
+		// branch of this repository.
+		if strings.EqualFold(repository, owner+"/"+repo) {
+			r.Branch = branch
+		}
+		return r, nil
+	}
+
+	if strings.HasPrefix(ref, "refs/") {
+		r, err := g.resolveQualifiedRef(ctx, owner, repo, ref)
+		if err == nil && r == nil {
+			err = fmt.Errorf("%s not found in %s/%s", ref, owner, repo)
+		}
+		return r, err
+	}
+
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		r, err := g.resolveQualifiedRef(ctx, owner, repo, prefix+ref)
+		if err != nil || r != nil {
+			return r, err
+		}
+	}
+
+	if shaRef.MatchString(ref) {
+		// No need to look up a full sha.
+		if len(ref) == 40 {
+			return &Ref{Sha: ref}, nil
+		}
+
+		c, _, err := g.Repositories.GetCommit(ctx, owner, repo, ref)
+		if err != nil {
+			return nil, err
+		}
+		return &Ref{Sha: c.GetSHA()}, nil
+	}
+
+	return nil, fmt.Errorf("%s doesn't match a branch, tag or commit in %s/%s", ref, owner, repo)
+}
+
+// resolveQualifiedRef resolves a ref like `refs/heads/master` or
+// `refs/tags/v1.2.3`. It returns nil if the ref doesn't exist.
+func (g *GitHub) resolveQualifiedRef(ctx context.Context, owner, repo, name string) (*Ref, error) {
+	ref, resp, err := g.Git.GetRef(ctx, owner, repo, name)
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || (err != nil && resp.StatusCode == http.StatusOK)) {
+		// A 200 with an error means that only refs that start
+		// with the name exist.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Ref{Sha: ref.Object.GetSHA()}
+	switch {
+	case strings.HasPrefix(name, "refs/heads/"):
+		r.Branch = strings.TrimPrefix(name, "refs/heads/")
+	case strings.HasPrefix(name, "refs/tags/"):
+		r.Tag = strings.TrimPrefix(name, "refs/tags/")
+	}
+
+	// Annotated tags point to a tag object, rather than a commit, which
+	// in turn points to the commit.
+	if ref.Object.GetType() == "tag" {
+		t, _, err := g.Git.GetTag(ctx, owner, repo, ref.Object.GetSHA())
+		if err != nil {
+			return nil, err
+		}
+		r.Sha = t.Object.GetSHA()
+	}
+
+	return r, nil
+}
+
+func (g *GitHub) Config(ctx context.Context, owner, repo, sha string) (*builder.Config, error) {
+	return builder.FetchConfig(ctx, g.Repositories, owner, repo, sha)
+}
+
+func (g *GitHub) CreateStatus(ctx context.Context, owner, repo, sha string, status *github.RepoStatus) error {
+	_, _, err := g.Repositories.CreateStatus(ctx, owner, repo, sha, status)
+	return err
+}
+
+func (g *GitHub) CreateCheckRun(ctx context.Context, owner, repo string, run *builder.CheckRun) (*builder.CheckRun, error) {
+	return g.Checks.CreateCheckRun(ctx, owner, repo, run)
+}
+
+func (g *GitHub) UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run *builder.CheckRun) error {
+	_, err := g.Checks.UpdateCheckRun(ctx, owner, repo, id, run)
+	return err
+}
+
+func (g *GitHub) Private(ctx context.Context, owner, repo string) (bool, error) {
+	r, _, err := g.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return false, err
+	}
+	return r.GetPrivate(), nil
+}
+
+func (g *GitHub) Permission(ctx context.Context, owner, repo, user string) (string, error) {
+	p, _, err := g.Repositories.GetPermissionLevel(ctx, owner, repo, user)
 	if err != nil {
 		return "", err
 	}
-	return *ref.Object.SHA, nil
+	return p.GetPermission(), nil
+}
+
+func (g *GitHub) PullRequestHead(ctx context.Context, owner, repo string, number int) (string, string, string, error) {
+	pr, _, err := g.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return "", "", "", err
+	}
+	head := pr.GetHead()
+	return head.GetRepo().GetFullName(), head.GetRef(), head.GetSHA(), nil
+}
+
+func (g *GitHub) PullRequestFiles(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	var files []string
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := g.PullRequests.ListFiles(ctx, owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range page {
+			files = append(files, f.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (g *GitHub) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error {
+	_, _, err := g.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{
+		Body: github.String(body),
+	})
+	return err
+}
+
+func (g *GitHub) CreateCommitComment(ctx context.Context, owner, repo, sha, body string) error {
+	_, _, err := g.Repositories.CreateComment(ctx, owner, repo, sha, &github.RepositoryComment{
+		Body: github.String(body),
+	})
+	return err
+}
+
+func (g *GitHub) Hooks(ctx context.Context, owner, repo string) ([]*github.Hook, error) {
+	var hooks []*github.Hook
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := g.Repositories.ListHooks(ctx, owner, repo, opt)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, page...)
+		if resp.NextPage == 0 {
+			return hooks, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+func (g *GitHub) CreateHook(ctx context.Context, owner, repo string, hook *github.Hook) (*github.Hook, error) {
+	h, _, err := g.Repositories.CreateHook(ctx, owner, repo, hook)
+	return h, err
+}
+
+func (g *GitHub) EditHook(ctx context.Context, owner, repo string, id int64, hook *github.Hook) (*github.Hook, error) {
+	h, _, err := g.Repositories.EditHook(ctx, owner, repo, id, hook)
+	return h, err
+}
+
+func (g *GitHub) PingHook(ctx context.Context, owner, repo string, id int64) error {
+	_, err := g.Repositories.PingHook(ctx, owner, repo, id)
+	return err
 }
 
 func splitRepo(fullRepo string) (owner, repo string) {
@@ -0,0 +1,168 @@
+package conveyor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/google/go-github/github"
+	"github.com/remind101/conveyor/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGitHub_ResolveRef(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/remind101/acme-inc/git/refs/heads/master":
+			fmt.Fprint(w, `{"ref": "refs/heads/master", "object": {"type": "commit", "sha": "139759bd61e98faeec619c45b1060b4288952164"}}`)
+		case "/repos/remind101/acme-inc/git/refs/tags/v1.2.3":
+			fmt.Fprint(w, `{"ref": "refs/tags/v1.2.3", "object": {"type": "tag", "sha": "1111111111111111111111111111111111111111"}}`)
+		case "/repos/remind101/acme-inc/git/tags/1111111111111111111111111111111111111111":
+			fmt.Fprint(w, `{"object": {"type": "commit", "sha": "2222222222222222222222222222222222222222"}}`)
+		case "/repos/remind101/acme-inc/git/refs/heads/v1":
+			// No exact match, so GitHub returns the refs that
+			// start with the name.
+			fmt.Fprint(w, `[{"ref": "refs/heads/v1.x"}]`)
+		case "/repos/remind101/acme-inc/commits/139759b":
+			fmt.Fprint(w, `{"sha": "139759bd61e98faeec619c45b1060b4288952164"}`)
+		case "/repos/remind101/acme-inc/pulls/42":
+			fmt.Fprint(w, `{"head": {"ref": "feature", "sha": "3333333333333333333333333333333333333333", "repo": {"full_name": "remind101/acme-inc"}}}`)
+		case "/repos/remind101/acme-inc/pulls/43":
+			fmt.Fprint(w, `{"head": {"ref": "master", "sha": "4444444444444444444444444444444444444444", "repo": {"full_name": "ejholmes/acme-inc"}}}`)
+		case "/repos/remind101/acme-inc/pulls/44":
+			// The fork has been deleted.
+			fmt.Fprint(w, `{"head": {"ref": "master", "sha": "5555555555555555555555555555555555555555", "repo": null}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := github.NewClient(nil)
+	c.BaseURL, _ = url.Parse(ts.URL + "/")
+	g := NewGitHub(c)
+
+	tests := []struct {
+		ref string
+		out *Ref
+	}{
+		{"master", &Ref{Sha: "139759bd61e98faeec619c45b1060b4288952164", Branch: "master"}},
+		{"refs/heads/master", &Ref{Sha: "139759bd61e98faeec619c45b1060b4288952164", Branch: "master"}},
+		{"v1.2.3", &Ref{Sha: "2222222222222222222222222222222222222222", Tag: "v1.2.3"}},
+		{"139759b", &Ref{Sha: "139759bd61e98faeec619c45b1060b4288952164"}},
+		{"139759bd61e98faeec619c45b1060b4288952164", &Ref{Sha: "139759bd61e98faeec619c45b1060b4288952164"}},
+		{"pull/42/head", &Ref{Sha: "3333333333333333333333333333333333333333", Branch: "feature", PullRequest: 42}},
+		{"pull/43/head", &Ref{Sha: "4444444444444444444444444444444444444444", PullRequest: 43}},
+		{"pull/44/head", &Ref{Sha: "5555555555555555555555555555555555555555", PullRequest: 44}},
+	}
+
+	for _, tt := range tests {
+		ref, err := g.ResolveRef(context.Background(), "remind101", "acme-inc", tt.ref)
+		assert.NoError(t, err, tt.ref)
+		assert.Equal(t, tt.out, ref, tt.ref)
+	}
+
+	_, err := g.ResolveRef(context.Background(), "remind101", "acme-inc", "v1")
+	assert.EqualError(t, err, "v1 doesn't match a branch, tag or commit in remind101/acme-inc")
+
+	_, err = g.ResolveRef(context.Background(), "remind101", "acme-inc", "refs/heads/missing")
+	assert.EqualError(t, err, "refs/heads/missing not found in remind101/acme-inc")
+}
+
+type mockGitHub struct {
+	mock.Mock
+}
+
+func (m *mockGitHub) ResolveRef(ctx context.Context, owner, repo, ref string) (*Ref, error) {
+	args := m.Called(owner, repo, ref)
+	return args.Get(0).(*Ref), args.Error(1)
+}
+
+func (m *mockGitHub) Config(ctx context.Context, owner, repo, sha string) (*builder.Config, error) {
+	args := m.Called(owner, repo, sha)
+	return args.Get(0).(*builder.Config), args.Error(1)
+}
+
+func (m *mockGitHub) CreateStatus(ctx context.Context, owner, repo, sha string, status *github.RepoStatus) error {
+	args := m.Called(owner, repo, sha, status)
+	return args.Error(0)
+}
+
+func (m *mockGitHub) CreateCheckRun(ctx context.Context, owner, repo string, run *builder.CheckRun) (*builder.CheckRun, error) {
+	args := m.Called(owner, repo, run)
+	return args.Get(0).(*builder.CheckRun), args.Error(1)
+}
+
+func (m *mockGitHub) UpdateCheckRun(ctx context.Context, owner, repo string, id int64, run *builder.CheckRun) error {
+	args := m.Called(owner, repo, id, run)
+	return args.Error(0)
+}
+
+func (m *mockGitHub) Private(ctx context.Context, owner, repo string) (bool, error) {
+	args := m.Called(owner, repo)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockGitHub) Permission(ctx context.Context, owner, repo, user string) (string, error) {
+	args := m.Called(owner, repo, user)
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockGitHub) PullRequestHead(ctx context.Context, owner, repo string, number int) (string, string, string, error) {
+	args := m.Called(owner, repo, number)
+	return args.String(0), args.String(1), args.String(2), args.Error(3)
+}
+
+func (m *mockGitHub) PullRequestFiles(ctx context.Context, owner, repo string, number int) ([]string, error) {
+	args := m.Called(owner, repo, number)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockGitHub) CreateIssueComment(ctx context.Context, owner, repo string, number int, body string) error {
+	args := m.Called(owner, repo, number, body)
+	return args.Error(0)
+}
+
+func (m *mockGitHub) CreateCommitComment(ctx context.Context, owner, repo, sha, body string) error {
+	args := m.Called(owner, repo, sha, body)
+	return args.Error(0)
+}
+
+func (m *mockGitHub) Hooks(ctx context.Context, owner, repo string) ([]*github.Hook, error) {
+	args := m.Called(owner, repo)
+	return args.Get(0).([]*github.Hook), args.Error(1)
+}
+
+func (m *mockGitHub) CreateHook(ctx context.Context, owner, repo string, hook *github.Hook) (*github.Hook, error) {
+	args := m.Called(owner, repo, hook)
+	return args.Get(0).(*github.Hook), args.Error(1)
+}
+
+func (m *mockGitHub) EditHook(ctx context.Context, owner, repo string, id int64, hook *github.Hook) (*github.Hook, error) {
+	args := m.Called(owner, repo, id, hook)
+	return args.Get(0).(*github.Hook), args.Error(1)
+}
+
+func (m *mockGitHub) PingHook(ctx context.Context, owner, repo string, id int64) error {
+	args := m.Called(owner, repo, id)
+	return args.Error(0)
+}
+
+// mockGitHubApp is a GitHubApp that uses the same GitHubAPI for every
+// installation.
+type mockGitHubApp struct {
+	GitHubAPI
+}
+
+func (m *mockGitHubApp) Installation(id int64) (GitHubAPI, error) {
+	return m.GitHubAPI, nil
+}
+
+func (m *mockGitHubApp) FindInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	return 1, nil
+}
@@ -0,0 +1,199 @@
+package conveyor
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"github.com/google/go-github/github"
+	"github.com/remind101/conveyor/builder"
+	"github.com/remind101/conveyor/internal/ghinstallation"
+	"github.com/remind101/conveyor/internal/ghtransport"
+)
+
+// GitHubApp provides clients that are authenticated as the installations of a
+// GitHub App, so that a single Conveyor can build the repositories of multiple
+// organizations.
+type GitHubApp interface {
+	// Installation returns a client that's authenticated as an
+	// installation of the GitHub App.
+	Installation(id int64) (GitHubAPI, error)
+
+	// FindInstallation returns the ID of the installation of the GitHub
+	// App that has access to a repository.
+	FindInstallation(ctx context.Context, owner, repo string) (int64, error)
+}
+
+// GitHubInstallations is an implementation of the GitHubApp interface backed by
+// the GitHub API. A client is created for each installation the first time
+// that it's used, and cached, so that installation tokens are reused until
+// they expire.
+type GitHubInstallations struct {
+	// When set, this installation is used for repositories, rather than
+	// looking up the installation that has access to them. Webhooks
+	// always use the installation that they were delivered for.
+	DefaultInstallationID int64
+
+	// transport is shared by the clients for each installation. Requests
+	// are identified (see ghtransport.Identify) as the app or installation
+	// that they're made as, so that rate limits and cached responses are
+	// tracked for it, even as tokens are refreshed.
+	transport  http.RoundTripper
+	appID      int
+	privateKey []byte
+
+	// The GitHub Enterprise API and upload URLs. Empty for github.com.
+	baseURL, uploadURL string
+
+	// app is authenticated as the GitHub App itself.
+	app *github.Client
+
+	mu      sync.Mutex
+	clients map[int64]*github.Client
+}
+
+// NewGitHubInstallations returns a new GitHubInstallations for the GitHub App
+// with the given ID and private key.
+func NewGitHubInstallations(tr http.RoundTripper, appID int, privateKey []byte) (*GitHubInstallations, error) {
+	return NewGitHubEnterpriseInstallations(tr, "", "", appID, privateKey)
+}
+
+// NewGitHubEnterpriseInstallations returns a new GitHubInstallations for a
+// GitHub App on GitHub Enterprise Server, with the given API and upload URLs
+// (e.g. https://github.example.com/api/v3/ and
+// https://github.example.com/api/uploads/). If baseURL is empty, github.com
+// is used.
+func NewGitHubEnterpriseInstallations(tr http.RoundTripper, baseURL, uploadURL string, appID int, privateKey []byte) (*GitHubInstallations, error) {
+	t, err := ghinstallation.NewAppsTransport(tr, appID, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GitHubInstallations{
+		transport:  tr,
+		appID:      appID,
+		privateKey: privateKey,
+		baseURL:    baseURL,
+		uploadURL:  uploadURL,
+		clients:    make(map[int64]*github.Client),
+	}
+
+	if baseURL != "" {
+		t.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	g.app, err = g.newClient(ghtransport.Identify(t, fmt.Sprintf("app/%d", appID)))
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Client returns the go-github client for an installation.
+func (g *GitHubInstallations) Client(id int64) (*github.Client, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.clients[id]; ok {
+		return c, nil
+	}
+
+	t, err := ghinstallation.New(g.transport, g.appID, int(id), g.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if g.baseURL != "" {
+		t.BaseURL = strings.TrimSuffix(g.baseURL, "/")
+	}
+
+	c, err := g.newClient(ghtransport.Identify(t, fmt.Sprintf("installation/%d", id)))
+	if err != nil {
+		return nil, err
+	}
+	g.clients[id] = c
+	return c, nil
+}
+
+// newClient returns a go-github client that makes requests through tr, to
+// GitHub Enterprise if it's configured.
+func (g *GitHubInstallations) newClient(tr http.RoundTripper) (*github.Client, error) {
+	hc := &http.Client{Transport: tr}
+	if g.baseURL == "" {
+		return github.NewClient(hc), nil
+	}
+
+	uploadURL := g.uploadURL
+	if uploadURL == "" {
+		uploadURL = g.baseURL
+	}
+	return github.NewEnterpriseClient(g.baseURL, uploadURL, hc)
+}
+
+// Installation implements the GitHubApp interface.
+func (g *GitHubInstallations) Installation(id int64) (GitHubAPI, error) {
+	c, err := g.Client(id)
+	if err != nil {
+		return nil, err
+	}
+	return NewGitHub(c), nil
+}
+
+// FindInstallation implements the GitHubApp interface. go-github doesn't
+// support finding the installation for a repository, so the request is made
+// directly.
+func (g *GitHubInstallations) FindInstallation(ctx context.Context, owner, repo string) (int64, error) {
+	if g.DefaultInstallationID != 0 {
+		return g.DefaultInstallationID, nil
+	}
+
+	req, err := g.app.NewRequest("GET", fmt.Sprintf("repos/%s/%s/installation", owner, repo), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var i github.Installation
+	if _, err := g.app.Do(ctx, req, &i); err != nil {
+		return 0, fmt.Errorf("error finding the GitHub App installation for %s/%s: %v", owner, repo, err)
+	}
+	return i.GetID(), nil
+}
+
+// GitHubClient implements the builder.GitHubClients interface, by returning a
+// client for the installation that the build belongs to.
+func (g *GitHubInstallations) GitHubClient(ctx context.Context, opts builder.BuildOptions) (builder.GitHubClient, error) {
+	id := opts.InstallationID
+	if id == 0 {
+		owner, repo := splitRepo(opts.Repository)
+		var err error
+		id, err = g.FindInstallation(ctx, owner, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := g.Client(id)
+	if err != nil {
+		return nil, err
+	}
+	return builder.NewGitHubClient(c), nil
+}
+
+// installation returns a client for an installation of the GitHub App, and the
+// ID of the installation. If id is 0, the installation that has access to the
+// repository is used.
+func (c *Conveyor) installation(ctx context.Context, repository string, id int64) (GitHubAPI, int64, error) {
+	if id == 0 {
+		owner, repo := splitRepo(repository)
+		var err error
+		id, err = c.GitHub.FindInstallation(ctx, owner, repo)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	g, err := c.GitHub.Installation(id)
+	return g, id, err
+}
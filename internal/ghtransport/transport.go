@@ -0,0 +1,397 @@
+// Package ghtransport provides an http.RoundTripper for the GitHub API that
+// respects rate limits, and caches GET responses using conditional requests.
+package ghtransport
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the default number of times that a request that
+	// was rate limited is retried.
+	DefaultMaxRetries = 3
+
+	// DefaultMaxWait is the default longest time that a request waits for
+	// a rate limit to reset. When the rate limit resets later than this,
+	// the rate limited response is returned instead.
+	DefaultMaxWait = time.Minute
+
+	// DefaultCacheSize is the default number of responses that are cached.
+	DefaultCacheSize = 1000
+)
+
+// now and after are variables so they can be stubbed in tests.
+var (
+	now   = time.Now
+	after = time.After
+)
+
+// statsdClient represents a client that can send gauges to datadog.
+type statsdClient interface {
+	Gauge(name string, value float64, tags []string, rate float64) error
+}
+
+// identityKey is the context key for the identity that a request is made as.
+type identityKey struct{}
+
+// Identify returns an http.RoundTripper that makes requests through tr as
+// identity, e.g. an installation of a GitHub App. Rate limits and cached
+// responses are tracked for the identity, rather than for the Authorization
+// header, which changes whenever a token is refreshed.
+func Identify(tr http.RoundTripper, identity string) http.RoundTripper {
+	return &identifyTransport{tr: tr, identity: identity}
+}
+
+type identifyTransport struct {
+	tr       http.RoundTripper
+	identity string
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *identifyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.tr.RoundTrip(req.WithContext(context.WithValue(req.Context(), identityKey{}, t.identity)))
+}
+
+// identity returns the key that rate limits and cached responses are tracked
+// under for a request: the identity from its context, or the Authorization
+// header if it doesn't have one.
+func identity(req *http.Request) string {
+	if id, ok := req.Context().Value(identityKey{}).(string); ok {
+		return id
+	}
+	return req.Header.Get("Authorization")
+}
+
+// rateLimit is the last rate limit that GitHub returned for an identity.
+type rateLimit struct {
+	remaining int
+	reset     time.Time
+}
+
+// Transport is an http.RoundTripper that tracks the X-RateLimit-* headers
+// returned by the GitHub API. Requests wait for the rate limit to reset when
+// it's been exhausted, and requests that are rate limited with a 403 or 429
+// are retried after Retry-After. Successful GET responses with an ETag are
+// cached, and revalidated with If-None-Match, which doesn't count against the
+// rate limit.
+//
+// Rate limits and cached responses are tracked separately for each identity
+// (see Identify), or for each Authorization header for requests without
+// one, since GitHub rate limits each installation separately. Rate limits are
+// forgotten once they've reset.
+type Transport struct {
+	// The RoundTripper that makes requests. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// If set, the remaining rate limit is sent as the
+	// conveyor.github.rate_limit.remaining gauge.
+	Stats statsdClient
+
+	// The number of times to retry a request that was rate limited.
+	// Defaults to DefaultMaxRetries.
+	MaxRetries int
+
+	// The longest time to wait for a rate limit to reset. Defaults to
+	// DefaultMaxWait.
+	MaxWait time.Duration
+
+	// The number of responses to cache. Defaults to DefaultCacheSize.
+	CacheSize int
+
+	mu     sync.Mutex
+	limits map[string]rateLimit
+	cache  *list.List
+	items  map[string]*list.Element
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	key  string
+	etag string
+	// The response, as written by httputil.DumpResponse.
+	response []byte
+}
+
+// New returns a new Transport that makes requests with tr.
+func New(tr http.RoundTripper) *Transport {
+	return &Transport{Transport: tr}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := identity(req)
+
+	if err := t.waitForReset(req, key); err != nil {
+		return nil, err
+	}
+
+	cacheKey := key + " " + req.URL.String()
+	cached := t.cached(req, cacheKey)
+
+	for attempt := 0; ; attempt++ {
+		// Retries are sent with a copy of the request, so that the
+		// caller's request isn't modified.
+		r := req
+		if cached != nil || attempt > 0 {
+			r = cloneRequest(req)
+		}
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		if cached != nil {
+			r.Header.Set("If-None-Match", cached.etag)
+		}
+
+		resp, err := t.transport().RoundTrip(r)
+		if err != nil {
+			return resp, err
+		}
+
+		t.track(key, resp)
+
+		if cached != nil && resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			return cached.read(req)
+		}
+
+		wait, ok := t.retryAfter(resp)
+		if !ok || attempt >= t.maxRetries() || !rewindable(req) {
+			t.store(req, cacheKey, resp)
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForReset waits for the rate limit for an identity to reset, if the last
+// response said that it was exhausted.
+func (t *Transport) waitForReset(req *http.Request, key string) error {
+	t.mu.Lock()
+	l, ok := t.limits[key]
+	t.mu.Unlock()
+
+	if !ok || l.remaining > 0 {
+		return nil
+	}
+
+	wait := l.reset.Sub(now())
+	if wait <= 0 || wait > t.maxWait() {
+		return nil
+	}
+	return sleep(req, wait)
+}
+
+// track records the rate limit headers from a response, and sends the
+// remaining rate limit to datadog. Rate limits that have reset are removed,
+// so that identities that are no longer used, e.g. expired tokens, aren't
+// kept around.
+func (t *Transport) track(key string, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	if t.limits == nil {
+		t.limits = make(map[string]rateLimit)
+	}
+	t.limits[key] = rateLimit{remaining: remaining, reset: time.Unix(reset, 0)}
+	n := now()
+	for k, l := range t.limits {
+		if l.reset.Before(n) {
+			delete(t.limits, k)
+		}
+	}
+	t.mu.Unlock()
+
+	if t.Stats != nil {
+		var tags []string
+		if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" {
+			tags = append(tags, fmt.Sprintf("resource:%s", resource))
+		}
+		_ = t.Stats.Gauge("conveyor.github.rate_limit.remaining", float64(remaining), tags, 1)
+	}
+}
+
+// retryAfter returns how long to wait before retrying a request that was rate
+// limited. It returns false if the response wasn't rate limited, or the rate
+// limit resets too far in the future to wait for it.
+func (t *Transport) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, false
+		}
+		wait = time.Duration(seconds) * time.Second
+	} else if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		wait = time.Unix(reset, 0).Sub(now())
+	} else {
+		// A 403 that isn't because of a rate limit, e.g. missing
+		// permissions.
+		return 0, false
+	}
+
+	if wait > t.maxWait() {
+		return 0, false
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// cached returns the cached response for a GET request, if there is one.
+func (t *Transport) cached(req *http.Request, key string) *cacheEntry {
+	if req.Method != "GET" || req.Header.Get("If-None-Match") != "" {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.items[key]; ok {
+		t.cache.MoveToFront(e)
+		return e.Value.(*cacheEntry)
+	}
+	return nil
+}
+
+// store caches a successful response to a GET request that has an ETag. The
+// response body is read, and replaced so that it can still be read by the
+// caller.
+func (t *Transport) store(req *http.Request, key string, resp *http.Response) {
+	etag := resp.Header.Get("ETag")
+	if req.Method != "GET" || resp.StatusCode != http.StatusOK || etag == "" {
+		return
+	}
+
+	raw, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cache == nil {
+		t.cache = list.New()
+		t.items = make(map[string]*list.Element)
+	}
+
+	entry := &cacheEntry{key: key, etag: etag, response: raw}
+	if e, ok := t.items[key]; ok {
+		e.Value = entry
+		t.cache.MoveToFront(e)
+	} else {
+		t.items[key] = t.cache.PushFront(entry)
+	}
+
+	for t.cache.Len() > t.cacheSize() {
+		e := t.cache.Back()
+		t.cache.Remove(e)
+		delete(t.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+// read returns a copy of the cached response.
+func (e *cacheEntry) read(req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(e.response)), req)
+	if err != nil {
+		return nil, err
+	}
+	// Read the body now, so that it doesn't depend on the buffer.
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+func (t *Transport) maxRetries() int {
+	if t.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+	return t.MaxRetries
+}
+
+func (t *Transport) maxWait() time.Duration {
+	if t.MaxWait == 0 {
+		return DefaultMaxWait
+	}
+	return t.MaxWait
+}
+
+func (t *Transport) cacheSize() int {
+	if t.CacheSize == 0 {
+		return DefaultCacheSize
+	}
+	return t.CacheSize
+}
+
+// sleep waits for d, or until the request is canceled.
+func sleep(req *http.Request, d time.Duration) error {
+	select {
+	case <-after(d):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// rewindable returns true if the request can be sent again.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.GetBody != nil
+}
+
+// cloneRequest returns a copy of req with its own headers, per the
+// http.RoundTripper contract that requests aren't modified.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	return r
+}
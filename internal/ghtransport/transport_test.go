@@ -0,0 +1,236 @@
+package ghtransport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func init() {
+	// Don't actually wait in tests.
+	after = func(time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+}
+
+func TestTransport_ETag(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"abcd"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abcd"`)
+		fmt.Fprint(w, `{"sha": "abcd"}`)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: New(http.DefaultTransport)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(ts.URL + "/repos/remind101/acme-inc/git/refs/heads/master")
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"sha": "abcd"}`, readBody(t, resp))
+	}
+	assert.Equal(t, 2, requests)
+}
+
+func TestTransport_ETag_Authorization(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Cached responses for another token shouldn't be
+		// revalidated.
+		assert.Equal(t, "", r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"abcd"`)
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: New(http.DefaultTransport)}
+
+	for _, token := range []string{"token a", "token b"} {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("Authorization", token)
+		resp, err := c.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, token, readBody(t, resp))
+	}
+}
+
+func TestTransport_ETag_Identity(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The response cached with the old token is revalidated with
+		// the new one.
+		if requests == 2 {
+			assert.Equal(t, `"abcd"`, r.Header.Get("If-None-Match"))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"abcd"`)
+		fmt.Fprint(w, `{"sha": "abcd"}`)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: Identify(New(http.DefaultTransport), "installation/1")}
+
+	for _, token := range []string{"token a", "token b"} {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("Authorization", token)
+		resp, err := c.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"sha": "abcd"}`, readBody(t, resp))
+	}
+	assert.Equal(t, 2, requests)
+}
+
+func TestTransport_RetryAfter(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"state": "success"}`, string(body))
+		if requests == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: New(http.DefaultTransport)}
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(`{"state": "success"}`))
+	body := req.Body
+	resp, err := c.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+
+	// The retry is sent with a copy of the request.
+	assert.Equal(t, body, req.Body)
+}
+
+func TestTransport_RetryAfter_TooLong(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: New(http.DefaultTransport)}
+
+	resp, err := c.Get(ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+}
+
+func TestTransport_Forbidden(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	c := &http.Client{Transport: New(http.DefaultTransport)}
+
+	resp, err := c.Get(ts.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, 1, requests)
+}
+
+func TestTransport_RateLimit(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Unix()
+
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Resource", "core")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", reset))
+		remaining := 2 - requests
+		if remaining < 0 {
+			// The rate limit has reset.
+			remaining = 4999
+		}
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	}))
+	defer ts.Close()
+
+	s := new(mockStatsdClient)
+	s.On("Gauge", "conveyor.github.rate_limit.remaining", float64(1), []string{"resource:core"}, float64(1)).Return(nil)
+	s.On("Gauge", "conveyor.github.rate_limit.remaining", float64(0), []string{"resource:core"}, float64(1)).Return(nil)
+	s.On("Gauge", "conveyor.github.rate_limit.remaining", float64(4999), []string{"resource:core"}, float64(1)).Return(nil)
+
+	var waits []time.Duration
+	defer func(f func(time.Duration) <-chan time.Time) { after = f }(after)
+	after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		c := make(chan time.Time, 1)
+		c <- time.Now()
+		return c
+	}
+
+	tr := New(http.DefaultTransport)
+	tr.Stats = s
+	c := &http.Client{Transport: tr}
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(ts.URL)
+		assert.NoError(t, err)
+	}
+
+	// Only the request after the rate limit was exhausted waits for it to
+	// reset.
+	assert.Equal(t, 1, len(waits))
+	assert.True(t, waits[0] > 0 && waits[0] <= 30*time.Second)
+	s.AssertExpectations(t)
+}
+
+func TestTransport_RateLimit_Reset(t *testing.T) {
+	tr := New(http.DefaultTransport)
+
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(-time.Minute).Unix()))
+	tr.track("token a", resp)
+
+	// Rate limits that have reset are forgotten.
+	resp.Header.Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Minute).Unix()))
+	tr.track("token b", resp)
+	assert.Equal(t, 1, len(tr.limits))
+	assert.Equal(t, 0, tr.limits["token b"].remaining)
+}
+
+func readBody(t testing.TB, resp *http.Response) string {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+// mockStatsdClient is a mock implementation of the statsdClient interface.
+type mockStatsdClient struct {
+	mock.Mock
+}
+
+func (c *mockStatsdClient) Gauge(name string, value float64, tags []string, rate float64) error {
+	args := c.Called(name, value, tags, rate)
+	return args.Error(0)
+}
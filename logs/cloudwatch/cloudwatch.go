@@ -3,6 +3,8 @@ package cloudwatch
 import (
 	"io"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/ejholmes/cloudwatch"
@@ -10,11 +12,18 @@ import (
 
 func NewLogger(group string) *Group {
 	c := cloudwatchlogs.New(defaults.DefaultConfig)
-	return &Group{cloudwatch.NewGroup(group, c)}
+	return &Group{
+		Group:  cloudwatch.NewGroup(group, c),
+		name:   group,
+		client: c,
+	}
 }
 
 type Group struct {
 	*cloudwatch.Group
+
+	name   string
+	client *cloudwatchlogs.CloudWatchLogs
 }
 
 func (g *Group) Create(name string) (io.Writer, error) {
@@ -33,6 +42,17 @@ func (g *Group) Open(name string) (io.Reader, error) {
 	return &reader{Reader: r}, nil
 }
 
+func (g *Group) Delete(name string) error {
+	_, err := g.client.DeleteLogStream(&cloudwatchlogs.DeleteLogStreamInput{
+		LogGroupName:  aws.String(g.name),
+		LogStreamName: aws.String(name),
+	})
+	if err, ok := err.(awserr.Error); ok && err.Code() == "ResourceNotFoundException" {
+		return nil
+	}
+	return err
+}
+
 // http://www.nthelp.com/ascii.htm
 const endOfText = '\x03'
 
@@ -0,0 +1,377 @@
+package logs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encodings that logs can be stored with.
+const (
+	// EncodingNone stores logs as is.
+	EncodingNone = ""
+
+	// EncodingGzip stores logs gzip compressed.
+	EncodingGzip = "gzip"
+
+	// EncodingEncrypted stores logs gzip compressed, then encrypted with
+	// AES-GCM using a random data key. The data key is itself encrypted
+	// with the configured key and stored in the header of the log.
+	EncodingEncrypted = "gzip+aes-gcm"
+)
+
+// ErrNoKey is returned when logs are created or opened with EncodingEncrypted,
+// but no key is configured.
+var ErrNoKey = errors.New("logs: no key configured for encrypted logs")
+
+// EncodingLogger can be implemented by Loggers that can store logs with a
+// choice of encodings.
+type EncodingLogger interface {
+	Logger
+
+	// CreateEncoded returns an io.Writer that writes a log with the given
+	// encoding.
+	CreateEncoded(name, encoding string) (io.Writer, error)
+
+	// OpenEncoded returns an io.Reader that reads a log that was written
+	// with the given encoding.
+	OpenEncoded(name, encoding string) (io.Reader, error)
+}
+
+// EncodedLogger is a Logger that wraps another Logger to encode logs at rest,
+// and transparently decode them when they're opened.
+type EncodedLogger struct {
+	Logger
+
+	// The encoding used by Create and Open.
+	Encoding string
+
+	// The key used to encrypt the data keys for EncodingEncrypted. This
+	// should be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+	Key []byte
+}
+
+// Encode returns a new EncodedLogger that stores logs in l with the given
+// encoding.
+func Encode(l Logger, encoding string) *EncodedLogger {
+	return &EncodedLogger{Logger: l, Encoding: encoding}
+}
+
+// Create implements the Logger interface.
+func (l *EncodedLogger) Create(name string) (io.Writer, error) {
+	return l.CreateEncoded(name, l.Encoding)
+}
+
+// Open implements the Logger interface.
+func (l *EncodedLogger) Open(name string) (io.Reader, error) {
+	return l.OpenEncoded(name, l.Encoding)
+}
+
+// CreateEncoded implements the EncodingLogger interface.
+func (l *EncodedLogger) CreateEncoded(name, encoding string) (io.Writer, error) {
+	if err := l.check(encoding); err != nil {
+		return nil, err
+	}
+
+	w, err := l.Logger.Create(name)
+	if err != nil || encoding == EncodingNone {
+		return w, err
+	}
+
+	if encoding == EncodingEncrypted {
+		w, err = newEncryptWriter(w, l.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &gzipWriter{Writer: gzip.NewWriter(w), w: w}, nil
+}
+
+// OpenEncoded implements the EncodingLogger interface.
+func (l *EncodedLogger) OpenEncoded(name, encoding string) (io.Reader, error) {
+	if err := l.check(encoding); err != nil {
+		return nil, err
+	}
+
+	r, err := l.Logger.Open(name)
+	if err != nil || encoding == EncodingNone {
+		return r, err
+	}
+
+	if encoding == EncodingEncrypted {
+		r, err = newDecryptReader(r, l.Key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return gzip.NewReader(r)
+}
+
+// Validate returns an error if logs can't be stored with the given encoding,
+// e.g. because it's unknown, or it needs a Key that isn't configured or isn't
+// a valid AES key. This can be used to fail at startup, rather than when the
+// logs for a build are created.
+func (l *EncodedLogger) Validate(encoding string) error {
+	if err := l.check(encoding); err != nil {
+		return err
+	}
+	if encoding == EncodingEncrypted {
+		if _, err := aes.NewCipher(l.Key); err != nil {
+			return fmt.Errorf("logs: invalid key: %v", err)
+		}
+	}
+	return nil
+}
+
+func (l *EncodedLogger) check(encoding string) error {
+	switch encoding {
+	case EncodingNone, EncodingGzip:
+		return nil
+	case EncodingEncrypted:
+		if len(l.Key) == 0 {
+			return ErrNoKey
+		}
+		return nil
+	default:
+		return fmt.Errorf("logs: unknown encoding: %s", encoding)
+	}
+}
+
+// gzipWriter is an io.WriteCloser that flushes the gzip stream, then closes
+// the underlying io.Writer if it implements the io.Closer interface.
+type gzipWriter struct {
+	*gzip.Writer
+	w io.Writer
+}
+
+func (w *gzipWriter) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Encrypted logs are a header, followed by a sequence of chunks:
+//
+//	header: magic (4 bytes) | nonce (12 bytes) | encrypted data key (48 bytes)
+//	chunk:  length (4 bytes, big endian) | sealed chunk
+//
+// Each chunk is sealed with the data key, using its sequence number as the
+// nonce. The last chunk is sealed with different additional data, so that a
+// log that was cut short can be detected.
+const (
+	encryptedMagic = "CVE1"
+
+	// The size of the plaintext in each chunk.
+	chunkSize = 64 * 1024
+
+	// The size of the data key, which is always AES-256.
+	dataKeySize = 32
+)
+
+var (
+	chunkData     = []byte{0}
+	lastChunkData = []byte{1}
+)
+
+// ErrCorrupt is returned when an encrypted log can't be decrypted.
+var ErrCorrupt = errors.New("logs: encrypted log is corrupt or was truncated")
+
+// newGCM returns an AES-GCM cipher.AEAD for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce for the nth chunk.
+func chunkNonce(aead cipher.AEAD, n uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], n)
+	return nonce
+}
+
+// encryptWriter is an io.WriteCloser that encrypts everything written to it.
+type encryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	buf  []byte
+	n    uint64
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, kek.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(encryptedMagic), nonce...)
+	header = kek.Seal(header, nonce, dataKey, []byte(encryptedMagic))
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+
+		if len(w.buf) == cap(w.buf) {
+			if err := w.seal(chunkData); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes the last chunk, then closes the underlying io.Writer if it
+// implements the io.Closer interface.
+func (w *encryptWriter) Close() error {
+	if err := w.seal(lastChunkData); err != nil {
+		return err
+	}
+	if c, ok := w.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *encryptWriter) seal(ad []byte) error {
+	sealed := w.aead.Seal(nil, chunkNonce(w.aead, w.n), w.buf, ad)
+	w.n++
+	w.buf = w.buf[:0]
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := w.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+// decryptReader is an io.Reader that decrypts a log written by an
+// encryptWriter.
+type decryptReader struct {
+	r    *bufio.Reader
+	aead cipher.AEAD
+	buf  []byte
+	n    uint64
+	last bool
+}
+
+func newDecryptReader(r io.Reader, key []byte) (*decryptReader, error) {
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(encryptedMagic)+kek.NonceSize()+dataKeySize+kek.Overhead())
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrCorrupt
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, ErrCorrupt
+	}
+	nonce := header[len(encryptedMagic) : len(encryptedMagic)+kek.NonceSize()]
+	sealed := header[len(encryptedMagic)+kek.NonceSize():]
+
+	dataKey, err := kek.Open(nil, nonce, sealed, []byte(encryptedMagic))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.last {
+			return 0, io.EOF
+		}
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk.
+func (r *decryptReader) open() error {
+	var length [4]byte
+	if _, err := io.ReadFull(r.r, length[:]); err != nil {
+		return ErrCorrupt
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > chunkSize+uint32(r.aead.Overhead()) {
+		return ErrCorrupt
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		return ErrCorrupt
+	}
+
+	nonce := chunkNonce(r.aead, r.n)
+	buf, err := r.aead.Open(nil, nonce, sealed, chunkData)
+	if err != nil {
+		buf, err = r.aead.Open(nil, nonce, sealed, lastChunkData)
+		if err != nil {
+			return ErrCorrupt
+		}
+		r.last = true
+	}
+
+	r.n++
+	r.buf = buf
+	return nil
+}
@@ -0,0 +1,145 @@
+package logs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncodedLogger(t *testing.T) {
+	output := strings.Repeat("Step 1/1 : RUN make\n", 10000)
+
+	tests := []struct {
+		encoding string
+	}{
+		{EncodingNone},
+		{EncodingGzip},
+		{EncodingEncrypted},
+	}
+
+	for _, tt := range tests {
+		m := newMemLogger()
+		l := &EncodedLogger{Logger: m, Encoding: tt.encoding, Key: testKey}
+
+		w, err := l.Create("1234")
+		assert.NoError(t, err)
+		io.WriteString(w, output)
+		assert.NoError(t, closeLog(w))
+
+		if tt.encoding != EncodingNone {
+			assert.NotContains(t, m.logs["1234"].String(), "RUN make")
+		}
+
+		r, err := l.Open("1234")
+		assert.NoError(t, err)
+		raw, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, output, string(raw))
+	}
+}
+
+func TestEncodedLogger_OpenEncoded(t *testing.T) {
+	m := newMemLogger()
+	io.WriteString(m.logs["old"], "plain text")
+
+	l := &EncodedLogger{Logger: m, Encoding: EncodingGzip}
+
+	// Logs that were stored before the encoding was changed can still be
+	// read.
+	r, err := l.OpenEncoded("old", EncodingNone)
+	assert.NoError(t, err)
+	raw, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "plain text", string(raw))
+}
+
+func TestEncodedLogger_NoKey(t *testing.T) {
+	l := Encode(newMemLogger(), EncodingEncrypted)
+
+	_, err := l.Create("1234")
+	assert.Equal(t, ErrNoKey, err)
+}
+
+func TestEncodedLogger_Validate(t *testing.T) {
+	l := &EncodedLogger{Logger: newMemLogger(), Key: testKey}
+	assert.NoError(t, l.Validate(EncodingNone))
+	assert.NoError(t, l.Validate(EncodingGzip))
+	assert.NoError(t, l.Validate(EncodingEncrypted))
+	assert.EqualError(t, l.Validate("zstd"), "logs: unknown encoding: zstd")
+
+	l.Key = nil
+	assert.Equal(t, ErrNoKey, l.Validate(EncodingEncrypted))
+	assert.NoError(t, l.Validate(EncodingGzip))
+
+	l.Key = []byte("short")
+	assert.EqualError(t, l.Validate(EncodingEncrypted), "logs: invalid key: crypto/aes: invalid key size 5")
+}
+
+func TestEncodedLogger_WrongKey(t *testing.T) {
+	m := newMemLogger()
+	l := &EncodedLogger{Logger: m, Encoding: EncodingEncrypted, Key: testKey}
+
+	w, _ := l.Create("1234")
+	io.WriteString(w, "secret")
+	closeLog(w)
+
+	l.Key = []byte("fedcba9876543210fedcba9876543210")
+	_, err := l.Open("1234")
+	assert.Equal(t, ErrCorrupt, err)
+}
+
+func TestEncodedLogger_Truncated(t *testing.T) {
+	m := newMemLogger()
+	l := &EncodedLogger{Logger: m, Encoding: EncodingEncrypted, Key: testKey}
+
+	w, _ := l.Create("1234")
+	io.WriteString(w, strings.Repeat("a", 3*chunkSize))
+	// Flush the gzip stream without closing it, so the last chunk is
+	// never written.
+	w.(*gzipWriter).Flush()
+	w.(*gzipWriter).w.(*encryptWriter).seal(chunkData)
+
+	r, err := l.Open("1234")
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrCorrupt, err)
+}
+
+// closeLog closes w if it implements the io.Closer interface.
+func closeLog(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// memLogger is a Logger that stores logs in memory.
+type memLogger struct {
+	logs map[string]*bytes.Buffer
+}
+
+func newMemLogger() *memLogger {
+	return &memLogger{logs: map[string]*bytes.Buffer{
+		"old": new(bytes.Buffer),
+	}}
+}
+
+func (l *memLogger) Create(name string) (io.Writer, error) {
+	b := new(bytes.Buffer)
+	l.logs[name] = b
+	return b, nil
+}
+
+func (l *memLogger) Open(name string) (io.Reader, error) {
+	return bytes.NewReader(l.logs[name].Bytes()), nil
+}
+
+func (l *memLogger) Delete(name string) error {
+	delete(l.logs, name)
+	return nil
+}
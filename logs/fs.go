@@ -19,3 +19,11 @@ func (l *FSLogger) Create(name string) (io.Writer, error) {
 func (l *FSLogger) Open(name string) (io.Reader, error) {
 	return os.Open(filepath.Join(l.Dir, name))
 }
+
+func (l *FSLogger) Delete(name string) error {
+	err := os.Remove(filepath.Join(l.Dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTruncated is returned by a LimitWriter when FailOnTruncate is set and the
+// log exceeds the maximum size.
+var ErrTruncated = errors.New("log exceeded the maximum size")
+
+// LimitWriter is an io.Writer that limits the amount of data that's written to
+// an underlying io.Writer. Output is passed through until it's within Tail
+// bytes of Max. After that, only the most recent Tail bytes of output are
+// buffered, and they're written after a truncation notice when the
+// LimitWriter is closed.
+type LimitWriter struct {
+	// The maximum number of bytes of output to keep.
+	Max int64
+
+	// The number of bytes at the end of the output to keep. The zero
+	// value is a tenth of Max, and it's capped at Max.
+	Tail int64
+
+	// When true, writes will return ErrTruncated once the output exceeds
+	// Max, which will generally cause the build to fail.
+	FailOnTruncate bool
+
+	// Notice returns the notice that's written between the head and the
+	// tail of the output, when some output was truncated. The zero value
+	// returns a plain text notice.
+	Notice func(truncated int64) []byte
+
+	// OnTruncate, if provided, is called when the LimitWriter is closed
+	// and some output was truncated.
+	OnTruncate func(truncated int64)
+
+	w io.Writer
+
+	// The number of bytes that have been written through to w.
+	written int64
+	// The number of bytes of output that were dropped from the tail.
+	dropped int64
+	// True once the head of the output has been written.
+	full bool
+	// The most recent output, once the head has been written.
+	tail []byte
+}
+
+// Limit returns a new LimitWriter that writes at most max bytes to w.
+func Limit(w io.Writer, max int64) *LimitWriter {
+	return &LimitWriter{w: w, Max: max}
+}
+
+// LimitStructured returns a new LimitWriter for a structured log, which writes
+// the truncation notice as an Entry.
+func LimitStructured(w io.Writer, max int64) *LimitWriter {
+	l := Limit(w, max)
+	l.Notice = func(truncated int64) []byte {
+		b, _ := json.Marshal(Entry{
+			Time:   now().UTC(),
+			Stream: StreamConveyor,
+			Phase:  PhaseTruncated,
+			Text:   fmt.Sprintf("log exceeded %d bytes, %d bytes truncated", max, truncated),
+		})
+		return append(b, '\n')
+	}
+	return l
+}
+
+// Write implements the io.Writer interface.
+func (l *LimitWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if !l.full {
+		head := p
+		room := l.Max - l.tailSize() - l.written
+		if room < 0 {
+			room = 0
+		}
+		if int64(len(p)) > room {
+			// End the head on a line boundary so that line oriented
+			// output stays parseable.
+			var cut int64
+			if i := bytes.LastIndexByte(p[:room], '\n'); i >= 0 {
+				cut = int64(i + 1)
+			}
+			head, p = p[:cut], p[cut:]
+			l.full = true
+		} else {
+			p = nil
+		}
+
+		m, err := l.w.Write(head)
+		l.written += int64(m)
+		if err != nil {
+			return m, err
+		}
+	}
+
+	if len(p) > 0 {
+		l.tail = append(l.tail, p...)
+
+		// Compact the buffer once it's grown to twice the size of the
+		// tail, to avoid copying on every write.
+		if int64(len(l.tail)) > 2*l.tailSize() {
+			over := int64(len(l.tail)) - l.tailSize()
+			l.dropped += over
+			l.tail = append(l.tail[:0], l.tail[over:]...)
+		}
+	}
+
+	if l.FailOnTruncate && l.Truncated() > 0 {
+		return n, ErrTruncated
+	}
+
+	return n, nil
+}
+
+// Truncated returns the number of bytes of output that were dropped.
+func (l *LimitWriter) Truncated() int64 {
+	truncated := l.dropped
+	if over := int64(len(l.tail)) - l.tailSize(); over > 0 {
+		truncated += over
+	}
+	return truncated
+}
+
+// Close writes the truncation notice and the buffered tail of the output, then
+// closes the underlying io.Writer if it implements the io.Closer interface.
+func (l *LimitWriter) Close() error {
+	if err := l.flush(); err != nil {
+		return err
+	}
+
+	if l.dropped > 0 && l.OnTruncate != nil {
+		l.OnTruncate(l.dropped)
+	}
+
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (l *LimitWriter) flush() error {
+	tail := l.tail
+	if over := int64(len(tail)) - l.tailSize(); over > 0 {
+		l.dropped += over
+		tail = tail[over:]
+	}
+
+	if l.dropped > 0 {
+		// Drop the partial line at the start of the tail.
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			l.dropped += int64(i + 1)
+			tail = tail[i+1:]
+		}
+
+		if _, err := l.w.Write(l.notice()); err != nil {
+			return err
+		}
+	}
+
+	_, err := l.w.Write(tail)
+	l.tail = nil
+	return err
+}
+
+func (l *LimitWriter) notice() []byte {
+	if l.Notice != nil {
+		return l.Notice(l.dropped)
+	}
+	return []byte(fmt.Sprintf("\n... log exceeded %d bytes, %d bytes truncated ...\n", l.Max, l.dropped))
+}
+
+func (l *LimitWriter) tailSize() int64 {
+	size := l.Tail
+	if size == 0 {
+		size = l.Max / 10
+	}
+	if size > l.Max {
+		size = l.Max
+	}
+	if size < 0 {
+		size = 0
+	}
+	return size
+}
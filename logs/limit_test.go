@@ -0,0 +1,98 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitWriter_UnderLimit(t *testing.T) {
+	b := new(bytes.Buffer)
+	w := Limit(b, 100)
+
+	io.WriteString(w, "line 1\n")
+	io.WriteString(w, "line 2\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "line 1\nline 2\n", b.String())
+	assert.Equal(t, int64(0), w.Truncated())
+}
+
+func TestLimitWriter_Truncate(t *testing.T) {
+	var truncated int64
+	b := new(bytes.Buffer)
+	w := Limit(b, 40)
+	w.Tail = 15
+	w.OnTruncate = func(n int64) { truncated = n }
+
+	for i := 0; i < 10; i++ {
+		_, err := io.WriteString(w, fmt.Sprintf("line %d\n", i))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "line 0\nline 1\nline 2\n\n... log exceeded 40 bytes, 35 bytes truncated ...\nline 8\nline 9\n", b.String())
+	assert.Equal(t, int64(35), truncated)
+}
+
+func TestLimitWriter_TailLargerThanMax(t *testing.T) {
+	b := new(bytes.Buffer)
+	w := Limit(b, 10)
+	w.Tail = 20
+
+	// The tail is capped at Max, so none of the head is kept.
+	_, err := io.WriteString(w, "line 1\nline 2\nline 3\n")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "\n... log exceeded 10 bytes, 14 bytes truncated ...\nline 3\n", b.String())
+}
+
+func TestLimitWriter_Negative(t *testing.T) {
+	b := new(bytes.Buffer)
+	w := Limit(b, -1)
+
+	_, err := io.WriteString(w, "line 1\n")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+}
+
+func TestLimitWriter_Notice(t *testing.T) {
+	b := new(bytes.Buffer)
+	w := Limit(b, 10)
+	w.Tail = 5
+	w.Notice = func(n int64) []byte {
+		return []byte(fmt.Sprintf("{\"truncated\":%d}\n", n))
+	}
+
+	io.WriteString(w, "{\"a\":1}\n{\"b\":2}\n{\"c\":3}\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "{\"truncated\":24}\n", b.String())
+}
+
+func TestLimitStructured(t *testing.T) {
+	b := new(bytes.Buffer)
+	w := LimitStructured(b, 20)
+	w.Tail = 5
+
+	io.WriteString(w, "{\"a\":1}\n{\"b\":2}\n")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "{\"a\":1}\n{\"time\":\"2016-01-01T00:00:00Z\",\"stream\":\"conveyor\",\"phase\":\"truncated\",\"text\":\"log exceeded 20 bytes, 8 bytes truncated\"}\n", b.String())
+}
+
+func TestLimitWriter_FailOnTruncate(t *testing.T) {
+	b := new(bytes.Buffer)
+	w := Limit(b, 10)
+	w.FailOnTruncate = true
+
+	_, err := io.WriteString(w, "12345678")
+	assert.NoError(t, err)
+
+	_, err = io.WriteString(w, "90abcdef")
+	assert.Equal(t, ErrTruncated, err)
+}
@@ -0,0 +1,62 @@
+package logs
+
+import (
+	"bytes"
+	"io"
+)
+
+// LineObserver is an io.Writer that passes all writes through to an
+// underlying io.Writer, and calls a function with every complete line of
+// output. The function is called before the bytes that complete the line are
+// written to the underlying io.Writer.
+type LineObserver struct {
+	w  io.Writer
+	fn func(line string)
+
+	// line holds the bytes of the line that has not yet been terminated.
+	line []byte
+}
+
+// ObserveLines returns a new LineObserver that writes to w and calls fn for
+// each line.
+func ObserveLines(w io.Writer, fn func(line string)) *LineObserver {
+	return &LineObserver{w: w, fn: fn}
+}
+
+// Write implements the io.Writer interface.
+func (o *LineObserver) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			o.line = append(o.line, p...)
+			m, err := o.w.Write(p)
+			return n + m, err
+		}
+
+		o.line = append(o.line, p[:i]...)
+		o.observe()
+
+		m, err := o.w.Write(p[:i+1])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[i+1:]
+	}
+
+	return n, nil
+}
+
+// Flush calls the function with any trailing output that was not terminated
+// with a newline.
+func (o *LineObserver) Flush() {
+	if len(o.line) > 0 {
+		o.observe()
+	}
+}
+
+func (o *LineObserver) observe() {
+	o.fn(string(bytes.TrimSuffix(o.line, []byte{'\r'})))
+	o.line = o.line[:0]
+}
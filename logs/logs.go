@@ -23,6 +23,10 @@ type Logger interface {
 	// Open returns an io.Reader that can be read from to stream the logs
 	// back to the client.
 	Open(name string) (io.Reader, error)
+
+	// Delete removes the logs. Deleting logs that don't exist is not an
+	// error.
+	Delete(name string) error
 }
 
 // nullLogger is a Logger implementation that returns null readers and
@@ -37,6 +41,10 @@ func (l *nullLogger) Open(name string) (io.Reader, error) {
 	return strings.NewReader(""), nil
 }
 
+func (l *nullLogger) Delete(name string) error {
+	return nil
+}
+
 // stdLogger is a Logger implementation that writes log output to os.Stdout.
 type stdoutLogger struct{}
 
@@ -47,3 +55,8 @@ func (l *stdoutLogger) Create(name string) (io.Writer, error) {
 func (l *stdoutLogger) Open(name string) (io.Reader, error) {
 	return strings.NewReader(""), errors.New("stdout logger: reading is not implemented")
 }
+
+// Delete is a noop, since logs written to os.Stdout aren't stored.
+func (l *stdoutLogger) Delete(name string) error {
+	return nil
+}
@@ -2,7 +2,6 @@ package s3
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"path/filepath"
@@ -31,18 +30,45 @@ func NewLogger(bucket string) *Logs {
 }
 
 func (l *Logs) Create(name string) (io.Writer, error) {
-	name = filepath.Join("logs", fmt.Sprintf("%s.txt", name))
+	contentType := "text/plain"
+	if filepath.Ext(name) == ".json" {
+		contentType = "application/x-ndjson"
+	}
 
 	return &writer{
-		bucket: l.Bucket,
-		name:   name,
-		client: l.client,
-		b:      new(bytes.Buffer),
+		bucket:      l.Bucket,
+		name:        key(name),
+		contentType: contentType,
+		client:      l.client,
+		b:           new(bytes.Buffer),
 	}, nil
 }
 
 func (l *Logs) Open(name string) (io.Reader, error) {
-	return nil, errors.New("s3 logs: read is not implemented yet")
+	resp, err := l.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(l.Bucket),
+		Key:    aws.String(key(name)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (l *Logs) Delete(name string) error {
+	_, err := l.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(l.Bucket),
+		Key:    aws.String(key(name)),
+	})
+	return err
+}
+
+// key returns the key of the s3 object that the named log is stored in.
+func key(name string) string {
+	if filepath.Ext(name) == "" {
+		name = fmt.Sprintf("%s.txt", name)
+	}
+	return filepath.Join("logs", name)
 }
 
 // writer is an io.WriteCloser implementation that buffers up the bytes until
@@ -51,8 +77,8 @@ type writer struct {
 	// Data will be buffered here.
 	b *bytes.Buffer
 
-	bucket, name string
-	client       *s3.S3
+	bucket, name, contentType string
+	client                    *s3.S3
 }
 
 func (l *writer) Write(p []byte) (int, error) {
@@ -66,7 +92,7 @@ func (l *writer) Close() error {
 		ACL:           aws.String("public-read"),
 		Body:          bytes.NewReader(l.b.Bytes()),
 		ContentLength: aws.Int64(int64(l.b.Len())),
-		ContentType:   aws.String("text/plain"),
+		ContentType:   aws.String(l.contentType),
 	})
 	return err
 }
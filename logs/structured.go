@@ -0,0 +1,174 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Streams that an Entry can belong to.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	// StreamConveyor is the stream for markers that are generated by
+	// Conveyor itself, rather than the build.
+	StreamConveyor = "conveyor"
+)
+
+// Phases of a build that are marked in the structured log.
+const (
+	PhaseConfig   = "config"
+	PhaseCreate   = "create"
+	PhaseStart    = "start"
+	PhasePull     = "pull"
+	PhaseStep     = "step"
+	PhasePush     = "push"
+	PhaseComplete = "complete"
+
+	// PhaseTruncated marks the point where output was dropped because
+	// the log exceeded the maximum size.
+	PhaseTruncated = "truncated"
+)
+
+// now returns the current time. It's a variable so it can be stubbed in tests.
+var now = time.Now
+
+// Entry is a single line within a structured log.
+type Entry struct {
+	// The time that the line was written.
+	Time time.Time `json:"time"`
+	// The stream that the line was written to.
+	Stream string `json:"stream"`
+	// If this entry is a marker, the phase of the build that it marks.
+	Phase string `json:"phase,omitempty"`
+	// The text of the line, without the trailing newline.
+	Text string `json:"text"`
+}
+
+// StructuredName returns the name of the structured log that's stored
+// alongside the raw log with the given name.
+func StructuredName(name string) string {
+	return name + ".json"
+}
+
+// Streamer can be implemented by log writers that can differentiate between
+// stdout and stderr.
+type Streamer interface {
+	Stream(name string) io.Writer
+}
+
+// Marker can be implemented by log writers that can record markers for the
+// phases of a build.
+type Marker interface {
+	Mark(phase, text string) error
+}
+
+// Stream returns an io.Writer for the named stream if w implements the
+// Streamer interface. Otherwise, w is returned.
+func Stream(w io.Writer, name string) io.Writer {
+	if s, ok := w.(Streamer); ok {
+		return s.Stream(name)
+	}
+	return w
+}
+
+// Mark records a marker for the phase if w implements the Marker interface.
+func Mark(w io.Writer, phase, format string, v ...interface{}) error {
+	if m, ok := w.(Marker); ok {
+		return m.Mark(phase, fmt.Sprintf(format, v...))
+	}
+	return nil
+}
+
+// StructuredWriter is an io.Writer that writes raw output to one io.Writer and
+// timestamped entries, encoded as newline delimited JSON, to another.
+type StructuredWriter struct {
+	raw        io.Writer
+	structured io.Writer
+
+	sync.Mutex
+	enc     *json.Encoder
+	streams map[string]*LineObserver
+}
+
+// NewStructuredWriter returns a new StructuredWriter. Anything written directly
+// to the returned StructuredWriter is treated as stdout.
+func NewStructuredWriter(raw, structured io.Writer) *StructuredWriter {
+	return &StructuredWriter{
+		raw:        raw,
+		structured: structured,
+		enc:        json.NewEncoder(structured),
+		streams:    make(map[string]*LineObserver),
+	}
+}
+
+// Write implements the io.Writer interface.
+func (w *StructuredWriter) Write(p []byte) (int, error) {
+	return w.Stream(StreamStdout).Write(p)
+}
+
+// Stream returns an io.Writer that will record each line as an Entry for the
+// named stream.
+func (w *StructuredWriter) Stream(name string) io.Writer {
+	w.Lock()
+	defer w.Unlock()
+
+	s, ok := w.streams[name]
+	if !ok {
+		s = ObserveLines(writerFunc(w.writeRaw), func(line string) {
+			w.encode(Entry{Stream: name, Text: line})
+		})
+		w.streams[name] = s
+	}
+	return s
+}
+
+// Mark records a marker for the given phase.
+func (w *StructuredWriter) Mark(phase, text string) error {
+	return w.encode(Entry{Stream: StreamConveyor, Phase: phase, Text: text})
+}
+
+// Close flushes any unterminated lines and closes the underlying io.Writers
+// if they implement the io.Closer interface.
+func (w *StructuredWriter) Close() error {
+	w.Lock()
+	streams := w.streams
+	w.Unlock()
+
+	for _, s := range streams {
+		s.Flush()
+	}
+
+	var err error
+	for _, c := range []io.Writer{w.structured, w.raw} {
+		if c, ok := c.(io.Closer); ok {
+			if closeErr := c.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+func (w *StructuredWriter) writeRaw(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	return w.raw.Write(p)
+}
+
+func (w *StructuredWriter) encode(e Entry) error {
+	w.Lock()
+	defer w.Unlock()
+	e.Time = now().UTC()
+	return w.enc.Encode(e)
+}
+
+// writerFunc is a function that implements the io.Writer interface.
+type writerFunc func([]byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
@@ -0,0 +1,53 @@
+package logs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	now = func() time.Time {
+		return time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func TestObserveLines(t *testing.T) {
+	var lines []string
+	b := new(bytes.Buffer)
+	w := ObserveLines(b, func(line string) {
+		lines = append(lines, line)
+	})
+
+	io.WriteString(w, "Step 1/2 : FROM")
+	io.WriteString(w, " ubuntu\r\nStep 2/2 : RUN make\n---> Running")
+	w.Flush()
+
+	assert.Equal(t, "Step 1/2 : FROM ubuntu\r\nStep 2/2 : RUN make\n---> Running", b.String())
+	assert.Equal(t, []string{"Step 1/2 : FROM ubuntu", "Step 2/2 : RUN make", "---> Running"}, lines)
+}
+
+func TestStructuredWriter(t *testing.T) {
+	raw, structured := new(bytes.Buffer), new(bytes.Buffer)
+	w := NewStructuredWriter(raw, structured)
+
+	Mark(w, PhaseStart, "Started container %s", "4321")
+	io.WriteString(Stream(w, StreamStdout), "Pulling base image\n")
+	io.WriteString(Stream(w, StreamStderr), "warning")
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "Pulling base image\nwarning", raw.String())
+	assert.Equal(t, `{"time":"2016-01-01T00:00:00Z","stream":"conveyor","phase":"start","text":"Started container 4321"}
+{"time":"2016-01-01T00:00:00Z","stream":"stdout","text":"Pulling base image"}
+{"time":"2016-01-01T00:00:00Z","stream":"stderr","text":"warning"}
+`, structured.String())
+}
+
+func TestStream_NotStreamer(t *testing.T) {
+	b := new(bytes.Buffer)
+	assert.Equal(t, b, Stream(b, StreamStderr))
+	assert.NoError(t, Mark(b, PhaseStart, "Started"))
+}
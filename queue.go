@@ -29,14 +29,17 @@ type BuildContext struct {
 }
 
 // buildQueue is an implementation of the BuildQueue interface that is in memory
-// using a channel.
+// using a channel. High priority builds are sent on a separate channel, which
+// is always drained first.
 type buildQueue struct {
 	queue chan BuildContext
+	high  chan BuildContext
 }
 
 func newBuildQueue(buffer int) *buildQueue {
 	return &buildQueue{
 		queue: make(chan BuildContext, buffer),
+		high:  make(chan BuildContext, buffer),
 	}
 }
 
@@ -46,7 +49,12 @@ func NewBuildQueue(buffer int) BuildQueue {
 }
 
 func (q *buildQueue) Push(ctx context.Context, options builder.BuildOptions) error {
-	q.queue <- BuildContext{
+	queue := q.queue
+	if options.Priority == PriorityHigh {
+		queue = q.high
+	}
+
+	queue <- BuildContext{
 		Ctx:          ctx,
 		BuildOptions: options,
 	}
@@ -55,8 +63,21 @@ func (q *buildQueue) Push(ctx context.Context, options builder.BuildOptions) err
 
 func (q *buildQueue) Subscribe(ch chan BuildContext) error {
 	go func() {
-		for req := range q.queue {
-			ch <- req
+		for {
+			// Prefer high priority builds when both are waiting.
+			select {
+			case req := <-q.high:
+				ch <- req
+				continue
+			default:
+			}
+
+			select {
+			case req := <-q.high:
+				ch <- req
+			case req := <-q.queue:
+				ch <- req
+			}
 		}
 	}()
 
@@ -75,6 +96,10 @@ type SQSBuildQueue struct {
 	// QueueURL is the URL for the SQS queue.
 	QueueURL string
 
+	// If provided, high priority builds are sent to this SQS queue, which
+	// is received from before QueueURL.
+	HighPriorityQueueURL string
+
 	// Context is used to generate a context.Context when receiving a
 	// message. The zero value is context.Background.
 	Context func() context.Context
@@ -101,9 +126,14 @@ func (q *SQSBuildQueue) Push(ctx context.Context, options builder.BuildOptions)
 		return err
 	}
 
+	queueURL := q.QueueURL
+	if options.Priority == PriorityHigh && q.HighPriorityQueueURL != "" {
+		queueURL = q.HighPriorityQueueURL
+	}
+
 	input := &sqs.SendMessageInput{
 		MessageBody: aws.String(string(raw)),
-		QueueUrl:    aws.String(q.QueueURL),
+		QueueUrl:    aws.String(queueURL),
 	}
 
 	_, err = q.sqs.SendMessage(input)
@@ -115,7 +145,17 @@ func (q *SQSBuildQueue) Push(ctx context.Context, options builder.BuildOptions)
 func (q *SQSBuildQueue) Subscribe(ch chan BuildContext) error {
 	go func() {
 		for {
-			if err := q.receiveMessage(ch); err != nil {
+			if q.HighPriorityQueueURL != "" {
+				n, err := q.receiveMessage(ch, q.HighPriorityQueueURL)
+				if err != nil {
+					q.handleError(err)
+				}
+				if n > 0 {
+					continue
+				}
+			}
+
+			if _, err := q.receiveMessage(ch, q.QueueURL); err != nil {
 				q.handleError(err)
 			}
 		}
@@ -124,8 +164,9 @@ func (q *SQSBuildQueue) Subscribe(ch chan BuildContext) error {
 	return nil
 }
 
-// receiveMessage calls ReceiveMessage and sends the build requests of ch.
-func (q *SQSBuildQueue) receiveMessage(ch chan BuildContext) (err error) {
+// receiveMessage calls ReceiveMessage on the queue and sends the build requests
+// on ch. It returns the number of messages that were received.
+func (q *SQSBuildQueue) receiveMessage(ch chan BuildContext, queueURL string) (n int, err error) {
 	defer func() {
 		if v := recover(); v != nil {
 			err = fmt.Errorf("panic: %v", v)
@@ -135,7 +176,7 @@ func (q *SQSBuildQueue) receiveMessage(ch chan BuildContext) (err error) {
 
 	var resp *sqs.ReceiveMessageOutput
 	resp, err = q.sqs.ReceiveMessage(&sqs.ReceiveMessageInput{
-		QueueUrl: aws.String(q.QueueURL),
+		QueueUrl: aws.String(queueURL),
 	})
 	if err != nil {
 		return
@@ -145,7 +186,7 @@ func (q *SQSBuildQueue) receiveMessage(ch chan BuildContext) (err error) {
 	defer func() {
 		if len(entries) > 0 {
 			_, err = q.sqs.DeleteMessageBatch(&sqs.DeleteMessageBatchInput{
-				QueueUrl: aws.String(q.QueueURL),
+				QueueUrl: aws.String(queueURL),
 				Entries:  entries,
 			})
 		}
@@ -167,6 +208,7 @@ func (q *SQSBuildQueue) receiveMessage(ch chan BuildContext) (err error) {
 			Id:            aws.String(fmt.Sprintf("%d", i)),
 			ReceiptHandle: m.ReceiptHandle,
 		})
+		n++
 	}
 
 	return
@@ -29,6 +29,45 @@ func TestBuildQueue(t *testing.T) {
 	assert.Equal(t, req.Ctx, background)
 }
 
+func TestBuildQueue_Priority(t *testing.T) {
+	q := newBuildQueue(2)
+
+	background := context.Background()
+	normal := builder.BuildOptions{ID: "1"}
+	high := builder.BuildOptions{ID: "2", Priority: PriorityHigh}
+	assert.NoError(t, q.Push(background, normal))
+	assert.NoError(t, q.Push(background, high))
+
+	ch := make(chan BuildContext)
+	go q.Subscribe(ch)
+	assert.Equal(t, high, (<-ch).BuildOptions)
+	assert.Equal(t, normal, (<-ch).BuildOptions)
+}
+
+func TestSQSBuildQueue_Push_HighPriority(t *testing.T) {
+	c := new(mockSQSClient)
+	q := &SQSBuildQueue{
+		QueueURL:             "https://sqs/normal",
+		HighPriorityQueueURL: "https://sqs/high",
+		sqs:                  c,
+	}
+
+	c.On("SendMessage", &sqs.SendMessageInput{
+		MessageBody: aws.String(`{"ID":"01234567-89ab-cdef-0123-456789abcdef","Repository":"remind101/acme-inc","Sha":"abcd","Branch":"master","NoCache":false,"Priority":"high"}`),
+		QueueUrl:    aws.String("https://sqs/high"),
+	}).Return(&sqs.SendMessageOutput{}, nil)
+
+	err := q.Push(context.Background(), builder.BuildOptions{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+		Priority:   PriorityHigh,
+	})
+	assert.NoError(t, err)
+	c.AssertExpectations(t)
+}
+
 func TestSQSBuildQueue_Push(t *testing.T) {
 	c := new(mockSQSClient)
 	q := &SQSBuildQueue{
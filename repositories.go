@@ -0,0 +1,412 @@
+package conveyor
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/remind101/conveyor/builder"
+	"golang.org/x/net/context"
+)
+
+// ErrDuplicateRepository is returned when registering a repository that's
+// already registered.
+var ErrDuplicateRepository = errors.New("this repository is already registered")
+
+// The database constraint that counts as an ErrDuplicateRepository.
+const uniqueRepositoryConstraint = "unique_repository"
+
+// DefaultBranch is the default branch of a newly registered repository.
+const DefaultBranch = "master"
+
+// Repository is a GitHub repository in the registry, which controls whether,
+// and how, it's built. Repositories that aren't registered are built with the
+// defaults.
+type Repository struct {
+	// A unique identifier for this repository.
+	ID string `db:"id"`
+	// The full name of the GitHub repository, e.g. `remind101/acme-inc`.
+	Name string `db:"name"`
+	// When false, builds of the repository are denied.
+	Enabled bool `db:"enabled"`
+	// When true, new builds are held in the pending state, rather than
+	// being pushed onto the build queue, until the repository is
+	// unpaused.
+	Paused bool `db:"paused"`
+	// The branch that's built when a build request doesn't say what to
+	// build.
+	DefaultBranch string `db:"default_branch"`
+	// The docker repository that images are pushed to. Defaults to the
+	// Name.
+	Image string `db:"image"`
+	// The docker image that builds are run with, instead of the worker's
+	// default.
+	BuilderImage string `db:"builder_image"`
+	// How long builds can run before they're canceled. Defaults to the
+	// worker's timeout.
+	Timeout time.Duration `db:"timeout"`
+	// The maximum number of builds that can be queued or running at once.
+	// Further builds are held in the pending state until one completes.
+	// The zero value means no limit.
+	Concurrency int `db:"concurrency"`
+	// The time that the repository was registered.
+	CreatedAt time.Time `db:"created_at"`
+	// The time that the repository was last updated.
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// NewRepository returns a new enabled Repository with the default settings.
+func NewRepository(name string) *Repository {
+	return &Repository{
+		Name:          name,
+		Enabled:       true,
+		DefaultBranch: DefaultBranch,
+	}
+}
+
+// RepositoryError is returned when a Repository is invalid.
+type RepositoryError struct {
+	Field  string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *RepositoryError) Error() string {
+	return fmt.Sprintf("invalid repository: %s %s", e.Field, e.Reason)
+}
+
+// Validate returns an error if the Repository is invalid.
+func (r *Repository) Validate() error {
+	if parts := strings.Split(r.Name, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return &RepositoryError{Field: "name", Reason: "must be the full name of a GitHub repository, e.g. remind101/acme-inc"}
+	}
+
+	if r.DefaultBranch == "" {
+		return &RepositoryError{Field: "default_branch", Reason: "is required"}
+	}
+
+	if r.Timeout < 0 {
+		return &RepositoryError{Field: "timeout", Reason: "can't be negative"}
+	}
+
+	if r.Concurrency < 0 {
+		return &RepositoryError{Field: "concurrency", Reason: "can't be negative"}
+	}
+
+	return nil
+}
+
+// apply sets the BuildOptions that are configured for the repository.
+func (r *Repository) apply(opts *builder.BuildOptions) {
+	opts.Image = r.Image
+	opts.BuilderImage = r.BuilderImage
+	opts.Timeout = r.Timeout
+}
+
+// CreateRepository adds a repository to the registry.
+func (c *Conveyor) CreateRepository(ctx context.Context, r *Repository) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	return c.inTx(func(tx *sqlx.Tx) error {
+		return repositoriesCreate(tx, r)
+	})
+}
+
+// Repositories returns the registered repositories, ordered by name.
+func (c *Conveyor) Repositories(ctx context.Context) ([]*Repository, error) {
+	var repositories []*Repository
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		repositories, err = repositoriesFindAll(tx)
+		return
+	})
+	return repositories, err
+}
+
+// FindRepository finds a registered repository by its id, or its name.
+func (c *Conveyor) FindRepository(ctx context.Context, repositoryIdentity string) (*Repository, error) {
+	find := repositoriesFindByID
+	if strings.Contains(repositoryIdentity, "/") {
+		find = repositoriesFindByName
+	}
+
+	var r *Repository
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		r, err = find(tx, repositoryIdentity)
+		return
+	})
+	return r, err
+}
+
+// UpdateRepository updates a registered repository. Builds that were held
+// because the repository was paused, or at its concurrency limit, are released
+// if they no longer need to be held.
+func (c *Conveyor) UpdateRepository(ctx context.Context, r *Repository) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.inTx(func(tx *sqlx.Tx) error {
+		return repositoriesUpdate(tx, r)
+	}); err != nil {
+		return err
+	}
+
+	return c.releaseBuilds(ctx, r.Name)
+}
+
+// DeleteRepository removes a repository from the registry, so that it's built
+// with the defaults. Builds that were held are released.
+func (c *Conveyor) DeleteRepository(ctx context.Context, r *Repository) error {
+	if err := c.inTx(func(tx *sqlx.Tx) error {
+		return repositoriesDelete(tx, r.ID)
+	}); err != nil {
+		return err
+	}
+
+	return c.releaseBuilds(ctx, r.Name)
+}
+
+// registeredRepository returns the repository from the registry, or nil if it
+// isn't registered.
+func (c *Conveyor) registeredRepository(ctx context.Context, name string) (*Repository, error) {
+	r, err := c.FindRepository(ctx, name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return r, err
+}
+
+// holdBuild holds a new build in the pending state, rather than letting it be
+// pushed onto the build queue, if the repository is paused or at its
+// concurrency limit. Builds are also held while older builds are, so that
+// they're released in order. It returns true if the build was held.
+func holdBuild(tx *sqlx.Tx, r *Repository, opts builder.BuildOptions) (bool, error) {
+	// Lock the repository, so that concurrent builds are counted one at a
+	// time, and get its current settings.
+	r, err := repositoriesLock(tx, r.Name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	held, err := heldBuildsCount(tx, r.Name)
+	if err != nil {
+		return false, err
+	}
+
+	// This includes the new build.
+	active, err := buildsCountActive(tx, r.Name)
+	if err != nil {
+		return false, err
+	}
+
+	if !r.Paused && held == 0 && (r.Concurrency == 0 || active <= r.Concurrency) {
+		return false, nil
+	}
+
+	raw, err := json.Marshal(opts)
+	if err != nil {
+		return false, err
+	}
+
+	return true, heldBuildsCreate(tx, opts.ID, string(raw))
+}
+
+// releaseBuilds pushes the held builds of a repository onto the build queue,
+// oldest first, as long as the repository isn't paused or disabled, and is
+// within its concurrency limit. Held builds that were canceled are discarded.
+//
+// Builds are pushed before the transaction that releases them commits. A build
+// that can't be pushed is held again, and the builds after it stay held, so
+// they're released the next time a build of the repository finishes.
+func (c *Conveyor) releaseBuilds(ctx context.Context, repository string) error {
+	var pushErr error
+	err := c.inTx(func(tx *sqlx.Tx) error {
+		r, err := repositoriesLock(tx, repository)
+		if err == sql.ErrNoRows {
+			r, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if r != nil && (r.Paused || !r.Enabled) {
+			return nil
+		}
+
+		held, err := heldBuildsFind(tx, repository)
+		if err != nil || len(held) == 0 {
+			return err
+		}
+
+		active, err := buildsCountActive(tx, repository)
+		if err != nil {
+			return err
+		}
+
+		for _, h := range held {
+			if h.State == StatePending && r != nil && r.Concurrency > 0 && active >= r.Concurrency {
+				break
+			}
+
+			deleted, err := heldBuildsDelete(tx, h.BuildID)
+			if err != nil {
+				return err
+			}
+			// Released concurrently, or canceled.
+			if !deleted || h.State != StatePending {
+				continue
+			}
+
+			var opts builder.BuildOptions
+			if err := json.Unmarshal([]byte(h.Options), &opts); err != nil {
+				return err
+			}
+
+			log.Printf("releasing held build %s of %s", opts.ID, opts.Repository)
+			if pushErr = c.BuildQueue.Push(ctx, opts); pushErr != nil {
+				// Keep the builds that were already pushed
+				// released.
+				return heldBuildsCreate(tx, h.BuildID, h.Options)
+			}
+			active++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return pushErr
+}
+
+// repositoriesCreate inserts a new repository into the database.
+func repositoriesCreate(tx *sqlx.Tx, r *Repository) error {
+	const sql = `INSERT INTO repositories (name, enabled, paused, default_branch, image, builder_image, timeout, concurrency) VALUES (:name, :enabled, :paused, :default_branch, :image, :builder_image, :timeout, :concurrency) RETURNING id, created_at, updated_at`
+	err := insert(tx, sql, r, &r.ID, &r.CreatedAt, &r.UpdatedAt)
+	if err, ok := err.(*pq.Error); ok {
+		if err.Constraint == uniqueRepositoryConstraint {
+			return ErrDuplicateRepository
+		}
+	}
+	return err
+}
+
+// repositoriesFindAll returns all of the repositories, ordered by name.
+func repositoriesFindAll(tx *sqlx.Tx) ([]*Repository, error) {
+	const sql = `SELECT * FROM repositories ORDER BY lower(name)`
+	var repositories []*Repository
+	err := tx.Select(&repositories, sql)
+	return repositories, err
+}
+
+// repositoriesFindByID finds a repository by id.
+func repositoriesFindByID(tx *sqlx.Tx, id string) (*Repository, error) {
+	const sql = `SELECT * FROM repositories WHERE id = ? LIMIT 1`
+	var r Repository
+	err := tx.Get(&r, tx.Rebind(sql), id)
+	return &r, err
+}
+
+// repositoriesFindByName finds a repository by name. Names are case
+// insensitive.
+func repositoriesFindByName(tx *sqlx.Tx, name string) (*Repository, error) {
+	const sql = `SELECT * FROM repositories WHERE lower(name) = lower(?) LIMIT 1`
+	var r Repository
+	err := tx.Get(&r, tx.Rebind(sql), name)
+	return &r, err
+}
+
+// repositoriesLock finds a repository by name, and locks it until the end of
+// the transaction.
+func repositoriesLock(tx *sqlx.Tx, name string) (*Repository, error) {
+	const sql = `SELECT * FROM repositories WHERE lower(name) = lower(?) LIMIT 1 FOR UPDATE`
+	var r Repository
+	err := tx.Get(&r, tx.Rebind(sql), name)
+	return &r, err
+}
+
+// repositoriesUpdate updates the settings of a repository.
+func repositoriesUpdate(tx *sqlx.Tx, r *Repository) error {
+	const sql = `UPDATE repositories SET enabled = ?, paused = ?, default_branch = ?, image = ?, builder_image = ?, timeout = ?, concurrency = ?, updated_at = ? WHERE id = ? RETURNING updated_at`
+	return tx.Get(&r.UpdatedAt, tx.Rebind(sql), r.Enabled, r.Paused, r.DefaultBranch, r.Image, r.BuilderImage, r.Timeout, r.Concurrency, time.Now(), r.ID)
+}
+
+// repositoriesDelete deletes a repository.
+func repositoriesDelete(tx *sqlx.Tx, id string) error {
+	const sql = `DELETE FROM repositories WHERE id = ?`
+	_, err := tx.Exec(tx.Rebind(sql), id)
+	return err
+}
+
+// heldBuild is a build that's held in the pending state, along with the
+// BuildOptions to push onto the build queue when it's released.
+type heldBuild struct {
+	BuildID string     `db:"build_id"`
+	Options string     `db:"options"`
+	State   BuildState `db:"state"`
+}
+
+// heldBuildsCreate holds a build.
+func heldBuildsCreate(tx *sqlx.Tx, buildID, options string) error {
+	const sql = `INSERT INTO held_builds (build_id, options) VALUES (?, ?)`
+	_, err := tx.Exec(tx.Rebind(sql), buildID, options)
+	return err
+}
+
+// heldBuildsFind returns the held builds of a repository, oldest first.
+func heldBuildsFind(tx *sqlx.Tx, repository string) ([]*heldBuild, error) {
+	const sql = `SELECT held_builds.build_id, held_builds.options, builds.state FROM held_builds
+JOIN builds ON builds.id = held_builds.build_id
+WHERE lower(builds.repository) = lower(?)
+ORDER BY builds.seq`
+	var held []*heldBuild
+	err := tx.Select(&held, tx.Rebind(sql), repository)
+	return held, err
+}
+
+// heldBuildsCount returns the number of pending builds of a repository that
+// are held.
+func heldBuildsCount(tx *sqlx.Tx, repository string) (int, error) {
+	const sql = `SELECT count(*) FROM held_builds
+JOIN builds ON builds.id = held_builds.build_id
+WHERE lower(builds.repository) = lower(?)
+AND builds.state = 'pending'`
+	var n int
+	err := tx.Get(&n, tx.Rebind(sql), repository)
+	return n, err
+}
+
+// heldBuildsDelete releases a held build. It returns false if the build wasn't
+// held.
+func heldBuildsDelete(tx *sqlx.Tx, buildID string) (bool, error) {
+	const sql = `DELETE FROM held_builds WHERE build_id = ?`
+	res, err := tx.Exec(tx.Rebind(sql), buildID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// buildsCountActive returns the number of builds of a repository that are
+// queued or running, i.e. that are pending or building, and aren't held.
+func buildsCountActive(tx *sqlx.Tx, repository string) (int, error) {
+	const sql = `SELECT count(*) FROM builds
+WHERE lower(repository) = lower(?)
+AND state IN ('pending', 'building')
+AND id NOT IN (SELECT build_id FROM held_builds)`
+	var n int
+	err := tx.Get(&n, tx.Rebind(sql), repository)
+	return n, err
+}
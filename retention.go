@@ -0,0 +1,270 @@
+package conveyor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/remind101/conveyor/logs"
+	"golang.org/x/net/context"
+)
+
+// now returns the current time. It's a variable so that it can be stubbed in
+// tests.
+var now = time.Now
+
+// gcLockID is the key of the Postgres advisory lock that's held while garbage
+// collecting, so that only one process garbage collects at a time.
+const gcLockID = 7365320630
+
+// ErrGCLocked is returned by GC when another process is already garbage
+// collecting.
+var ErrGCLocked = errors.New("another process is already garbage collecting")
+
+// RetentionPolicy controls which builds, artifacts and logs are removed when
+// garbage collecting. The zero value retains everything.
+type RetentionPolicy struct {
+	// The number of builds to keep for each branch of a repository. Older
+	// builds are deleted, along with their artifacts and logs. 0 means
+	// that builds are never deleted.
+	KeepBuilds int
+
+	// When set, builds are only deleted once they're older than this, even
+	// if there are more than KeepBuilds newer builds.
+	MinAge time.Duration
+
+	// When set, the logs for failed builds are deleted once the build has
+	// been completed for longer than this. The build itself is kept.
+	FailedLogsTTL time.Duration
+
+	// When set, webhook deliveries are deleted once they're older than
+	// this.
+	DeliveriesTTL time.Duration
+
+	// When set, status updates that succeeded or failed are deleted once
+	// they've been completed for longer than this.
+	StatusUpdatesTTL time.Duration
+}
+
+// GCReport describes what was (or, in a dry run, would be) removed by garbage
+// collection.
+type GCReport struct {
+	// Builds that were deleted, along with their artifacts and logs.
+	Builds []*Build
+
+	// Failed builds that had their logs deleted.
+	Logs []*Build
+
+	// The number of webhook deliveries that were deleted.
+	Deliveries int
+
+	// The number of completed status updates that were deleted.
+	StatusUpdates int
+}
+
+// GC removes builds, artifacts and logs according to the retention policy.
+// Builds that are pending or building, and builds that produced the latest
+// artifact for a branch, are always kept. When dryRun is true, nothing is
+// removed, but the report describes what would be.
+//
+// Only one process can garbage collect at a time. If another process is
+// already garbage collecting, ErrGCLocked is returned.
+func (c *Conveyor) GC(ctx context.Context, p RetentionPolicy, dryRun bool) (*GCReport, error) {
+	if !dryRun {
+		unlock, err := c.lockGC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(GCReport)
+	t := now().UTC()
+
+	if p.KeepBuilds > 0 {
+		r.Builds, err = buildsFindExpired(tx, p.KeepBuilds, t.Add(-p.MinAge))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if p.FailedLogsTTL > 0 {
+		r.Logs, err = buildsFindExpiredLogs(tx, t.Add(-p.FailedLogsTTL))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if p.DeliveriesTTL > 0 {
+		expire := deliveriesDeleteExpired
+		if dryRun {
+			expire = deliveriesCountExpired
+		}
+		r.Deliveries, err = expire(tx, t.Add(-p.DeliveriesTTL))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if p.StatusUpdatesTTL > 0 {
+		expire := statusUpdatesDeleteExpired
+		if dryRun {
+			expire = statusUpdatesCountExpired
+		}
+		r.StatusUpdates, err = expire(tx, t.Add(-p.StatusUpdatesTTL))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return r, nil
+	}
+
+	// Logs are deleted before the builds that reference them, so that a
+	// failure part way through can be picked up by the next run.
+	for _, b := range r.Logs {
+		if err := c.deleteLogs(b.ID); err != nil {
+			return r, err
+		}
+
+		if err := c.inTx(func(tx *sqlx.Tx) error {
+			return buildsUpdateLogsDeleted(tx, b.ID)
+		}); err != nil {
+			return r, err
+		}
+	}
+
+	for _, b := range r.Builds {
+		if !b.LogsDeleted {
+			if err := c.deleteLogs(b.ID); err != nil {
+				return r, err
+			}
+		}
+
+		if err := c.inTx(func(tx *sqlx.Tx) error {
+			return buildsDelete(tx, b.ID)
+		}); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// lockGC takes the advisory lock for garbage collection, and returns a function
+// that releases it. The lock is held by a single connection, since it's
+// released when the session ends.
+func (c *Conveyor) lockGC(ctx context.Context) (func(), error) {
+	conn, err := c.db.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, gcLockID).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, ErrGCLocked
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, gcLockID)
+		conn.Close()
+	}, nil
+}
+
+// deleteLogs deletes the raw and structured logs for a build.
+func (c *Conveyor) deleteLogs(buildID string) error {
+	for _, name := range []string{buildID, logs.StructuredName(buildID)} {
+		if err := c.Logger.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inTx runs fn within a transaction.
+func (c *Conveyor) inTx(fn func(*sqlx.Tx) error) error {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// buildsFindExpired returns the completed builds that aren't among the most
+// recent keep builds for their branch, were created before the given time, and
+// didn't produce the latest artifact for their branch.
+func buildsFindExpired(tx *sqlx.Tx, keep int, before time.Time) ([]*Build, error) {
+	const sql = `SELECT * FROM builds WHERE id IN (
+	SELECT id FROM (
+		SELECT id, state, created_at, row_number() OVER (PARTITION BY repository, branch ORDER BY seq DESC) AS rank
+		FROM builds
+	) ranked
+	WHERE rank > ?
+	AND state IN ('succeeded', 'failed', 'canceled')
+	AND created_at < ?
+	AND id NOT IN (
+		SELECT DISTINCT ON (builds.repository, builds.branch) artifacts.build_id
+		FROM artifacts
+		JOIN builds ON builds.id = artifacts.build_id
+		ORDER BY builds.repository, builds.branch, artifacts.seq DESC
+	)
+)
+ORDER BY seq ASC`
+	var builds []*Build
+	err := tx.Select(&builds, tx.Rebind(sql), keep, before)
+	return builds, err
+}
+
+// buildsFindExpiredLogs returns the failed builds that were completed before
+// the given time, and still have logs.
+func buildsFindExpiredLogs(tx *sqlx.Tx, before time.Time) ([]*Build, error) {
+	const sql = `SELECT * FROM builds
+WHERE state = 'failed'
+AND completed_at < ?
+AND NOT logs_deleted
+ORDER BY seq ASC`
+	var builds []*Build
+	err := tx.Select(&builds, tx.Rebind(sql), before)
+	return builds, err
+}
+
+// buildsUpdateLogsDeleted marks the logs for a build as deleted.
+func buildsUpdateLogsDeleted(tx *sqlx.Tx, buildID string) error {
+	const sql = `UPDATE builds SET logs_deleted = true WHERE id = ?`
+	_, err := tx.Exec(tx.Rebind(sql), buildID)
+	return err
+}
+
+// buildsDelete deletes a build, along with its artifacts and steps.
+func buildsDelete(tx *sqlx.Tx, buildID string) error {
+	if _, err := tx.Exec(tx.Rebind(`DELETE FROM artifacts WHERE build_id = ?`), buildID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(tx.Rebind(`DELETE FROM builds WHERE id = ?`), buildID)
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"golang.org/x/net/context"
@@ -20,9 +21,26 @@ import (
 // client mocks out the interface from conveyor.Conveyor that we use.
 type client interface {
 	Logs(context.Context, string) (io.Reader, error)
+	StructuredLogs(context.Context, string) (io.Reader, error)
 	Build(context.Context, conveyor.BuildRequest) (*conveyor.Build, error)
 	FindBuild(context.Context, string) (*conveyor.Build, error)
 	FindArtifact(context.Context, string) (*conveyor.Artifact, error)
+	FindSteps(context.Context, string) ([]*conveyor.Step, error)
+	FindPullRequestBuilds(ctx context.Context, repository string, number int) ([]*conveyor.Build, error)
+	PendingStatusUpdates(context.Context) ([]*conveyor.StatusUpdate, error)
+	Deliveries(context.Context) ([]*conveyor.Delivery, error)
+	FindDelivery(context.Context, string) (*conveyor.Delivery, error)
+	CreateRepository(context.Context, *conveyor.Repository) error
+	Repositories(context.Context) ([]*conveyor.Repository, error)
+	FindRepository(context.Context, string) (*conveyor.Repository, error)
+	UpdateRepository(context.Context, *conveyor.Repository) error
+	DeleteRepository(context.Context, *conveyor.Repository) error
+	Setup(context.Context, conveyor.SetupRequest) (*conveyor.Webhook, error)
+}
+
+// replayer replays recorded webhook deliveries.
+type replayer interface {
+	Replay(context.Context, *conveyor.Delivery) (*conveyor.Delivery, error)
 }
 
 // Server implements the http.Handler interface for serving build requests via
@@ -30,6 +48,13 @@ type client interface {
 type Server struct {
 	client
 
+	// Webhooks replays recorded webhook deliveries.
+	Webhooks replayer
+
+	// When set, streaming the logs of a build requires a link signed with
+	// this secret (see SignLogsURL), or the API's authentication.
+	LogsSecret []byte
+
 	// mux contains the routes.
 	mux http.Handler
 }
@@ -52,14 +77,41 @@ func newServer(c client, auth func(http.Handler) http.Handler) *Server {
 	// Builds
 	r.Handle("/builds", authFunc(s.BuildCreate)).Methods("POST")
 	r.Handle("/builds/{owner}/{repo}@{sha}", authFunc(s.BuildInfo)).Methods("GET")
+	r.Handle("/builds/{owner}/{repo}/pulls/{number:[0-9]+}", authFunc(s.PullRequestBuildList)).Methods("GET")
 	r.Handle("/builds/{id}", authFunc(s.BuildInfo)).Methods("GET")
 
+	// Steps
+	r.Handle("/builds/{owner}/{repo}@{sha}/steps", authFunc(s.StepList)).Methods("GET")
+	r.Handle("/builds/{id}/steps", authFunc(s.StepList)).Methods("GET")
+
 	// Artifacts
 	r.Handle("/artifacts/{owner}/{repo}@{sha}", authFunc(s.ArtifactInfo)).Methods("GET")
+	r.Handle("/artifacts/{owner}/{repo}@{sha}/{name}", authFunc(s.ArtifactInfo)).Methods("GET")
 	r.Handle("/artifacts/{id}", authFunc(s.ArtifactInfo)).Methods("GET")
 
+	// Status updates
+	r.Handle("/status_updates", authFunc(s.StatusUpdateList)).Methods("GET")
+
+	// Repositories
+	r.Handle("/repositories", authFunc(s.RepositoryList)).Methods("GET")
+	r.Handle("/repositories", authFunc(s.RepositoryCreate)).Methods("POST")
+	r.Handle("/repositories/{owner}/{repo}", authFunc(s.RepositoryInfo)).Methods("GET")
+	r.Handle("/repositories/{owner}/{repo}", authFunc(s.RepositoryUpdate)).Methods("PATCH")
+	r.Handle("/repositories/{owner}/{repo}", authFunc(s.RepositoryDelete)).Methods("DELETE")
+	r.Handle("/repositories/{id}", authFunc(s.RepositoryInfo)).Methods("GET")
+	r.Handle("/repositories/{id}", authFunc(s.RepositoryUpdate)).Methods("PATCH")
+	r.Handle("/repositories/{id}", authFunc(s.RepositoryDelete)).Methods("DELETE")
+
+	// Webhooks
+	r.Handle("/webhooks", authFunc(s.WebhookSetup)).Methods("POST")
+
+	// Webhook deliveries
+	r.Handle("/webhooks/deliveries", authFunc(s.WebhookDeliveryList)).Methods("GET")
+	r.Handle("/webhooks/deliveries/{id}", authFunc(s.WebhookDeliveryInfo)).Methods("GET")
+	r.Handle("/webhooks/deliveries/{id}/replay", authFunc(s.WebhookDeliveryReplay)).Methods("POST")
+
 	// Logs
-	r.HandleFunc("/logs/{id}", s.LogsStream).Methods("GET")
+	r.Handle("/logs/{id}", s.logsAuth(auth, http.HandlerFunc(s.LogsStream))).Methods("GET")
 
 	s.mux = r
 	return s
@@ -70,20 +122,36 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
 
-// LogsStream is an http.HandlerFunc that will stream the logs for a build.
+// LogsStream is an http.HandlerFunc that will stream the logs for a build. If
+// the `format` query parameter is `json`, the structured logs are streamed
+// as newline delimited JSON.
 func (s *Server) LogsStream(rw http.ResponseWriter, req *http.Request) {
 	ctx := context.TODO()
 
 	vars := mux.Vars(req)
 
+	var (
+		open        func(context.Context, string) (io.Reader, error)
+		contentType string
+	)
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "text":
+		open, contentType = s.client.Logs, "text/plain"
+	case "json":
+		open, contentType = s.client.StructuredLogs, "application/x-ndjson"
+	default:
+		http.Error(rw, fmt.Sprintf("unknown log format: %s", format), http.StatusBadRequest)
+		return
+	}
+
 	// Get a handle to an io.Reader to stream the logs from.
-	r, err := s.client.Logs(ctx, vars["id"])
+	r, err := open(ctx, vars["id"])
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	rw.Header().Set("Content-Type", "text/plain")
+	rw.Header().Set("Content-Type", contentType)
 
 	// Chrome won't show data if we don't set this. See
 	// http://stackoverflow.com/questions/26164705/chrome-not-handling-chunked-responses-like-firefox-safari.
@@ -101,16 +169,24 @@ func (s *Server) LogsStream(rw http.ResponseWriter, req *http.Request) {
 
 // newBuild decorates a conveyor.Build as a schema.Build.
 func newBuild(b *conveyor.Build) schema.Build {
-	return schema.Build{
-		ID:          b.ID,
-		Repository:  b.Repository,
-		Branch:      b.Branch,
-		Sha:         b.Sha,
-		State:       b.State.String(),
-		CreatedAt:   b.CreatedAt,
-		StartedAt:   b.StartedAt,
-		CompletedAt: b.CompletedAt,
+	build := schema.Build{
+		ID:            b.ID,
+		Repository:    b.Repository,
+		Branch:        b.Branch,
+		Tag:           b.Tag,
+		Sha:           b.Sha,
+		PullRequest:   b.PullRequest,
+		State:         b.State.String(),
+		CreatedAt:     b.CreatedAt,
+		StartedAt:     b.StartedAt,
+		CompletedAt:   b.CompletedAt,
+		LogsTruncated: b.LogsTruncated,
+		Directives:    []string(b.Directives),
+	}
+	if build.Directives == nil {
+		build.Directives = []string{}
 	}
+	return build
 }
 
 // BuildCreate creates a Build and returns it.
@@ -123,10 +199,20 @@ func (s *Server) BuildCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	directives, err := conveyor.ParseDirectives(emptyString(req.Message))
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
 	b, err := s.client.Build(ctx, conveyor.BuildRequest{
 		Repository: req.Repository,
 		Branch:     emptyString(req.Branch),
 		Sha:        emptyString(req.Sha),
+		Tag:        emptyString(req.Tag),
+		Ref:        emptyString(req.Ref),
+		NoCache:    directives.NoCache,
+		Directives: directives,
 	})
 	if err != nil {
 		encodeErr(w, err)
@@ -151,10 +237,379 @@ func (s *Server) BuildInfo(w http.ResponseWriter, r *http.Request) {
 	encode(w, newBuild(b))
 }
 
+// PullRequestBuildList returns the Builds for a pull request, newest first.
+func (s *Server) PullRequestBuildList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	vars := mux.Vars(r)
+	number, err := strconv.Atoi(vars["number"])
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	builds, err := s.client.FindPullRequestBuilds(ctx, fmt.Sprintf("%s/%s", vars["owner"], vars["repo"]), number)
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	resp := make([]schema.Build, 0, len(builds))
+	for _, b := range builds {
+		resp = append(resp, newBuild(b))
+	}
+
+	encode(w, resp)
+}
+
+func newStep(st *conveyor.Step) schema.Step {
+	step := schema.Step{
+		ID:          st.ID,
+		Number:      st.Number,
+		Total:       st.Total,
+		Instruction: st.Instruction,
+		Cached:      st.Cached,
+		StartedAt:   st.StartedAt,
+		Duration:    st.Duration.Seconds(),
+	}
+	step.Build.ID = st.BuildID
+	return step
+}
+
+// StepList returns the Dockerfile steps that were run for a Build.
+func (s *Server) StepList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	ident := identity(mux.Vars(r))
+
+	steps, err := s.client.FindSteps(ctx, ident)
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	resp := make([]schema.Step, 0, len(steps))
+	for _, st := range steps {
+		resp = append(resp, newStep(st))
+	}
+
+	encode(w, resp)
+}
+
+func newStatusUpdate(u *conveyor.StatusUpdate) schema.StatusUpdate {
+	update := schema.StatusUpdate{
+		ID:            u.ID,
+		Repository:    u.Repository,
+		Sha:           u.Sha,
+		Kind:          u.Kind,
+		Attempts:      u.Attempts,
+		LastError:     u.LastError,
+		NextAttemptAt: u.NextAttemptAt,
+		CreatedAt:     u.CreatedAt,
+	}
+	if u.BuildID != nil {
+		update.Build = &struct {
+			ID string `json:"id" url:"id,key"`
+		}{ID: *u.BuildID}
+	}
+	return update
+}
+
+// StatusUpdateList returns the GitHub status updates that haven't been applied
+// yet.
+func (s *Server) StatusUpdateList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	updates, err := s.client.PendingStatusUpdates(ctx)
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	resp := make([]schema.StatusUpdate, 0, len(updates))
+	for _, u := range updates {
+		resp = append(resp, newStatusUpdate(u))
+	}
+
+	encode(w, resp)
+}
+
+func newRepository(r *conveyor.Repository) schema.Repository {
+	return schema.Repository{
+		ID:            r.ID,
+		Name:          r.Name,
+		Enabled:       r.Enabled,
+		Paused:        r.Paused,
+		DefaultBranch: r.DefaultBranch,
+		Image:         r.Image,
+		BuilderImage:  r.BuilderImage,
+		Timeout:       int(r.Timeout / time.Second),
+		Concurrency:   r.Concurrency,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+}
+
+// RepositoryList returns the registered repositories.
+func (s *Server) RepositoryList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	repositories, err := s.client.Repositories(ctx)
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	resp := make([]schema.Repository, 0, len(repositories))
+	for _, repo := range repositories {
+		resp = append(resp, newRepository(repo))
+	}
+
+	encode(w, resp)
+}
+
+// RepositoryCreate registers a repository and returns it.
+func (s *Server) RepositoryCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	var req schema.RepositoryCreateOpts
+	if err := decode(r.Body, &req); err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	repo := conveyor.NewRepository(req.Name)
+	updateRepository(repo, schema.RepositoryUpdateOpts{
+		BuilderImage:  req.BuilderImage,
+		Concurrency:   req.Concurrency,
+		DefaultBranch: req.DefaultBranch,
+		Enabled:       req.Enabled,
+		Image:         req.Image,
+		Paused:        req.Paused,
+		Timeout:       req.Timeout,
+	})
+
+	if err := s.client.CreateRepository(ctx, repo); err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	encode(w, newRepository(repo))
+}
+
+// RepositoryInfo returns a repository.
+func (s *Server) RepositoryInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	repo, err := s.client.FindRepository(ctx, repositoryIdentity(mux.Vars(r)))
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	encode(w, newRepository(repo))
+}
+
+// RepositoryUpdate updates a repository and returns it.
+func (s *Server) RepositoryUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	var req schema.RepositoryUpdateOpts
+	if err := decode(r.Body, &req); err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	repo, err := s.client.FindRepository(ctx, repositoryIdentity(mux.Vars(r)))
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	updateRepository(repo, req)
+
+	if err := s.client.UpdateRepository(ctx, repo); err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	encode(w, newRepository(repo))
+}
+
+// RepositoryDelete removes a repository from the registry and returns it.
+func (s *Server) RepositoryDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	repo, err := s.client.FindRepository(ctx, repositoryIdentity(mux.Vars(r)))
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	if err := s.client.DeleteRepository(ctx, repo); err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	encode(w, newRepository(repo))
+}
+
+// updateRepository sets the settings that were provided on a repository.
+func updateRepository(repo *conveyor.Repository, opts schema.RepositoryUpdateOpts) {
+	if opts.Enabled != nil {
+		repo.Enabled = *opts.Enabled
+	}
+	if opts.Paused != nil {
+		repo.Paused = *opts.Paused
+	}
+	if opts.DefaultBranch != nil {
+		repo.DefaultBranch = *opts.DefaultBranch
+	}
+	if opts.Image != nil {
+		repo.Image = *opts.Image
+	}
+	if opts.BuilderImage != nil {
+		repo.BuilderImage = *opts.BuilderImage
+	}
+	if opts.Timeout != nil {
+		repo.Timeout = time.Duration(*opts.Timeout) * time.Second
+	}
+	if opts.Concurrency != nil {
+		repo.Concurrency = *opts.Concurrency
+	}
+}
+
+func newWebhook(wh *conveyor.Webhook) schema.Webhook {
+	webhook := schema.Webhook{
+		ID:         int(wh.ID),
+		Repository: wh.Repository,
+		URL:        wh.URL,
+		Events:     wh.Events,
+		Created:    wh.Created,
+	}
+	if wh.Ping != nil {
+		webhook.Ping.ID = wh.Ping.ID
+	}
+	return webhook
+}
+
+// WebhookSetup creates or updates the webhook for a repository, and registers
+// the repository once the webhook is verified.
+func (s *Server) WebhookSetup(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	var req schema.WebhookSetupOpts
+	if err := decode(r.Body, &req); err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	wh, err := s.client.Setup(ctx, conveyor.SetupRequest{
+		Repository:   req.Repository,
+		PullRequests: req.PullRequests != nil && *req.PullRequests,
+	})
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	if wh.Created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	encode(w, newWebhook(wh))
+}
+
+func newWebhookDelivery(d *conveyor.Delivery) schema.WebhookDelivery {
+	delivery := schema.WebhookDelivery{
+		ID:         d.ID,
+		DeliveryID: d.DeliveryID,
+		Event:      d.Event,
+		Repository: d.Repository,
+		Headers:    map[string]string(d.Headers),
+		Payload:    d.Payload,
+		Status:     d.Status,
+		Response:   d.Response,
+		CreatedAt:  d.CreatedAt,
+	}
+	if delivery.Headers == nil {
+		delivery.Headers = map[string]string{}
+	}
+	if d.BuildID != nil {
+		delivery.Build = &struct {
+			ID string `json:"id" url:"id,key"`
+		}{ID: *d.BuildID}
+	}
+	if d.ReplayOf != nil {
+		delivery.ReplayOf = &struct {
+			ID string `json:"id" url:"id,key"`
+		}{ID: *d.ReplayOf}
+	}
+	return delivery
+}
+
+// WebhookDeliveryList returns the most recent webhook deliveries.
+func (s *Server) WebhookDeliveryList(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	deliveries, err := s.client.Deliveries(ctx)
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	resp := make([]schema.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp = append(resp, newWebhookDelivery(d))
+	}
+
+	encode(w, resp)
+}
+
+// WebhookDeliveryInfo returns a webhook delivery.
+func (s *Server) WebhookDeliveryInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	d, err := s.client.FindDelivery(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	encode(w, newWebhookDelivery(d))
+}
+
+// WebhookDeliveryReplay handles a webhook delivery again, and returns the
+// record of the replay.
+func (s *Server) WebhookDeliveryReplay(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	original, err := s.client.FindDelivery(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	d, err := s.Webhooks.Replay(ctx, original)
+	if err != nil {
+		encodeErr(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	encode(w, newWebhookDelivery(d))
+}
+
 func newArtifact(a *conveyor.Artifact) schema.Artifact {
 	artifact := schema.Artifact{
-		ID:    a.ID,
-		Image: a.Image,
+		ID:     a.ID,
+		Name:   a.Name,
+		Image:  a.Image,
+		Digest: a.Digest,
+		Tags:   []string(a.Tags),
+	}
+	if artifact.Tags == nil {
+		artifact.Tags = []string{}
 	}
 	artifact.Build.ID = a.BuildID
 	return artifact
@@ -181,7 +636,19 @@ func identity(vars map[string]string) string {
 		return id
 	}
 
-	return fmt.Sprintf("%s/%s@%s", vars["owner"], vars["repo"], vars["sha"])
+	ident := fmt.Sprintf("%s/%s@%s", vars["owner"], vars["repo"], vars["sha"])
+	if name := vars["name"]; name != "" {
+		ident = fmt.Sprintf("%s/%s", ident, name)
+	}
+	return ident
+}
+
+func repositoryIdentity(vars map[string]string) string {
+	if id := vars["id"]; id != "" {
+		return id
+	}
+
+	return fmt.Sprintf("%s/%s", vars["owner"], vars["repo"])
 }
 
 func encode(w io.Writer, v interface{}) error {
@@ -195,9 +662,13 @@ func decode(r io.Reader, v interface{}) error {
 func encodeErr(w http.ResponseWriter, e error) error {
 	err := newError(e)
 
-	switch err {
-	case schema.ErrNotFound:
+	switch {
+	case err == schema.ErrNotFound:
 		w.WriteHeader(http.StatusNotFound)
+	case err.ID == "bad_request":
+		w.WriteHeader(http.StatusBadRequest)
+	case err.ID == "forbidden":
+		w.WriteHeader(http.StatusForbidden)
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -210,6 +681,41 @@ func newError(err error) *schema.Error {
 		return schema.ErrNotFound
 	}
 
+	if _, ok := err.(*conveyor.DirectiveError); ok {
+		return &schema.Error{
+			ID:      "bad_request",
+			Message: err.Error(),
+		}
+	}
+
+	if _, ok := err.(*conveyor.TagError); ok {
+		return &schema.Error{
+			ID:      "bad_request",
+			Message: err.Error(),
+		}
+	}
+
+	if _, ok := err.(*conveyor.SetupError); ok {
+		return &schema.Error{
+			ID:      "bad_request",
+			Message: err.Error(),
+		}
+	}
+
+	if _, ok := err.(*conveyor.RepositoryError); ok || err == conveyor.ErrDuplicateRepository {
+		return &schema.Error{
+			ID:      "bad_request",
+			Message: err.Error(),
+		}
+	}
+
+	if _, ok := err.(*conveyor.AccessDeniedError); ok {
+		return &schema.Error{
+			ID:      "forbidden",
+			Message: err.Error(),
+		}
+	}
+
 	return &schema.Error{
 		ID:      "internal_error",
 		Message: err.Error(),
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -36,6 +37,67 @@ func TestServer_Logs(t *testing.T) {
 	c.AssertExpectations(t)
 }
 
+func TestServer_Logs_JSON(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/logs/1234?format=json", nil)
+
+	c.On("StructuredLogs", "1234").Return(strings.NewReader(`{"stream":"stdout","text":"Logs"}`), nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+	assert.Equal(t, `{"stream":"stdout","text":"Logs"}`, resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Logs_UnknownFormat(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/logs/1234?format=xml", nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestServer_Logs_Signed(t *testing.T) {
+	c := new(mockConveyor)
+	denyAuth := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+	}
+	s := newServer(c, denyAuth)
+	s.LogsSecret = []byte("secret")
+
+	c.On("Logs", "1234").Return(strings.NewReader("Logs"), nil)
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{SignLogsURL(s.LogsSecret, "/logs/1234", "1234", time.Now().Add(time.Hour)), http.StatusOK},
+		{SignLogsURL(s.LogsSecret, "/logs/1234?format=text", "1234", time.Now().Add(time.Hour)), http.StatusOK},
+		{SignLogsURL(s.LogsSecret, "/logs/1234", "1234", time.Now().Add(-time.Hour)), http.StatusForbidden},
+		{SignLogsURL([]byte("other"), "/logs/1234", "1234", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{SignLogsURL(s.LogsSecret, "/logs/1234", "5678", time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"/logs/1234", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.url, nil)
+
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, tt.code, resp.Code, tt.url)
+	}
+}
+
 func TestServer_BuildCreate(t *testing.T) {
 	c := new(mockConveyor)
 	s := newServer(c, nullAuth)
@@ -60,7 +122,132 @@ func TestServer_BuildCreate(t *testing.T) {
 
 	s.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
-	assert.Equal(t, "{\"branch\":\"master\",\"completed_at\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\",\"started_at\":null,\"state\":\"pending\"}\n", resp.Body.String())
+	assert.Equal(t, "{\"branch\":\"master\",\"completed_at\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"directives\":[],\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"logs_truncated\":false,\"pull_request\":null,\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\",\"started_at\":null,\"state\":\"pending\",\"tag\":\"\"}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_BuildCreate_Ref(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/builds", strings.NewReader(`{
+  "repository": "remind101/acme-inc",
+  "ref": "v1.4.2"
+}`))
+
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Ref:        "v1.4.2",
+	}).Return(&conveyor.Build{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Tag:        "v1.4.2",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"tag":"v1.4.2"`)
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_BuildCreate_InvalidTag(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/builds", strings.NewReader(`{
+  "repository": "remind101/acme-inc",
+  "ref": "release/1.0"
+}`))
+
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Ref:        "release/1.0",
+	}).Return((*conveyor.Build)(nil), &conveyor.TagError{Tag: "release/1.0"})
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, `{"id":"bad_request","message":"tag release/1.0 can't be built: it isn't a valid docker tag"}`+"\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_BuildCreate_Directives(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/builds", strings.NewReader(`{
+  "repository": "remind101/acme-inc",
+  "branch": "master",
+  "message": "Rebuild [docker nocache] [docker target=release]"
+}`))
+
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		NoCache:    true,
+		Directives: conveyor.Directives{
+			NoCache: true,
+			Target:  "release",
+			List:    conveyor.DirectiveList{"docker nocache", "docker target=release"},
+		},
+	}).Return(&conveyor.Build{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		Directives: conveyor.DirectiveList{"docker nocache", "docker target=release"},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"directives":["docker nocache","docker target=release"]`)
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_BuildCreate_InvalidDirective(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/builds", strings.NewReader(`{
+  "repository": "remind101/acme-inc",
+  "branch": "master",
+  "message": "[conveyor priority=urgent]"
+}`))
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, `{"id":"bad_request","message":"invalid directive [conveyor priority=urgent]: unknown priority: urgent"}`+"\n", resp.Body.String())
+}
+
+func TestServer_BuildCreate_AccessDenied(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/builds", strings.NewReader(`{
+  "repository": "ejholmes/acme-inc",
+  "branch": "master"
+}`))
+
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "ejholmes/acme-inc",
+		Branch:     "master",
+	}).Return((*conveyor.Build)(nil), &conveyor.AccessDeniedError{
+		Repository: "ejholmes/acme-inc",
+		Reason:     "repository is not in the allowed organizations or repositories",
+	})
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, `{"id":"forbidden","message":"access denied to ejholmes/acme-inc: repository is not in the allowed organizations or repositories"}`+"\n", resp.Body.String())
 
 	c.AssertExpectations(t)
 }
@@ -81,7 +268,7 @@ func TestServer_BuildInfo(t *testing.T) {
 
 	s.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
-	assert.Equal(t, "{\"branch\":\"master\",\"completed_at\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\",\"started_at\":null,\"state\":\"pending\"}\n", resp.Body.String())
+	assert.Equal(t, "{\"branch\":\"master\",\"completed_at\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"directives\":[],\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"logs_truncated\":false,\"pull_request\":null,\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\",\"started_at\":null,\"state\":\"pending\",\"tag\":\"\"}\n", resp.Body.String())
 
 	c.AssertExpectations(t)
 }
@@ -95,17 +282,335 @@ func TestServer_ArtifactInfo(t *testing.T) {
 
 	c.On("FindArtifact", fakeUUID).Return(&conveyor.Artifact{
 		ID:      fakeUUID,
-		Image:   "remind101/acme-inc:139759bd61e98faeec619c45b1060b4288952164",
+		Image:   "remind101/acme-inc@sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d",
+		Digest:  "sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d",
+		Tags:    conveyor.Tags{"139759bd61e98faeec619c45b1060b4288952164", "master"},
 		BuildID: fakeUUID,
 	}, nil)
 
 	s.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
-	assert.Equal(t, "{\"build\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"image\":\"remind101/acme-inc:139759bd61e98faeec619c45b1060b4288952164\"}\n", resp.Body.String())
+	assert.Equal(t, "{\"build\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"digest\":\"sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d\",\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"image\":\"remind101/acme-inc@sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d\",\"name\":\"\",\"tags\":[\"139759bd61e98faeec619c45b1060b4288952164\",\"master\"]}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_ArtifactInfo_Name(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/artifacts/remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164/migrations", nil)
+
+	c.On("FindArtifact", "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164/migrations").Return(&conveyor.Artifact{
+		ID:      fakeUUID,
+		Name:    "migrations",
+		Image:   "remind101/acme-inc-migrations:139759bd61e98faeec619c45b1060b4288952164",
+		BuildID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"build\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"digest\":\"\",\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"image\":\"remind101/acme-inc-migrations:139759bd61e98faeec619c45b1060b4288952164\",\"name\":\"migrations\",\"tags\":[]}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_StepList(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/builds/remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164/steps", nil)
+
+	c.On("FindSteps", "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164").Return([]*conveyor.Step{
+		{
+			ID:          fakeUUID,
+			BuildID:     fakeUUID,
+			Number:      2,
+			Total:       5,
+			Instruction: "RUN apt-get update",
+			Cached:      true,
+			Duration:    1500 * time.Millisecond,
+		},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"build\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"cached\":true,\"duration\":1.5,\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"instruction\":\"RUN apt-get update\",\"number\":2,\"started_at\":\"0001-01-01T00:00:00Z\",\"total\":5}]\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_StatusUpdateList(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/status_updates", nil)
+
+	buildID := fakeUUID
+	c.On("PendingStatusUpdates").Return([]*conveyor.StatusUpdate{
+		{
+			ID:         fakeUUID,
+			BuildID:    &buildID,
+			Repository: "remind101/acme-inc",
+			Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+			Kind:       conveyor.StatusUpdateCheckRun,
+			Attempts:   2,
+			LastError:  "502 Bad Gateway",
+		},
+		{
+			ID:         fakeUUID,
+			Repository: "remind101/acme-inc",
+			Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+			Kind:       conveyor.StatusUpdateStatus,
+		},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"attempts\":2,\"build\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"created_at\":\"0001-01-01T00:00:00Z\",\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"kind\":\"check_run\",\"last_error\":\"502 Bad Gateway\",\"next_attempt_at\":\"0001-01-01T00:00:00Z\",\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\"},{\"attempts\":0,\"build\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"kind\":\"status\",\"last_error\":\"\",\"next_attempt_at\":\"0001-01-01T00:00:00Z\",\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\"}]\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_PullRequestBuildList(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/builds/remind101/acme-inc/pulls/42", nil)
+
+	number := 42
+	c.On("FindPullRequestBuilds", "remind101/acme-inc", 42).Return([]*conveyor.Build{
+		{
+			ID:          fakeUUID,
+			Repository:  "remind101/acme-inc",
+			Branch:      "feature",
+			Sha:         "139759bd61e98faeec619c45b1060b4288952164",
+			PullRequest: &number,
+			State:       conveyor.StateCanceled,
+		},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"branch\":\"feature\",\"completed_at\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"directives\":[],\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"logs_truncated\":false,\"pull_request\":42,\"repository\":\"remind101/acme-inc\",\"sha\":\"139759bd61e98faeec619c45b1060b4288952164\",\"started_at\":null,\"state\":\"canceled\",\"tag\":\"\"}]\n", resp.Body.String())
 
 	c.AssertExpectations(t)
 }
 
+func TestServer_RepositoryCreate(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/repositories", strings.NewReader(`{
+  "name": "remind101/acme-inc",
+  "timeout": 1800,
+  "concurrency": 2
+}`))
+
+	c.On("CreateRepository", &conveyor.Repository{
+		Name:          "remind101/acme-inc",
+		Enabled:       true,
+		DefaultBranch: "master",
+		Timeout:       30 * time.Minute,
+		Concurrency:   2,
+	}).Return(nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "{\"builder_image\":\"\",\"concurrency\":2,\"created_at\":\"0001-01-01T00:00:00Z\",\"default_branch\":\"master\",\"enabled\":true,\"id\":\"\",\"image\":\"\",\"name\":\"remind101/acme-inc\",\"paused\":false,\"timeout\":1800,\"updated_at\":\"0001-01-01T00:00:00Z\"}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_RepositoryCreate_Invalid(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/repositories", strings.NewReader(`{
+  "name": "remind101/acme-inc",
+  "concurrency": -1
+}`))
+
+	c.On("CreateRepository", &conveyor.Repository{
+		Name:          "remind101/acme-inc",
+		Enabled:       true,
+		DefaultBranch: "master",
+		Concurrency:   -1,
+	}).Return(&conveyor.RepositoryError{Field: "concurrency", Reason: "can't be negative"})
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, `{"id":"bad_request","message":"invalid repository: concurrency can't be negative"}`+"\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_RepositoryUpdate(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/repositories/remind101/acme-inc", strings.NewReader(`{
+  "paused": true
+}`))
+
+	repo := &conveyor.Repository{
+		ID:            fakeUUID,
+		Name:          "remind101/acme-inc",
+		Enabled:       true,
+		DefaultBranch: "master",
+	}
+	c.On("FindRepository", "remind101/acme-inc").Return(repo, nil)
+	c.On("UpdateRepository", &conveyor.Repository{
+		ID:            fakeUUID,
+		Name:          "remind101/acme-inc",
+		Enabled:       true,
+		Paused:        true,
+		DefaultBranch: "master",
+	}).Return(nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"builder_image\":\"\",\"concurrency\":0,\"created_at\":\"0001-01-01T00:00:00Z\",\"default_branch\":\"master\",\"enabled\":true,\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"image\":\"\",\"name\":\"remind101/acme-inc\",\"paused\":true,\"timeout\":0,\"updated_at\":\"0001-01-01T00:00:00Z\"}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_RepositoryDelete(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/repositories/"+fakeUUID, nil)
+
+	repo := &conveyor.Repository{
+		ID:   fakeUUID,
+		Name: "remind101/acme-inc",
+	}
+	c.On("FindRepository", fakeUUID).Return(repo, nil)
+	c.On("DeleteRepository", repo).Return(nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_WebhookSetup(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(`{"repository":"remind101/acme-inc","pull_requests":true}`))
+
+	c.On("Setup", conveyor.SetupRequest{
+		Repository:   "remind101/acme-inc",
+		PullRequests: true,
+	}).Return(&conveyor.Webhook{
+		ID:         12345678,
+		Repository: "remind101/acme-inc",
+		URL:        "https://conveyor.example.com",
+		Events:     []string{"push", "pull_request"},
+		Created:    true,
+		Ping:       &conveyor.Delivery{ID: fakeUUID},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "{\"created\":true,\"events\":[\"push\",\"pull_request\"],\"id\":12345678,\"ping\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"repository\":\"remind101/acme-inc\",\"url\":\"https://conveyor.example.com\"}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_WebhookSetup_Failed(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(`{"repository":"remind101/acme-inc"}`))
+
+	c.On("Setup", conveyor.SetupRequest{
+		Repository: "remind101/acme-inc",
+	}).Return((*conveyor.Webhook)(nil), &conveyor.SetupError{
+		Repository: "remind101/acme-inc",
+		Reason:     "the webhook URL isn't configured",
+	})
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "{\"id\":\"bad_request\",\"message\":\"setup of remind101/acme-inc failed: the webhook URL isn't configured\"}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_WebhookDeliveryList(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c, nullAuth)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/webhooks/deliveries", nil)
+
+	buildID := fakeUUID
+	c.On("Deliveries").Return([]*conveyor.Delivery{
+		{
+			ID:         fakeUUID,
+			DeliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			Event:      "push",
+			Repository: "remind101/acme-inc",
+			Headers:    conveyor.DeliveryHeaders{"X-Github-Event": "push"},
+			Payload:    `{}`,
+			Status:     200,
+			Response:   fakeUUID,
+			BuildID:    &buildID,
+		},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"build\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"created_at\":\"0001-01-01T00:00:00Z\",\"delivery_id\":\"72d3162e-cc78-11e3-81ab-4c9367dc0958\",\"event\":\"push\",\"headers\":{\"X-Github-Event\":\"push\"},\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"payload\":\"{}\",\"replay_of\":null,\"repository\":\"remind101/acme-inc\",\"response\":\"01234567-89ab-cdef-0123-456789abcdef\",\"status\":200}]\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_WebhookDeliveryReplay(t *testing.T) {
+	c := new(mockConveyor)
+	r := new(mockReplayer)
+	s := newServer(c, nullAuth)
+	s.Webhooks = r
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/webhooks/deliveries/"+fakeUUID+"/replay", nil)
+
+	original := &conveyor.Delivery{
+		ID:      fakeUUID,
+		Event:   "ping",
+		Payload: `{}`,
+	}
+	replayOf := fakeUUID
+	c.On("FindDelivery", fakeUUID).Return(original, nil)
+	r.On("Replay", original).Return(&conveyor.Delivery{
+		ID:       fakeUUID,
+		Event:    "ping",
+		Payload:  `{}`,
+		Status:   200,
+		Response: "Ok",
+		ReplayOf: &replayOf,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "{\"build\":null,\"created_at\":\"0001-01-01T00:00:00Z\",\"delivery_id\":\"\",\"event\":\"ping\",\"headers\":{},\"id\":\"01234567-89ab-cdef-0123-456789abcdef\",\"payload\":\"{}\",\"replay_of\":{\"id\":\"01234567-89ab-cdef-0123-456789abcdef\"},\"repository\":\"\",\"response\":\"Ok\",\"status\":200}\n", resp.Body.String())
+
+	c.AssertExpectations(t)
+	r.AssertExpectations(t)
+}
+
 // mockConveyor is an implementation of the client interface.
 type mockConveyor struct {
 	mock.Mock
@@ -116,6 +621,11 @@ func (m *mockConveyor) Logs(ctx context.Context, buildID string) (io.Reader, err
 	return args.Get(0).(io.Reader), args.Error(1)
 }
 
+func (m *mockConveyor) StructuredLogs(ctx context.Context, buildID string) (io.Reader, error) {
+	args := m.Called(buildID)
+	return args.Get(0).(io.Reader), args.Error(1)
+}
+
 func (m *mockConveyor) Build(ctx context.Context, req conveyor.BuildRequest) (*conveyor.Build, error) {
 	args := m.Called(req)
 	return args.Get(0).(*conveyor.Build), args.Error(1)
@@ -130,3 +640,68 @@ func (m *mockConveyor) FindArtifact(ctx context.Context, artifactIdentity string
 	args := m.Called(artifactIdentity)
 	return args.Get(0).(*conveyor.Artifact), args.Error(1)
 }
+
+func (m *mockConveyor) FindSteps(ctx context.Context, buildIdentity string) ([]*conveyor.Step, error) {
+	args := m.Called(buildIdentity)
+	return args.Get(0).([]*conveyor.Step), args.Error(1)
+}
+
+func (m *mockConveyor) FindPullRequestBuilds(ctx context.Context, repository string, number int) ([]*conveyor.Build, error) {
+	args := m.Called(repository, number)
+	return args.Get(0).([]*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) PendingStatusUpdates(ctx context.Context) ([]*conveyor.StatusUpdate, error) {
+	args := m.Called()
+	return args.Get(0).([]*conveyor.StatusUpdate), args.Error(1)
+}
+
+func (m *mockConveyor) Deliveries(ctx context.Context) ([]*conveyor.Delivery, error) {
+	args := m.Called()
+	return args.Get(0).([]*conveyor.Delivery), args.Error(1)
+}
+
+func (m *mockConveyor) FindDelivery(ctx context.Context, id string) (*conveyor.Delivery, error) {
+	args := m.Called(id)
+	return args.Get(0).(*conveyor.Delivery), args.Error(1)
+}
+
+func (m *mockConveyor) CreateRepository(ctx context.Context, r *conveyor.Repository) error {
+	args := m.Called(r)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) Repositories(ctx context.Context) ([]*conveyor.Repository, error) {
+	args := m.Called()
+	return args.Get(0).([]*conveyor.Repository), args.Error(1)
+}
+
+func (m *mockConveyor) FindRepository(ctx context.Context, repositoryIdentity string) (*conveyor.Repository, error) {
+	args := m.Called(repositoryIdentity)
+	return args.Get(0).(*conveyor.Repository), args.Error(1)
+}
+
+func (m *mockConveyor) UpdateRepository(ctx context.Context, r *conveyor.Repository) error {
+	args := m.Called(r)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) DeleteRepository(ctx context.Context, r *conveyor.Repository) error {
+	args := m.Called(r)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) Setup(ctx context.Context, req conveyor.SetupRequest) (*conveyor.Webhook, error) {
+	args := m.Called(req)
+	return args.Get(0).(*conveyor.Webhook), args.Error(1)
+}
+
+// mockReplayer is an implementation of the replayer interface.
+type mockReplayer struct {
+	mock.Mock
+}
+
+func (m *mockReplayer) Replay(ctx context.Context, d *conveyor.Delivery) (*conveyor.Delivery, error) {
+	args := m.Called(d)
+	return args.Get(0).(*conveyor.Delivery), args.Error(1)
+}
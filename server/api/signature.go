@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SignLogsURL returns a link to the logs of a build, which can be streamed
+// without the API credentials until it expires. logsURL is the unsigned link,
+// e.g. `https://conveyor.example.com/logs/<build_id>`.
+func SignLogsURL(secret []byte, logsURL, buildID string, expires time.Time) string {
+	sep := "?"
+	if strings.Contains(logsURL, "?") {
+		sep = "&"
+	}
+	e := strconv.FormatInt(expires.Unix(), 10)
+	return fmt.Sprintf("%s%sexpires=%s&signature=%s", logsURL, sep, e, logsSignature(secret, buildID, e))
+}
+
+// logsSignature returns the signature for a link to the logs of a build.
+func logsSignature(secret []byte, buildID, expires string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s:%s", buildID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// logsAuth wraps the logs stream. When the Server has a LogsSecret, requests
+// must either be signed with it, or pass auth.
+func (s *Server) logsAuth(auth func(http.Handler) http.Handler, h http.Handler) http.Handler {
+	authed := auth(h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.LogsSecret == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		q := r.URL.Query()
+		if q.Get("signature") == "" {
+			authed.ServeHTTP(w, r)
+			return
+		}
+
+		if !s.validLogsSignature(mux.Vars(r)["id"], q.Get("expires"), q.Get("signature")) {
+			http.Error(w, "The link to these logs is invalid or has expired.", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// validLogsSignature returns true if the signature of a link to the logs of a
+// build is valid and hasn't expired.
+func (s *Server) validLogsSignature(buildID, expires, signature string) bool {
+	e, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > e {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(logsSignature(s.LogsSecret, buildID, expires)))
+}
@@ -0,0 +1,179 @@
+package github
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Headers that GitHub sends with webhook deliveries.
+const (
+	HeaderDelivery        = "X-GitHub-Delivery"
+	HeaderSignature       = "X-Hub-Signature"
+	HeaderSignatureSHA256 = "X-Hub-Signature-256"
+)
+
+// DefaultReplayWindow is the default length of time that handled deliveries
+// are looked back on, to reject replayed deliveries.
+const DefaultReplayWindow = time.Hour
+
+// Reasons that a webhook delivery is rejected, which are used to tag the
+// conveyor.github.webhook.rejected metric.
+const (
+	rejectMissingSignature = "missing_signature"
+	rejectInvalidSignature = "invalid_signature"
+	rejectReplayed         = "replayed"
+)
+
+// now is a variable so it can be stubbed in tests.
+var now = time.Now
+
+// statsdClient represents a client that can send counts to datadog.
+type statsdClient interface {
+	Count(name string, value int64, tags []string, rate float64) error
+}
+
+// handledClient is the interface from conveyor.Conveyor that the Authorizer
+// uses to find deliveries that were already handled.
+type handledClient interface {
+	DeliveryHandled(ctx context.Context, deliveryID string, since time.Time) (bool, error)
+}
+
+// Authorizer is an http.Handler that verifies that webhook deliveries were
+// signed by GitHub, and haven't been handled before, before passing them on
+// to Handler.
+//
+// The X-Hub-Signature-256 header is verified if it's present, otherwise the
+// SHA-1 X-Hub-Signature header is. A delivery is accepted if it was signed
+// with any of Secrets, so that the secret can be rotated by adding the new
+// secret, updating the webhooks, then removing the old secret.
+//
+// Handled deliveries are the ones that Handler recorded (see Recorder) with a
+// successful response, so a delivery that failed can be redelivered from
+// GitHub.
+type Authorizer struct {
+	// The handler for authorized deliveries.
+	Handler http.Handler
+
+	// The secrets that deliveries can be signed with. Empty secrets are
+	// ignored. When there aren't any, signatures aren't verified.
+	Secrets []string
+
+	// If set, deliveries that were already handled are rejected.
+	Deliveries handledClient
+
+	// How far back handled deliveries are looked for. Defaults to
+	// DefaultReplayWindow.
+	ReplayWindow time.Duration
+
+	// If set, rejected deliveries are counted with the
+	// conveyor.github.webhook.rejected metric.
+	Stats statsdClient
+}
+
+// Authorize returns a new Authorizer that verifies deliveries to h with the
+// given secrets.
+func Authorize(h http.Handler, secrets []string) *Authorizer {
+	return &Authorizer{Handler: h, Secrets: secrets}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a *Authorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	delivery := r.Header.Get(HeaderDelivery)
+
+	if reason := a.verify(r); reason != "" {
+		a.reject(w, delivery, reason, "The provided signature does not match.")
+		return
+	}
+
+	if delivery != "" && a.Deliveries != nil {
+		handled, err := a.handled(delivery)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if handled {
+			a.reject(w, delivery, rejectReplayed, "This delivery has already been processed.")
+			return
+		}
+	}
+
+	a.Handler.ServeHTTP(w, r)
+}
+
+// verify checks the signature of a delivery. It returns the reason that it was
+// rejected, or an empty string if it's authorized.
+func (a *Authorizer) verify(r *http.Request) string {
+	// An empty secret, e.g. from a trailing comma, would let anyone sign
+	// deliveries.
+	var secrets []string
+	for _, secret := range a.Secrets {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) == 0 {
+		return ""
+	}
+
+	var (
+		signature string
+		newHash   func() hash.Hash
+	)
+	if s := r.Header.Get(HeaderSignatureSHA256); s != "" {
+		signature, newHash = strings.TrimPrefix(s, "sha256="), sha256.New
+	} else if s := r.Header.Get(HeaderSignature); s != "" {
+		signature, newHash = strings.TrimPrefix(s, "sha1="), sha1.New
+	} else {
+		return rejectMissingSignature
+	}
+
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return rejectInvalidSignature
+	}
+	// Let the handler read the body too.
+	r.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	for _, secret := range secrets {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write(raw)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if subtle.ConstantTimeCompare([]byte(signature), []byte(expected)) == 1 {
+			return ""
+		}
+	}
+
+	return rejectInvalidSignature
+}
+
+// handled returns true if the delivery was already handled within the replay
+// window.
+func (a *Authorizer) handled(delivery string) (bool, error) {
+	window := a.ReplayWindow
+	if window == 0 {
+		window = DefaultReplayWindow
+	}
+	return a.Deliveries.DeliveryHandled(context.TODO(), delivery, now().Add(-window))
+}
+
+// reject logs and counts a rejected delivery, and responds with a 403.
+func (a *Authorizer) reject(w http.ResponseWriter, delivery, reason, message string) {
+	log.Printf("github: rejected delivery %q: %s", delivery, reason)
+	if a.Stats != nil {
+		_ = a.Stats.Count("conveyor.github.webhook.rejected", 1, []string{fmt.Sprintf("reason:%s", reason)}, 1)
+	}
+	http.Error(w, message, http.StatusForbidden)
+}
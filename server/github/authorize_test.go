@@ -0,0 +1,140 @@
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testBody = `{"zen": "Keep it logically awesome."}`
+
+func TestAuthorizer(t *testing.T) {
+	tests := []struct {
+		header    string
+		signature string
+		status    int
+		reason    string
+	}{
+		{HeaderSignatureSHA256, "sha256=" + sign(sha256.New, "new", testBody), http.StatusOK, ""},
+		{HeaderSignatureSHA256, "sha256=" + sign(sha256.New, "old", testBody), http.StatusOK, ""},
+		{HeaderSignature, "sha1=" + sign(sha1.New, "old", testBody), http.StatusOK, ""},
+		{HeaderSignatureSHA256, "sha256=" + sign(sha256.New, "other", testBody), http.StatusForbidden, rejectInvalidSignature},
+		{HeaderSignatureSHA256, "sha256=" + sign(sha256.New, "new", "{}"), http.StatusForbidden, rejectInvalidSignature},
+		{"", "", http.StatusForbidden, rejectMissingSignature},
+	}
+
+	for _, tt := range tests {
+		s := new(mockStatsdClient)
+		if tt.reason != "" {
+			s.On("Count", "conveyor.github.webhook.rejected", int64(1), []string{"reason:" + tt.reason}, float64(1)).Return(nil)
+		}
+
+		a := Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The handler can still read the body.
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, testBody, string(body))
+		}), []string{"new", "", "old"})
+		a.Stats = s
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(testBody))
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.signature)
+		}
+
+		a.ServeHTTP(resp, req)
+		assert.Equal(t, tt.status, resp.Code, tt.signature)
+		s.AssertExpectations(t)
+	}
+}
+
+func TestAuthorizer_EmptySecret(t *testing.T) {
+	s := new(mockStatsdClient)
+	s.On("Count", "conveyor.github.webhook.rejected", int64(1), []string{"reason:" + rejectInvalidSignature}, float64(1)).Return(nil)
+
+	a := Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), []string{"new", ""})
+	a.Stats = s
+
+	// Signed with an empty key.
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testBody))
+	req.Header.Set(HeaderSignatureSHA256, "sha256="+sign(sha256.New, "", testBody))
+
+	a.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	s.AssertExpectations(t)
+}
+
+func TestAuthorizer_Replay(t *testing.T) {
+	t0 := time.Now()
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	s := new(mockStatsdClient)
+	d := new(mockHandledClient)
+	var calls int
+	a := Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }), nil)
+	a.Stats = s
+	a.Deliveries = d
+
+	deliver := func(id string) int {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(testBody))
+		req.Header.Set(HeaderDelivery, id)
+		a.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	since := t0.Add(-DefaultReplayWindow)
+	d.On("DeliveryHandled", "72d3162e-cc78-11e3-81ab-4c9367dc0958", since).Return(true, nil)
+	d.On("DeliveryHandled", "a1a2ea9c-cc78-11e3-81ab-4c9367dc0958", since).Return(false, nil)
+	s.On("Count", "conveyor.github.webhook.rejected", int64(1), []string{"reason:" + rejectReplayed}, float64(1)).Return(nil)
+
+	assert.Equal(t, http.StatusForbidden, deliver("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+	// A delivery that wasn't handled, e.g. because it failed, can be
+	// redelivered.
+	assert.Equal(t, http.StatusOK, deliver("a1a2ea9c-cc78-11e3-81ab-4c9367dc0958"))
+	assert.Equal(t, 1, calls)
+
+	d.AssertExpectations(t)
+	s.AssertExpectations(t)
+}
+
+func sign(h func() hash.Hash, secret, body string) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mockHandledClient is a mock implementation of the handledClient interface.
+type mockHandledClient struct {
+	mock.Mock
+}
+
+func (c *mockHandledClient) DeliveryHandled(ctx context.Context, deliveryID string, since time.Time) (bool, error) {
+	args := c.Called(deliveryID, since)
+	return args.Bool(0), args.Error(1)
+}
+
+// mockStatsdClient is a mock implementation of the statsdClient interface.
+type mockStatsdClient struct {
+	mock.Mock
+}
+
+func (c *mockStatsdClient) Count(name string, value int64, tags []string, rate float64) error {
+	args := c.Called(name, value, tags, rate)
+	return args.Error(0)
+}
@@ -0,0 +1,293 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/google/go-github/github"
+	"github.com/remind101/conveyor"
+)
+
+// commandPrefix is the prefix for commands given in comments, e.g.
+// `/conveyor rebuild nocache`.
+const commandPrefix = "/conveyor"
+
+// commandUsage describes the available commands.
+const commandUsage = "Usage: `/conveyor rebuild [nocache]` or `/conveyor cancel`."
+
+// command is a command given in a comment on a pull request or commit.
+type command struct {
+	// The name of the command, "rebuild" or "cancel".
+	Name string
+
+	// True if the layer cache should be disabled when rebuilding.
+	NoCache bool
+}
+
+// parseCommand parses the first command in a comment. If the comment doesn't
+// contain a command, nil is returned.
+func parseCommand(body string) (*command, error) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != commandPrefix {
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("missing command")
+		}
+
+		cmd := &command{Name: fields[1]}
+		args := fields[2:]
+		switch cmd.Name {
+		case "rebuild":
+			for _, arg := range args {
+				if arg != "nocache" {
+					return nil, fmt.Errorf("unknown option for rebuild: %s", arg)
+				}
+				cmd.NoCache = true
+			}
+		case "cancel":
+			if len(args) > 0 {
+				return nil, fmt.Errorf("cancel doesn't take any options")
+			}
+		default:
+			return nil, fmt.Errorf("unknown command: %s", cmd.Name)
+		}
+
+		return cmd, nil
+	}
+
+	return nil, nil
+}
+
+// commandTarget is the pull request or commit that a command was given on.
+type commandTarget struct {
+	Repository string
+	Private    bool
+
+	// The GitHub App installation that the comment was delivered for.
+	Installation int64
+
+	// Set when the command was given on a pull request.
+	PullRequest int
+
+	// Set when the command was given on a commit.
+	Sha string
+}
+
+// String implements the fmt.Stringer interface.
+func (t commandTarget) String() string {
+	if t.PullRequest != 0 {
+		return fmt.Sprintf("%s#%d", t.Repository, t.PullRequest)
+	}
+	return fmt.Sprintf("%s@%s", t.Repository, t.Sha)
+}
+
+// IssueComment is an http.HandlerFunc that will handle the `issue_comment`
+// event from GitHub. Commands given in comments on pull requests are run.
+func (s *Server) IssueComment(w http.ResponseWriter, r *http.Request) {
+	var event github.IssueCommentEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if event.GetAction() != "created" {
+		io.WriteString(w, fmt.Sprintf("Ignoring %s action", event.GetAction()))
+		return
+	}
+
+	// Comments on issues, rather than pull requests, are ignored.
+	if event.GetIssue().PullRequestLinks == nil {
+		io.WriteString(w, "Ignoring comment on an issue")
+		return
+	}
+
+	s.runCommand(w, event.GetComment().GetUser(), event.GetComment().GetBody(), commandTarget{
+		Repository:   event.GetRepo().GetFullName(),
+		Private:      event.GetRepo().GetPrivate(),
+		Installation: event.GetInstallation().GetID(),
+		PullRequest:  event.GetIssue().GetNumber(),
+	})
+}
+
+// CommitComment is an http.HandlerFunc that will handle the `commit_comment`
+// event from GitHub. Commands given in comments on commits are run.
+func (s *Server) CommitComment(w http.ResponseWriter, r *http.Request) {
+	var event github.CommitCommentEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if event.GetAction() != "created" {
+		io.WriteString(w, fmt.Sprintf("Ignoring %s action", event.GetAction()))
+		return
+	}
+
+	s.runCommand(w, event.GetComment().GetUser(), event.GetComment().GetBody(), commandTarget{
+		Repository:   event.GetRepo().GetFullName(),
+		Private:      event.GetRepo().GetPrivate(),
+		Installation: event.GetInstallation().GetID(),
+		Sha:          event.GetComment().GetCommitID(),
+	})
+}
+
+// runCommand runs the command in a comment, if it has one, and replies to it
+// with the result.
+func (s *Server) runCommand(w http.ResponseWriter, user *github.User, body string, t commandTarget) {
+	ctx := context.TODO()
+
+	// Don't respond to bots, which includes our own replies.
+	if user.GetType() == "Bot" {
+		io.WriteString(w, "Ignoring comment from a bot")
+		return
+	}
+
+	cmd, parseErr := parseCommand(body)
+	if cmd == nil && parseErr == nil {
+		io.WriteString(w, "No command")
+		return
+	}
+
+	// Permissions are checked before anything is replied, so that users
+	// without write access can't make us comment.
+	ok, err := s.client.CanWrite(ctx, t.Installation, t.Repository, user.GetLogin())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		io.WriteString(w, fmt.Sprintf("Ignoring command from %s, who doesn't have write access", user.GetLogin()))
+		return
+	}
+
+	if parseErr != nil {
+		s.reply(ctx, w, t, fmt.Sprintf("@%s %v. %s", user.GetLogin(), parseErr, commandUsage))
+		return
+	}
+
+	var reply string
+	switch cmd.Name {
+	case "rebuild":
+		reply, err = s.rebuild(ctx, t, cmd)
+	case "cancel":
+		reply, err = s.cancel(ctx, t)
+	}
+	if err != nil {
+		buildError(w, err)
+		return
+	}
+
+	s.reply(ctx, w, t, fmt.Sprintf("@%s %s", user.GetLogin(), reply))
+}
+
+// rebuild builds the head of the pull request, or the commit. Pull requests
+// are built under the same rules as the `pull_request` event: the kind of pull
+// request has to be allowed, and builds of forks don't have a branch.
+func (s *Server) rebuild(ctx context.Context, t commandTarget, cmd *command) (string, error) {
+	req := conveyor.BuildRequest{
+		Repository:     t.Repository,
+		Sha:            t.Sha,
+		PullRequest:    t.PullRequest,
+		NoCache:        cmd.NoCache,
+		Private:        t.Private,
+		InstallationID: t.Installation,
+	}
+
+	if t.PullRequest != 0 {
+		head, branch, sha, err := s.client.PullRequestHead(ctx, t.Installation, t.Repository, t.PullRequest)
+		if err != nil {
+			return "", err
+		}
+
+		kind := PullRequestsForks
+		if strings.EqualFold(head, t.Repository) {
+			kind = PullRequestsSameRepo
+		}
+		if !s.allowPullRequests(kind) {
+			return fmt.Sprintf("Not building: %s pull requests aren't allowed.", kind), nil
+		}
+
+		req.Sha = sha
+		if kind == PullRequestsSameRepo {
+			req.Branch = branch
+		}
+	}
+
+	b, err := s.client.Build(ctx, req)
+	if err == conveyor.ErrDuplicateBuild {
+		return fmt.Sprintf("`%s` is already being built.", shortSha(req.Sha)), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Building `%s`. See the [logs](%s).", shortSha(req.Sha), s.logsURL(b)), nil
+}
+
+// cancel cancels the pending and building builds for the pull request, or the
+// commit.
+func (s *Server) cancel(ctx context.Context, t commandTarget) (string, error) {
+	var (
+		builds []*conveyor.Build
+		err    error
+	)
+	if t.PullRequest != 0 {
+		builds, err = s.client.CancelPullRequest(ctx, t.Repository, t.PullRequest)
+	} else {
+		builds, err = s.client.CancelCommit(ctx, t.Repository, t.Sha)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(builds) == 0 {
+		return "There are no builds to cancel.", nil
+	}
+
+	var links []string
+	for _, b := range builds {
+		links = append(links, fmt.Sprintf("[%s](%s)", shortSha(b.Sha), s.logsURL(b)))
+	}
+	return fmt.Sprintf("Canceled %d builds: %s.", len(builds), strings.Join(links, ", ")), nil
+}
+
+// reply comments on the pull request or commit, and writes the comment as the
+// response.
+func (s *Server) reply(ctx context.Context, w http.ResponseWriter, t commandTarget, body string) {
+	var err error
+	if t.PullRequest != 0 {
+		err = s.client.CommentOnPullRequest(ctx, t.Installation, t.Repository, t.PullRequest, body)
+	} else {
+		err = s.client.CommentOnCommit(ctx, t.Installation, t.Repository, t.Sha, body)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error commenting on %s: %v", t, err), http.StatusInternalServerError)
+		return
+	}
+
+	io.WriteString(w, body)
+}
+
+// logsURL returns the url for the logs of a build.
+func (s *Server) logsURL(b *conveyor.Build) string {
+	if s.LogsURL == nil {
+		return b.ID
+	}
+	return s.LogsURL(b)
+}
+
+// shortSha abbreviates a git sha.
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,260 @@
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/remind101/conveyor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testLogsURL returns a link to the logs of a build.
+func testLogsURL(b *conveyor.Build) string {
+	return "https://conveyor/logs/" + b.ID
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		body string
+		cmd  *command
+		err  string
+	}{
+		{"LGTM", nil, ""},
+		{"/conveyor rebuild", &command{Name: "rebuild"}, ""},
+		{"Flaky test.\n\n/conveyor rebuild nocache\r\n", &command{Name: "rebuild", NoCache: true}, ""},
+		{"/conveyor cancel", &command{Name: "cancel"}, ""},
+		{"/conveyor", nil, "missing command"},
+		{"/conveyor deploy", nil, "unknown command: deploy"},
+		{"/conveyor rebuild fast", nil, "unknown option for rebuild: fast"},
+		{"/conveyor cancel now", nil, "cancel doesn't take any options"},
+	}
+
+	for _, tt := range tests {
+		cmd, err := parseCommand(tt.body)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.cmd, cmd)
+	}
+}
+
+func TestServer_IssueComment_Rebuild(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+	s.PullRequests = []string{PullRequestsSameRepo}
+	s.LogsURL = testLogsURL
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "created",
+  "issue": {
+    "number": 42,
+    "pull_request": {}
+  },
+  "comment": {
+    "body": "/conveyor rebuild nocache",
+    "user": {
+      "login": "ejholmes",
+      "type": "User"
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+
+	c.On("CanWrite", int64(0), "remind101/acme-inc", "ejholmes").Return(true, nil)
+	c.On("PullRequestHead", int64(0), "remind101/acme-inc", 42).Return("remind101/acme-inc", "feature", "139759bd61e98faeec619c45b1060b4288952164", nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository:  "remind101/acme-inc",
+		Branch:      "feature",
+		Sha:         "139759bd61e98faeec619c45b1060b4288952164",
+		PullRequest: 42,
+		NoCache:     true,
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+	c.On("CommentOnPullRequest", int64(0), "remind101/acme-inc", 42, "@ejholmes Building `139759b`. See the [logs](https://conveyor/logs/"+fakeUUID+").").Return(nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	c.AssertExpectations(t)
+}
+
+func TestServer_IssueComment_PermissionDenied(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "created",
+  "issue": {
+    "number": 42,
+    "pull_request": {}
+  },
+  "comment": {
+    "body": "/conveyor cancel",
+    "user": {
+      "login": "stranger"
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+
+	c.On("CanWrite", int64(0), "remind101/acme-inc", "stranger").Return(false, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Ignoring command from stranger, who doesn't have write access", resp.Body.String())
+	c.AssertExpectations(t)
+	c.AssertNotCalled(t, "CancelPullRequest", mock.Anything, mock.Anything)
+	c.AssertNotCalled(t, "CommentOnPullRequest", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestServer_IssueComment_PermissionDeniedInvalid(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "created",
+  "issue": {
+    "number": 42,
+    "pull_request": {}
+  },
+  "comment": {
+    "body": "/conveyor deploy",
+    "user": {
+      "login": "stranger"
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+
+	c.On("CanWrite", int64(0), "remind101/acme-inc", "stranger").Return(false, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	c.AssertExpectations(t)
+	c.AssertNotCalled(t, "CommentOnPullRequest", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestServer_IssueComment_RebuildFork(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		reply   string
+	}{
+		{[]string{PullRequestsSameRepo}, "@ejholmes Not building: forks pull requests aren't allowed."},
+		{[]string{PullRequestsForks}, "@ejholmes Building `139759b`. See the [logs](https://conveyor/logs/" + fakeUUID + ")."},
+	}
+
+	for _, tt := range tests {
+		c := new(mockConveyor)
+		s := newServer(c)
+		s.PullRequests = tt.allowed
+		s.LogsURL = testLogsURL
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "created",
+  "issue": {
+    "number": 42,
+    "pull_request": {}
+  },
+  "comment": {
+    "body": "/conveyor rebuild",
+    "user": {
+      "login": "ejholmes",
+      "type": "User"
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+		req.Header.Set("X-GitHub-Event", "issue_comment")
+
+		c.On("CanWrite", int64(0), "remind101/acme-inc", "ejholmes").Return(true, nil)
+		c.On("PullRequestHead", int64(0), "remind101/acme-inc", 42).Return("stranger/acme-inc", "master", "139759bd61e98faeec619c45b1060b4288952164", nil)
+		c.On("Build", conveyor.BuildRequest{
+			Repository:  "remind101/acme-inc",
+			Sha:         "139759bd61e98faeec619c45b1060b4288952164",
+			PullRequest: 42,
+		}).Return(&conveyor.Build{
+			ID: fakeUUID,
+		}, nil)
+		c.On("CommentOnPullRequest", int64(0), "remind101/acme-inc", 42, tt.reply).Return(nil)
+
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		c.AssertCalled(t, "CommentOnPullRequest", int64(0), "remind101/acme-inc", 42, tt.reply)
+	}
+}
+
+func TestServer_IssueComment_Issue(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "created",
+  "issue": {
+    "number": 42
+  },
+  "comment": {
+    "body": "/conveyor rebuild"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "issue_comment")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Ignoring comment on an issue", resp.Body.String())
+}
+
+func TestServer_CommitComment_Cancel(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+	s.LogsURL = testLogsURL
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "created",
+  "comment": {
+    "commit_id": "139759bd61e98faeec619c45b1060b4288952164",
+    "body": "/conveyor cancel",
+    "user": {
+      "login": "ejholmes"
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "commit_comment")
+
+	c.On("CanWrite", int64(0), "remind101/acme-inc", "ejholmes").Return(true, nil)
+	c.On("CancelCommit", "remind101/acme-inc", "139759bd61e98faeec619c45b1060b4288952164").Return([]*conveyor.Build{
+		{ID: fakeUUID, Sha: "139759bd61e98faeec619c45b1060b4288952164"},
+	}, nil)
+	c.On("CommentOnCommit", int64(0), "remind101/acme-inc", "139759bd61e98faeec619c45b1060b4288952164", "@ejholmes Canceled 1 builds: [139759b](https://conveyor/logs/"+fakeUUID+").").Return(nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	c.AssertExpectations(t)
+}
@@ -0,0 +1,125 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+
+	"golang.org/x/net/context"
+
+	"github.com/ejholmes/hookshot"
+	"github.com/remind101/conveyor"
+)
+
+// HeaderBuild is the response header that contains the ID of the build that a
+// webhook delivery triggered.
+const HeaderBuild = "X-Conveyor-Build"
+
+// deliveriesClient is the interface from conveyor.Conveyor that the Recorder
+// uses.
+type deliveriesClient interface {
+	RecordDelivery(context.Context, *conveyor.Delivery) error
+}
+
+// Recorder is an http.Handler that records each webhook delivery, along with
+// the response from Handler, so that deliveries that didn't trigger a build can
+// be inspected, and replayed.
+type Recorder struct {
+	// The handler for deliveries.
+	Handler http.Handler
+
+	client deliveriesClient
+}
+
+// RecordDeliveries returns a new Recorder that records the deliveries to h.
+func RecordDeliveries(h http.Handler, c *conveyor.Conveyor) *Recorder {
+	return &Recorder{Handler: h, client: c}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d := &conveyor.Delivery{
+		DeliveryID: r.Header.Get(HeaderDelivery),
+		Headers:    make(conveyor.DeliveryHeaders),
+	}
+	for k := range r.Header {
+		d.Headers[k] = r.Header.Get(k)
+	}
+
+	resp, err := rec.serve(ctx, d, payload)
+	if err != nil {
+		// A delivery that can't be recorded is still handled.
+		log.Printf("github: error recording delivery %q: %v", d.DeliveryID, err)
+	}
+
+	for k, v := range resp.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.Code)
+	w.Write(resp.Body.Bytes())
+}
+
+// Replay handles a recorded delivery again, and returns the record of the
+// replay.
+func (rec *Recorder) Replay(ctx context.Context, original *conveyor.Delivery) (*conveyor.Delivery, error) {
+	d := &conveyor.Delivery{
+		DeliveryID: original.DeliveryID,
+		Headers:    original.Headers,
+		ReplayOf:   &original.ID,
+	}
+
+	_, err := rec.serve(ctx, d, []byte(original.Payload))
+	return d, err
+}
+
+// serve handles a delivery with the payload, and records it along with the
+// response.
+func (rec *Recorder) serve(ctx context.Context, d *conveyor.Delivery, payload []byte) (*httptest.ResponseRecorder, error) {
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader(payload))
+	for k, v := range d.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp := httptest.NewRecorder()
+	rec.Handler.ServeHTTP(resp, req)
+
+	d.Event = req.Header.Get(hookshot.HeaderEvent)
+	d.Repository = repository(payload)
+	d.Payload = string(payload)
+	d.Status = resp.Code
+	d.Response = resp.Body.String()
+	if id := resp.Header().Get(HeaderBuild); id != "" {
+		d.BuildID = &id
+	}
+
+	return resp, rec.client.RecordDelivery(ctx, d)
+}
+
+// repository returns the full name of the repository in an event payload, or
+// an empty string if there isn't one.
+func repository(payload []byte) string {
+	var event struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	json.Unmarshal(payload, &event)
+	return event.Repository.FullName
+}
+
+// built responds with the ID of the build that was triggered.
+func built(w http.ResponseWriter, b *conveyor.Build) {
+	w.Header().Set(HeaderBuild, b.ID)
+	w.Write([]byte(b.ID))
+}
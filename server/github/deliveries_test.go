@@ -0,0 +1,122 @@
+package github
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/remind101/conveyor"
+	"github.com/remind101/conveyor/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRecorder(t *testing.T) {
+	c := new(mockConveyor)
+	d := new(mockDeliveriesClient)
+	rec := &Recorder{Handler: newServer(c), client: d}
+
+	payload := `{
+  "ref": "refs/heads/master",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set(HeaderDelivery, "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	var recorded *conveyor.Delivery
+	d.On("RecordDelivery", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		recorded = args.Get(0).(*conveyor.Delivery)
+	})
+
+	rec.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, fakeUUID, resp.Body.String())
+	assert.Equal(t, fakeUUID, resp.Header().Get(HeaderBuild))
+
+	buildID := fakeUUID
+	assert.Equal(t, &conveyor.Delivery{
+		DeliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		Event:      "push",
+		Repository: "remind101/acme-inc",
+		Headers: conveyor.DeliveryHeaders{
+			"X-Github-Event":    "push",
+			"X-Github-Delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		},
+		Payload:  payload,
+		Status:   http.StatusOK,
+		Response: fakeUUID,
+		BuildID:  &buildID,
+	}, recorded)
+
+	c.AssertExpectations(t)
+	d.AssertExpectations(t)
+}
+
+func TestRecorder_Replay(t *testing.T) {
+	c := new(mockConveyor)
+	d := new(mockDeliveriesClient)
+	rec := &Recorder{Handler: newServer(c), client: d}
+
+	original := &conveyor.Delivery{
+		ID:         fakeUUID,
+		DeliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		Event:      "push",
+		Headers: conveyor.DeliveryHeaders{
+			"X-Github-Event": "push",
+		},
+		Payload: `{
+  "ref": "refs/heads/master",
+  "deleted": true,
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`,
+		Status:   http.StatusOK,
+		Response: "Not building deleted branch",
+	}
+
+	d.On("RecordDelivery", mock.Anything).Return(nil)
+
+	replay, err := rec.Replay(context.Background(), original)
+	assert.NoError(t, err)
+	assert.Equal(t, original.DeliveryID, replay.DeliveryID)
+	assert.Equal(t, "push", replay.Event)
+	assert.Equal(t, "remind101/acme-inc", replay.Repository)
+	assert.Equal(t, original.Payload, replay.Payload)
+	assert.Equal(t, &original.ID, replay.ReplayOf)
+	assert.Nil(t, replay.BuildID)
+
+	c.AssertExpectations(t)
+	d.AssertExpectations(t)
+}
+
+// mockDeliveriesClient is a mock implementation of the deliveriesClient
+// interface.
+type mockDeliveriesClient struct {
+	mock.Mock
+}
+
+func (m *mockDeliveriesClient) RecordDelivery(ctx context.Context, d *conveyor.Delivery) error {
+	args := m.Called(d)
+	return args.Error(0)
+}
@@ -2,9 +2,10 @@ package github
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"regexp"
 	"strings"
 
 	"golang.org/x/net/context"
@@ -12,18 +13,47 @@ import (
 	"github.com/ejholmes/hookshot"
 	"github.com/ejholmes/hookshot/events"
 	"github.com/remind101/conveyor"
+	"github.com/remind101/conveyor/builder"
 )
 
 // client mocks out the interface from conveyor.Conveyor that we use.
 type client interface {
 	Build(context.Context, conveyor.BuildRequest) (*conveyor.Build, error)
+	Config(ctx context.Context, installationID int64, repository, sha string) (*builder.Config, error)
+	BuildSkipped(ctx context.Context, req conveyor.BuildRequest, reason string) error
+	FindBuild(ctx context.Context, buildIdentity string) (*conveyor.Build, error)
+	AttachPullRequest(ctx context.Context, req conveyor.BuildRequest) (*conveyor.Build, error)
+	CancelPullRequest(ctx context.Context, repository string, number int) ([]*conveyor.Build, error)
+	CancelCommit(ctx context.Context, repository, sha string) ([]*conveyor.Build, error)
+	CanWrite(ctx context.Context, installationID int64, repository, user string) (bool, error)
+	PullRequestHead(ctx context.Context, installationID int64, repository string, number int) (head, branch, sha string, err error)
+	PullRequestFiles(ctx context.Context, installationID int64, repository string, number int) ([]string, error)
+	CommentOnPullRequest(ctx context.Context, installationID int64, repository string, number int, body string) error
+	CommentOnCommit(ctx context.Context, installationID int64, repository, sha, body string) error
 }
 
+// Kinds of pull requests that can be allowed to build.
+const (
+	// Pull requests from a branch in the same repository.
+	PullRequestsSameRepo = "same-repo"
+
+	// Pull requests from a fork of the repository.
+	PullRequestsForks = "forks"
+)
+
 // Server implements the http.Handler interface for serving build requests via
 // GitHub webhooks.
 type Server struct {
 	client
 
+	// The kinds of pull requests that are built. When empty, pull requests
+	// aren't built.
+	PullRequests []string
+
+	// Returns the url of a build's logs, which is linked to in replies to
+	// commands.
+	LogsURL func(*conveyor.Build) string
+
 	// mux contains the routes.
 	mux http.Handler
 }
@@ -41,6 +71,10 @@ func newServer(c client) *Server {
 	g := hookshot.NewRouter()
 	g.HandleFunc("ping", s.Ping)
 	g.HandleFunc("push", s.Push)
+	g.HandleFunc("pull_request", s.PullRequest)
+	g.HandleFunc("issue_comment", s.IssueComment)
+	g.HandleFunc("commit_comment", s.CommitComment)
+	g.HandleFunc("check_run", s.CheckRun)
 
 	s.mux = g
 	return s
@@ -56,11 +90,25 @@ func (s *Server) Ping(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, "Ok\n")
 }
 
+// installation is the GitHub App installation that an event was delivered for,
+// which is included in the payload of every event.
+type installation struct {
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+// pushEvent is the `push` event payload.
+type pushEvent struct {
+	events.Push
+	installation
+}
+
 // Push is an http.HandlerFunc that will handle the `push` event from GitHub.
 func (s *Server) Push(w http.ResponseWriter, r *http.Request) {
 	ctx := context.TODO()
 
-	var event events.Push
+	var event pushEvent
 	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -78,28 +126,338 @@ func (s *Server) Push(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	directives, err := conveyor.ParseDirectives(event.HeadCommit.Message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Don't build commits that ask to be skipped.
+	if directives.Skip {
+		io.WriteString(w, "Not building: skipped by commit message")
+		return
+	}
+
 	opts := conveyor.BuildRequest{
-		Repository: event.Repository.FullName,
-		Branch:     strings.Replace(event.Ref, "refs/heads/", "", -1),
-		Sha:        event.HeadCommit.ID,
-		NoCache:    noCache(event.HeadCommit.Message),
+		Repository:     event.Repository.FullName,
+		Sha:            event.HeadCommit.ID,
+		NoCache:        directives.NoCache,
+		Private:        event.Repository.Private,
+		Directives:     directives,
+		InstallationID: event.Installation.ID,
+	}
+
+	// Tags are built without a branch. If the push doesn't include the
+	// commit, the tag is resolved to it when the build is created.
+	if strings.HasPrefix(event.Ref, "refs/tags/") {
+		opts.Tag = strings.TrimPrefix(event.Ref, "refs/tags/")
+		if err := conveyor.CheckTag(opts.Tag); err != nil {
+			io.WriteString(w, fmt.Sprintf("Not building: %v", err))
+			return
+		}
+	} else {
+		opts.Branch = strings.Replace(event.Ref, "refs/heads/", "", -1)
+	}
+
+	ref := opts.Sha
+	if ref == "" {
+		ref = opts.Tag
 	}
 
-	// Enqueue the build
+	files := func() ([]string, error) { return changedFiles(event.Push), nil }
+	if s.skip(ctx, w, opts, ref, files) {
+		return
+	}
+
+	// Enqueue the build. A push to the branch of a pull request also sends
+	// a `pull_request` event, which may have built the commit already.
 	b, err := s.client.Build(ctx, opts)
+	if err == conveyor.ErrDuplicateBuild {
+		io.WriteString(w, fmt.Sprintf("Not building: %s is already being built", opts.Sha))
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		buildError(w, err)
 		return
 	}
 
-	io.WriteString(w, b.ID)
+	built(w, b)
 }
 
-// http://rubular.com/r/y8oJAY9eAS
-var noCacheRegexp = regexp.MustCompile(`\[docker nocache\]`)
+// skip returns true, after responding, if the repository's config at ref
+// filters out the build. files returns the changed files, and is only called if
+// the config filters them. If the config can't be fetched, or is invalid, the
+// build is enqueued anyway, so that the error is reported on the build.
+func (s *Server) skip(ctx context.Context, w http.ResponseWriter, req conveyor.BuildRequest, ref string, files func() ([]string, error)) bool {
+	config, err := s.client.Config(ctx, req.InstallationID, req.Repository, ref)
+	if err != nil {
+		log.Printf("error fetching config for %s@%s: %v", req.Repository, ref, err)
+	}
+	if config == nil {
+		return false
+	}
+
+	var changed []string
+	if len(config.Paths.Include) > 0 || len(config.Paths.Exclude) > 0 {
+		changed, err = files()
+		if err != nil {
+			// Without the changed files, the path filter isn't
+			// applied.
+			log.Printf("error fetching changed files for %s@%s: %v", req.Repository, ref, err)
+		}
+	}
+
+	reason := config.SkipReason(req.Branch, changed)
+	if reason == "" {
+		return false
+	}
+
+	if config.SkippedStatus {
+		if err := s.client.BuildSkipped(ctx, req, reason); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+	}
+	io.WriteString(w, fmt.Sprintf("Not building: %s", reason))
+	return true
+}
+
+// changedFiles returns the files that were added, modified or removed by the
+// commits in a push.
+func changedFiles(event events.Push) []string {
+	var files []string
+	for _, c := range event.Commits {
+		for _, f := range c.Added {
+			files = append(files, fmt.Sprint(f))
+		}
+		files = append(files, c.Modified...)
+		for _, f := range c.Removed {
+			files = append(files, fmt.Sprint(f))
+		}
+	}
+	return files
+}
+
+// pullRequestEvent is the subset of the `pull_request` event payload that we
+// use.
+type pullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref  string `json:"ref"`
+			Sha  string `json:"sha"`
+			Repo *struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		Private  bool   `json:"private"`
+	} `json:"repository"`
+	installation
+}
+
+// fork returns true if the pull request is from a fork. If the fork was
+// deleted, GitHub doesn't provide the head repository, which is treated as a
+// fork.
+func (e *pullRequestEvent) fork() bool {
+	repo := e.PullRequest.Head.Repo
+	return repo == nil || repo.FullName != e.Repository.FullName
+}
 
-// noCache returns whether the docker layer cache should be used for this build
-// or not.
-func noCache(message string) bool {
-	return noCacheRegexp.MatchString(message)
+// PullRequest is an http.HandlerFunc that will handle the `pull_request` event
+// from GitHub. The head of the pull request is built when it's opened,
+// reopened or pushed to, and builds that are still running are canceled when
+// it's closed.
+func (s *Server) PullRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	var event pullRequestEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch event.Action {
+	case "opened", "reopened", "synchronize":
+	case "closed":
+		builds, err := s.client.CancelPullRequest(ctx, event.Repository.FullName, event.Number)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, fmt.Sprintf("Canceled %d builds", len(builds)))
+		return
+	default:
+		io.WriteString(w, fmt.Sprintf("Not building: ignoring %s action", event.Action))
+		return
+	}
+
+	kind := PullRequestsSameRepo
+	if event.fork() {
+		kind = PullRequestsForks
+	}
+	if !s.allowPullRequests(kind) {
+		io.WriteString(w, fmt.Sprintf("Not building: %s pull requests aren't allowed", kind))
+		return
+	}
+
+	req := conveyor.BuildRequest{
+		Repository:     event.Repository.FullName,
+		Sha:            event.PullRequest.Head.Sha,
+		PullRequest:    event.Number,
+		Private:        event.Repository.Private,
+		InstallationID: event.Installation.ID,
+	}
+
+	// The name of a fork's branch is chosen by its owner, so it can't be
+	// trusted to tag the image, or to match the access policy, e.g. a fork
+	// with a `master` branch. Builds of forks don't have a branch.
+	if kind == PullRequestsSameRepo {
+		req.Branch = event.PullRequest.Head.Ref
+	}
+
+	files := func() ([]string, error) {
+		return s.client.PullRequestFiles(ctx, req.InstallationID, req.Repository, req.PullRequest)
+	}
+	if s.skip(ctx, w, req, req.Sha, files) {
+		return
+	}
+
+	b, err := s.client.Build(ctx, req)
+	if err == conveyor.ErrDuplicateBuild {
+		// The commit was most likely built by the `push` event for the
+		// pull request's branch, so the build is attached to the pull
+		// request, e.g. so that it's canceled when the pull request is
+		// closed.
+		b, err := s.client.AttachPullRequest(ctx, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if b != nil {
+			io.WriteString(w, fmt.Sprintf("Not building: %s is already being built by %s", req.Sha, b.ID))
+			return
+		}
+		io.WriteString(w, fmt.Sprintf("Not building: %s is already being built", req.Sha))
+		return
+	}
+	if err != nil {
+		buildError(w, err)
+		return
+	}
+
+	built(w, b)
+}
+
+// allowPullRequests returns true if the kind of pull request is allowed to
+// build.
+func (s *Server) allowPullRequests(kind string) bool {
+	for _, k := range s.PullRequests {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRunEvent is the subset of the `check_run` event payload that we use.
+type checkRunEvent struct {
+	Action   string `json:"action"`
+	CheckRun struct {
+		Name       string `json:"name"`
+		HeadSha    string `json:"head_sha"`
+		ExternalID string `json:"external_id"`
+		CheckSuite struct {
+			HeadBranch string `json:"head_branch"`
+		} `json:"check_suite"`
+	} `json:"check_run"`
+	RequestedAction struct {
+		Identifier string `json:"identifier"`
+	} `json:"requested_action"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		Private  bool   `json:"private"`
+	} `json:"repository"`
+	installation
+}
+
+// CheckRun is an http.HandlerFunc that will handle the `check_run` event from
+// GitHub. The commit is rebuilt when "Re-run" is clicked on one of our check
+// runs, or without the layer cache when the "Rebuild (no cache)" action is
+// clicked.
+func (s *Server) CheckRun(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	var event checkRunEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if event.CheckRun.Name != builder.Context {
+		io.WriteString(w, fmt.Sprintf("Ignoring check run %s", event.CheckRun.Name))
+		return
+	}
+
+	req := conveyor.BuildRequest{
+		Repository:     event.Repository.FullName,
+		Sha:            event.CheckRun.HeadSha,
+		Branch:         event.CheckRun.CheckSuite.HeadBranch,
+		Private:        event.Repository.Private,
+		InstallationID: event.Installation.ID,
+	}
+
+	switch {
+	case event.Action == "rerequested":
+	case event.Action == "requested_action" && event.RequestedAction.Identifier == builder.ActionRebuildNoCache:
+		req.NoCache = true
+	default:
+		io.WriteString(w, fmt.Sprintf("Ignoring %s action", event.Action))
+		return
+	}
+
+	// Rebuild with the branch, tag, pull request and directives of the
+	// original build. Check runs for builds that were skipped don't have
+	// one.
+	if id := event.CheckRun.ExternalID; id != "" {
+		b, err := s.client.FindBuild(ctx, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		req.Branch, req.Tag = b.Branch, b.Tag
+		if b.PullRequest != nil {
+			req.PullRequest = *b.PullRequest
+		}
+		req.Directives, err = b.Directives.Parse()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	b, err := s.client.Build(ctx, req)
+	if err == conveyor.ErrDuplicateBuild {
+		io.WriteString(w, fmt.Sprintf("Not building: %s is already being built", req.Sha))
+		return
+	}
+	if err != nil {
+		buildError(w, err)
+		return
+	}
+
+	built(w, b)
+}
+
+// buildError responds with an error from triggering a build. Builds that the
+// access policy doesn't allow are forbidden.
+func buildError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if _, ok := err.(*conveyor.AccessDeniedError); ok {
+		status = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), status)
 }
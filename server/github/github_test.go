@@ -9,6 +9,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/remind101/conveyor"
+	"github.com/remind101/conveyor/builder"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -42,6 +43,7 @@ func TestServer_Push(t *testing.T) {
 }`))
 	req.Header.Set("X-GitHub-Event", "push")
 
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
 	c.On("Build", conveyor.BuildRequest{
 		Repository: "remind101/acme-inc",
 		Branch:     "master",
@@ -55,6 +57,152 @@ func TestServer_Push(t *testing.T) {
 	assert.Equal(t, resp.Body.String(), fakeUUID)
 }
 
+func TestServer_Push_Duplicate(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/feature",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	// The `pull_request` event for the same push built it first.
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "feature",
+		Sha:        "abcd",
+	}).Return((*conveyor.Build)(nil), conveyor.ErrDuplicateBuild)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: abcd is already being built", resp.Body.String())
+}
+
+func TestServer_Push_Installation(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/master",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  },
+  "installation": {
+    "id": 1234
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(1234), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository:     "remind101/acme-inc",
+		Branch:         "master",
+		Sha:            "abcd",
+		InstallationID: 1234,
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	c.AssertExpectations(t)
+}
+
+func TestServer_Push_Private(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/master",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc",
+    "private": true
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+		Private:    true,
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestServer_Push_Tag(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/tags/v1.4.2",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Tag:        "v1.4.2",
+		Sha:        "abcd",
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	c.AssertExpectations(t)
+}
+
+func TestServer_Push_InvalidTag(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/tags/release/1.0",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: tag release/1.0 can't be built: it isn't a valid docker tag", resp.Body.String())
+	c.AssertExpectations(t)
+}
+
 func TestServer_Push_Fork(t *testing.T) {
 	c := new(mockConveyor)
 	s := newServer(c)
@@ -76,6 +224,38 @@ func TestServer_Push_Fork(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
 
+func TestServer_Push_AccessDenied(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/feature",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "feature",
+		Sha:        "abcd",
+	}).Return((*conveyor.Build)(nil), &conveyor.AccessDeniedError{
+		Repository: "remind101/acme-inc",
+		Branch:     "feature",
+		Reason:     "branch does not match the allowed branches",
+	})
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "access denied to remind101/acme-inc (branch feature): branch does not match the allowed branches\n", resp.Body.String())
+}
+
 func TestServer_Push_Deleted(t *testing.T) {
 	c := new(mockConveyor)
 	s := newServer(c)
@@ -97,26 +277,499 @@ func TestServer_Push_Deleted(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
 
-func TestNoCache(t *testing.T) {
+func TestServer_Push_SkippedBranch(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/dependabot/npm/lodash",
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return(&builder.Config{
+		Branches:      builder.Filter{Exclude: []string{"dependabot/**"}},
+		SkippedStatus: true,
+	}, nil)
+	c.On("BuildSkipped", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "dependabot/npm/lodash",
+		Sha:        "abcd",
+	}, "branch dependabot/npm/lodash doesn't match branches: exclude dependabot/**").Return(nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: branch dependabot/npm/lodash doesn't match branches: exclude dependabot/**", resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_Push_SkippedPaths(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/master",
+  "commits": [
+    {"added": ["docs/setup.md"], "modified": ["README.md"], "removed": []},
+    {"added": [], "modified": [], "removed": ["docs/old.md"]}
+  ],
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return(&builder.Config{
+		Paths: builder.Filter{Exclude: []string{"docs/**", "*.md"}},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: no changed files match paths: exclude docs/**, *.md", resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_Push_MatchingPaths(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/master",
+  "commits": [
+    {"added": ["docs/setup.md"], "modified": ["app/main.go"], "removed": []}
+  ],
+  "head_commit": {
+    "id": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return(&builder.Config{
+		Paths: builder.Filter{Exclude: []string{"docs/**", "*.md"}},
+	}, nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, fakeUUID, resp.Body.String())
+}
+
+func TestServer_Push_Skip(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/master",
+  "head_commit": {
+    "id": "abcd",
+    "message": "Update README [ci skip]"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: skipped by commit message", resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_Push_Directives(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "ref": "refs/heads/master",
+  "head_commit": {
+    "id": "abcd",
+    "message": "Hotfix [docker nocache] [conveyor priority=high]"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "push")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "abcd",
+		NoCache:    true,
+		Directives: conveyor.Directives{
+			NoCache:  true,
+			Priority: conveyor.PriorityHigh,
+			List:     conveyor.DirectiveList{"docker nocache", "conveyor priority=high"},
+		},
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	c.AssertExpectations(t)
+}
+
+func TestServer_PullRequest(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+	s.PullRequests = []string{PullRequestsSameRepo}
+
+	for _, action := range []string{"opened", "reopened", "synchronize"} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "`+action+`",
+  "number": 42,
+  "pull_request": {
+    "head": {
+      "ref": "feature",
+      "sha": "abcd",
+      "repo": {
+        "full_name": "remind101/acme-inc"
+      }
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc",
+    "private": true
+  }
+}`))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+
+		c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+		c.On("Build", conveyor.BuildRequest{
+			Repository:  "remind101/acme-inc",
+			Branch:      "feature",
+			Sha:         "abcd",
+			PullRequest: 42,
+			Private:     true,
+		}).Return(&conveyor.Build{
+			ID: fakeUUID,
+		}, nil)
+
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, fakeUUID, resp.Body.String())
+	}
+}
+
+func TestServer_PullRequest_Duplicate(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+	s.PullRequests = []string{PullRequestsSameRepo}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "synchronize",
+  "number": 42,
+  "pull_request": {
+    "head": {
+      "ref": "feature",
+      "sha": "abcd",
+      "repo": {
+        "full_name": "remind101/acme-inc"
+      }
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+
+	// The `push` event for the same push built it first, so the build is
+	// attached to the pull request.
+	br := conveyor.BuildRequest{
+		Repository:  "remind101/acme-inc",
+		Branch:      "feature",
+		Sha:         "abcd",
+		PullRequest: 42,
+	}
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", br).Return((*conveyor.Build)(nil), conveyor.ErrDuplicateBuild)
+	c.On("AttachPullRequest", br).Return(&conveyor.Build{ID: fakeUUID}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: abcd is already being built by "+fakeUUID, resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_PullRequest_Fork(t *testing.T) {
 	tests := []struct {
-		in  string
-		out bool
+		allowed []string
+		repo    string
+		body    string
 	}{
-		// Use cache
-		{"testing", false},
+		{nil, `{"full_name": "remind101/acme-inc"}`, "Not building: same-repo pull requests aren't allowed"},
+		{[]string{PullRequestsSameRepo}, `{"full_name": "ejholmes/acme-inc"}`, "Not building: forks pull requests aren't allowed"},
+		{[]string{PullRequestsSameRepo}, `null`, "Not building: forks pull requests aren't allowed"},
+		{[]string{PullRequestsForks}, `{"full_name": "ejholmes/acme-inc"}`, fakeUUID},
+	}
+
+	for _, tt := range tests {
+		c := new(mockConveyor)
+		s := newServer(c)
+		s.PullRequests = tt.allowed
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "opened",
+  "number": 42,
+  "pull_request": {
+    "head": {
+      "ref": "feature",
+      "sha": "abcd",
+      "repo": `+tt.repo+`
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+		req.Header.Set("X-GitHub-Event", "pull_request")
 
-		// Don't use cache
-		{"[docker nocache]", true},
-		{"this is a commit [docker nocache]", true},
+		c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+		c.On("Build", mock.Anything).Return(&conveyor.Build{
+			ID: fakeUUID,
+		}, nil)
+
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, tt.body, resp.Body.String())
+	}
+}
+
+func TestServer_PullRequest_ForkBranch(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+	s.PullRequests = []string{PullRequestsForks}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "opened",
+  "number": 42,
+  "pull_request": {
+    "head": {
+      "ref": "master",
+      "sha": "abcd",
+      "repo": {
+        "full_name": "ejholmes/acme-inc"
+      }
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+
+	c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return((*builder.Config)(nil), nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository:  "remind101/acme-inc",
+		Sha:         "abcd",
+		PullRequest: 42,
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, fakeUUID, resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_PullRequest_Skipped(t *testing.T) {
+	tests := []struct {
+		config *builder.Config
+		files  []string
+		body   string
+	}{
+		{&builder.Config{Branches: builder.Filter{Exclude: []string{"feature"}}}, nil, "Not building: branch feature doesn't match branches: exclude feature"},
+		{&builder.Config{Paths: builder.Filter{Exclude: []string{"docs/**"}}}, []string{"docs/setup.md"}, "Not building: no changed files match paths: exclude docs/**"},
+		{&builder.Config{Paths: builder.Filter{Exclude: []string{"docs/**"}}}, []string{"docs/setup.md", "main.go"}, fakeUUID},
 	}
 
 	for _, tt := range tests {
-		if got, want := noCache(tt.in), tt.out; got != want {
-			t.Fatalf("noCache(%q) => %v; want %v", tt.in, got, want)
-		}
+		c := new(mockConveyor)
+		s := newServer(c)
+		s.PullRequests = []string{PullRequestsSameRepo}
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "opened",
+  "number": 42,
+  "pull_request": {
+    "head": {
+      "ref": "feature",
+      "sha": "abcd",
+      "repo": {
+        "full_name": "remind101/acme-inc"
+      }
+    }
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+		req.Header.Set("X-GitHub-Event", "pull_request")
+
+		c.On("Config", int64(0), "remind101/acme-inc", "abcd").Return(tt.config, nil)
+		c.On("PullRequestFiles", int64(0), "remind101/acme-inc", 42).Return(tt.files, nil)
+		c.On("Build", mock.Anything).Return(&conveyor.Build{
+			ID: fakeUUID,
+		}, nil)
+
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, tt.body, resp.Body.String())
 	}
 }
 
+func TestServer_PullRequest_Closed(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "closed",
+  "number": 42,
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+
+	c.On("CancelPullRequest", "remind101/acme-inc", 42).Return([]*conveyor.Build{
+		{ID: fakeUUID},
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Canceled 1 builds", resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_PullRequest_Ignored(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+	s.PullRequests = []string{PullRequestsSameRepo}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "labeled",
+  "number": 42,
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "pull_request")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Not building: ignoring labeled action", resp.Body.String())
+	c.AssertNotCalled(t, "Build", mock.Anything)
+}
+
+func TestServer_CheckRun_RebuildNoCache(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "requested_action",
+  "check_run": {
+    "name": "container/docker",
+    "head_sha": "abcd",
+    "external_id": "`+fakeUUID+`",
+    "check_suite": {
+      "head_branch": "feature"
+    }
+  },
+  "requested_action": {
+    "identifier": "rebuild_nocache"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "check_run")
+
+	number := 42
+	c.On("FindBuild", fakeUUID).Return(&conveyor.Build{
+		ID:          fakeUUID,
+		Branch:      "feature",
+		PullRequest: &number,
+		Directives:  conveyor.DirectiveList{"docker target=release", "docker build-arg VERSION=1.2"},
+	}, nil)
+	c.On("Build", conveyor.BuildRequest{
+		Repository:  "remind101/acme-inc",
+		Branch:      "feature",
+		Sha:         "abcd",
+		PullRequest: 42,
+		NoCache:     true,
+		Directives: conveyor.Directives{
+			Target:    "release",
+			BuildArgs: map[string]string{"VERSION": "1.2"},
+			List:      conveyor.DirectiveList{"docker target=release", "docker build-arg VERSION=1.2"},
+		},
+	}).Return(&conveyor.Build{
+		ID: fakeUUID,
+	}, nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, fakeUUID, resp.Body.String())
+	c.AssertExpectations(t)
+}
+
+func TestServer_CheckRun_OtherCheck(t *testing.T) {
+	c := new(mockConveyor)
+	s := newServer(c)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{
+  "action": "rerequested",
+  "check_run": {
+    "name": "ci/test",
+    "head_sha": "abcd"
+  },
+  "repository": {
+    "full_name": "remind101/acme-inc"
+  }
+}`))
+	req.Header.Set("X-GitHub-Event", "check_run")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "Ignoring check run ci/test", resp.Body.String())
+	c.AssertNotCalled(t, "Build", mock.Anything)
+}
+
 // mockConveyor is an implementation of the client interface.
 type mockConveyor struct {
 	mock.Mock
@@ -126,3 +779,58 @@ func (m *mockConveyor) Build(ctx context.Context, req conveyor.BuildRequest) (*c
 	args := m.Called(req)
 	return args.Get(0).(*conveyor.Build), args.Error(1)
 }
+
+func (m *mockConveyor) Config(ctx context.Context, installationID int64, repository, sha string) (*builder.Config, error) {
+	args := m.Called(installationID, repository, sha)
+	return args.Get(0).(*builder.Config), args.Error(1)
+}
+
+func (m *mockConveyor) BuildSkipped(ctx context.Context, req conveyor.BuildRequest, reason string) error {
+	args := m.Called(req, reason)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) AttachPullRequest(ctx context.Context, req conveyor.BuildRequest) (*conveyor.Build, error) {
+	args := m.Called(req)
+	return args.Get(0).(*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) CancelPullRequest(ctx context.Context, repository string, number int) ([]*conveyor.Build, error) {
+	args := m.Called(repository, number)
+	return args.Get(0).([]*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) CancelCommit(ctx context.Context, repository, sha string) ([]*conveyor.Build, error) {
+	args := m.Called(repository, sha)
+	return args.Get(0).([]*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) CanWrite(ctx context.Context, installationID int64, repository, user string) (bool, error) {
+	args := m.Called(installationID, repository, user)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockConveyor) PullRequestHead(ctx context.Context, installationID int64, repository string, number int) (string, string, string, error) {
+	args := m.Called(installationID, repository, number)
+	return args.String(0), args.String(1), args.String(2), args.Error(3)
+}
+
+func (m *mockConveyor) PullRequestFiles(ctx context.Context, installationID int64, repository string, number int) ([]string, error) {
+	args := m.Called(installationID, repository, number)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockConveyor) CommentOnPullRequest(ctx context.Context, installationID int64, repository string, number int, body string) error {
+	args := m.Called(installationID, repository, number, body)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) CommentOnCommit(ctx context.Context, installationID int64, repository, sha, body string) error {
+	args := m.Called(installationID, repository, sha, body)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) FindBuild(ctx context.Context, buildIdentity string) (*conveyor.Build, error) {
+	args := m.Called(buildIdentity)
+	return args.Get(0).(*conveyor.Build), args.Error(1)
+}
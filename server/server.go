@@ -1,36 +1,124 @@
 package server
 
 import (
+	"bytes"
 	"net/http"
+	"text/template"
+	"time"
 
-	"github.com/ejholmes/hookshot"
+	"github.com/DataDog/datadog-go/statsd"
 	"github.com/gorilla/mux"
 	"github.com/remind101/conveyor"
 	"github.com/remind101/conveyor/server/api"
 	"github.com/remind101/conveyor/server/github"
+	"github.com/remind101/conveyor/server/slack"
 )
 
+// DefaultLogsLinkTTL is how long signed links to the logs of a build are valid
+// for by default.
+const DefaultLogsLinkTTL = 24 * time.Hour
+
 type Config struct {
 	APIAuth func(http.Handler) http.Handler
 
-	// Shared secret between GitHub and Conveyor.
-	GitHubSecret string
+	// Shared secrets between GitHub and Conveyor. Webhook deliveries
+	// signed with any of them are accepted, so that the secret can be
+	// rotated.
+	GitHubSecrets []string
+
+	// How long webhook delivery IDs are remembered, to reject replayed
+	// deliveries. Defaults to github.DefaultReplayWindow.
+	GitHubReplayWindow time.Duration
+
+	// If set, rejected webhook deliveries are counted.
+	Stats *statsd.Client
+
+	// The kinds of pull requests that are built. See github.PullRequestsSameRepo
+	// and github.PullRequestsForks.
+	PullRequests []string
+
+	// A template for the url of a build's logs, e.g.
+	// `https://conveyor.example.com/logs/{{.ID}}`.
+	LogsURL string
+
+	// If set, links to the logs of a build are signed with this secret, and
+	// streaming the logs requires either a signed link or the API's
+	// authentication.
+	LogsSecret []byte
+
+	// How long signed links to the logs of a build are valid for. Defaults
+	// to DefaultLogsLinkTTL.
+	LogsLinkTTL time.Duration
+
+	// The signing secret of the Slack app. If set, Slack slash commands are
+	// served at /slack.
+	SlackSigningSecret string
+
+	// Maps Slack user IDs (not user names, which can be changed), or `*`
+	// for everyone else, to what they're allowed to do with slash commands.
+	SlackUsers map[string]slack.Permission
 }
 
 func NewServer(c *conveyor.Conveyor, config Config) http.Handler {
 	r := mux.NewRouter()
 
 	// Github webhooks
-	r.MatcherFunc(githubWebhook).Handler(
-		hookshot.Authorize(github.NewServer(c), config.GitHubSecret),
-	)
+	g := github.NewServer(c)
+	g.PullRequests = config.PullRequests
+	if config.LogsURL != "" {
+		g.LogsURL = logsURL(config)
+	}
+	d := github.RecordDeliveries(g, c)
+	a := github.Authorize(d, config.GitHubSecrets)
+	a.Deliveries = c
+	a.ReplayWindow = config.GitHubReplayWindow
+	if config.Stats != nil {
+		a.Stats = config.Stats
+	}
+	r.MatcherFunc(githubWebhook).Handler(a)
+
+	// Slack slash commands
+	if config.SlackSigningSecret != "" {
+		sl := slack.NewServer(c)
+		sl.Users = config.SlackUsers
+		sl.LogsURL = logsURL(config)
+		r.Handle("/slack", slack.Authorize(sl, config.SlackSigningSecret)).Methods("POST")
+	}
 
 	// API
-	r.NotFoundHandler = api.NewServer(c, config.APIAuth)
+	s := api.NewServer(c, config.APIAuth)
+	s.Webhooks = d
+	s.LogsSecret = config.LogsSecret
+	r.NotFoundHandler = s
 
 	return r
 }
 
+// logsURL returns a function that renders the link to the logs of a build,
+// signed with the LogsSecret when there is one.
+func logsURL(config Config) func(*conveyor.Build) string {
+	if config.LogsURL == "" {
+		return func(*conveyor.Build) string { return "" }
+	}
+
+	t := template.Must(template.New("url").Parse(config.LogsURL))
+	ttl := config.LogsLinkTTL
+	if ttl == 0 {
+		ttl = DefaultLogsLinkTTL
+	}
+
+	return func(b *conveyor.Build) string {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, b); err != nil {
+			return ""
+		}
+		if config.LogsSecret == nil {
+			return buf.String()
+		}
+		return api.SignLogsURL(config.LogsSecret, buf.String(), b.ID, time.Now().Add(ttl))
+	}
+}
+
 // githubWebhook is a MatcherFunc that matches requests that have an
 // `X-GitHub-Event` header present.
 func githubWebhook(r *http.Request, _ *mux.RouteMatch) bool {
@@ -0,0 +1,93 @@
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers that Slack sends with slash commands.
+const (
+	HeaderSignature = "X-Slack-Signature"
+	HeaderTimestamp = "X-Slack-Request-Timestamp"
+)
+
+// MaxRequestAge is how old a request can be, according to its timestamp,
+// before it's rejected as a replay.
+const MaxRequestAge = 5 * time.Minute
+
+// now is a variable so it can be stubbed in tests.
+var now = time.Now
+
+// Authorizer is an http.Handler that verifies that requests were signed by
+// Slack with the app's signing secret, and are recent, before passing them on
+// to Handler. See https://api.slack.com/authentication/verifying-requests-from-slack.
+type Authorizer struct {
+	// The handler for authorized requests.
+	Handler http.Handler
+
+	// The signing secret of the Slack app.
+	Secret string
+}
+
+// Authorize returns a new Authorizer that verifies requests to h with the
+// given signing secret.
+func Authorize(h http.Handler, secret string) *Authorizer {
+	return &Authorizer{Handler: h, Secret: secret}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a *Authorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if reason := a.verify(r.Header, body); reason != "" {
+		log.Printf("slack: rejected request: %s", reason)
+		http.Error(w, "The provided signature does not match.", http.StatusForbidden)
+		return
+	}
+
+	a.Handler.ServeHTTP(w, r)
+}
+
+// verify checks the signature and timestamp of a request. It returns the
+// reason that it was rejected, or an empty string if it's authorized.
+func (a *Authorizer) verify(h http.Header, body []byte) string {
+	signature, timestamp := h.Get(HeaderSignature), h.Get(HeaderTimestamp)
+	if signature == "" || timestamp == "" {
+		return "missing signature"
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "invalid timestamp"
+	}
+	if age := now().Sub(time.Unix(ts, 0)); age > MaxRequestAge || age < -MaxRequestAge {
+		return "expired timestamp"
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(sign(a.Secret, timestamp, body))) {
+		return "invalid signature"
+	}
+
+	return ""
+}
+
+// sign returns the signature of a request body, in the format of the
+// X-Slack-Signature header.
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
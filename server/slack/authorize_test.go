@@ -0,0 +1,57 @@
+package slack
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A request recorded from Slack, with its signature, from
+// https://api.slack.com/authentication/verifying-requests-from-slack.
+const (
+	recordedSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	recordedTimestamp = "1531420618"
+	recordedSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+	recordedBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+)
+
+func TestAuthorizer(t *testing.T) {
+	now = func() time.Time { return time.Unix(1531420618, 0).Add(time.Minute) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		status    int
+	}{
+		{recordedSecret, recordedTimestamp, recordedSignature, recordedBody, http.StatusOK},
+		{"other", recordedTimestamp, recordedSignature, recordedBody, http.StatusForbidden},
+		{recordedSecret, recordedTimestamp, recordedSignature, recordedBody + "&text=cancel", http.StatusForbidden},
+		{recordedSecret, "1531420918", recordedSignature, recordedBody, http.StatusForbidden},
+		{recordedSecret, "1531410618", sign(recordedSecret, "1531410618", []byte(recordedBody)), recordedBody, http.StatusForbidden},
+		{recordedSecret, "", "", recordedBody, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		a := Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The handler can still read the body.
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, tt.body, string(body))
+		}), tt.secret)
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/slack", strings.NewReader(tt.body))
+		req.Header.Set(HeaderTimestamp, tt.timestamp)
+		req.Header.Set(HeaderSignature, tt.signature)
+
+		a.ServeHTTP(resp, req)
+		assert.Equal(t, tt.status, resp.Code, tt.timestamp)
+	}
+}
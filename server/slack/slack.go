@@ -0,0 +1,385 @@
+package slack
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/remind101/conveyor"
+)
+
+// client mocks out the interface from conveyor.Conveyor that we use.
+type client interface {
+	Build(context.Context, conveyor.BuildRequest) (*conveyor.Build, error)
+	FindBuild(context.Context, string) (*conveyor.Build, error)
+	CancelBuild(context.Context, string) (*conveyor.Build, error)
+	Setup(context.Context, conveyor.SetupRequest) (*conveyor.Webhook, error)
+}
+
+// Permission is what a Slack user is allowed to do with slash commands.
+type Permission int
+
+const (
+	// PermissionNone doesn't allow any commands.
+	PermissionNone Permission = iota
+	// PermissionRead allows `status` and `logs`.
+	PermissionRead
+	// PermissionWrite also allows `build` and `cancel`.
+	PermissionWrite
+	// PermissionAdmin also allows `setup`.
+	PermissionAdmin
+)
+
+// String implements the fmt.Stringer interface.
+func (p Permission) String() string {
+	switch p {
+	case PermissionRead:
+		return "read"
+	case PermissionWrite:
+		return "write"
+	case PermissionAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// userID matches Slack user IDs. User names can be changed by their users, so
+// permissions are only granted to user IDs.
+var userID = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+
+// ParseUsers parses a list of `user=permission` mappings, e.g.
+// `U024BE7LH=admin`, where user is a Slack user ID, or `*` for everyone else.
+func ParseUsers(mappings []string) (map[string]Permission, error) {
+	users := make(map[string]Permission)
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid slack user mapping: %q", m)
+		}
+		if parts[0] != "*" && !userID.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid slack user %q: only user IDs (e.g. U024BE7LH) can be mapped", parts[0])
+		}
+
+		var p Permission
+		switch parts[1] {
+		case "none":
+			p = PermissionNone
+		case "read":
+			p = PermissionRead
+		case "write":
+			p = PermissionWrite
+		case "admin":
+			p = PermissionAdmin
+		default:
+			return nil, fmt.Errorf("unknown slack permission %q for %s", parts[1], parts[0])
+		}
+		users[parts[0]] = p
+	}
+	return users, nil
+}
+
+// commandPermissions are the permissions that each command requires.
+var commandPermissions = map[string]Permission{
+	"build":  PermissionWrite,
+	"status": PermissionRead,
+	"cancel": PermissionWrite,
+	"logs":   PermissionRead,
+	"setup":  PermissionAdmin,
+}
+
+// commandUsage describes the available commands, given the name of the slash
+// command.
+const commandUsage = "Usage: `%[1]s build owner/repo@branch`, `%[1]s status owner/repo@sha`, `%[1]s cancel <build-id>`, `%[1]s logs <build-id>` or `%[1]s setup owner/repo`."
+
+// Response types for slash commands.
+const (
+	// Only the user that ran the command sees the response.
+	responseEphemeral = "ephemeral"
+	// Everyone in the channel sees the response.
+	responseInChannel = "in_channel"
+)
+
+// response is the response to a slash command.
+type response struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// ephemeral returns a response that only the user sees.
+func ephemeral(format string, v ...interface{}) *response {
+	return &response{ResponseType: responseEphemeral, Text: fmt.Sprintf(format, v...)}
+}
+
+// inChannel returns a response that everyone in the channel sees.
+func inChannel(format string, v ...interface{}) *response {
+	return &response{ResponseType: responseInChannel, Text: fmt.Sprintf(format, v...)}
+}
+
+// slashCommand is a slash command that was run in Slack.
+type slashCommand struct {
+	// The slash command, e.g. `/conveyor`.
+	Command string
+	// The ID of the user that ran it.
+	UserID string
+	// The name of the subcommand, e.g. `build`, and its arguments.
+	Name string
+	Args []string
+	// The URL that delayed responses are posted to.
+	ResponseURL string
+}
+
+// Server is an http.Handler that runs Slack slash commands. Requests should be
+// verified with an Authorizer.
+type Server struct {
+	client
+
+	// Maps Slack user IDs (not user names, which can be changed), or `*`
+	// for everyone else, to what they're allowed to do. Users that aren't
+	// mapped get PermissionRead.
+	Users map[string]Permission
+
+	// Returns the link to the logs of a build.
+	LogsURL func(*conveyor.Build) string
+
+	// respond posts a delayed response to a response_url.
+	respond func(responseURL string, resp *response) error
+}
+
+// NewServer returns a new Server for the slash commands.
+func NewServer(c *conveyor.Conveyor) *Server {
+	return newServer(c)
+}
+
+func newServer(c client) *Server {
+	return &Server{
+		client:  c,
+		respond: postResponse,
+		LogsURL: func(b *conveyor.Build) string { return "" },
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := strings.Fields(r.PostForm.Get("text"))
+	cmd := slashCommand{
+		Command:     r.PostForm.Get("command"),
+		UserID:      r.PostForm.Get("user_id"),
+		ResponseURL: r.PostForm.Get("response_url"),
+	}
+	if len(fields) > 0 {
+		cmd.Name, cmd.Args = fields[0], fields[1:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.run(ctx, cmd))
+}
+
+// run runs a slash command, and returns the response.
+func (s *Server) run(ctx context.Context, cmd slashCommand) *response {
+	usage := fmt.Sprintf(commandUsage, cmd.Command)
+
+	required, ok := commandPermissions[cmd.Name]
+	if !ok {
+		if cmd.Name == "" || cmd.Name == "help" {
+			return ephemeral("%s", usage)
+		}
+		return ephemeral("Unknown command `%s`. %s", cmd.Name, usage)
+	}
+	if len(cmd.Args) != 1 {
+		return ephemeral("`%s` takes one argument. %s", cmd.Name, usage)
+	}
+
+	if p := s.permission(cmd); p < required {
+		return ephemeral("You need %s permission to run `%s %s`, but you have %s permission.", required, cmd.Command, cmd.Name, p)
+	}
+
+	arg := cmd.Args[0]
+	switch cmd.Name {
+	case "build":
+		return s.build(ctx, cmd, arg)
+	case "status":
+		return s.status(ctx, arg)
+	case "cancel":
+		return s.cancel(ctx, cmd, arg)
+	case "logs":
+		return s.logs(ctx, arg)
+	default:
+		return s.setup(cmd, arg)
+	}
+}
+
+// permission returns what the user that ran a command is allowed to do.
+func (s *Server) permission(cmd slashCommand) Permission {
+	for _, user := range []string{cmd.UserID, "*"} {
+		if p, ok := s.Users[user]; ok {
+			return p
+		}
+	}
+	return PermissionRead
+}
+
+// build builds the head of a branch.
+func (s *Server) build(ctx context.Context, cmd slashCommand, arg string) *response {
+	repository, branch := splitRepoRef(arg)
+	if repository == "" || branch == "" {
+		return ephemeral("Expected `owner/repo@branch`, but got `%s`.", arg)
+	}
+
+	b, err := s.client.Build(ctx, conveyor.BuildRequest{
+		Repository: repository,
+		Branch:     branch,
+	})
+	if err == conveyor.ErrDuplicateBuild {
+		return ephemeral("The head of `%s` is already being built.", arg)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return inChannel("<@%s> started build `%s` of `%s@%s` (`%s`). %s", cmd.UserID, b.ID, b.Repository, b.Branch, shortSha(b.Sha), s.logsLink(b))
+}
+
+// status reports the state of the build of a commit.
+func (s *Server) status(ctx context.Context, arg string) *response {
+	repository, sha := splitRepoRef(arg)
+	if repository == "" || sha == "" {
+		return ephemeral("Expected `owner/repo@sha`, but got `%s`.", arg)
+	}
+
+	b, err := s.client.FindBuild(ctx, arg)
+	if err == sql.ErrNoRows {
+		return ephemeral("There's no build of `%s`.", arg)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return ephemeral("Build `%s` of `%s@%s` is *%s*. %s", b.ID, b.Repository, shortSha(b.Sha), b.State, s.logsLink(b))
+}
+
+// cancel cancels a build.
+func (s *Server) cancel(ctx context.Context, cmd slashCommand, id string) *response {
+	b, err := s.client.CancelBuild(ctx, id)
+	if err == sql.ErrNoRows {
+		return ephemeral("There's no build `%s`.", id)
+	}
+	if err == conveyor.ErrBuildFinished {
+		return ephemeral("Build `%s` has already finished.", id)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return inChannel("<@%s> canceled build `%s` of `%s@%s`.", cmd.UserID, b.ID, b.Repository, shortSha(b.Sha))
+}
+
+// logs returns a link to the logs of a build.
+func (s *Server) logs(ctx context.Context, id string) *response {
+	b, err := s.client.FindBuild(ctx, id)
+	if err == sql.ErrNoRows {
+		return ephemeral("There's no build `%s`.", id)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	return ephemeral("Build `%s` of `%s@%s`: %s", b.ID, b.Repository, shortSha(b.Sha), s.logsLink(b))
+}
+
+// setup sets up the webhook for a repository. Since that waits for a ping to
+// be delivered, which takes longer than Slack waits for a response, the result
+// is posted to the response_url.
+func (s *Server) setup(cmd slashCommand, repository string) *response {
+	if strings.Count(repository, "/") != 1 {
+		return ephemeral("Expected `owner/repo`, but got `%s`.", repository)
+	}
+
+	go func() {
+		var resp *response
+		w, err := s.client.Setup(context.Background(), conveyor.SetupRequest{
+			Repository: repository,
+		})
+		if err != nil {
+			resp = errorResponse(err)
+		} else {
+			resp = inChannel("<@%s> set up the webhook for `%s`, which delivers %s events.", cmd.UserID, w.Repository, strings.Join(w.Events, " and "))
+		}
+
+		if err := s.respond(cmd.ResponseURL, resp); err != nil {
+			log.Printf("slack: error responding to setup of %s: %v", repository, err)
+		}
+	}()
+
+	return ephemeral("Setting up the webhook for `%s`...", repository)
+}
+
+// logsLink returns a Slack link to the logs of a build.
+func (s *Server) logsLink(b *conveyor.Build) string {
+	u := s.LogsURL(b)
+	if u == "" {
+		return ""
+	}
+	return fmt.Sprintf("<%s|View the logs>", u)
+}
+
+// errorResponse returns the response for an error from Conveyor.
+func errorResponse(err error) *response {
+	if _, ok := err.(*conveyor.AccessDeniedError); !ok {
+		log.Printf("slack: %v", err)
+	}
+	return ephemeral("Error: %v", err)
+}
+
+// postResponse posts a delayed response to a response_url.
+func postResponse(responseURL string, r *response) error {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
+
+// splitRepoRef splits `owner/repo@ref` into the repository and the ref. The
+// repository is empty if it isn't in the form `owner/repo`.
+func splitRepoRef(s string) (repository, ref string) {
+	parts := strings.SplitN(s, "@", 2)
+	if strings.Count(parts[0], "/") == 1 {
+		repository = parts[0]
+	}
+	if len(parts) == 2 {
+		ref = parts[1]
+	}
+	return
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,261 @@
+package slack
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/remind101/conveyor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const fakeUUID = "01234567-89ab-cdef-0123-456789abcdef"
+
+// recordedCommand is a slash command payload recorded from Slack, with the
+// text of the command left out.
+const recordedCommand = "token=gIkuvaNzQIHg97ATvDxqgjtO&team_id=T0001&team_domain=example&enterprise_id=E0001&enterprise_name=Globular%%20Construct%%20Inc&channel_id=C2147483705&channel_name=test&user_id=U2147483697&user_name=Steve&command=%%2Fconveyor&text=%s&response_url=https%%3A%%2F%%2Fhooks.slack.com%%2Fcommands%%2F1234%%2F5678&trigger_id=13345224609.738474920.8088930838d88f008e0&api_app_id=A123456"
+
+func TestServer_Build(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+	s.Users = map[string]Permission{"U2147483697": PermissionWrite}
+
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+	}).Return(&conveyor.Build{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Branch:     "master",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	}, nil)
+
+	resp := runCommand(s, "build remind101/acme-inc@master")
+	assert.Equal(t, &response{ResponseType: "in_channel", Text: "<@U2147483697> started build `01234567-89ab-cdef-0123-456789abcdef` of `remind101/acme-inc@master` (`139759b`). <https://conveyor.example.com/logs/01234567-89ab-cdef-0123-456789abcdef?signature=x|View the logs>"}, decodeResponse(t, resp))
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Build_Forbidden(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+	s.Users = map[string]Permission{"U2147483697": PermissionRead, "*": PermissionWrite}
+
+	resp := runCommand(s, "build remind101/acme-inc@master")
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "You need write permission to run `/conveyor build`, but you have read permission."}, decodeResponse(t, resp))
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Build_AccessDenied(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+	s.Users = map[string]Permission{"*": PermissionWrite}
+
+	c.On("Build", conveyor.BuildRequest{
+		Repository: "ejholmes/acme-inc",
+		Branch:     "master",
+	}).Return((*conveyor.Build)(nil), &conveyor.AccessDeniedError{
+		Repository: "ejholmes/acme-inc",
+		Reason:     "repository is not in the allowed organizations or repositories",
+	})
+
+	resp := runCommand(s, "build ejholmes/acme-inc@master")
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "Error: access denied to ejholmes/acme-inc: repository is not in the allowed organizations or repositories"}, decodeResponse(t, resp))
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Status(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+
+	c.On("FindBuild", "remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164").Return(&conveyor.Build{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		State:      conveyor.StateSucceeded,
+	}, nil)
+	c.On("FindBuild", "remind101/acme-inc@abcd").Return((*conveyor.Build)(nil), sql.ErrNoRows)
+
+	resp := runCommand(s, "status remind101/acme-inc@139759bd61e98faeec619c45b1060b4288952164")
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "Build `01234567-89ab-cdef-0123-456789abcdef` of `remind101/acme-inc@139759b` is *succeeded*. <https://conveyor.example.com/logs/01234567-89ab-cdef-0123-456789abcdef?signature=x|View the logs>"}, decodeResponse(t, resp))
+
+	resp = runCommand(s, "status remind101/acme-inc@abcd")
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "There's no build of `remind101/acme-inc@abcd`."}, decodeResponse(t, resp))
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Cancel(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+	s.Users = map[string]Permission{"U2147483697": PermissionWrite}
+
+	c.On("CancelBuild", fakeUUID).Return(&conveyor.Build{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+		State:      conveyor.StateCanceled,
+	}, nil).Once()
+	c.On("CancelBuild", fakeUUID).Return((*conveyor.Build)(nil), conveyor.ErrBuildFinished).Once()
+
+	resp := runCommand(s, "cancel "+fakeUUID)
+	assert.Equal(t, &response{ResponseType: "in_channel", Text: "<@U2147483697> canceled build `01234567-89ab-cdef-0123-456789abcdef` of `remind101/acme-inc@139759b`."}, decodeResponse(t, resp))
+
+	resp = runCommand(s, "cancel "+fakeUUID)
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "Build `01234567-89ab-cdef-0123-456789abcdef` has already finished."}, decodeResponse(t, resp))
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Logs(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+
+	c.On("FindBuild", fakeUUID).Return(&conveyor.Build{
+		ID:         fakeUUID,
+		Repository: "remind101/acme-inc",
+		Sha:        "139759bd61e98faeec619c45b1060b4288952164",
+	}, nil)
+
+	resp := runCommand(s, "logs "+fakeUUID)
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "Build `01234567-89ab-cdef-0123-456789abcdef` of `remind101/acme-inc@139759b`: <https://conveyor.example.com/logs/01234567-89ab-cdef-0123-456789abcdef?signature=x|View the logs>"}, decodeResponse(t, resp))
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Setup(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+	s.Users = map[string]Permission{"U2147483697": PermissionAdmin}
+
+	responses := make(chan *response, 1)
+	s.respond = func(responseURL string, resp *response) error {
+		assert.Equal(t, "https://hooks.slack.com/commands/1234/5678", responseURL)
+		responses <- resp
+		return nil
+	}
+
+	c.On("Setup", conveyor.SetupRequest{
+		Repository: "remind101/acme-inc",
+	}).Return(&conveyor.Webhook{
+		ID:         12345678,
+		Repository: "remind101/acme-inc",
+		Events:     []string{"push"},
+		Created:    true,
+	}, nil)
+
+	resp := runCommand(s, "setup remind101/acme-inc")
+	assert.Equal(t, &response{ResponseType: "ephemeral", Text: "Setting up the webhook for `remind101/acme-inc`..."}, decodeResponse(t, resp))
+
+	assert.Equal(t, &response{
+		ResponseType: "in_channel",
+		Text:         "<@U2147483697> set up the webhook for `remind101/acme-inc`, which delivers push events.",
+	}, <-responses)
+
+	c.AssertExpectations(t)
+}
+
+func TestServer_Usage(t *testing.T) {
+	c := new(mockConveyor)
+	s := newTestServer(c)
+
+	tests := []struct {
+		text string
+		out  string
+	}{
+		{"", "Usage: `/conveyor build owner/repo@branch`, `/conveyor status owner/repo@sha`, `/conveyor cancel <build-id>`, `/conveyor logs <build-id>` or `/conveyor setup owner/repo`."},
+		{"deploy remind101/acme-inc", "Unknown command `deploy`. Usage: `/conveyor build owner/repo@branch`, `/conveyor status owner/repo@sha`, `/conveyor cancel <build-id>`, `/conveyor logs <build-id>` or `/conveyor setup owner/repo`."},
+		{"status", "`status` takes one argument. Usage: `/conveyor build owner/repo@branch`, `/conveyor status owner/repo@sha`, `/conveyor cancel <build-id>`, `/conveyor logs <build-id>` or `/conveyor setup owner/repo`."},
+		{"status remind101/acme-inc", "Expected `owner/repo@sha`, but got `remind101/acme-inc`."},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, ephemeral("%s", tt.out), s.run(context.Background(), slashCommand{
+			Command: "/conveyor",
+			Name:    strings.SplitN(tt.text+" ", " ", 2)[0],
+			Args:    strings.Fields(strings.SplitN(tt.text+" ", " ", 2)[1]),
+		}), tt.text)
+	}
+}
+
+func TestParseUsers(t *testing.T) {
+	users, err := ParseUsers([]string{"U2147483697=admin", "W0123ABCD=write", "*=none"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Permission{
+		"U2147483697": PermissionAdmin,
+		"W0123ABCD":   PermissionWrite,
+		"*":           PermissionNone,
+	}, users)
+
+	_, err = ParseUsers([]string{"U2147483697=owner"})
+	assert.EqualError(t, err, `unknown slack permission "owner" for U2147483697`)
+
+	// User names can be changed, so they can't be mapped.
+	_, err = ParseUsers([]string{"Steve=write"})
+	assert.EqualError(t, err, `invalid slack user "Steve": only user IDs (e.g. U024BE7LH) can be mapped`)
+}
+
+// newTestServer returns a Server with a stubbed link to the logs of builds.
+func newTestServer(c client) *Server {
+	s := newServer(c)
+	s.LogsURL = func(b *conveyor.Build) string {
+		return fmt.Sprintf("https://conveyor.example.com/logs/%s?signature=x", b.ID)
+	}
+	return s
+}
+
+// runCommand runs a slash command with the given text, using a recorded
+// payload.
+func runCommand(s *Server, text string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/slack", strings.NewReader(fmt.Sprintf(recordedCommand, url.QueryEscape(text))))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(resp, req)
+	return resp
+}
+
+// decodeResponse decodes the response to a slash command.
+func decodeResponse(t testing.TB, resp *httptest.ResponseRecorder) *response {
+	assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+// mockConveyor is a mock implementation of the client interface.
+type mockConveyor struct {
+	mock.Mock
+}
+
+func (m *mockConveyor) Build(ctx context.Context, req conveyor.BuildRequest) (*conveyor.Build, error) {
+	args := m.Called(req)
+	return args.Get(0).(*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) FindBuild(ctx context.Context, buildIdentity string) (*conveyor.Build, error) {
+	args := m.Called(buildIdentity)
+	return args.Get(0).(*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) CancelBuild(ctx context.Context, buildID string) (*conveyor.Build, error) {
+	args := m.Called(buildID)
+	return args.Get(0).(*conveyor.Build), args.Error(1)
+}
+
+func (m *mockConveyor) Setup(ctx context.Context, req conveyor.SetupRequest) (*conveyor.Webhook, error) {
+	args := m.Called(req)
+	return args.Get(0).(*conveyor.Webhook), args.Error(1)
+}
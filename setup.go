@@ -0,0 +1,262 @@
+package conveyor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/context"
+)
+
+// DefaultPingTimeout is how long Setup waits for the ping to be delivered,
+// when the WebhookConfig doesn't say.
+const DefaultPingTimeout = 30 * time.Second
+
+// pingInterval is how often Setup checks whether the ping was delivered.
+var pingInterval = time.Second
+
+// WebhookConfig configures the webhooks that Setup creates.
+type WebhookConfig struct {
+	// The URL that GitHub delivers events to, which is the canonical URL
+	// of this instance.
+	URL string
+
+	// The shared secret that GitHub signs deliveries with.
+	Secret string
+
+	// How long to wait for the ping to be delivered. The zero value is
+	// DefaultPingTimeout.
+	PingTimeout time.Duration
+}
+
+// SetupRequest is a request to set up the webhook for a repository.
+type SetupRequest struct {
+	// The repository to set up, e.g. `remind101/acme-inc`.
+	Repository string
+
+	// When true, the webhook is also subscribed to the `pull_request`
+	// event.
+	PullRequests bool
+}
+
+// Webhook is a GitHub webhook that delivers the events of a repository to
+// Conveyor.
+type Webhook struct {
+	// The ID of the webhook in GitHub.
+	ID int64
+	// The repository that the webhook is for.
+	Repository string
+	// The URL that events are delivered to.
+	URL string
+	// The events that the webhook is subscribed to.
+	Events []string
+	// True if the webhook was created, false if an existing webhook was
+	// updated.
+	Created bool
+	// The ping that verified the webhook.
+	Ping *Delivery
+}
+
+// SetupError is returned when the webhook for a repository can't be set up, or
+// its ping wasn't delivered.
+type SetupError struct {
+	Repository string
+	Reason     string
+}
+
+// Error implements the error interface.
+func (e *SetupError) Error() string {
+	return fmt.Sprintf("setup of %s failed: %s", e.Repository, e.Reason)
+}
+
+// Setup creates the webhook for a repository, or updates it if the repository
+// already has a webhook for this instance, so that it points at the configured
+// URL and is signed with the configured secret. It then asks GitHub to ping
+// the webhook, waits until the ping is delivered, and registers the
+// repository.
+//
+// Since the ping is only recorded once its signature is verified, this
+// instance's server must be running, and reachable from GitHub.
+func (c *Conveyor) Setup(ctx context.Context, req SetupRequest) (*Webhook, error) {
+	if c.Webhook.URL == "" {
+		return nil, &SetupError{
+			Repository: req.Repository,
+			Reason:     "the webhook URL isn't configured",
+		}
+	}
+
+	// Deliveries to a webhook without a secret aren't signed, so they'd
+	// all be rejected.
+	if c.Webhook.Secret == "" {
+		return nil, &SetupError{
+			Repository: req.Repository,
+			Reason:     "the webhook secret isn't configured",
+		}
+	}
+
+	if err := c.Access.checkRepository(req.Repository); err != nil {
+		return nil, err
+	}
+
+	g, _, err := c.installation(ctx, req.Repository, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, repo := splitRepo(req.Repository)
+	hooks, err := g.Hooks(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Webhook{
+		Repository: req.Repository,
+		URL:        c.Webhook.URL,
+		Events:     []string{"push"},
+	}
+	if req.PullRequests {
+		w.Events = append(w.Events, "pull_request")
+	}
+
+	hook := &github.Hook{
+		Events: w.Events,
+		Active: github.Bool(true),
+		Config: map[string]interface{}{
+			"url":          w.URL,
+			"content_type": "json",
+			"secret":       c.Webhook.Secret,
+			"insecure_ssl": "0",
+		},
+	}
+
+	if existing := findHook(hooks, w.URL); existing != nil {
+		// Keep the events that the webhook was already subscribed
+		// to, e.g. `issue_comment` for comment commands.
+		w.Events = mergeEvents(existing.Events, w.Events)
+		hook.Events = w.Events
+		hook, err = g.EditHook(ctx, owner, repo, existing.GetID(), hook)
+	} else {
+		hook.Name = github.String("web")
+		hook, err = g.CreateHook(ctx, owner, repo, hook)
+		w.Created = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.ID = hook.GetID()
+
+	// Only deliveries recorded after this one can be the ping.
+	var seq int64
+	if err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		seq, err = deliveriesLastSeq(tx)
+		return
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := g.PingHook(ctx, owner, repo, w.ID); err != nil {
+		return nil, err
+	}
+
+	w.Ping, err = c.waitForPing(ctx, w, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.registeredRepository(ctx, req.Repository)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		if err := c.CreateRepository(ctx, NewRepository(req.Repository)); err != nil && err != ErrDuplicateRepository {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// waitForPing waits for the ping to the webhook to be recorded as a delivery,
+// after the delivery with the given seq.
+func (c *Conveyor) waitForPing(ctx context.Context, w *Webhook, seq int64) (*Delivery, error) {
+	timeout := c.Webhook.PingTimeout
+	if timeout == 0 {
+		timeout = DefaultPingTimeout
+	}
+	deadline := time.After(timeout)
+
+	for {
+		var pings []*Delivery
+		if err := c.inTx(func(tx *sqlx.Tx) (err error) {
+			pings, err = deliveriesFindPings(tx, seq)
+			return
+		}); err != nil {
+			return nil, err
+		}
+
+		for _, d := range pings {
+			if pingHookID(d) != w.ID {
+				continue
+			}
+			if d.Status >= 300 {
+				return d, &SetupError{
+					Repository: w.Repository,
+					Reason:     fmt.Sprintf("the ping was answered with a %d: %s", d.Status, strings.TrimSpace(d.Response)),
+				}
+			}
+			return d, nil
+		}
+
+		select {
+		case <-deadline:
+			return nil, &SetupError{
+				Repository: w.Repository,
+				Reason:     fmt.Sprintf("the ping wasn't delivered within %v; check that %s is reachable from GitHub, and that the server's secret matches", timeout, w.URL),
+			}
+		case <-time.After(pingInterval):
+		}
+	}
+}
+
+// findHook returns the webhook that delivers to url, or nil if there isn't
+// one.
+func findHook(hooks []*github.Hook, url string) *github.Hook {
+	for _, h := range hooks {
+		if u, ok := h.Config["url"].(string); ok && strings.TrimSuffix(u, "/") == strings.TrimSuffix(url, "/") {
+			return h
+		}
+	}
+	return nil
+}
+
+// mergeEvents returns the events in existing, followed by the events in events
+// that aren't already in existing.
+func mergeEvents(existing, events []string) []string {
+	merged := append([]string(nil), existing...)
+	for _, e := range events {
+		var found bool
+		for _, m := range merged {
+			if m == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, e)
+		}
+	}
+	return merged
+}
+
+// pingHookID returns the ID of the webhook that a `ping` delivery was sent
+// for.
+func pingHookID(d *Delivery) int64 {
+	var event struct {
+		HookID int64 `json:"hook_id"`
+	}
+	json.Unmarshal([]byte(d.Payload), &event)
+	return event.HookID
+}
@@ -0,0 +1,368 @@
+package conveyor
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/jmoiron/sqlx"
+	"github.com/remind101/conveyor/builder"
+	"golang.org/x/net/context"
+)
+
+// The kinds of status update.
+const (
+	// A commit status.
+	StatusUpdateStatus = "status"
+	// A create or update of the check run for a build.
+	StatusUpdateCheckRun = "check_run"
+)
+
+// The states of a status update.
+const (
+	StatusUpdatePending   = "pending"
+	StatusUpdateSucceeded = "succeeded"
+	StatusUpdateFailed    = "failed"
+)
+
+// maxStatusUpdateAttempts is the number of times that a status update is tried
+// before it's marked as failed.
+const maxStatusUpdateAttempts = 15
+
+// maxStatusUpdateBackoff is the longest that a failed status update waits
+// before it's retried.
+const maxStatusUpdateBackoff = 10 * time.Minute
+
+// statusUpdateLease is how long a worker has to apply a status update that it
+// claimed. It's longer than GitHub requests can wait for rate limits, and if
+// the worker dies, another worker tries the update once the lease expires.
+const statusUpdateLease = 10 * time.Minute
+
+// StatusUpdate is a queued update to a GitHub commit status or check run.
+// Status updates are applied by UpdateStatuses, in the order that they were
+// queued for each commit.
+type StatusUpdate struct {
+	// A unique identifier for this status update.
+	ID string `db:"id"`
+	// Autogenerated sequence id, which orders the updates.
+	Seq int64 `db:"seq"`
+	// The build that this status update relates to, if any.
+	BuildID *string `db:"build_id"`
+	// The repository and sha of the commit to update.
+	Repository string `db:"repository"`
+	Sha        string `db:"sha"`
+	// The GitHub App installation that has access to the repository, or
+	// 0 if it should be looked up.
+	InstallationID int64 `db:"installation_id"`
+	// The kind of update, StatusUpdateStatus or StatusUpdateCheckRun.
+	Kind string `db:"kind"`
+	// The JSON encoded github.RepoStatus or builder.CheckRun.
+	Payload string `db:"payload"`
+	// The state of the update: pending, succeeded or failed.
+	State string `db:"state"`
+	// The number of times that applying the update has been tried.
+	Attempts int `db:"attempts"`
+	// The error from the last attempt, if it failed.
+	LastError string `db:"last_error"`
+	// The time after which the update will be tried next.
+	NextAttemptAt time.Time `db:"next_attempt_at"`
+	// When a worker is applying the update, the time until which it's
+	// claimed by that worker.
+	LeasedUntil *time.Time `db:"leased_until"`
+	// The time that the update was queued.
+	CreatedAt time.Time `db:"created_at"`
+	// The time that the update succeeded, or was given up on.
+	CompletedAt *time.Time `db:"completed_at"`
+}
+
+// QueueStatus queues a commit status for a build. It implements the
+// builder.StatusQueue interface.
+func (c *Conveyor) QueueStatus(ctx context.Context, opts builder.BuildOptions, status *github.RepoStatus) error {
+	return c.queueStatusUpdate(opts, StatusUpdateStatus, status)
+}
+
+// QueueCheckRun queues an update to the check run for a build. It implements
+// the builder.StatusQueue interface.
+func (c *Conveyor) QueueCheckRun(ctx context.Context, opts builder.BuildOptions, run *builder.CheckRun) error {
+	return c.queueStatusUpdate(opts, StatusUpdateCheckRun, run)
+}
+
+func (c *Conveyor) queueStatusUpdate(opts builder.BuildOptions, kind string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	u := &StatusUpdate{
+		Repository:     opts.Repository,
+		Sha:            opts.Sha,
+		InstallationID: opts.InstallationID,
+		Kind:           kind,
+		Payload:        string(raw),
+	}
+	if opts.ID != "" {
+		u.BuildID = &opts.ID
+	}
+
+	return c.inTx(func(tx *sqlx.Tx) error {
+		return statusUpdatesCreate(tx, u)
+	})
+}
+
+// PendingStatusUpdates returns the status updates that haven't been applied
+// yet, oldest first.
+func (c *Conveyor) PendingStatusUpdates(ctx context.Context) ([]*StatusUpdate, error) {
+	var updates []*StatusUpdate
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		updates, err = statusUpdatesFindPending(tx)
+		return
+	})
+	return updates, err
+}
+
+// UpdateStatuses applies the queued status updates that are due, until there
+// are none left. Updates for a commit are applied in the order that they were
+// queued, and updates that fail are retried with exponential backoff. When the
+// GitHub rate limit is exceeded, all pending updates are postponed until it
+// resets.
+func (c *Conveyor) UpdateStatuses(ctx context.Context) error {
+	for {
+		ok, err := c.updateNextStatus(ctx)
+		if err != nil || !ok {
+			return err
+		}
+	}
+}
+
+// updateNextStatus applies the next status update that's due. It returns false
+// if there wasn't one, or updates were postponed because of the rate limit.
+//
+// The update is claimed in its own transaction, so that no transaction is held
+// open while GitHub is called, and the outcome is recorded in another. The
+// outcome isn't recorded if the lease expired and another worker claimed the
+// update in the meantime.
+func (c *Conveyor) updateNextStatus(ctx context.Context) (bool, error) {
+	var u *StatusUpdate
+	err := c.inTx(func(tx *sqlx.Tx) (err error) {
+		u, err = statusUpdatesClaim(tx, now().UTC())
+		return
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	applyErr := c.applyStatusUpdate(ctx, u)
+
+	ok := true
+	err = c.inTx(func(tx *sqlx.Tx) error {
+		t := now().UTC()
+		switch e := applyErr.(type) {
+		case nil:
+			return statusUpdatesComplete(tx, u, StatusUpdateSucceeded, t)
+		case *github.RateLimitError:
+			log.Printf("status updates: rate limit exceeded, postponing until %v", e.Rate.Reset.Time)
+			ok = false
+			return statusUpdatesPostpone(tx, u, e.Rate.Reset.Time.UTC())
+		case *github.AbuseRateLimitError:
+			retryAfter := time.Minute
+			if e.RetryAfter != nil {
+				retryAfter = *e.RetryAfter
+			}
+			log.Printf("status updates: abuse rate limit triggered, postponing for %v", retryAfter)
+			ok = false
+			return statusUpdatesPostpone(tx, u, t.Add(retryAfter))
+		default:
+			log.Printf("status updates: error applying %s update %s for %s@%s (attempt %d): %v", u.Kind, u.ID, u.Repository, u.Sha, u.Attempts+1, e)
+			return statusUpdatesRetry(tx, u, e, t)
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// applyStatusUpdate creates the commit status, or creates or updates the check
+// run, for a status update.
+func (c *Conveyor) applyStatusUpdate(ctx context.Context, u *StatusUpdate) error {
+	g, _, err := c.installation(ctx, u.Repository, u.InstallationID)
+	if err != nil {
+		return err
+	}
+
+	owner, repo := splitRepo(u.Repository)
+
+	switch u.Kind {
+	case StatusUpdateStatus:
+		var status github.RepoStatus
+		if err := json.Unmarshal([]byte(u.Payload), &status); err != nil {
+			return err
+		}
+		if status.Description != nil {
+			status.Description = github.String(truncateDescription(*status.Description))
+		}
+		return g.CreateStatus(ctx, owner, repo, u.Sha, &status)
+	case StatusUpdateCheckRun:
+		var run builder.CheckRun
+		if err := json.Unmarshal([]byte(u.Payload), &run); err != nil {
+			return err
+		}
+
+		var b *Build
+		if u.BuildID != nil {
+			err = c.inTx(func(tx *sqlx.Tx) (err error) {
+				b, err = buildsFindByID(tx, *u.BuildID)
+				return
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		// The first update for a build creates its check run, and
+		// later updates change it.
+		if b != nil && b.CheckRunID != nil {
+			run.HeadSHA = ""
+			return g.UpdateCheckRun(ctx, owner, repo, *b.CheckRunID, &run)
+		}
+
+		created, err := g.CreateCheckRun(ctx, owner, repo, &run)
+		if err != nil {
+			return err
+		}
+		if b != nil {
+			return c.inTx(func(tx *sqlx.Tx) error {
+				return buildsUpdateCheckRunID(tx, b.ID, created.ID)
+			})
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown status update kind: %s", u.Kind)
+	}
+}
+
+// statusUpdateBackoff returns how long to wait before retrying a status update
+// that has failed the given number of times.
+func statusUpdateBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return maxStatusUpdateBackoff
+	}
+	d := time.Second << uint(attempts-1)
+	if d > maxStatusUpdateBackoff {
+		return maxStatusUpdateBackoff
+	}
+	return d
+}
+
+// isPermanentGitHubError returns true if GitHub rejected a request as invalid,
+// so that retrying it won't help.
+func isPermanentGitHubError(err error) bool {
+	if e, ok := err.(*github.ErrorResponse); ok && e.Response != nil {
+		return e.Response.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// statusUpdatesCreate inserts a new status update into the database.
+func statusUpdatesCreate(tx *sqlx.Tx, u *StatusUpdate) error {
+	const sql = `INSERT INTO status_updates (build_id, repository, sha, installation_id, kind, payload) VALUES (:build_id, :repository, :sha, :installation_id, :kind, :payload) RETURNING id`
+	return insert(tx, sql, u, &u.ID)
+}
+
+// statusUpdatesFindPending returns the pending status updates, oldest first.
+func statusUpdatesFindPending(tx *sqlx.Tx) ([]*StatusUpdate, error) {
+	const sql = `SELECT * FROM status_updates WHERE state = 'pending' ORDER BY seq ASC`
+	var updates []*StatusUpdate
+	err := tx.Select(&updates, sql)
+	return updates, err
+}
+
+// statusUpdatesClaim leases the oldest pending status update that's due, isn't
+// leased by another worker, and doesn't have an earlier pending update for the
+// same commit. Updates that are being claimed by another worker are skipped.
+func statusUpdatesClaim(tx *sqlx.Tx, t time.Time) (*StatusUpdate, error) {
+	const sql = `UPDATE status_updates SET leased_until = ? WHERE id = (
+	SELECT id FROM status_updates u
+	WHERE state = 'pending'
+	AND next_attempt_at <= ?
+	AND (leased_until IS NULL OR leased_until <= ?)
+	AND NOT EXISTS (
+		SELECT 1 FROM status_updates p
+		WHERE p.repository = u.repository
+		AND p.sha = u.sha
+		AND p.state = 'pending'
+		AND p.seq < u.seq
+	)
+	ORDER BY seq ASC
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING *`
+	var u StatusUpdate
+	err := tx.Get(&u, tx.Rebind(sql), t.Add(statusUpdateLease), t, t)
+	return &u, err
+}
+
+// statusUpdatesComplete marks a status update as succeeded or failed.
+func statusUpdatesComplete(tx *sqlx.Tx, u *StatusUpdate, state string, t time.Time) error {
+	const sql = `UPDATE status_updates SET state = ?, completed_at = ?, leased_until = NULL WHERE id = ? AND leased_until = ?`
+	_, err := tx.Exec(tx.Rebind(sql), state, t, u.ID, u.LeasedUntil)
+	return err
+}
+
+// statusUpdatesRetry records a failed attempt to apply a status update, and
+// schedules the next attempt. Once the update has been tried
+// maxStatusUpdateAttempts times, or GitHub rejected it, it's marked as failed.
+func statusUpdatesRetry(tx *sqlx.Tx, u *StatusUpdate, cause error, t time.Time) error {
+	attempts := u.Attempts + 1
+	if attempts >= maxStatusUpdateAttempts || isPermanentGitHubError(cause) {
+		const sql = `UPDATE status_updates SET state = 'failed', attempts = ?, last_error = ?, completed_at = ?, leased_until = NULL WHERE id = ? AND leased_until = ?`
+		_, err := tx.Exec(tx.Rebind(sql), attempts, cause.Error(), t, u.ID, u.LeasedUntil)
+		return err
+	}
+
+	const sql = `UPDATE status_updates SET attempts = ?, last_error = ?, next_attempt_at = ?, leased_until = NULL WHERE id = ? AND leased_until = ?`
+	_, err := tx.Exec(tx.Rebind(sql), attempts, cause.Error(), t.Add(statusUpdateBackoff(attempts)), u.ID, u.LeasedUntil)
+	return err
+}
+
+// statusUpdatesPostpone releases the lease on a status update, and delays all
+// pending status updates until at least t.
+func statusUpdatesPostpone(tx *sqlx.Tx, u *StatusUpdate, t time.Time) error {
+	if _, err := tx.Exec(tx.Rebind(`UPDATE status_updates SET leased_until = NULL WHERE id = ? AND leased_until = ?`), u.ID, u.LeasedUntil); err != nil {
+		return err
+	}
+
+	const sql = `UPDATE status_updates SET next_attempt_at = ? WHERE state = 'pending' AND next_attempt_at < ?`
+	_, err := tx.Exec(tx.Rebind(sql), t, t)
+	return err
+}
+
+// statusUpdatesDeleteExpired deletes the status updates that succeeded or
+// failed before the given time, and returns how many were deleted.
+func statusUpdatesDeleteExpired(tx *sqlx.Tx, before time.Time) (int, error) {
+	const sql = `DELETE FROM status_updates WHERE state IN ('succeeded', 'failed') AND completed_at < ?`
+	res, err := tx.Exec(tx.Rebind(sql), before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// statusUpdatesCountExpired returns how many status updates succeeded or
+// failed before the given time.
+func statusUpdatesCountExpired(tx *sqlx.Tx, before time.Time) (int, error) {
+	const sql = `SELECT count(*) FROM status_updates WHERE state IN ('succeeded', 'failed') AND completed_at < ?`
+	var n int
+	err := tx.Get(&n, tx.Rebind(sql), before)
+	return n, err
+}
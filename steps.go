@@ -0,0 +1,43 @@
+package conveyor
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Step represents an instruction from a Dockerfile that was run as part of a
+// build.
+type Step struct {
+	// Unique identifier for this step.
+	ID string `db:"id"`
+	// The build that this step was run in.
+	BuildID string `db:"build_id"`
+	// The position of this step in the Dockerfile, starting at 1.
+	Number int `db:"number"`
+	// The total number of steps in the Dockerfile, or 0 if unknown.
+	Total int `db:"total"`
+	// The Dockerfile instruction, e.g. `RUN make`.
+	Instruction string `db:"instruction"`
+	// True if the step was satisfied by the layer cache.
+	Cached bool `db:"cached"`
+	// The time that the step started.
+	StartedAt time.Time `db:"started_at"`
+	// How long the step took to run.
+	Duration time.Duration `db:"duration"`
+}
+
+// stepsCreate inserts a new step into the database.
+func stepsCreate(tx *sqlx.Tx, s *Step) error {
+	const createStepSql = `INSERT INTO build_steps (build_id, number, total, instruction, cached, started_at, duration) VALUES (:build_id, :number, :total, :instruction, :cached, :started_at, :duration) RETURNING id`
+	return insert(tx, createStepSql, s, &s.ID)
+}
+
+// stepsFindByBuildID returns the steps for a build, in the order that they
+// were run.
+func stepsFindByBuildID(tx *sqlx.Tx, buildID string) ([]*Step, error) {
+	const findStepsSql = `SELECT * FROM build_steps WHERE build_id = ? ORDER BY number ASC`
+	var steps []*Step
+	err := tx.Select(&steps, tx.Rebind(findStepsSql), buildID)
+	return steps, err
+}
@@ -20,8 +20,8 @@ type Builder struct {
 	// A Reporter to use to report errors.
 	Reporter reporter.Reporter
 
-	// Timeout controls how long to wait before canceling a build. A timeout
-	// of 0 means no timeout.
+	// Timeout controls how long to wait before canceling a build, unless
+	// the build has its own timeout. A timeout of 0 means no timeout.
 	Timeout time.Duration
 }
 
@@ -46,9 +46,9 @@ func (b *Builder) Build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 	// Embed the reporter in the context.Context.
 	ctx = reporter.WithReporter(ctx, b.reporter())
 
-	if b.Timeout != 0 {
+	if timeout := b.timeout(opts); timeout != 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel() // Release resources.
 	}
 
@@ -65,6 +65,14 @@ func (b *Builder) Build(ctx context.Context, w io.Writer, opts builder.BuildOpti
 	return
 }
 
+// timeout returns how long to wait before canceling the build.
+func (b *Builder) timeout(opts builder.BuildOptions) time.Duration {
+	if opts.Timeout != 0 {
+		return opts.Timeout
+	}
+	return b.Timeout
+}
+
 func (b *Builder) reporter() reporter.Reporter {
 	if b.Reporter == nil {
 		return reporter.ReporterFunc(func(ctx context.Context, err error) error {
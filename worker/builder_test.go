@@ -2,7 +2,9 @@ package worker
 
 import (
 	"bytes"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/remind101/conveyor/builder"
 	"github.com/stretchr/testify/assert"
@@ -23,3 +25,30 @@ func TestBuilder_Build(t *testing.T) {
 	_, err := bb.Build(context.Background(), w, options)
 	assert.NoError(t, err)
 }
+
+func TestBuilder_Build_Timeout(t *testing.T) {
+	tests := []struct {
+		builderTimeout, buildTimeout time.Duration
+		timeout                      time.Duration
+	}{
+		{DefaultTimeout, 0, DefaultTimeout},
+		{DefaultTimeout, time.Hour, time.Hour},
+		{DefaultTimeout, time.Minute, time.Minute},
+	}
+
+	for _, tt := range tests {
+		var deadline time.Time
+		bb := &Builder{
+			builder: builder.BuilderFunc(func(ctx context.Context, w io.Writer, opts builder.BuildOptions) (string, error) {
+				deadline, _ = ctx.Deadline()
+				return "", nil
+			}),
+			Timeout: tt.builderTimeout,
+		}
+
+		start := time.Now()
+		_, err := bb.Build(context.Background(), new(bytes.Buffer), builder.BuildOptions{Timeout: tt.buildTimeout})
+		assert.NoError(t, err)
+		assert.WithinDuration(t, start.Add(tt.timeout), deadline, time.Second)
+	}
+}
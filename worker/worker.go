@@ -18,12 +18,18 @@ const (
 	DefaultTimeout = 20 * time.Minute
 )
 
+// cancelCheckInterval is how often a running build is checked to see if it was
+// canceled, e.g. because its pull request was closed.
+var cancelCheckInterval = 10 * time.Second
+
 // Conveyor mocks out the conveyor.Conveyor interface that we use.
 type Conveyor interface {
 	Writer(ctx context.Context, buildID string) (io.Writer, error)
 	BuildStarted(ctx context.Context, buildID string) error
-	BuildComplete(ctx context.Context, buildID, image string) error
+	BuildComplete(ctx context.Context, buildID, image string, pushed []builder.Image) error
 	BuildFailed(ctx context.Context, buildID string, err error) error
+	RecordSteps(ctx context.Context, buildID string, steps []builder.Step) error
+	IsCanceled(ctx context.Context, buildID string) (bool, error)
 }
 
 // Workers is a collection of workers.
@@ -146,14 +152,25 @@ func (w *Worker) build(ctx context.Context, options builder.BuildOptions) (err e
 	buildID := options.ID
 
 	err = w.BuildStarted(ctx, buildID)
+	if err == conveyor.ErrBuildCanceled {
+		log.Printf("build %s was canceled before it started", buildID)
+		return nil
+	}
 	if err != nil {
 		return
 	}
 
-	var image string
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go w.watchCanceled(ctx, buildID, cancel)
+
+	var (
+		image  string
+		pushed []builder.Image
+	)
 	defer func() {
 		if err == nil {
-			err = w.BuildComplete(ctx, buildID, image)
+			err = w.BuildComplete(ctx, buildID, image, pushed)
 		} else {
 			w.BuildFailed(ctx, buildID, err)
 		}
@@ -166,15 +183,58 @@ func (w *Worker) build(ctx context.Context, options builder.BuildOptions) (err e
 		return
 	}
 
+	// Observe the build output to record the timing of each Dockerfile
+	// step, regardless of whether the build succeeds, and the images that
+	// were pushed, along with their digests and tags. Builders that
+	// decorate the build share the same Output through ctx.
+	ctx, logger, output := builder.ObserveOutput(ctx, logger, options)
+	defer func() {
+		if err := w.RecordSteps(ctx, buildID, output.Steps()); err != nil {
+			log.Printf("error recording steps for build %s: %v", buildID, err)
+		}
+	}()
+
 	// Perform the build.
 	image, err = w.Build(ctx, logger, options)
 	if err != nil {
 		return
 	}
 
+	// Tags can be moved, so prefer referencing the image by its digest.
+	pushed = output.Images()
+	for _, i := range pushed {
+		if i.Name == "" && i.Digest != "" {
+			image = i.Ref()
+		}
+	}
+
 	return
 }
 
+// watchCanceled periodically checks whether the build was canceled, and calls
+// cancel if it was. It returns when ctx is done.
+func (w *Worker) watchCanceled(ctx context.Context, buildID string, cancel context.CancelFunc) {
+	t := time.NewTicker(cancelCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			canceled, err := w.IsCanceled(ctx, buildID)
+			if err != nil {
+				log.Printf("error checking if build %s was canceled: %v", buildID, err)
+				continue
+			}
+			if canceled {
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // Shutdown stops this worker for processing any build requests. If the Builder
 // supports the Cancel method, this function will block until all currently
 // processesing builds have been canceled.
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -30,11 +31,12 @@ func TestWorker(t *testing.T) {
 		close(done)
 	}()
 
-	b.On("Build", ioutil.Discard, builder.BuildOptions{
+	b.On("Build", mock.AnythingOfType("*builder.Output"), builder.BuildOptions{
 		ID: "1234",
 	}).Return("remind101/acme-inc:abcd", nil)
 	c.On("BuildStarted", "1234").Return(nil)
-	c.On("BuildComplete", "1234", "remind101/acme-inc:abcd").Return(nil)
+	c.On("BuildComplete", "1234", "remind101/acme-inc:abcd", []builder.Image{}).Return(nil)
+	c.On("RecordSteps", "1234", []builder.Step{}).Return(nil)
 
 	q <- conveyor.BuildContext{
 		Ctx: context.Background(),
@@ -47,6 +49,94 @@ func TestWorker(t *testing.T) {
 	<-done
 }
 
+func TestWorker_Digest(t *testing.T) {
+	c := new(mockConveyor)
+	b := new(mockBuilder)
+	w := &Worker{
+		Builder:  b,
+		Conveyor: c,
+	}
+
+	digest := "sha256:6b558cade79544da908c349ba0e5b63d6b558cade79544da908c349ba0e5b63d"
+
+	b.On("Build", mock.AnythingOfType("*builder.Output"), builder.BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+	}).Run(func(args mock.Arguments) {
+		w := args.Get(0).(io.Writer)
+		io.WriteString(w, "The push refers to a repository [docker.io/remind101/acme-inc]\n")
+		io.WriteString(w, "abcd: digest: "+digest+" size: 1234\n")
+		io.WriteString(w, "latest: digest: "+digest+" size: 1234\n")
+		io.WriteString(w, "The push refers to a repository [docker.io/remind101/acme-inc-migrations]\n")
+		io.WriteString(w, "abcd: digest: "+digest+" size: 1234\n")
+	}).Return("remind101/acme-inc:abcd", nil)
+	c.On("BuildStarted", "1234").Return(nil)
+	c.On("BuildComplete", "1234", "remind101/acme-inc@"+digest, []builder.Image{
+		{
+			Repository: "docker.io/remind101/acme-inc",
+			Digest:     digest,
+			Tags:       []string{"abcd", "latest"},
+		},
+		{
+			Name:       "migrations",
+			Repository: "docker.io/remind101/acme-inc-migrations",
+			Digest:     digest,
+			Tags:       []string{"abcd"},
+		},
+	}).Return(nil)
+	c.On("RecordSteps", "1234", []builder.Step{}).Return(nil)
+
+	err := w.build(context.Background(), builder.BuildOptions{
+		ID:         "1234",
+		Repository: "remind101/acme-inc",
+	})
+	assert.NoError(t, err)
+	c.AssertExpectations(t)
+}
+
+func TestWorker_Canceled(t *testing.T) {
+	c := new(mockConveyor)
+	b := new(mockBuilder)
+	w := &Worker{
+		Builder:  b,
+		Conveyor: c,
+	}
+
+	c.On("BuildStarted", "1234").Return(conveyor.ErrBuildCanceled)
+
+	err := w.build(context.Background(), builder.BuildOptions{
+		ID: "1234",
+	})
+	assert.NoError(t, err)
+	c.AssertExpectations(t)
+	b.AssertNotCalled(t, "Build", mock.Anything, mock.Anything)
+}
+
+func TestWorker_Canceled_Building(t *testing.T) {
+	defer func(d time.Duration) { cancelCheckInterval = d }(cancelCheckInterval)
+	cancelCheckInterval = time.Millisecond
+
+	c := new(mockConveyor)
+	w := &Worker{
+		Builder: builder.BuilderFunc(func(ctx context.Context, w io.Writer, options builder.BuildOptions) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}),
+		Conveyor: c,
+	}
+
+	c.On("BuildStarted", "1234").Return(nil)
+	c.On("IsCanceled", "1234").Return(true, nil)
+	c.On("BuildFailed", "1234", context.Canceled).Return(nil)
+	c.On("RecordSteps", "1234", []builder.Step{}).Return(nil)
+
+	err := w.build(context.Background(), builder.BuildOptions{
+		ID: "1234",
+	})
+	assert.Equal(t, context.Canceled, err)
+	c.AssertExpectations(t)
+}
+
 func TestWorker_Shutdown(t *testing.T) {
 	c := new(mockConveyor)
 	b := new(mockBuilder)
@@ -158,8 +248,8 @@ func (m *mockConveyor) BuildStarted(ctx context.Context, buildID string) error {
 	return args.Error(0)
 }
 
-func (m *mockConveyor) BuildComplete(ctx context.Context, buildID string, image string) error {
-	args := m.Called(buildID, image)
+func (m *mockConveyor) BuildComplete(ctx context.Context, buildID string, image string, pushed []builder.Image) error {
+	args := m.Called(buildID, image, pushed)
 	return args.Error(0)
 }
 
@@ -167,3 +257,13 @@ func (m *mockConveyor) BuildFailed(ctx context.Context, buildID string, err erro
 	args := m.Called(buildID, err)
 	return args.Error(0)
 }
+
+func (m *mockConveyor) RecordSteps(ctx context.Context, buildID string, steps []builder.Step) error {
+	args := m.Called(buildID, steps)
+	return args.Error(0)
+}
+
+func (m *mockConveyor) IsCanceled(ctx context.Context, buildID string) (bool, error) {
+	args := m.Called(buildID)
+	return args.Bool(0), args.Error(1)
+}